@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go_payment/internal/config"
+	"go_payment/internal/messaging"
+	"go_payment/internal/models"
+	"go_payment/internal/payment"
+	"go_payment/internal/service"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// container создает конфигурацию, подключения и сервисы один раз для всех
+// команд. Компоненты получают зависимости из него, а не создают свои.
+type container struct {
+	cfg      *config.Config
+	runtime  *config.RuntimeStore
+	db       *gorm.DB
+	rabbitmq *messaging.RabbitMQ
+
+	authService         *service.AuthService
+	webhookService      *service.WebhookService
+	notificationService *service.NotificationService
+	receiptService      *service.ReceiptService
+	asyncService        *service.AsyncService
+	paymentService      *service.PaymentService
+	customerService     *service.CustomerService
+}
+
+// newContainer подключается к базе данных и RabbitMQ и создает сервисы.
+// runtime содержит настройки, изменяемые без перезапуска.
+func newContainer(ctx context.Context, cfg *config.Config, runtime *config.RuntimeStore) (*container, error) {
+	db, err := openDatabase(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	// Схема создается командой migrate, сервис не запускается со схемой
+	// другой версии
+	if err := checkSchema(ctx, db); err != nil {
+		closeDatabase(db)
+		return nil, err
+	}
+
+	// Подключение к RabbitMQ
+	rabbitmq, err := messaging.NewRabbitMQ(cfg.RabbitMQ.URL)
+	if err != nil {
+		closeDatabase(db)
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+
+	app := &container{cfg: cfg, runtime: runtime, db: db, rabbitmq: rabbitmq}
+	if err := app.initServices(ctx); err != nil {
+		app.Close()
+		return nil, err
+	}
+	return app, nil
+}
+
+// initServices создает сервисы в порядке их зависимостей
+func (app *container) initServices(ctx context.Context) error {
+	app.authService = service.NewAuthService(app.db, app.cfg.JWT.Secret)
+	app.webhookService = service.NewWebhookService(app.db, app.rabbitmq)
+
+	// Инициализация сервиса уведомлений
+	smsSender, err := newSMSSender(app.cfg.SMS)
+	if err != nil {
+		return fmt.Errorf("failed to initialize SMS sender: %w", err)
+	}
+
+	emailSender, err := newEmailSender(app.cfg.SMTP)
+	if err != nil {
+		return fmt.Errorf("failed to initialize email sender: %w", err)
+	}
+	app.notificationService = service.NewNotificationService(app.db, app.rabbitmq, emailSender, app.webhookService, smsSender, newPushSender(app.cfg.Push))
+	app.notificationService.ConfigureUnsubscribe(app.cfg.Notifications.UnsubscribeURL, app.cfg.Notifications.UnsubscribeSecret)
+	location, err := time.LoadLocation(app.cfg.Notifications.TimeZone)
+	if err != nil {
+		return fmt.Errorf("invalid notifications timezone: %w", err)
+	}
+	app.notificationService.ConfigureLocation(location)
+	if err := app.notificationService.EnsureDefaultTemplates(ctx); err != nil {
+		return fmt.Errorf("failed to create default notification templates: %w", err)
+	}
+	if err := app.notificationService.LoadTemplates(); err != nil {
+		return fmt.Errorf("failed to load notification templates: %w", err)
+	}
+
+	// Платежные документы прикладываются к письмам по ссылке
+	receipts := app.cfg.Receipts
+	app.receiptService = service.NewReceiptService(app.db, service.ReceiptConfig{
+		Merchant: models.MerchantDetails{
+			Name:    receipts.Merchant.Name,
+			Address: receipts.Merchant.Address,
+			TaxID:   receipts.Merchant.TaxID,
+			Email:   receipts.Merchant.Email,
+			Phone:   receipts.Merchant.Phone,
+		},
+		TaxRate:          receipts.TaxRate,
+		InvoicePrefix:    receipts.InvoicePrefix,
+		CreditNotePrefix: receipts.CreditNotePrefix,
+	})
+	app.notificationService.RegisterAttachmentSource(service.ReceiptAttachmentSource, app.receiptService.ReceiptPDF)
+
+	app.asyncService = service.NewAsyncService(app.db, app.rabbitmq, app.webhookService, app.notificationService, app.receiptService)
+	app.asyncService.ConfigureRuntime(app.runtime)
+	app.paymentService = service.NewPaymentService(app.db, app.asyncService, app.receiptService)
+	app.paymentService.ConfigureRuntime(app.runtime)
+	if err := app.paymentService.InitializeProviders(providerConfig(app.cfg.Payment)); err != nil {
+		return err
+	}
+	app.customerService = service.NewCustomerService(app.db)
+
+	return nil
+}
+
+// Close закрывает подключения
+func (app *container) Close() {
+	app.rabbitmq.Close()
+	closeDatabase(app.db)
+}
+
+// openDatabase подключается к базе данных
+func openDatabase(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// closeDatabase закрывает пул соединений с базой данных
+func closeDatabase(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// checkSchema проверяет, что версия схемы совпадает с миграциями сборки
+func checkSchema(ctx context.Context, db *gorm.DB) error {
+	migrator, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	if err := migrator.Check(ctx); err != nil {
+		return fmt.Errorf("%w (run \"payment-service migrate up\" with this build)", err)
+	}
+	return nil
+}
+
+// providerConfig возвращает настройки включенных платежных провайдеров
+func providerConfig(cfg config.PaymentConfig) map[payment.ProviderType]map[string]string {
+	providers := make(map[payment.ProviderType]map[string]string)
+	if cfg.Stripe.Enabled {
+		providers[payment.ProviderStripe] = map[string]string{
+			"secretKey":   cfg.Stripe.SecretKey,
+			"webhookKey":  cfg.Stripe.WebhookSecret,
+			"endpointURL": cfg.Stripe.EndpointURL,
+			"testMode":    strconv.FormatBool(cfg.Stripe.TestMode),
+		}
+	}
+	if cfg.PayPal.Enabled {
+		providers[payment.ProviderPayPal] = map[string]string{
+			"clientID":    cfg.PayPal.ClientID,
+			"secretKey":   cfg.PayPal.SecretKey,
+			"webhookID":   cfg.PayPal.WebhookID,
+			"endpointURL": cfg.PayPal.EndpointURL,
+			"testMode":    strconv.FormatBool(cfg.PayPal.Mode != "production"),
+		}
+	}
+	return providers
+}
+
+// newEmailSender создает отправителя писем согласно настройке smtp.provider
+func newEmailSender(cfg config.SMTPConfig) (service.EmailSender, error) {
+	switch cfg.Provider {
+	case "smtp":
+		return service.NewSMTPEmailSender(service.SMTPConfig{
+			Host:        cfg.Host,
+			Port:        cfg.Port,
+			Username:    cfg.User,
+			Password:    cfg.Password,
+			From:        cfg.From,
+			ReplyTo:     cfg.ReplyTo,
+			PoolSize:    cfg.PoolSize,
+			IdleTimeout: cfg.IdleTimeout,
+			DialTimeout: cfg.DialTimeout,
+		}), nil
+	case "capture":
+		return service.NewCaptureEmailSender(cfg.CaptureDir, cfg.From)
+	default:
+		return nil, fmt.Errorf("unsupported email provider: %s", cfg.Provider)
+	}
+}
+
+// newSMSSender создает отправителя SMS согласно настройке sms.provider
+func newSMSSender(cfg config.SMSConfig) (service.SMSSender, error) {
+	switch cfg.Provider {
+	case "http":
+		return service.NewHTTPSMSSender(service.HTTPSMSConfig{
+			URL:         cfg.GatewayURL,
+			APIKey:      cfg.APIKey,
+			From:        cfg.From,
+			CallbackURL: cfg.CallbackURL,
+		}), nil
+	case "file":
+		return service.NewFileSMSSender(cfg.FilePath)
+	case "console":
+		return service.NewConsoleSMSSender(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unsupported SMS provider: %s", cfg.Provider)
+	}
+}
+
+// newPushSender создает провайдеров push-уведомлений по платформам. Если
+// ни один провайдер не настроен, push-уведомления отключены.
+func newPushSender(cfg config.PushConfig) service.PushSender {
+	senders := map[models.DevicePlatform]service.PushSender{}
+	if cfg.BaseURL != "" {
+		senders[models.DevicePlatformIOS] = service.NewHTTP2PushSender(service.HTTP2PushConfig{
+			BaseURL:   cfg.BaseURL,
+			AuthToken: cfg.AuthToken,
+			Topic:     cfg.Topic,
+		})
+	}
+	if cfg.FCM.ProjectID != "" {
+		senders[models.DevicePlatformAndroid] = service.NewFCMPushSender(service.FCMPushConfig{
+			BaseURL:     cfg.FCM.BaseURL,
+			ProjectID:   cfg.FCM.ProjectID,
+			AccessToken: cfg.FCM.AccessToken,
+		})
+	}
+	if len(senders) == 0 {
+		return nil
+	}
+	return service.NewPlatformPushSender(senders)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	pb "go_payment/api/proto/payment/v1"
+	grpcServer "go_payment/internal/grpc"
+	"go_payment/internal/messaging"
+	"go_payment/internal/ratelimit"
+	"go_payment/internal/service"
+	"go_payment/internal/tlsconfig"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"gorm.io/gorm"
+)
+
+// providerHealthGroup — имя в health сервисе, под которым публикуется
+// сводный статус провайдеров
+const providerHealthGroup = "providers"
+
+// serveGRPC обслуживает gRPC API до отмены ctx
+func serveGRPC(ctx context.Context, app *container) error {
+	// Подписка на изменения статусов для потоков WatchPayment
+	paymentWatcher := service.NewPaymentWatcher(app.db, app.rabbitmq)
+	if err := paymentWatcher.Start(); err != nil {
+		return fmt.Errorf("failed to start payment watcher: %w", err)
+	}
+
+	// Настройка gRPC сервера
+	cfg := app.cfg.GRPC
+	port := cfg.Port
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	// Цепочка интерцепторов: журнал и метрики видят результат восстановления
+	// после паники, аутентификация выполняется перед ограничением частоты,
+	// которое учитывает вызовы по клиенту. Правила доступа методов заданы
+	// в proto.
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	authInterceptor := grpcServer.NewAuthInterceptor(app.authService, tlsconfig.NewIdentities(cfg.TLS.ClientIdentities))
+	limiter := ratelimit.NewLimiter(app.runtime)
+
+	serverOptions, err := transportOptions(ctx, cfg.TLS.Config)
+	if err != nil {
+		return fmt.Errorf("failed to configure TLS: %w", err)
+	}
+	s := grpc.NewServer(append(serverOptions,
+		grpc.ChainUnaryInterceptor(
+			grpcServer.UnaryLoggingInterceptor(logger),
+			grpcServer.UnaryMetricsInterceptor(),
+			grpcServer.UnaryRecoveryInterceptor(logger),
+			grpcServer.UnaryTimeoutInterceptor(cfg.DefaultTimeout),
+			authInterceptor.Unary(),
+			grpcServer.UnaryRateLimitInterceptor(limiter),
+		),
+		grpc.ChainStreamInterceptor(
+			grpcServer.StreamLoggingInterceptor(logger),
+			grpcServer.StreamMetricsInterceptor(),
+			grpcServer.StreamRecoveryInterceptor(logger),
+			authInterceptor.Stream(),
+			grpcServer.StreamRateLimitInterceptor(limiter),
+		),
+	)...)
+	pb.RegisterPaymentServiceServer(s, grpcServer.NewPaymentServer(app.paymentService, app.customerService, app.webhookService, paymentWatcher, cfg.WatchHeartbeat))
+
+	// Стандартный health сервис со статусами зависимостей
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(s, healthServer)
+	grpcServer.NewHealthReporter(healthServer, cfg.HealthInterval, healthChecks(app.db, app.rabbitmq, app.paymentService, cfg.ProviderHealthTTL)...).Start(ctx)
+
+	// Включаем reflection для удобства разработки
+	reflection.Register(s)
+
+	// Метрики gRPC сервера
+	go func() {
+		log.Printf("Serving gRPC metrics on port %d", cfg.MetricsPort)
+		if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.MetricsPort), promhttp.Handler()); err != nil {
+			log.Printf("Metrics server stopped: %v", err)
+		}
+	}()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Starting gRPC server on port %d", port)
+		serveErr <- s.Serve(lis)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("failed to serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	// Пробы переводят под в NOT_SERVING, новые вызовы перестают поступать,
+	// начатые завершаются до истечения shutdown_timeout
+	log.Println("Shutting down gRPC server")
+	healthServer.Shutdown()
+	gracefulStop(s, cfg.ShutdownTimeout)
+	return nil
+}
+
+// gracefulStop дожидается завершения начатых вызовов, а по истечении timeout
+// принудительно закрывает соединения. Потоки WatchPayment не завершаются
+// сами, поэтому закрываются принудительно.
+func gracefulStop(s *grpc.Server, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		log.Println("gRPC server stopped")
+	case <-time.After(timeout):
+		log.Println("Graceful shutdown timed out, closing remaining connections")
+		s.Stop()
+	}
+}
+
+// healthChecks возвращает проверки зависимостей gRPC сервера. Провайдеры
+// некритичны: недоступность одного из них не мешает платежам через другие.
+// Их статусы сводятся в отдельную группу providers, а запросы к API
+// провайдеров выполняются не чаще providerTTL.
+func healthChecks(db *gorm.DB, rabbitmq *messaging.RabbitMQ, paymentService *service.PaymentService, providerTTL time.Duration) []grpcServer.HealthCheck {
+	checks := []grpcServer.HealthCheck{
+		{
+			Name:     "database",
+			Critical: true,
+			Check: func(ctx context.Context) error {
+				sqlDB, err := db.DB()
+				if err != nil {
+					return err
+				}
+				return sqlDB.PingContext(ctx)
+			},
+		},
+		{
+			Name:     "rabbitmq",
+			Critical: true,
+			Check: func(ctx context.Context) error {
+				return rabbitmq.CheckHealth()
+			},
+		},
+	}
+
+	for _, providerType := range paymentService.Providers() {
+		providerType := providerType
+		checks = append(checks, grpcServer.HealthCheck{
+			Name:  "provider." + string(providerType),
+			Group: providerHealthGroup,
+			TTL:   providerTTL,
+			Check: func(ctx context.Context) error {
+				return paymentService.CheckProviderHealth(ctx, providerType)
+			},
+		})
+	}
+
+	return checks
+}
+
+// transportOptions включает TLS, а при заданном CA клиентов и mTLS.
+// Сертификаты перечитываются при ротации без перезапуска.
+func transportOptions(ctx context.Context, cfg tlsconfig.Config) ([]grpc.ServerOption, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	reloader, err := tlsconfig.NewReloader(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := reloader.ServerConfig()
+	if err != nil {
+		return nil, err
+	}
+	reloader.Start(ctx)
+
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(tlsConfig))}, nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_payment/internal/config"
+	"go_payment/internal/gateway"
+	"go_payment/internal/handlers"
+	"go_payment/internal/middleware"
+	"go_payment/internal/models"
+	"go_payment/internal/ratelimit"
+	"go_payment/internal/tlsconfig"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	grpcCredentials "google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	// httpShutdownTimeout ограничивает ожидание начатых HTTP запросов при остановке
+	httpShutdownTimeout = 15 * time.Second
+	// apiPrefix — префикс REST API, общий для шлюза и обработчиков gin
+	apiPrefix = "/api/v1/"
+)
+
+// serveHTTP обслуживает REST API до отмены ctx
+func serveHTTP(ctx context.Context, app *container) error {
+	// Настройка Gin
+	r := gin.Default()
+
+	// Добавляем middleware для метрик
+	r.Use(middleware.MetricsMiddleware())
+
+	// Публичные endpoints
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/health", func(c *gin.Context) {
+		c.JSON(200, gin.H{"status": "UP"})
+	})
+
+	// Ограничение частоты запросов из секции runtime.rate_limits. Маршруты
+	// шлюза ограничиваются интерцептором gRPC сервера.
+	limiter := ratelimit.NewLimiter(app.runtime)
+
+	// Аутентификация
+	auth := r.Group("/auth")
+	auth.Use(middleware.RateLimitMiddleware(limiter))
+	{
+		authHandler := handlers.NewAuthHandler(app.authService)
+		auth.POST("/register", authHandler.Register)
+		auth.POST("/login", authHandler.Login)
+		auth.POST("/refresh", authHandler.RefreshToken)
+	}
+
+	// Callback'и внешних шлюзов уведомлений
+	callbacks := r.Group("/callbacks")
+	callbacks.Use(middleware.CallbackTokenMiddleware(app.cfg.SMS.CallbackToken))
+	{
+		notificationHandler := handlers.NewNotificationHandler(app.notificationService)
+		callbacks.POST("/sms", notificationHandler.SMSStatusCallback)
+	}
+
+	// Возвраты и жалобы почтового провайдера
+	emailCallbacks := r.Group("/callbacks/email")
+	emailCallbacks.Use(middleware.CallbackTokenMiddleware(app.cfg.SMTP.CallbackToken))
+	{
+		notificationHandler := handlers.NewNotificationHandler(app.notificationService)
+		emailCallbacks.POST("", notificationHandler.EmailEventCallback)
+	}
+
+	// Отписка по ссылке из письма, токен в ссылке подписан
+	{
+		notificationHandler := handlers.NewNotificationHandler(app.notificationService)
+		r.GET("/unsubscribe", notificationHandler.UnsubscribePage)
+		r.POST("/unsubscribe", notificationHandler.Unsubscribe)
+	}
+
+	// REST API платежей генерируется из payment.proto и транслируется в вызовы
+	// gRPC сервера. Аутентификация и роли проверяются интерцепторами gRPC,
+	// поэтому маршруты шлюза не входят в группу с AuthMiddleware.
+	paymentGateway, err := newPaymentGateway(ctx, app.cfg.Gateway)
+	if err != nil {
+		return fmt.Errorf("failed to create payment gateway: %w", err)
+	}
+	// Маршруты шлюза задаются аннотациями google.api.http, поэтому запросы к
+	// /api/v1 без маршрута gin передаются шлюзу целиком. Gin не допускает
+	// catch-all маршрут /api/v1/*any рядом с маршрутами того же префикса,
+	// поэтому шлюз подключается через NoRoute.
+	r.NoRoute(gatewayFallback(apiPrefix, paymentGateway))
+
+	// Защищенные endpoints
+	api := r.Group("/api/v1")
+	api.Use(middleware.AuthMiddleware(app.authService), middleware.RateLimitMiddleware(limiter))
+	{
+		// Платежные документы (доступны только для админов и менеджеров)
+		payments := api.Group("/payments")
+		payments.Use(middleware.RoleMiddleware(models.RoleAdmin, models.RoleManager))
+		{
+			receiptHandler := handlers.NewReceiptHandler(app.receiptService)
+			payments.GET("/:orderID/receipt", receiptHandler.GetPaymentReceipt)
+			payments.GET("/:orderID/receipts", receiptHandler.ListPaymentReceipts)
+			payments.GET("/:orderID/receipts/:receipt_id", receiptHandler.GetReceipt)
+		}
+
+		// Endpoints для уведомлений
+		notifications := api.Group("/notifications")
+		{
+			notificationHandler := handlers.NewNotificationHandler(app.notificationService)
+			notifications.POST("/", notificationHandler.SendNotification)
+			notifications.GET("/", middleware.RoleMiddleware(models.RoleAdmin, models.RoleManager), notificationHandler.ListNotifications)
+			notifications.GET("/status/:notification_id", notificationHandler.GetStatus)
+			notifications.POST("/cancel/:notification_id", notificationHandler.CancelNotification)
+			notifications.POST("/devices", notificationHandler.RegisterDevice)
+			notifications.GET("/devices", notificationHandler.ListDevices)
+			notifications.DELETE("/devices/:device_id", notificationHandler.UnregisterDevice)
+
+			// Управление шаблонами доступно только для админов и менеджеров
+			templates := notifications.Group("/templates")
+			templates.Use(middleware.RoleMiddleware(models.RoleAdmin, models.RoleManager))
+			{
+				templates.POST("", notificationHandler.CreateTemplate)
+				templates.GET("", notificationHandler.ListTemplates)
+				templates.GET("/:template_id", notificationHandler.GetTemplate)
+				templates.PUT("/:template_id", notificationHandler.UpdateTemplate)
+				templates.DELETE("/:template_id", notificationHandler.DeleteTemplate)
+				templates.GET("/:template_id/versions", notificationHandler.ListTemplateVersions)
+				templates.POST("/:template_id/preview", notificationHandler.PreviewTemplate)
+			}
+
+			// Список блокировки адресов доступен только для админов и менеджеров
+			suppressions := notifications.Group("/suppressions")
+			suppressions.Use(middleware.RoleMiddleware(models.RoleAdmin, models.RoleManager))
+			{
+				suppressions.GET("", notificationHandler.ListSuppressions)
+				suppressions.POST("", notificationHandler.AddSuppression)
+				suppressions.DELETE("/:email", notificationHandler.DeleteSuppression)
+			}
+		}
+
+		// Ключи доступа сервисных клиентов gRPC API (только для админов)
+		apiKeys := api.Group("/api-keys")
+		apiKeys.Use(middleware.RoleMiddleware(models.RoleAdmin))
+		{
+			authHandler := handlers.NewAuthHandler(app.authService)
+			apiKeys.POST("", authHandler.CreateAPIKey)
+			apiKeys.GET("", authHandler.ListAPIKeys)
+			apiKeys.DELETE("/:id", authHandler.RevokeAPIKey)
+		}
+
+		// Endpoints для пользователей (только для админов)
+		users := api.Group("/users")
+		users.Use(middleware.RoleMiddleware(models.RoleAdmin))
+		{
+			// TODO: добавить управление пользователями
+		}
+	}
+
+	// Запуск сервера
+	port := app.cfg.Server.Port
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: r}
+
+	serveErr := make(chan error, 1)
+	if app.cfg.Server.TLS.Enabled {
+		// Сертификаты перечитываются при ротации без перезапуска
+		reloader, err := tlsconfig.NewReloader(app.cfg.Server.TLS)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificates: %w", err)
+		}
+		reloader.Start(ctx)
+		if srv.TLSConfig, err = reloader.ServerConfig(); err != nil {
+			return fmt.Errorf("invalid TLS configuration: %w", err)
+		}
+
+		go func() {
+			log.Printf("Starting HTTPS server on port %d", port)
+			serveErr <- srv.ListenAndServeTLS("", "")
+		}()
+	} else {
+		go func() {
+			log.Printf("Starting HTTP server on port %d", port)
+			serveErr <- srv.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("failed to start server: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down HTTP server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to shut down HTTP server: %w", err)
+	}
+	return nil
+}
+
+// newPaymentGateway создает шлюз REST API платежей к gRPC серверу из
+// секции gateway. Сертификат шлюза для mTLS не должен входить в
+// grpc.tls.client_identities: шлюз передает учетные данные пользователя.
+func newPaymentGateway(ctx context.Context, cfg config.GatewayConfig) (http.Handler, error) {
+	creds := insecure.NewCredentials()
+	if cfg.TLS.Enabled {
+		tlsConfig, err := tlsconfig.NewClientConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		creds = grpcCredentials.NewTLS(tlsConfig)
+	}
+
+	handler, err := gateway.NewHandler(ctx, cfg.GRPCEndpoint, []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+// gatewayFallback передает шлюзу запросы с префиксом prefix. Остальные
+// запросы получают стандартный ответ gin 404.
+func gatewayFallback(prefix string, gateway http.Handler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !strings.HasPrefix(c.Request.URL.Path, prefix) {
+			return
+		}
+		gateway.ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go_payment/internal/config"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// defaultConfigFile используется, если не задана PAYMENT_CONFIG_FILE
+const defaultConfigFile = "configs/config.yaml"
+
+const usage = `Usage: payment-service <command>
+
+Commands:
+  serve-http                   REST API and payment gateway
+  serve-grpc                   gRPC API
+  worker                       queue consumers and notification scheduler
+  all                          all of the above in one process
+  migrate <command>            apply or roll back database migrations
+  config print [--redacted]    print the effective configuration
+
+Settings are read from configs/config.yaml (PAYMENT_CONFIG_FILE) and can be
+overridden with PAYMENT_* environment variables, e.g. PAYMENT_GRPC_PORT.
+PAYMENT_*_FILE reads a value from a file, e.g. PAYMENT_JWT_SECRET_FILE.
+The runtime section is reloaded when the file changes or on SIGHUP.
+`
+
+// component — часть сервиса, работающая до отмены контекста
+type component func(ctx context.Context, app *container) error
+
+// commands сопоставляет команды с запускаемыми компонентами
+var commands = map[string][]component{
+	"serve-http": {serveHTTP},
+	"serve-grpc": {serveGRPC},
+	"worker":     {runWorker},
+	"all":        {serveHTTP, serveGRPC, runWorker},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+	components, ok := commands[command]
+	if command != "config" && command != "migrate" && (!ok || len(os.Args) != 2) {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	// Загрузка конфигурации
+	cfg, err := config.Load(configFile())
+	if err != nil {
+		log.Fatalf("Error reading config: %v", err)
+	}
+	switch command {
+	case "config":
+		os.Exit(configCommand(cfg, os.Args[2:]))
+	case "migrate":
+		os.Exit(migrateCommand(cfg, os.Args[2:]))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Секция runtime перечитывается при изменении файла и по SIGHUP
+	runtime := config.NewRuntimeStore(configFile(), cfg)
+	runtime.Watch(ctx)
+	app, err := newContainer(ctx, cfg, runtime)
+	if err != nil {
+		log.Fatalf("Failed to initialize: %v", err)
+	}
+
+	err = run(ctx, app, components...)
+	app.Close()
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
+// configFile возвращает путь к файлу конфигурации
+func configFile() string {
+	if path := os.Getenv("PAYMENT_CONFIG_FILE"); path != "" {
+		return path
+	}
+	return defaultConfigFile
+}
+
+// configCommand выполняет команду config и возвращает код завершения.
+// Ошибки проверки выводятся после конфигурации, чтобы их можно было
+// сопоставить с действующими значениями.
+func configCommand(cfg *config.Config, args []string) int {
+	if len(args) == 0 || args[0] != "print" || len(args) > 2 || (len(args) == 2 && args[1] != "--redacted") {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	if err := cfg.WriteYAML(os.Stdout, len(args) == 2); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// run запускает компоненты и ждет их завершения. Ошибка одного компонента
+// останавливает остальные.
+func run(ctx context.Context, app *container, components ...component) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for _, start := range components {
+		wg.Add(1)
+		go func(start component) {
+			defer wg.Done()
+			if err := start(ctx, app); err != nil {
+				once.Do(func() { firstErr = err })
+				cancel()
+			}
+		}(start)
+	}
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go_payment/internal/config"
+	"go_payment/internal/migrations"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `Usage: payment-service migrate <command>
+
+Commands:
+  up              apply all pending migrations
+  down            roll back the last applied migration
+  to <version>    migrate up or down to the version, 0 rolls back everything
+  status          list migrations and the current schema version
+`
+
+// migrateCommand выполняет команду migrate и возвращает код завершения.
+// Для миграций нужна только база данных, поэтому остальная конфигурация
+// не проверяется.
+func migrateCommand(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	var run func(ctx context.Context, migrator *migrations.Migrator) error
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		run = func(ctx context.Context, migrator *migrations.Migrator) error {
+			return migrator.Up(ctx)
+		}
+	case args[0] == "down" && len(args) == 1:
+		run = func(ctx context.Context, migrator *migrations.Migrator) error {
+			return migrator.Down(ctx)
+		}
+	case args[0] == "status" && len(args) == 1:
+		run = printMigrationStatus
+	case args[0] == "to" && len(args) == 2:
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version < 0 {
+			fmt.Fprintf(os.Stderr, "invalid version %q\n", args[1])
+			return 2
+		}
+		run = func(ctx context.Context, migrator *migrations.Migrator) error {
+			return migrator.To(ctx, version)
+		}
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	db, err := openDatabase(cfg.Database)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer closeDatabase(db)
+
+	migrator, err := newMigrator(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := run(ctx, migrator); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// newMigrator создает Migrator для подключения gorm
+func newMigrator(db *gorm.DB) (*migrations.Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database connection: %w", err)
+	}
+	return migrations.New(sqlDB)
+}
+
+// printMigrationStatus выводит состояние миграций
+func printMigrationStatus(ctx context.Context, migrator *migrations.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Schema version: %d (this build expects %d)\n\n", version, migrator.Latest())
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.UTC().Format("2006-01-02 15:04:05 MST")
+		}
+		if status.Unknown {
+			applied += " (unknown to this build)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, applied)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// workerShutdownTimeout ограничивает ожидание начатой обработки сообщений
+// при остановке
+const workerShutdownTimeout = 30 * time.Second
+
+// runWorker запускает обработчики очередей и планировщик уведомлений до
+// отмены ctx. Соединения закрываются после возврата из runWorker, поэтому
+// перед возвратом потребители останавливаются и начатая обработка
+// завершается.
+func runWorker(ctx context.Context, app *container) error {
+	ctx, cancel := context.WithCancel(ctx)
+	var scheduler sync.WaitGroup
+	defer func() {
+		cancel()
+		waitForWorkers(app, &scheduler)
+	}()
+
+	// Запуск обработчика уведомлений
+	err := app.rabbitmq.ConsumeNotifications(ctx, app.notificationService.ProcessNotification)
+	if err != nil {
+		return fmt.Errorf("failed to start notification consumer: %w", err)
+	}
+
+	// Публикация отложенных уведомлений
+	scheduler.Add(1)
+	go func() {
+		defer scheduler.Done()
+		app.notificationService.RunScheduler(ctx, app.cfg.Notifications.SchedulerInterval)
+	}()
+
+	// Запуск обработки асинхронных операций
+	if err := app.asyncService.StartProcessing(ctx); err != nil {
+		return fmt.Errorf("failed to start async processing: %w", err)
+	}
+
+	// Запуск доставки исходящих вебхуков
+	if err := app.webhookService.StartProcessing(ctx); err != nil {
+		return fmt.Errorf("failed to start webhook delivery: %w", err)
+	}
+
+	// Метрики и проба живости обработчиков
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if err := app.rabbitmq.CheckHealth(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("OK"))
+	})
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", app.cfg.Worker.MetricsPort),
+		Handler: mux,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Serving worker metrics on %s", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("failed to serve worker metrics: %w", err)
+	case <-ctx.Done():
+	}
+
+	log.Println("Shutting down worker")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), httpShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to shut down worker metrics server: %w", err)
+	}
+	return nil
+}
+
+// waitForWorkers дожидается остановки планировщика и потребителей очередей
+// не дольше workerShutdownTimeout
+func waitForWorkers(app *container, scheduler *sync.WaitGroup) {
+	stopped := make(chan struct{})
+	go func() {
+		scheduler.Wait()
+		app.rabbitmq.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		log.Println("Worker stopped")
+	case <-time.After(workerShutdownTimeout):
+		log.Println("Timed out waiting for in-flight messages")
+	}
+}
@@ -0,0 +1,314 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// baseYAML содержит минимальную корректную конфигурацию
+const baseYAML = `
+database:
+  postgres:
+    user: payment
+    dbname: payments
+jwt:
+  secret: file-secret-0123456789
+smtp:
+  host: smtp.example.com
+  from: billing@example.com
+grpc:
+  port: 50051
+`
+
+// writeConfig сохраняет YAML во временный файл и возвращает путь к нему
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loadBase загружает baseYAML
+func loadBase(t *testing.T) *Config {
+	t.Helper()
+	cfg, err := Load(writeConfig(t, baseYAML))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return cfg
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	secretFile := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "secret")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name  string
+		env   func(t *testing.T)
+		check func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "defaults fill missing keys",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Server.Port != 8080 || cfg.GRPC.HealthInterval != 10*time.Second || cfg.Notifications.TimeZone != "UTC" {
+					t.Errorf("defaults not applied: port %d, health %s, zone %q", cfg.Server.Port, cfg.GRPC.HealthInterval, cfg.Notifications.TimeZone)
+				}
+			},
+		},
+		{
+			name: "file overrides defaults",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.JWT.Secret != "file-secret-0123456789" {
+					t.Errorf("jwt.secret = %q", cfg.JWT.Secret)
+				}
+			},
+		},
+		{
+			name: "environment overrides file",
+			env: func(t *testing.T) {
+				t.Setenv("PAYMENT_JWT_SECRET", "env-secret-0123456789")
+				t.Setenv("PAYMENT_GRPC_PORT", "6000")
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.JWT.Secret != "env-secret-0123456789" || cfg.GRPC.Port != 6000 {
+					t.Errorf("jwt.secret = %q, grpc.port = %d", cfg.JWT.Secret, cfg.GRPC.Port)
+				}
+			},
+		},
+		{
+			name: "environment overrides squashed keys",
+			env: func(t *testing.T) {
+				t.Setenv("PAYMENT_GRPC_TLS_CERT_FILE", "/etc/tls/grpc.crt")
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.GRPC.TLS.CertFile != "/etc/tls/grpc.crt" {
+					t.Errorf("grpc.tls.cert_file = %q", cfg.GRPC.TLS.CertFile)
+				}
+			},
+		},
+		{
+			name: "_FILE value is trimmed of trailing newlines",
+			env: func(t *testing.T) {
+				t.Setenv("PAYMENT_JWT_SECRET_FILE", secretFile(t, "mounted-secret-0123456789\r\n"))
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.JWT.Secret != "mounted-secret-0123456789" {
+					t.Errorf("jwt.secret = %q", cfg.JWT.Secret)
+				}
+			},
+		},
+		{
+			name: "_FILE overrides environment and file",
+			env: func(t *testing.T) {
+				t.Setenv("PAYMENT_JWT_SECRET", "env-secret-0123456789")
+				t.Setenv("PAYMENT_JWT_SECRET_FILE", secretFile(t, "mounted-secret-0123456789\n"))
+			},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.JWT.Secret != "mounted-secret-0123456789" {
+					t.Errorf("jwt.secret = %q", cfg.JWT.Secret)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != nil {
+				tt.env(t)
+			}
+			tt.check(t, loadBase(t))
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Run("missing config file", func(t *testing.T) {
+		if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+			t.Error("Load() error = nil, want error")
+		}
+	})
+	t.Run("missing _FILE", func(t *testing.T) {
+		t.Setenv("PAYMENT_JWT_SECRET_FILE", filepath.Join(t.TempDir(), "missing"))
+		_, err := Load(writeConfig(t, baseYAML))
+		if err == nil || !strings.Contains(err.Error(), "PAYMENT_JWT_SECRET_FILE") {
+			t.Errorf("Load() error = %v, want error naming PAYMENT_JWT_SECRET_FILE", err)
+		}
+	})
+}
+
+func TestKeys(t *testing.T) {
+	type inner struct {
+		Host string `mapstructure:"host"`
+		Port int    `mapstructure:"port"`
+	}
+	type item struct {
+		Name string `mapstructure:"name"`
+	}
+	type sample struct {
+		inner   `mapstructure:",squash"`
+		Nested  inner           `mapstructure:"nested"`
+		Tags    []string        `mapstructure:"tags"`
+		Items   []item          `mapstructure:"items"`
+		Flags   map[string]bool `mapstructure:"flags"`
+		Timeout time.Duration   `mapstructure:"timeout"`
+	}
+
+	got := keys(reflect.TypeOf(sample{}), "root.")
+	want := []string{"root.host", "root.port", "root.nested.host", "root.nested.port", "root.tags", "root.timeout"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keys() = %v, want %v", got, want)
+	}
+}
+
+func TestKeysCoverConfig(t *testing.T) {
+	all := map[string]bool{}
+	for _, key := range keys(reflect.TypeOf(Config{}), "") {
+		all[key] = true
+	}
+	for _, key := range []string{"jwt.secret", "grpc.tls.cert_file", "grpc.tls.reload_interval", "runtime.retry.max_attempts"} {
+		if !all[key] {
+			t.Errorf("keys() does not contain %s", key)
+		}
+	}
+	for _, key := range []string{"grpc.tls.client_identities", "runtime.features", "runtime.routing.rules"} {
+		if all[key] {
+			t.Errorf("keys() contains file-only key %s", key)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr []string
+	}{
+		{name: "valid"},
+		{
+			name:    "missing jwt secret",
+			modify:  func(cfg *Config) { cfg.JWT.Secret = "" },
+			wantErr: []string{"jwt.secret: is required (set it in the config file or PAYMENT_JWT_SECRET)"},
+		},
+		{
+			name:    "short jwt secret",
+			modify:  func(cfg *Config) { cfg.JWT.Secret = strings.Repeat("x", minJWTSecretLength-1) },
+			wantErr: []string{"jwt.secret: must be at least 16 bytes long"},
+		},
+		{
+			name:   "jwt secret of minimal length",
+			modify: func(cfg *Config) { cfg.JWT.Secret = strings.Repeat("x", minJWTSecretLength) },
+		},
+		{
+			name:    "grpc port reused by http",
+			modify:  func(cfg *Config) { cfg.GRPC.Port = cfg.Server.Port },
+			wantErr: []string{"grpc.port: port 8080 is already used by server.port"},
+		},
+		{
+			name: "metrics ports reused",
+			modify: func(cfg *Config) {
+				cfg.Worker.MetricsPort = cfg.GRPC.MetricsPort
+			},
+			wantErr: []string{"worker.metrics_port: port 9091 is already used by grpc.metrics_port"},
+		},
+		{
+			name: "all problems are reported together",
+			modify: func(cfg *Config) {
+				cfg.JWT.Secret = ""
+				cfg.Server.Port = 0
+				cfg.GRPC.HealthInterval = -time.Second
+			},
+			wantErr: []string{"jwt.secret", "server.port", "grpc.health_interval: must not be negative"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := loadBase(t)
+			if tt.modify != nil {
+				tt.modify(cfg)
+			}
+
+			err := cfg.Validate()
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() error = nil, want %v", tt.wantErr)
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %v, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteYAMLRedaction(t *testing.T) {
+	cfg := loadBase(t)
+	cfg.Database.Postgres.Password = "db-password"
+	cfg.GRPC.TLS.CertFile = "/etc/tls/grpc.crt"
+
+	tests := []struct {
+		name      string
+		redacted  bool
+		contains  []string
+		forbidden []string
+	}{
+		{
+			name:      "redacted",
+			redacted:  true,
+			contains:  []string{"secret: '" + redactedValue + "'", "password: '" + redactedValue + "'", "cert_file: /etc/tls/grpc.crt", "health_interval: 10s"},
+			forbidden: []string{"file-secret-0123456789", "db-password"},
+		},
+		{
+			name:     "plain",
+			contains: []string{"secret: file-secret-0123456789", "password: db-password"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := cfg.WriteYAML(&buf, tt.redacted); err != nil {
+				t.Fatalf("WriteYAML() error = %v", err)
+			}
+			out := buf.String()
+			for _, want := range tt.contains {
+				if !strings.Contains(out, want) {
+					t.Errorf("output does not contain %q:\n%s", want, out)
+				}
+			}
+			for _, secret := range tt.forbidden {
+				if strings.Contains(out, secret) {
+					t.Errorf("output contains secret %q", secret)
+				}
+			}
+		})
+	}
+
+	// Пустой секрет не маскируется, чтобы было видно, что он не задан
+	cfg.SMTP.Password = ""
+	var buf bytes.Buffer
+	if err := cfg.WriteYAML(&buf, true); err != nil {
+		t.Fatalf("WriteYAML() error = %v", err)
+	}
+	if !strings.Contains(buf.String(), `password: ""`) {
+		t.Errorf("empty smtp.password is redacted:\n%s", buf.String())
+	}
+}
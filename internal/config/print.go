@@ -0,0 +1,69 @@
+package config
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactedValue заменяет заданные секреты при выводе конфигурации
+const redactedValue = "******"
+
+// WriteYAML выводит действующую конфигурацию в порядке полей Config. При
+// redacted непустые секреты заменяются на redactedValue.
+func (c *Config) WriteYAML(w io.Writer, redacted bool) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(encodeValue(reflect.ValueOf(*c), redacted)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// encodeValue строит узел YAML с именами ключей из тегов mapstructure
+func encodeValue(v reflect.Value, redacted bool) *yaml.Node {
+	if d, ok := v.Interface().(time.Duration); ok {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: d.String()}
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		encodeFields(node, v, redacted)
+		return node
+	case reflect.Slice:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for i := 0; i < v.Len(); i++ {
+			node.Content = append(node.Content, encodeValue(v.Index(i), redacted))
+		}
+		return node
+	}
+
+	node := &yaml.Node{}
+	if err := node.Encode(v.Interface()); err != nil {
+		return &yaml.Node{Kind: yaml.ScalarNode, Value: err.Error()}
+	}
+	return node
+}
+
+// encodeFields добавляет поля структуры v в узел node
+func encodeFields(node *yaml.Node, v reflect.Value, redacted bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, opts, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if opts == "squash" {
+			encodeFields(node, v.Field(i), redacted)
+			continue
+		}
+
+		value := encodeValue(v.Field(i), redacted)
+		if redacted && field.Tag.Get("secret") == "true" && !v.Field(i).IsZero() {
+			value = &yaml.Node{Kind: yaml.ScalarNode, Value: redactedValue}
+		}
+		node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+	}
+}
@@ -0,0 +1,229 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go_payment/internal/errors"
+	"strings"
+	"time"
+)
+
+// Флаги функций секции runtime.features
+const (
+	// FeatureManualCapture разрешает платежи с ручным списанием
+	FeatureManualCapture = "manual_capture"
+	// FeaturePartialRefunds разрешает частичные возвраты
+	FeaturePartialRefunds = "partial_refunds"
+)
+
+// knownFeatures содержит значения флагов по умолчанию
+var knownFeatures = map[string]bool{
+	FeatureManualCapture:  true,
+	FeaturePartialRefunds: true,
+}
+
+// Runtime — настройки, которые применяются без перезапуска при изменении
+// файла конфигурации или по SIGHUP
+type Runtime struct {
+	Routing    RoutingConfig   `mapstructure:"routing"`
+	RateLimits RateLimitConfig `mapstructure:"rate_limits"`
+	Retry      RetryConfig     `mapstructure:"retry"`
+	Risk       RiskConfig      `mapstructure:"risk"`
+	Features   map[string]bool `mapstructure:"features"`
+}
+
+// RoutingConfig выбирает провайдера для платежей, в которых он не указан.
+// Правила проверяются по порядку, применяется первое подходящее.
+type RoutingConfig struct {
+	DefaultProvider string        `mapstructure:"default_provider"`
+	Rules           []RoutingRule `mapstructure:"rules"`
+}
+
+// RoutingRule направляет платежи в провайдера по валюте и сумме. Пустой
+// список валют и нулевые границы суммы не ограничивают правило.
+type RoutingRule struct {
+	Currencies []string `mapstructure:"currencies"`
+	MinAmount  float64  `mapstructure:"min_amount"`
+	MaxAmount  float64  `mapstructure:"max_amount"`
+	Provider   string   `mapstructure:"provider"`
+}
+
+// RateLimitConfig ограничивает частоту запросов одного клиента.
+// Нулевое RequestsPerSecond отключает ограничение.
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `mapstructure:"requests_per_second"`
+	Burst             int     `mapstructure:"burst"`
+}
+
+// RetryConfig — повтор обработки сообщений очередей
+type RetryConfig struct {
+	MaxAttempts     int           `mapstructure:"max_attempts"`
+	InitialInterval time.Duration `mapstructure:"initial_interval"`
+	MaxInterval     time.Duration `mapstructure:"max_interval"`
+	Multiplier      float64       `mapstructure:"multiplier"`
+}
+
+// RiskConfig — ограничения суммы платежа по валютам
+type RiskConfig struct {
+	Limits []RiskLimit `mapstructure:"limits"`
+}
+
+// RiskLimit задает пороги суммы платежа в валюте Currency. Нулевой порог
+// не применяется.
+type RiskLimit struct {
+	Currency string `mapstructure:"currency"`
+	// MaxAmount — платежи на большую сумму отклоняются
+	MaxAmount float64 `mapstructure:"max_amount"`
+	// ReviewAmount — платежи от этой суммы проводятся с ручным списанием,
+	// чтобы их можно было проверить до списания
+	ReviewAmount float64 `mapstructure:"review_amount"`
+}
+
+// Route возвращает провайдера для платежа или пустую строку, если ни одно
+// правило не подошло и провайдер по умолчанию не задан
+func (r *Runtime) Route(currency string, amount float64) string {
+	for _, rule := range r.Routing.Rules {
+		if rule.matches(currency, amount) {
+			return rule.Provider
+		}
+	}
+	return r.Routing.DefaultProvider
+}
+
+func (r RoutingRule) matches(currency string, amount float64) bool {
+	if len(r.Currencies) > 0 && !containsFold(r.Currencies, currency) {
+		return false
+	}
+	if r.MinAmount > 0 && amount < r.MinAmount {
+		return false
+	}
+	if r.MaxAmount > 0 && amount > r.MaxAmount {
+		return false
+	}
+	return true
+}
+
+// RiskLimit возвращает пороги для валюты
+func (r *Runtime) RiskLimit(currency string) (RiskLimit, bool) {
+	for _, limit := range r.Risk.Limits {
+		if strings.EqualFold(limit.Currency, currency) {
+			return limit, true
+		}
+	}
+	return RiskLimit{}, false
+}
+
+// FeatureEnabled сообщает, включен ли флаг. Флаг, не заданный в
+// конфигурации, имеет значение по умолчанию.
+func (r *Runtime) FeatureEnabled(name string) bool {
+	if enabled, ok := r.Features[name]; ok {
+		return enabled
+	}
+	return knownFeatures[name]
+}
+
+// RetryStrategy возвращает стратегию повтора обработки сообщений
+func (r *Runtime) RetryStrategy() *errors.RetryStrategy {
+	return &errors.RetryStrategy{
+		MaxAttempts:     r.Retry.MaxAttempts,
+		InitialInterval: r.Retry.InitialInterval,
+		MaxInterval:     r.Retry.MaxInterval,
+		Multiplier:      r.Retry.Multiplier,
+	}
+}
+
+// Hash возвращает хэш содержимого настроек. Он не зависит от порядка
+// ключей в файле и числа перезагрузок, поэтому совпадает у реплик с
+// одинаковыми настройками.
+func (r *Runtime) Hash() string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// validate проверяет секцию runtime. providers сообщает для каждого
+// провайдера, включен ли он в секции payment: маршрут в отключенного
+// провайдера завершится ошибкой.
+func (r *Runtime) validate(p *problems, providers map[string]bool) {
+	checkProvider := func(key, provider string) {
+		enabled, known := providers[provider]
+		switch {
+		case !known:
+			p.addf(key, "unknown provider %q", provider)
+		case !enabled:
+			p.addf(key, "provider %s is not enabled in payment.%s", provider, provider)
+		}
+	}
+
+	if r.Routing.DefaultProvider != "" {
+		checkProvider("runtime.routing.default_provider", r.Routing.DefaultProvider)
+	}
+	for i, rule := range r.Routing.Rules {
+		key := fmt.Sprintf("runtime.routing.rules[%d]", i)
+		checkProvider(key+".provider", rule.Provider)
+		if rule.MinAmount < 0 || rule.MaxAmount < 0 {
+			p.addf(key, "amounts must not be negative")
+		}
+		if rule.MaxAmount > 0 && rule.MinAmount > rule.MaxAmount {
+			p.addf(key, "min_amount must not exceed max_amount")
+		}
+	}
+
+	if r.RateLimits.RequestsPerSecond < 0 {
+		p.addf("runtime.rate_limits.requests_per_second", "must not be negative")
+	}
+	if r.RateLimits.RequestsPerSecond > 0 && r.RateLimits.Burst < 1 {
+		p.addf("runtime.rate_limits.burst", "must be at least 1 when rate limiting is enabled")
+	}
+
+	if r.Retry.MaxAttempts < 1 {
+		p.addf("runtime.retry.max_attempts", "must be at least 1, got %d", r.Retry.MaxAttempts)
+	}
+	if r.Retry.InitialInterval <= 0 {
+		p.addf("runtime.retry.initial_interval", "must be positive")
+	}
+	if r.Retry.MaxInterval < r.Retry.InitialInterval {
+		p.addf("runtime.retry.max_interval", "must not be less than initial_interval")
+	}
+	if r.Retry.Multiplier < 1 {
+		p.addf("runtime.retry.multiplier", "must be at least 1, got %g", r.Retry.Multiplier)
+	}
+
+	currencies := map[string]bool{}
+	for i, limit := range r.Risk.Limits {
+		key := fmt.Sprintf("runtime.risk.limits[%d]", i)
+		currency := strings.ToUpper(limit.Currency)
+		if currency == "" {
+			p.addf(key+".currency", "is required")
+		} else if currencies[currency] {
+			p.addf(key+".currency", "duplicate limits for %s", currency)
+		}
+		currencies[currency] = true
+		if limit.MaxAmount < 0 || limit.ReviewAmount < 0 {
+			p.addf(key, "amounts must not be negative")
+		}
+		if limit.MaxAmount > 0 && limit.ReviewAmount > limit.MaxAmount {
+			p.addf(key, "review_amount must not exceed max_amount")
+		}
+	}
+
+	for name := range r.Features {
+		if _, ok := knownFeatures[name]; !ok {
+			p.addf("runtime.features."+name, "unknown feature flag")
+		}
+	}
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
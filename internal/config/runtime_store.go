@@ -0,0 +1,142 @@
+package config
+
+import (
+	"context"
+	"go_payment/internal/metrics"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+// RuntimeStore хранит действующие runtime настройки. Сервисы читают
+// Current при каждой операции, поэтому замена настроек не прерывает
+// выполняющиеся запросы: они завершаются с версией, полученной в начале.
+type RuntimeStore struct {
+	path   string
+	static Config
+
+	mu      sync.Mutex
+	current atomic.Pointer[Runtime]
+}
+
+// NewRuntimeStore создает хранилище с настройками cfg, загруженными из path
+func NewRuntimeStore(path string, cfg *Config) *RuntimeStore {
+	s := &RuntimeStore{path: path, static: *cfg}
+	s.static.Runtime = Runtime{}
+
+	runtime := cfg.Runtime
+	s.current.Store(&runtime)
+	publishRuntimeHash(runtime.Hash())
+	return s
+}
+
+// Current возвращает действующие настройки. Возвращаемое значение не
+// изменяется, при перезагрузке подменяется целиком.
+func (s *RuntimeStore) Current() *Runtime {
+	return s.current.Load()
+}
+
+// Version возвращает хэш действующих настроек
+func (s *RuntimeStore) Version() string {
+	return s.Current().Hash()
+}
+
+// Reload перечитывает файл конфигурации и применяет секцию runtime. Файл
+// проверяется целиком: при любой ошибке действующие настройки не меняются.
+func (s *RuntimeStore) Reload(trigger string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cfg, err := Load(s.path)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		metrics.RuntimeConfigReloads.WithLabelValues("rejected").Inc()
+		return err
+	}
+
+	// Остальные секции применяются только при запуске
+	static := *cfg
+	static.Runtime = Runtime{}
+	if !reflect.DeepEqual(static, s.static) {
+		log.Printf("Configuration changes outside the runtime section require a restart")
+	}
+
+	previous := s.Current()
+	if reflect.DeepEqual(*previous, cfg.Runtime) {
+		metrics.RuntimeConfigReloads.WithLabelValues("unchanged").Inc()
+		return nil
+	}
+
+	runtime := cfg.Runtime
+	s.current.Store(&runtime)
+	version := runtime.Hash()
+	publishRuntimeHash(version)
+	metrics.RuntimeConfigReloads.WithLabelValues("applied").Inc()
+	log.Printf("Runtime configuration version %s applied on %s, changed: %s",
+		version, trigger, strings.Join(changedSections(previous, &runtime), ", "))
+	return nil
+}
+
+// publishRuntimeHash заменяет хэш действующих настроек в метрике
+func publishRuntimeHash(hash string) {
+	metrics.RuntimeConfigInfo.Reset()
+	metrics.RuntimeConfigInfo.WithLabelValues(hash).Set(1)
+}
+
+// Watch перечитывает настройки при изменении файла конфигурации и по
+// SIGHUP. Отслеживается каталог файла, поэтому замена ConfigMap в
+// Kubernetes через симлинк тоже учитывается. Обработка SIGHUP
+// прекращается при отмене ctx. Watch вызывается до инициализации остальных
+// компонентов: до signal.Notify SIGHUP завершает процесс.
+func (s *RuntimeStore) Watch(ctx context.Context) {
+	v := viper.New()
+	v.SetConfigFile(s.path)
+	v.OnConfigChange(func(event fsnotify.Event) {
+		s.reload("file change")
+	})
+	v.WatchConfig()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(hangup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangup:
+				s.reload("SIGHUP")
+			}
+		}
+	}()
+}
+
+// reload перечитывает настройки и журналирует отклоненные изменения
+func (s *RuntimeStore) reload(trigger string) {
+	if err := s.Reload(trigger); err != nil {
+		log.Printf("Runtime configuration change on %s rejected, keeping version %s: %v", trigger, s.Version(), err)
+	}
+}
+
+// changedSections возвращает имена измененных разделов секции runtime
+func changedSections(previous, next *Runtime) []string {
+	var changed []string
+	a, b := reflect.ValueOf(*previous), reflect.ValueOf(*next)
+	for i := 0; i < a.NumField(); i++ {
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			name, _, _ := strings.Cut(a.Type().Field(i).Tag.Get("mapstructure"), ",")
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoute(t *testing.T) {
+	runtime := &Runtime{Routing: RoutingConfig{
+		DefaultProvider: "stripe",
+		Rules: []RoutingRule{
+			{Currencies: []string{"EUR"}, MinAmount: 1000, Provider: "paypal"},
+			{Currencies: []string{"usd", "CAD"}, MaxAmount: 50, Provider: "paypal"},
+			{MinAmount: 10000, Provider: "paypal"},
+		},
+	}}
+
+	tests := []struct {
+		name     string
+		currency string
+		amount   float64
+		want     string
+	}{
+		{name: "currency and minimum match", currency: "EUR", amount: 1000, want: "paypal"},
+		{name: "below minimum falls through", currency: "EUR", amount: 999.99, want: "stripe"},
+		{name: "currency matched case-insensitively", currency: "USD", amount: 50, want: "paypal"},
+		{name: "above maximum falls through", currency: "CAD", amount: 50.01, want: "stripe"},
+		{name: "rule without currencies", currency: "GBP", amount: 10000, want: "paypal"},
+		{name: "default provider", currency: "GBP", amount: 10, want: "stripe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := runtime.Route(tt.currency, tt.amount); got != tt.want {
+				t.Errorf("Route(%s, %g) = %q, want %q", tt.currency, tt.amount, got, tt.want)
+			}
+		})
+	}
+
+	if got := (&Runtime{}).Route("EUR", 10); got != "" {
+		t.Errorf("Route() without rules = %q, want empty", got)
+	}
+}
+
+func TestRuntimeValidate(t *testing.T) {
+	valid := func() Runtime {
+		return Runtime{
+			Retry: RetryConfig{MaxAttempts: 3, InitialInterval: time.Second, MaxInterval: 30 * time.Second, Multiplier: 2},
+		}
+	}
+	providers := map[string]bool{"stripe": true, "paypal": false}
+
+	tests := []struct {
+		name   string
+		modify func(r *Runtime)
+		want   []string
+	}{
+		{name: "valid"},
+		{
+			name:   "unknown default provider",
+			modify: func(r *Runtime) { r.Routing.DefaultProvider = "adyen" },
+			want:   []string{`runtime.routing.default_provider: unknown provider "adyen"`},
+		},
+		{
+			name:   "rule to a disabled provider",
+			modify: func(r *Runtime) { r.Routing.Rules = []RoutingRule{{Provider: "paypal"}} },
+			want:   []string{"runtime.routing.rules[0].provider: provider paypal is not enabled in payment.paypal"},
+		},
+		{
+			name:   "inverted amounts",
+			modify: func(r *Runtime) { r.Routing.Rules = []RoutingRule{{Provider: "stripe", MinAmount: 100, MaxAmount: 10}} },
+			want:   []string{"runtime.routing.rules[0]: min_amount must not exceed max_amount"},
+		},
+		{
+			name:   "rate limit without burst",
+			modify: func(r *Runtime) { r.RateLimits.RequestsPerSecond = 5 },
+			want:   []string{"runtime.rate_limits.burst: must be at least 1"},
+		},
+		{
+			name: "invalid retry",
+			modify: func(r *Runtime) {
+				r.Retry = RetryConfig{MaxAttempts: 0, InitialInterval: time.Second, MaxInterval: time.Millisecond, Multiplier: 0.5}
+			},
+			want: []string{"runtime.retry.max_attempts", "runtime.retry.max_interval", "runtime.retry.multiplier"},
+		},
+		{
+			name: "duplicate risk limits",
+			modify: func(r *Runtime) {
+				r.Risk.Limits = []RiskLimit{{Currency: "EUR", MaxAmount: 100}, {Currency: "eur", MaxAmount: 200}}
+			},
+			want: []string{"runtime.risk.limits[1].currency: duplicate limits for EUR"},
+		},
+		{
+			name:   "review above maximum",
+			modify: func(r *Runtime) { r.Risk.Limits = []RiskLimit{{Currency: "EUR", MaxAmount: 100, ReviewAmount: 200}} },
+			want:   []string{"runtime.risk.limits[0]: review_amount must not exceed max_amount"},
+		},
+		{
+			name:   "unknown feature flag",
+			modify: func(r *Runtime) { r.Features = map[string]bool{"instant_payouts": true} },
+			want:   []string{"runtime.features.instant_payouts: unknown feature flag"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := valid()
+			if tt.modify != nil {
+				tt.modify(&runtime)
+			}
+
+			var p problems
+			runtime.validate(&p, providers)
+			if len(tt.want) == 0 && len(p) > 0 {
+				t.Fatalf("validate() problems = %v", p)
+			}
+			got := strings.Join(p, "\n")
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("validate() problems = %v, want %q", p, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRuntimeHash(t *testing.T) {
+	a := Runtime{Features: map[string]bool{FeatureManualCapture: false, FeaturePartialRefunds: true}}
+	b := Runtime{Features: map[string]bool{FeaturePartialRefunds: true, FeatureManualCapture: false}}
+	if a.Hash() != b.Hash() {
+		t.Error("equal settings must have equal hashes")
+	}
+
+	b.Features[FeaturePartialRefunds] = false
+	if a.Hash() == b.Hash() {
+		t.Error("different settings must have different hashes")
+	}
+}
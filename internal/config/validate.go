@@ -0,0 +1,167 @@
+package config
+
+import (
+	"fmt"
+	"go_payment/internal/tlsconfig"
+	"strings"
+	"time"
+)
+
+// minJWTSecretLength — минимальная длина секрета подписи токенов
+const minJWTSecretLength = 16
+
+// problems накапливает ошибки проверки, чтобы сообщить обо всех сразу
+type problems []string
+
+func (p *problems) addf(key, format string, args ...interface{}) {
+	*p = append(*p, key+": "+fmt.Sprintf(format, args...))
+}
+
+func (p *problems) required(key, value string) {
+	if strings.TrimSpace(value) == "" {
+		p.addf(key, "is required (set it in the config file or %s)", EnvName(key))
+	}
+}
+
+func (p *problems) oneOf(key, value string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	p.addf(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+func (p *problems) port(key string, value int) {
+	if value <= 0 || value > 65535 {
+		p.addf(key, "must be a port number between 1 and 65535, got %d", value)
+	}
+}
+
+func (p *problems) nonNegative(key string, value time.Duration) {
+	if value < 0 {
+		p.addf(key, "must not be negative, got %s", value)
+	}
+}
+
+// Validate проверяет конфигурацию и возвращает все найденные ошибки
+func (c *Config) Validate() error {
+	var p problems
+
+	p.port("server.port", c.Server.Port)
+	p.serverTLS("server.tls", c.Server.TLS)
+
+	if c.Database.URL == "" {
+		p.required("database.postgres.host", c.Database.Postgres.Host)
+		p.port("database.postgres.port", c.Database.Postgres.Port)
+		p.required("database.postgres.user", c.Database.Postgres.User)
+		p.required("database.postgres.dbname", c.Database.Postgres.DBName)
+	}
+	p.required("rabbitmq.url", c.RabbitMQ.URL)
+
+	// Секрет по умолчанию позволял подделать токены любой установки
+	p.required("jwt.secret", c.JWT.Secret)
+	if c.JWT.Secret != "" && len(c.JWT.Secret) < minJWTSecretLength {
+		p.addf("jwt.secret", "must be at least %d bytes long", minJWTSecretLength)
+	}
+
+	if c.Payment.Stripe.Enabled {
+		p.required("payment.stripe.secret_key", c.Payment.Stripe.SecretKey)
+	}
+	if c.Payment.PayPal.Enabled {
+		p.required("payment.paypal.client_id", c.Payment.PayPal.ClientID)
+		p.required("payment.paypal.secret_key", c.Payment.PayPal.SecretKey)
+		p.oneOf("payment.paypal.mode", c.Payment.PayPal.Mode, "sandbox", "production")
+	}
+
+	p.oneOf("smtp.provider", c.SMTP.Provider, "smtp", "capture")
+	if c.SMTP.Provider == "smtp" {
+		p.required("smtp.host", c.SMTP.Host)
+		p.port("smtp.port", c.SMTP.Port)
+		p.required("smtp.from", c.SMTP.From)
+	}
+	p.nonNegative("smtp.idle_timeout", c.SMTP.IdleTimeout)
+	p.nonNegative("smtp.dial_timeout", c.SMTP.DialTimeout)
+
+	p.oneOf("sms.provider", c.SMS.Provider, "console", "file", "http")
+	switch c.SMS.Provider {
+	case "file":
+		p.required("sms.file_path", c.SMS.FilePath)
+	case "http":
+		p.required("sms.gateway_url", c.SMS.GatewayURL)
+	}
+
+	if c.Notifications.UnsubscribeURL != "" {
+		p.required("notifications.unsubscribe_secret", c.Notifications.UnsubscribeSecret)
+	}
+	p.nonNegative("notifications.scheduler_interval", c.Notifications.SchedulerInterval)
+	if _, err := time.LoadLocation(c.Notifications.TimeZone); err != nil {
+		p.addf("notifications.timezone", "unknown time zone %q", c.Notifications.TimeZone)
+	}
+
+	if c.Receipts.TaxRate < 0 || c.Receipts.TaxRate >= 100 {
+		p.addf("receipts.tax_rate", "must be a percentage between 0 and 100, got %g", c.Receipts.TaxRate)
+	}
+
+	p.port("grpc.port", c.GRPC.Port)
+	p.port("grpc.metrics_port", c.GRPC.MetricsPort)
+	p.nonNegative("grpc.watch_heartbeat", c.GRPC.WatchHeartbeat)
+	p.nonNegative("grpc.default_timeout", c.GRPC.DefaultTimeout)
+	p.nonNegative("grpc.health_interval", c.GRPC.HealthInterval)
+	p.nonNegative("grpc.provider_health_ttl", c.GRPC.ProviderHealthTTL)
+	p.nonNegative("grpc.shutdown_timeout", c.GRPC.ShutdownTimeout)
+	p.serverTLS("grpc.tls", c.GRPC.TLS.Config)
+	for i, identity := range c.GRPC.TLS.ClientIdentities {
+		if identity.CommonName == "" {
+			p.addf(fmt.Sprintf("grpc.tls.client_identities[%d].common_name", i), "is required")
+		}
+	}
+
+	p.required("gateway.grpc_endpoint", c.Gateway.GRPCEndpoint)
+	if (c.Gateway.TLS.CertFile == "") != (c.Gateway.TLS.KeyFile == "") {
+		p.addf("gateway.tls", "cert_file and key_file must be set together")
+	}
+
+	p.port("worker.metrics_port", c.Worker.MetricsPort)
+
+	c.Runtime.validate(&p, map[string]bool{
+		"stripe": c.Payment.Stripe.Enabled,
+		"paypal": c.Payment.PayPal.Enabled,
+	})
+
+	// В режиме all все серверы работают в одном процессе
+	ports := map[int]string{}
+	for _, entry := range []struct {
+		key  string
+		port int
+	}{
+		{"server.port", c.Server.Port},
+		{"grpc.port", c.GRPC.Port},
+		{"grpc.metrics_port", c.GRPC.MetricsPort},
+		{"worker.metrics_port", c.Worker.MetricsPort},
+	} {
+		if other, ok := ports[entry.port]; ok {
+			p.addf(entry.key, "port %d is already used by %s", entry.port, other)
+			continue
+		}
+		ports[entry.port] = entry.key
+	}
+
+	if len(p) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(p, "\n  "))
+	}
+	return nil
+}
+
+// serverTLS проверяет TLS сервера
+func (p *problems) serverTLS(key string, config tlsconfig.Config) {
+	if !config.Enabled {
+		return
+	}
+	p.required(key+".cert_file", config.CertFile)
+	p.required(key+".key_file", config.KeyFile)
+	if config.ClientAuth != "" {
+		p.oneOf(key+".client_auth", config.ClientAuth, tlsconfig.ClientAuthNone, tlsconfig.ClientAuthRequest, tlsconfig.ClientAuthRequire)
+	}
+	p.nonNegative(key+".reload_interval", config.ReloadInterval)
+}
@@ -0,0 +1,85 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	pb "go_payment/api/proto/payment/v1"
+	"net/http"
+	"net/textproto"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// forwardedHeaders — заголовки HTTP запроса, передаваемые в метаданные gRPC
+// вызова. Authorization передается шлюзом всегда.
+var forwardedHeaders = map[string]string{
+	textproto.CanonicalMIMEHeaderKey("X-Api-Key"):    "x-api-key",
+	textproto.CanonicalMIMEHeaderKey("X-Request-Id"): "x-request-id",
+}
+
+// NewHandler создает HTTP обработчик REST API платежей, сгенерированного из
+// аннотаций google.api.http в payment.proto. Запросы транслируются в вызовы
+// gRPC сервера по адресу endpoint, аутентификация и проверка ролей
+// выполняются интерцепторами gRPC сервера.
+func NewHandler(ctx context.Context, endpoint string, dialOptions []grpc.DialOption) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		// Имена полей JSON совпадают с именами в proto, как в прежнем REST API
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions: protojson.MarshalOptions{
+				UseProtoNames:   true,
+				EmitUnpopulated: true,
+			},
+			UnmarshalOptions: protojson.UnmarshalOptions{
+				DiscardUnknown: true,
+			},
+		}),
+		runtime.WithIncomingHeaderMatcher(headerMatcher),
+		runtime.WithErrorHandler(errorHandler),
+	)
+
+	if err := pb.RegisterPaymentServiceHandlerFromEndpoint(ctx, mux, endpoint, dialOptions); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// headerMatcher передает ключ доступа и идентификатор запроса под теми же
+// именами, что используют gRPC клиенты
+func headerMatcher(key string) (string, bool) {
+	if name, ok := forwardedHeaders[textproto.CanonicalMIMEHeaderKey(key)]; ok {
+		return name, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// errorHandler отвечает в формате остальных endpoints: {"error": "..."}.
+// Причина из деталей google.rpc.ErrorInfo передается в поле reason.
+func errorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	// Ошибки маршрутизации (например, 405) приходят с готовым HTTP статусом
+	var statusErr *runtime.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		err = statusErr.Err
+	}
+	st := status.Convert(err)
+
+	httpStatus := runtime.HTTPStatusFromCode(st.Code())
+	if statusErr != nil {
+		httpStatus = statusErr.HTTPStatus
+	}
+
+	body := map[string]string{"error": st.Message()}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			body["reason"] = info.Reason
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	json.NewEncoder(w).Encode(body)
+}
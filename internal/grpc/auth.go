@@ -0,0 +1,267 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	pb "go_payment/api/proto/payment/v1"
+	"go_payment/internal/models"
+	"go_payment/internal/service"
+	"go_payment/internal/tlsconfig"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionalphapb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// apiKeyHeader — заголовок метаданных с ключом доступа сервисного клиента
+const apiKeyHeader = "x-api-key"
+
+// Principal представляет аутентифицированного клиента gRPC вызова.
+// Service заполняется для внутренних сервисов, предъявивших сертификат.
+type Principal struct {
+	UserID   string
+	Email    string
+	Roles    []models.Role
+	APIKeyID string
+	Service  string
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext возвращает клиента, аутентифицированного интерцептором
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// AuthInterceptor проверяет JWT и ключи доступа во входящих вызовах и
+// применяет правила доступа из опции (payment.v1.auth) методов proto.
+type AuthInterceptor struct {
+	authService *service.AuthService
+	rules       map[string]*pb.AuthRule
+	identities  tlsconfig.Identities
+}
+
+// NewAuthInterceptor создает интерцептор с правилами всех методов,
+// зарегистрированных в protoregistry. identities перечисляет внутренние
+// сервисы, аутентифицируемые по клиентскому сертификату mTLS.
+func NewAuthInterceptor(authService *service.AuthService, identities tlsconfig.Identities) *AuthInterceptor {
+	return &AuthInterceptor{
+		authService: authService,
+		rules:       loadAuthRules(),
+		identities:  identities,
+	}
+}
+
+// Unary возвращает интерцептор унарных вызовов
+func (a *AuthInterceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream возвращает интерцептор потоковых вызовов
+func (a *AuthInterceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authorize(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// authorize аутентифицирует клиента и проверяет правило метода.
+// Метод без правила закрыт для всех, чтобы забытая опция не открывала его.
+func (a *AuthInterceptor) authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	rule, ok := a.rules[fullMethod]
+	if !ok {
+		return nil, status.Error(codes.PermissionDenied, "method has no access rule")
+	}
+	if rule.GetPublic() {
+		return ctx, nil
+	}
+
+	principal, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if roles := rule.GetRoles(); len(roles) > 0 && !containsRole(roles, principal.Roles) {
+		return nil, status.Error(codes.PermissionDenied, "insufficient permissions")
+	}
+
+	if required := rule.GetPermissions(); len(required) > 0 {
+		// Разрешения клиента объединяются по всем его ролям
+		var permissions []string
+		for _, role := range principal.Roles {
+			granted, err := a.authService.GetUserPermissions(role)
+			if err != nil {
+				return nil, status.Error(codes.Internal, "failed to get permissions")
+			}
+			permissions = append(permissions, granted...)
+		}
+		for _, permission := range required {
+			if !contains(permissions, permission) {
+				return nil, status.Error(codes.PermissionDenied, "insufficient permissions")
+			}
+		}
+	}
+
+	return context.WithValue(ctx, principalKey{}, principal), nil
+}
+
+// authenticate определяет клиента по клиентскому сертификату mTLS, по
+// заголовку x-api-key или по заголовку authorization с JWT
+func (a *AuthInterceptor) authenticate(ctx context.Context) (*Principal, error) {
+	if principal := a.authenticateCertificate(ctx); principal != nil {
+		return principal, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if keys := md.Get(apiKeyHeader); len(keys) > 0 {
+		apiKey, err := a.authService.ValidateAPIKey(ctx, keys[0])
+		if errors.Is(err, service.ErrInvalidAPIKey) {
+			return nil, status.Error(codes.Unauthenticated, "invalid api key")
+		}
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to validate api key")
+		}
+		return &Principal{Roles: []models.Role{apiKey.Role}, APIKeyID: apiKey.ID}, nil
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "no authorization metadata")
+	}
+
+	tokenParts := strings.Split(values[0], " ")
+	if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+		return nil, status.Error(codes.Unauthenticated, "invalid authorization metadata")
+	}
+
+	token, err := a.authService.ValidateToken(tokenParts[1])
+	if err != nil || !token.Valid {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "invalid token claims")
+	}
+
+	principal := &Principal{}
+	principal.Email, _ = claims["email"].(string)
+	if role, ok := claims["role"].(string); ok {
+		principal.Roles = []models.Role{models.Role(role)}
+	}
+	switch v := claims["user_id"].(type) {
+	case string:
+		principal.UserID = v
+	case float64:
+		// Числовые claims JWT разбираются как float64
+		principal.UserID = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return principal, nil
+}
+
+// authenticateCertificate сопоставляет проверенный клиентский сертификат с
+// внутренним сервисом. Сертификат без сопоставления не дает прав, и клиент
+// аутентифицируется по заголовкам.
+func (a *AuthInterceptor) authenticateCertificate(ctx context.Context) *Principal {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return nil
+	}
+
+	identity, ok := a.identities.Lookup(tlsInfo.State)
+	if !ok {
+		return nil
+	}
+	principal := &Principal{Service: identity.Name}
+	for _, role := range identity.Roles {
+		principal.Roles = append(principal.Roles, models.Role(role))
+	}
+	return principal
+}
+
+// authenticatedStream подменяет контекст потока контекстом с клиентом
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// loadAuthRules собирает правила доступа методов всех зарегистрированных
+// сервисов по полному имени метода вида /package.Service/Method
+func loadAuthRules() map[string]*pb.AuthRule {
+	rules := make(map[string]*pb.AuthRule)
+	protoregistry.GlobalFiles.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			methods := services.Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				method := methods.Get(j)
+				rule, ok := proto.GetExtension(method.Options(), pb.E_Auth).(*pb.AuthRule)
+				if !ok || rule == nil {
+					continue
+				}
+				rules["/"+string(services.Get(i).FullName())+"/"+string(method.Name())] = rule
+			}
+		}
+		return true
+	})
+
+	// Health сервис опрашивается пробами Kubernetes без учетных данных
+	rules[healthpb.Health_Check_FullMethodName] = &pb.AuthRule{Public: true}
+	rules[healthpb.Health_Watch_FullMethodName] = &pb.AuthRule{Public: true}
+	// Reflection доступен любому аутентифицированному клиенту
+	rules[reflectionpb.ServerReflection_ServerReflectionInfo_FullMethodName] = &pb.AuthRule{}
+	rules[reflectionalphapb.ServerReflection_ServerReflectionInfo_FullMethodName] = &pb.AuthRule{}
+	return rules
+}
+
+// containsRole проверяет, входит ли одна из ролей клиента в список
+func containsRole(roles []string, granted []models.Role) bool {
+	for _, role := range granted {
+		if contains(roles, string(role)) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains проверяет, входит ли значение в список
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
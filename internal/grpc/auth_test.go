@@ -0,0 +1,296 @@
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	pb "go_payment/api/proto/payment/v1"
+	"go_payment/internal/models"
+	"go_payment/internal/service"
+	"go_payment/internal/tlsconfig"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	testJWTSecret = "secret"
+
+	refundMethod  = "/payment.v1.PaymentService/RefundPayment"
+	listMethod    = "/payment.v1.PaymentService/ListPayments"
+	missingMethod = "/payment.v1.PaymentService/Unannotated"
+)
+
+// authDB открывает базу в режиме DryRun. Выборка ключа доступа возвращает
+// apiKey, выборка разрешений — permissions.
+func authDB(t *testing.T, apiKey *models.APIKey, permissions ...string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+
+	err = db.Callback().Query().After("gorm:query").Register("test:rows", func(tx *gorm.DB) {
+		switch dest := tx.Statement.Dest.(type) {
+		case *models.APIKey:
+			if apiKey == nil {
+				tx.AddError(gorm.ErrRecordNotFound)
+				return
+			}
+			*dest = *apiKey
+		case *[]models.Permission:
+			for _, name := range permissions {
+				*dest = append(*dest, models.Permission{Name: name})
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	return db
+}
+
+// bearer возвращает метаданные с JWT, подписанным secret
+func bearer(t *testing.T, secret string, claims jwt.MapClaims) metadata.MD {
+	t.Helper()
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("SignedString() error = %v", err)
+	}
+	return metadata.Pairs("authorization", "Bearer "+token)
+}
+
+// withCertificate добавляет в контекст TLS соединение с клиентским
+// сертификатом commonName. Непроверенный сертификат попадает только в
+// PeerCertificates.
+func withCertificate(ctx context.Context, commonName string, verified bool) context.Context {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if verified {
+		state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestAuthInterceptorUnary(t *testing.T) {
+	rules := map[string]*pb.AuthRule{
+		refundMethod:                         {Roles: []string{"admin"}},
+		listMethod:                           {Roles: []string{"admin", "manager"}, Permissions: []string{"payments:read"}},
+		healthpb.Health_Check_FullMethodName: {Public: true},
+		healthpb.Health_Watch_FullMethodName: {Public: true},
+	}
+	identities := tlsconfig.NewIdentities([]tlsconfig.Identity{{CommonName: "ledger.internal", Name: "ledger", Roles: []string{"admin"}}})
+
+	admin := jwt.MapClaims{"user_id": float64(7), "email": "admin@example.com", "role": "admin"}
+	manager := jwt.MapClaims{"user_id": "u-2", "email": "manager@example.com", "role": "manager"}
+	expired := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name          string
+		method        string
+		md            metadata.MD
+		certificate   string
+		unverified    bool
+		apiKey        *models.APIKey
+		permissions   []string
+		wantCode      codes.Code
+		wantPrincipal *Principal
+	}{
+		{
+			name:     "method without a rule is denied",
+			method:   missingMethod,
+			md:       bearer(t, testJWTSecret, admin),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:        "method without a rule is denied for services",
+			method:      missingMethod,
+			md:          metadata.MD{},
+			certificate: "ledger.internal",
+			wantCode:    codes.PermissionDenied,
+		},
+		{name: "health check is public", method: healthpb.Health_Check_FullMethodName},
+		{name: "health watch is public", method: healthpb.Health_Watch_FullMethodName},
+		{name: "no credentials", method: refundMethod, wantCode: codes.Unauthenticated},
+		{
+			name:          "jwt with an allowed role",
+			method:        refundMethod,
+			md:            bearer(t, testJWTSecret, admin),
+			wantPrincipal: &Principal{UserID: "7", Email: "admin@example.com", Roles: []models.Role{models.RoleAdmin}},
+		},
+		{
+			name:     "jwt with another role",
+			method:   refundMethod,
+			md:       bearer(t, testJWTSecret, manager),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "jwt signed with another secret",
+			method:   refundMethod,
+			md:       bearer(t, "other", admin),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "authorization without bearer",
+			method:   refundMethod,
+			md:       metadata.Pairs("authorization", "Token abc"),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:          "jwt with the required permission",
+			method:        listMethod,
+			md:            bearer(t, testJWTSecret, manager),
+			permissions:   []string{"payments:read"},
+			wantPrincipal: &Principal{UserID: "u-2", Email: "manager@example.com", Roles: []models.Role{models.RoleManager}},
+		},
+		{
+			name:     "jwt without the required permission",
+			method:   listMethod,
+			md:       bearer(t, testJWTSecret, manager),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:          "api key",
+			method:        refundMethod,
+			md:            metadata.Pairs(apiKeyHeader, "gp_admin"),
+			apiKey:        &models.APIKey{ID: "key-1", Role: models.RoleAdmin},
+			wantPrincipal: &Principal{Roles: []models.Role{models.RoleAdmin}, APIKeyID: "key-1"},
+		},
+		{
+			name:     "api key takes precedence over jwt",
+			method:   refundMethod,
+			md:       metadata.Join(metadata.Pairs(apiKeyHeader, "gp_manager"), bearer(t, testJWTSecret, admin)),
+			apiKey:   &models.APIKey{ID: "key-2", Role: models.RoleManager},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "revoked api key",
+			method:   refundMethod,
+			md:       metadata.Pairs(apiKeyHeader, "gp_revoked"),
+			apiKey:   &models.APIKey{ID: "key-3", Role: models.RoleAdmin, RevokedAt: &expired},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "unknown api key",
+			method:   refundMethod,
+			md:       metadata.Pairs(apiKeyHeader, "gp_unknown"),
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:     "api key without the prefix",
+			method:   refundMethod,
+			md:       metadata.Pairs(apiKeyHeader, "admin"),
+			apiKey:   &models.APIKey{ID: "key-1", Role: models.RoleAdmin},
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:          "mtls service identity",
+			method:        refundMethod,
+			certificate:   "ledger.internal",
+			wantPrincipal: &Principal{Service: "ledger", Roles: []models.Role{models.RoleAdmin}},
+		},
+		{
+			name:          "mtls identity takes precedence over jwt",
+			method:        refundMethod,
+			md:            bearer(t, testJWTSecret, manager),
+			certificate:   "ledger.internal",
+			wantPrincipal: &Principal{Service: "ledger", Roles: []models.Role{models.RoleAdmin}},
+		},
+		{
+			name:        "unknown certificate without credentials",
+			method:      refundMethod,
+			certificate: "unknown.internal",
+			wantCode:    codes.Unauthenticated,
+		},
+		{
+			name:          "unknown certificate falls back to jwt",
+			method:        refundMethod,
+			md:            bearer(t, testJWTSecret, admin),
+			certificate:   "unknown.internal",
+			wantPrincipal: &Principal{UserID: "7", Email: "admin@example.com", Roles: []models.Role{models.RoleAdmin}},
+		},
+		{
+			name:        "unverified certificate is ignored",
+			method:      refundMethod,
+			certificate: "ledger.internal",
+			unverified:  true,
+			wantCode:    codes.Unauthenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interceptor := NewAuthInterceptor(service.NewAuthService(authDB(t, tt.apiKey, tt.permissions...), testJWTSecret), identities)
+			interceptor.rules = rules
+
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			if tt.certificate != "" {
+				ctx = withCertificate(ctx, tt.certificate, !tt.unverified)
+			}
+
+			var principal *Principal
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				principal, _ = PrincipalFromContext(ctx)
+				return "ok", nil
+			}
+			_, err := interceptor.Unary()(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("code = %s (%v), want %s", code, err, tt.wantCode)
+			}
+			if !reflect.DeepEqual(principal, tt.wantPrincipal) {
+				t.Errorf("principal = %+v, want %+v", principal, tt.wantPrincipal)
+			}
+		})
+	}
+}
+
+func TestLoadAuthRules(t *testing.T) {
+	rules := loadAuthRules()
+
+	for _, method := range []string{healthpb.Health_Check_FullMethodName, healthpb.Health_Watch_FullMethodName} {
+		if !rules[method].GetPublic() {
+			t.Errorf("%s is not public", method)
+		}
+	}
+	if roles := rules[refundMethod].GetRoles(); !reflect.DeepEqual(roles, []string{"admin"}) {
+		t.Errorf("RefundPayment roles = %v, want [admin]", roles)
+	}
+
+	// Каждый метод API должен объявлять правило: метод без опции закрыт
+	descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName("payment.v1.PaymentService")
+	if err != nil {
+		t.Fatalf("FindDescriptorByName() error = %v", err)
+	}
+	methods := descriptor.(protoreflect.ServiceDescriptor).Methods()
+	for i := 0; i < methods.Len(); i++ {
+		name := "/payment.v1.PaymentService/" + string(methods.Get(i).Name())
+		rule, ok := rules[name]
+		if !ok {
+			t.Errorf("%s has no (payment.v1.auth) option", name)
+			continue
+		}
+		if rule.GetPublic() {
+			t.Errorf("%s is public", name)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package grpc
+
+import (
+	"context"
+	pb "go_payment/api/proto/payment/v1"
+	"go_payment/internal/models"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func (s *PaymentServer) CreateCustomer(ctx context.Context, req *pb.CreateCustomerRequest) (*pb.CreateCustomerResponse, error) {
+	customer := &models.Customer{
+		Email:    req.Email,
+		Name:     req.Name,
+		Phone:    req.Phone,
+		Metadata: convertMetadataToJSON(req.Metadata),
+	}
+	if err := s.customerService.CreateCustomer(ctx, customer); err != nil {
+		return nil, statusError(err, nil)
+	}
+	return &pb.CreateCustomerResponse{Customer: convertCustomerToProto(customer)}, nil
+}
+
+func (s *PaymentServer) GetCustomer(ctx context.Context, req *pb.GetCustomerRequest) (*pb.GetCustomerResponse, error) {
+	customer, err := s.customerService.GetCustomer(ctx, req.CustomerId)
+	if err != nil {
+		return nil, statusError(err, map[string]string{"customer_id": req.CustomerId})
+	}
+	return &pb.GetCustomerResponse{Customer: convertCustomerToProto(customer)}, nil
+}
+
+func (s *PaymentServer) ListCustomers(ctx context.Context, req *pb.ListCustomersRequest) (*pb.ListCustomersResponse, error) {
+	page, err := s.customerService.ListCustomers(ctx, req.Email, int(req.PageSize), req.PageToken)
+	if err != nil {
+		return nil, statusError(err, nil)
+	}
+
+	customers := make([]*pb.Customer, len(page.Customers))
+	for i := range page.Customers {
+		customers[i] = convertCustomerToProto(&page.Customers[i])
+	}
+	return &pb.ListCustomersResponse{
+		Customers:     customers,
+		NextPageToken: page.NextPageToken,
+	}, nil
+}
+
+func (s *PaymentServer) AttachPaymentMethod(ctx context.Context, req *pb.AttachPaymentMethodRequest) (*pb.AttachPaymentMethodResponse, error) {
+	method := &models.PaymentMethod{
+		CustomerID:    req.CustomerId,
+		ProviderType:  convertProviderFromProto(req.Provider),
+		ProviderToken: req.ProviderToken,
+		Type:          convertPaymentMethodTypeFromProto(req.Type),
+		Brand:         req.Brand,
+		Last4:         req.Last4,
+		ExpMonth:      int(req.ExpMonth),
+		ExpYear:       int(req.ExpYear),
+		IsDefault:     req.SetDefault,
+	}
+	if err := s.customerService.AttachPaymentMethod(ctx, method); err != nil {
+		return nil, statusError(err, map[string]string{"customer_id": req.CustomerId})
+	}
+	return &pb.AttachPaymentMethodResponse{PaymentMethod: convertPaymentMethodToProto(method)}, nil
+}
+
+func (s *PaymentServer) ListPaymentMethods(ctx context.Context, req *pb.ListPaymentMethodsRequest) (*pb.ListPaymentMethodsResponse, error) {
+	methods, err := s.customerService.ListPaymentMethods(ctx, req.CustomerId)
+	if err != nil {
+		return nil, statusError(err, map[string]string{"customer_id": req.CustomerId})
+	}
+
+	result := make([]*pb.PaymentMethod, len(methods))
+	for i := range methods {
+		result[i] = convertPaymentMethodToProto(&methods[i])
+	}
+	return &pb.ListPaymentMethodsResponse{PaymentMethods: result}, nil
+}
+
+func (s *PaymentServer) DetachPaymentMethod(ctx context.Context, req *pb.DetachPaymentMethodRequest) (*pb.DetachPaymentMethodResponse, error) {
+	if err := s.customerService.DetachPaymentMethod(ctx, req.CustomerId, req.PaymentMethodId); err != nil {
+		return nil, statusError(err, map[string]string{
+			"customer_id":       req.CustomerId,
+			"payment_method_id": req.PaymentMethodId,
+		})
+	}
+	return &pb.DetachPaymentMethodResponse{}, nil
+}
+
+func convertCustomerToProto(c *models.Customer) *pb.Customer {
+	return &pb.Customer{
+		CustomerId: c.ID,
+		Email:      c.Email,
+		Name:       c.Name,
+		Phone:      c.Phone,
+		Metadata:   convertJSONToMetadata(c.Metadata),
+		CreatedAt:  timestamppb.New(c.CreatedAt),
+	}
+}
+
+// convertPaymentMethodToProto конвертирует способ оплаты, токен провайдера
+// клиентам не передается
+func convertPaymentMethodToProto(m *models.PaymentMethod) *pb.PaymentMethod {
+	return &pb.PaymentMethod{
+		PaymentMethodId: m.ID,
+		CustomerId:      m.CustomerID,
+		Provider:        convertProviderToProto(m.ProviderType),
+		Type:            convertPaymentMethodTypeToProto(m.Type),
+		Brand:           m.Brand,
+		Last4:           m.Last4,
+		ExpMonth:        int32(m.ExpMonth),
+		ExpYear:         int32(m.ExpYear),
+		IsDefault:       m.IsDefault,
+		CreatedAt:       timestamppb.New(m.CreatedAt),
+	}
+}
+
+func convertPaymentMethodTypeToProto(t models.PaymentMethodType) pb.PaymentMethodType {
+	switch t {
+	case models.PaymentMethodTypeCard:
+		return pb.PaymentMethodType_PAYMENT_METHOD_TYPE_CARD
+	case models.PaymentMethodTypePayPal:
+		return pb.PaymentMethodType_PAYMENT_METHOD_TYPE_PAYPAL
+	default:
+		return pb.PaymentMethodType_PAYMENT_METHOD_TYPE_UNSPECIFIED
+	}
+}
+
+func convertPaymentMethodTypeFromProto(t pb.PaymentMethodType) models.PaymentMethodType {
+	switch t {
+	case pb.PaymentMethodType_PAYMENT_METHOD_TYPE_CARD:
+		return models.PaymentMethodTypeCard
+	case pb.PaymentMethodType_PAYMENT_METHOD_TYPE_PAYPAL:
+		return models.PaymentMethodTypePayPal
+	default:
+		return ""
+	}
+}
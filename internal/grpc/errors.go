@@ -0,0 +1,75 @@
+package grpc
+
+import (
+	"errors"
+	pb "go_payment/api/proto/payment/v1"
+	"go_payment/internal/service"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain — домен ошибок в деталях google.rpc.ErrorInfo
+const errorDomain = "payment.v1"
+
+// serviceErrors сопоставляет ошибки сервисов с кодом gRPC и причиной из
+// pb.ErrorReason. Ошибки проверяются по порядку через errors.Is.
+var serviceErrors = []struct {
+	err    error
+	code   codes.Code
+	reason pb.ErrorReason
+}{
+	{service.ErrPaymentNotFound, codes.NotFound, pb.ErrorReason_PAYMENT_NOT_FOUND},
+	{service.ErrRefundNotFound, codes.NotFound, pb.ErrorReason_REFUND_NOT_FOUND},
+	{service.ErrCustomerNotFound, codes.NotFound, pb.ErrorReason_CUSTOMER_NOT_FOUND},
+	{service.ErrPaymentMethodNotFound, codes.NotFound, pb.ErrorReason_PAYMENT_METHOD_NOT_FOUND},
+	{service.ErrWebhookEndpointNotFound, codes.NotFound, pb.ErrorReason_WEBHOOK_ENDPOINT_NOT_FOUND},
+	{service.ErrInvalidPaymentState, codes.FailedPrecondition, pb.ErrorReason_INVALID_PAYMENT_STATE},
+	{service.ErrCaptureNotSupported, codes.FailedPrecondition, pb.ErrorReason_CAPTURE_NOT_SUPPORTED},
+	{service.ErrFeatureDisabled, codes.FailedPrecondition, pb.ErrorReason_FEATURE_DISABLED},
+	{service.ErrRiskRejected, codes.FailedPrecondition, pb.ErrorReason_RISK_REJECTED},
+	{service.ErrInvalidAmount, codes.InvalidArgument, pb.ErrorReason_INVALID_AMOUNT},
+	{service.ErrInvalidPageToken, codes.InvalidArgument, pb.ErrorReason_INVALID_PAGE_TOKEN},
+	{service.ErrInvalidPaymentFilter, codes.InvalidArgument, pb.ErrorReason_INVALID_ARGUMENT},
+	{service.ErrInvalidCustomer, codes.InvalidArgument, pb.ErrorReason_INVALID_ARGUMENT},
+	{service.ErrWebhookURLNotAllowed, codes.InvalidArgument, pb.ErrorReason_INVALID_ARGUMENT},
+	{service.ErrUnsupportedProvider, codes.InvalidArgument, pb.ErrorReason_UNSUPPORTED_PROVIDER},
+	// Повтор отклоненного провайдером платежа небезопасен, поэтому не
+	// Unavailable, который клиенты повторяют автоматически
+	{service.ErrProviderFailed, codes.Internal, pb.ErrorReason_PROVIDER_ERROR},
+}
+
+// statusError преобразует ошибку сервиса в статус gRPC с деталями ErrorInfo.
+// metadata дополняет детали идентификаторами объектов запроса.
+func statusError(err error, metadata map[string]string) error {
+	code, reason := codes.Internal, pb.ErrorReason_ERROR_REASON_UNSPECIFIED
+	for _, e := range serviceErrors {
+		if errors.Is(err, e.err) {
+			code, reason = e.code, e.reason
+			break
+		}
+	}
+	return newStatusError(code, reason, err.Error(), metadata)
+}
+
+// invalidArgument возвращает ошибку проверки поля запроса
+func invalidArgument(field, message string) error {
+	return newStatusError(codes.InvalidArgument, pb.ErrorReason_INVALID_ARGUMENT, field+": "+message, map[string]string{
+		"field": field,
+	})
+}
+
+// newStatusError создает статус с деталями ErrorInfo
+func newStatusError(code codes.Code, reason pb.ErrorReason, message string, metadata map[string]string) error {
+	st := status.New(code, message)
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason.String(),
+		Domain:   errorDomain,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
@@ -0,0 +1,132 @@
+package grpc
+
+import (
+	"context"
+	pb "go_payment/api/proto/payment/v1"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	defaultHealthInterval = 10 * time.Second
+	healthCheckTimeout    = 5 * time.Second
+)
+
+// HealthCheck описывает проверку зависимости сервиса. Статус проверки
+// публикуется в health сервисе под именем Name. Недоступность критичной
+// зависимости переводит PaymentService в NOT_SERVING. Проверки с заданным
+// Group дополнительно сводятся в статус группы: SERVING, пока доступна хотя
+// бы одна зависимость группы. Результат проверки переиспользуется в течение
+// TTL, нулевой TTL проверяет зависимость на каждом интервале.
+type HealthCheck struct {
+	Name     string
+	Critical bool
+	Group    string
+	TTL      time.Duration
+	Check    func(ctx context.Context) error
+}
+
+// healthResult — последний результат проверки
+type healthResult struct {
+	checkedAt time.Time
+	err       error
+}
+
+// HealthReporter периодически выполняет проверки зависимостей и обновляет
+// статусы стандартного сервиса grpc.health.v1
+type HealthReporter struct {
+	server   *health.Server
+	checks   []HealthCheck
+	interval time.Duration
+	// results используется только из горутины проверок
+	results map[string]healthResult
+}
+
+// NewHealthReporter создает новый экземпляр HealthReporter
+func NewHealthReporter(server *health.Server, interval time.Duration, checks ...HealthCheck) *HealthReporter {
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	return &HealthReporter{
+		server:   server,
+		checks:   checks,
+		interval: interval,
+		results:  make(map[string]healthResult),
+	}
+}
+
+// Start выполняет проверки сразу и затем с интервалом до отмены ctx
+func (r *HealthReporter) Start(ctx context.Context) {
+	r.run(ctx)
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				r.run(ctx)
+			}
+		}
+	}()
+}
+
+// run выполняет все проверки и обновляет статусы зависимостей, групп и
+// сервера
+func (r *HealthReporter) run(ctx context.Context) {
+	serving := true
+	groups := make(map[string]bool)
+	for _, check := range r.checks {
+		status := healthpb.HealthCheckResponse_SERVING
+		err := r.check(ctx, check)
+		if err != nil {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+			if check.Critical {
+				serving = false
+			}
+		}
+		if check.Group != "" {
+			groups[check.Group] = groups[check.Group] || err == nil
+		}
+		r.server.SetServingStatus(check.Name, status)
+	}
+
+	for group, up := range groups {
+		r.server.SetServingStatus(group, servingStatus(up))
+	}
+
+	// Статус сервера целиком (пустое имя) не зависит от зависимостей: он
+	// используется liveness пробой, и перезапуск не восстановит базу данных
+	r.server.SetServingStatus(pb.PaymentService_ServiceDesc.ServiceName, servingStatus(serving))
+}
+
+// check выполняет проверку с ограничением по времени или возвращает
+// результат предыдущей проверки, если не истек ее TTL
+func (r *HealthReporter) check(ctx context.Context, check HealthCheck) error {
+	if last, ok := r.results[check.Name]; ok && time.Since(last.checkedAt) < check.TTL {
+		return last.err
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	err := check.Check(checkCtx)
+	if err != nil {
+		log.Printf("Health check %s failed: %v", check.Name, err)
+	}
+	r.results[check.Name] = healthResult{checkedAt: time.Now(), err: err}
+	return err
+}
+
+// servingStatus переводит доступность в статус health сервиса
+func servingStatus(up bool) healthpb.HealthCheckResponse_ServingStatus {
+	if up {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
@@ -0,0 +1,147 @@
+package grpc
+
+import (
+	"context"
+	"go_payment/internal/metrics"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDHeader — заголовок метаданных с идентификатором запроса клиента
+const requestIDHeader = "x-request-id"
+
+// UnaryLoggingInterceptor пишет строку журнала доступа на каждый вызов
+func UnaryLoggingInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logAccess(ctx, logger, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamLoggingInterceptor пишет строку журнала доступа при закрытии потока
+func StreamLoggingInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, stream)
+		logAccess(stream.Context(), logger, info.FullMethod, start, err)
+		return err
+	}
+}
+
+// UnaryMetricsInterceptor записывает длительность и код ответа вызова
+func UnaryMetricsInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		metrics.ObserveGRPCRequest(info.FullMethod, status.Code(err).String(), time.Since(start))
+		return resp, err
+	}
+}
+
+// StreamMetricsInterceptor записывает время жизни и код завершения потока
+func StreamMetricsInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		metrics.GRPCActiveStreams.WithLabelValues(info.FullMethod).Inc()
+		defer metrics.GRPCActiveStreams.WithLabelValues(info.FullMethod).Dec()
+
+		err := handler(srv, stream)
+		metrics.ObserveGRPCRequest(info.FullMethod, status.Code(err).String(), time.Since(start))
+		return err
+	}
+}
+
+// UnaryRecoveryInterceptor превращает панику обработчика в codes.Internal,
+// чтобы она не завершала процесс
+func UnaryRecoveryInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recoverPanic(logger, info.FullMethod, r)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamRecoveryInterceptor превращает панику обработчика потока в codes.Internal
+func StreamRecoveryInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recoverPanic(logger, info.FullMethod, r)
+			}
+		}()
+		return handler(srv, stream)
+	}
+}
+
+// UnaryTimeoutInterceptor ограничивает вызов timeout, если клиент не указал
+// свой deadline. Потоки не ограничиваются: WatchPayment работает, пока
+// клиент не закроет его.
+func UnaryTimeoutInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return handler(ctx, req)
+	}
+}
+
+// recoverPanic журналирует панику со стеком и возвращает ошибку клиенту без
+// внутренних подробностей
+func recoverPanic(logger *slog.Logger, method string, r interface{}) error {
+	metrics.GRPCPanics.WithLabelValues(method).Inc()
+	logger.Error("grpc handler panic",
+		slog.String("method", method),
+		slog.Any("panic", r),
+		slog.String("stack", string(debug.Stack())),
+	)
+	return status.Error(codes.Internal, "internal server error")
+}
+
+// logAccess пишет строку журнала доступа. Ошибки сервера журналируются с
+// уровнем Error, ошибки клиента с уровнем Warn.
+func logAccess(ctx context.Context, logger *slog.Logger, method string, start time.Time, err error) {
+	st := status.Convert(err)
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("code", st.Code().String()),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		attrs = append(attrs, slog.String("peer", p.Addr.String()))
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDHeader); len(ids) > 0 {
+			attrs = append(attrs, slog.String("request_id", ids[0]))
+		}
+		if agents := md.Get("user-agent"); len(agents) > 0 {
+			attrs = append(attrs, slog.String("user_agent", agents[0]))
+		}
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", st.Message()))
+	}
+
+	level := slog.LevelInfo
+	switch st.Code() {
+	case codes.OK, codes.Canceled:
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable, codes.DeadlineExceeded:
+		level = slog.LevelError
+	default:
+		level = slog.LevelWarn
+	}
+	logger.LogAttrs(ctx, level, "grpc request", attrs...)
+}
@@ -0,0 +1,70 @@
+package grpc
+
+import (
+	"context"
+	pb "go_payment/api/proto/payment/v1"
+	"go_payment/internal/ratelimit"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+)
+
+// UnaryRateLimitInterceptor ограничивает частоту вызовов клиента. Должен
+// следовать за аутентификацией, чтобы запросы шлюза REST API учитывались
+// по пользователю, а не по адресу шлюза.
+func UnaryRateLimitInterceptor(limiter *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := allowCall(ctx, limiter, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamRateLimitInterceptor ограничивает частоту открытия потоков клиента
+func StreamRateLimitInterceptor(limiter *ratelimit.Limiter) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := allowCall(stream.Context(), limiter, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, stream)
+	}
+}
+
+// allowCall расходует токен клиента вызова. Пробы health сервиса не
+// ограничиваются.
+func allowCall(ctx context.Context, limiter *ratelimit.Limiter, fullMethod string) error {
+	if fullMethod == healthpb.Health_Check_FullMethodName || fullMethod == healthpb.Health_Watch_FullMethodName {
+		return nil
+	}
+	if limiter.Allow(rateLimitKey(ctx)) {
+		return nil
+	}
+	return newStatusError(codes.ResourceExhausted, pb.ErrorReason_RATE_LIMITED, "rate limit exceeded", nil)
+}
+
+// rateLimitKey определяет клиента вызова: сервис, ключ доступа,
+// пользователь или, для публичных методов, адрес
+func rateLimitKey(ctx context.Context) string {
+	if principal, ok := PrincipalFromContext(ctx); ok {
+		switch {
+		case principal.Service != "":
+			return "service:" + principal.Service
+		case principal.APIKeyID != "":
+			return "key:" + principal.APIKeyID
+		case principal.UserID != "":
+			return "user:" + principal.UserID
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		return "ip:" + host
+	}
+	return ""
+}
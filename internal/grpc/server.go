@@ -4,92 +4,309 @@ import (
 	"context"
 	pb "go_payment/api/proto/payment/v1"
 	"go_payment/internal/models"
+	"go_payment/internal/payment"
 	"go_payment/internal/service"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/timestamppb"
+	"math"
+	"time"
 )
 
+// defaultWatchHeartbeat — интервал heartbeat потоков статусов по умолчанию
+const defaultWatchHeartbeat = 15 * time.Second
+
 type PaymentServer struct {
 	pb.UnimplementedPaymentServiceServer
-	paymentService *service.PaymentService
+	paymentService    *service.PaymentService
+	customerService   *service.CustomerService
+	webhookService    *service.WebhookService
+	watcher           *service.PaymentWatcher
+	heartbeatInterval time.Duration
 }
 
-func NewPaymentServer(paymentService *service.PaymentService) *PaymentServer {
+func NewPaymentServer(paymentService *service.PaymentService, customerService *service.CustomerService, webhookService *service.WebhookService, watcher *service.PaymentWatcher, heartbeatInterval time.Duration) *PaymentServer {
+	if heartbeatInterval <= 0 {
+		heartbeatInterval = defaultWatchHeartbeat
+	}
 	return &PaymentServer{
-		paymentService: paymentService,
+		paymentService:    paymentService,
+		customerService:   customerService,
+		webhookService:    webhookService,
+		watcher:           watcher,
+		heartbeatInterval: heartbeatInterval,
 	}
 }
 
 func (s *PaymentServer) CreatePayment(ctx context.Context, req *pb.CreatePaymentRequest) (*pb.CreatePaymentResponse, error) {
+	if req.OrderId == "" {
+		return nil, invalidArgument("order_id", "is required")
+	}
 	// Конвертируем gRPC запрос в модель платежа
-	payment := &models.Payment{
+	p := &models.Payment{
 		OrderID:       req.OrderId,
 		Amount:        req.Amount,
 		Currency:      req.Currency,
 		CustomerID:    req.CustomerId,
 		CustomerEmail: req.CustomerEmail,
 		Description:   req.Description,
-		MetaData:      convertMetadataToJSON(req.Metadata),
-		Provider:      models.PaymentProvider(req.Provider.String()),
+		Metadata:      convertMetadataToJSON(req.Metadata),
+		ProviderType:  convertProviderFromProto(req.Provider),
+		CaptureMethod: convertCaptureMethodFromProto(req.CaptureMethod),
+		Status:        models.PaymentStatusPending,
 	}
 
 	// Обрабатываем платеж через сервис
-	result, err := s.paymentService.ProcessPayment(ctx, payment)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to process payment: %v", err)
+	if err := s.paymentService.ProcessPayment(ctx, p); err != nil {
+		return nil, statusError(err, map[string]string{"order_id": req.OrderId})
 	}
 
-	// Конвертируем результат обратно в gRPC ответ
 	return &pb.CreatePaymentResponse{
-		Payment: convertPaymentToProto(result),
+		Payment: convertPaymentToProto(p),
 	}, nil
 }
 
 func (s *PaymentServer) GetPayment(ctx context.Context, req *pb.GetPaymentRequest) (*pb.GetPaymentResponse, error) {
-	payment, err := s.paymentService.GetPayment(req.OrderId)
+	p, err := s.paymentService.GetPayment(req.OrderId)
 	if err != nil {
-		return nil, status.Errorf(codes.NotFound, "payment not found: %v", err)
+		return nil, statusError(err, map[string]string{"order_id": req.OrderId})
 	}
 
 	return &pb.GetPaymentResponse{
-		Payment: convertPaymentToProto(payment),
+		Payment: convertPaymentToProto(p),
 	}, nil
 }
 
 func (s *PaymentServer) RefundPayment(ctx context.Context, req *pb.RefundPaymentRequest) (*pb.RefundPaymentResponse, error) {
-	err := s.paymentService.RefundPayment(ctx, req.OrderId)
+	metadata := map[string]string{"order_id": req.OrderId}
+	p, err := s.paymentService.GetPayment(req.OrderId)
+	if err != nil {
+		return nil, statusError(err, metadata)
+	}
+
+	refund, err := s.paymentService.RefundPayment(ctx, p, req.Amount, req.Reason)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to refund payment: %v", err)
+		return nil, statusError(err, metadata)
 	}
 
 	return &pb.RefundPaymentResponse{
-		RefundId:   "ref_" + req.OrderId, // В реальном приложении генерировать уникальный ID
-		Status:     pb.PaymentStatus_PAYMENT_STATUS_SUCCESS,
-		RefundDate: timestamppb.Now(),
+		RefundId:   refund.ID,
+		Status:     convertStatusToProto(p.Status),
+		RefundDate: timestamppb.New(refund.RefundedAt),
+		Refund:     convertRefundToProto(refund),
+		Payment:    convertPaymentToProto(p),
+	}, nil
+}
+
+func (s *PaymentServer) CapturePayment(ctx context.Context, req *pb.CapturePaymentRequest) (*pb.CapturePaymentResponse, error) {
+	metadata := map[string]string{"order_id": req.OrderId}
+	p, err := s.paymentService.GetPayment(req.OrderId)
+	if err != nil {
+		return nil, statusError(err, metadata)
+	}
+
+	if err := s.paymentService.CapturePayment(ctx, p, req.Amount); err != nil {
+		return nil, statusError(err, metadata)
+	}
+
+	return &pb.CapturePaymentResponse{
+		Payment: convertPaymentToProto(p),
+	}, nil
+}
+
+func (s *PaymentServer) VoidPayment(ctx context.Context, req *pb.VoidPaymentRequest) (*pb.VoidPaymentResponse, error) {
+	metadata := map[string]string{"order_id": req.OrderId}
+	p, err := s.paymentService.GetPayment(req.OrderId)
+	if err != nil {
+		return nil, statusError(err, metadata)
+	}
+
+	if err := s.paymentService.VoidPayment(ctx, p); err != nil {
+		return nil, statusError(err, metadata)
+	}
+
+	return &pb.VoidPaymentResponse{
+		Payment: convertPaymentToProto(p),
 	}, nil
 }
 
+func (s *PaymentServer) ListRefunds(ctx context.Context, req *pb.ListRefundsRequest) (*pb.ListRefundsResponse, error) {
+	refunds, err := s.paymentService.ListRefunds(ctx, req.OrderId)
+	if err != nil {
+		return nil, statusError(err, map[string]string{"order_id": req.OrderId})
+	}
+
+	result := make([]*pb.Refund, len(refunds))
+	for i := range refunds {
+		result[i] = convertRefundToProto(&refunds[i])
+	}
+	return &pb.ListRefundsResponse{Refunds: result}, nil
+}
+
+func (s *PaymentServer) GetRefund(ctx context.Context, req *pb.GetRefundRequest) (*pb.GetRefundResponse, error) {
+	refund, err := s.paymentService.GetRefund(ctx, req.RefundId)
+	if err != nil {
+		return nil, statusError(err, map[string]string{"refund_id": req.RefundId})
+	}
+	return &pb.GetRefundResponse{Refund: convertRefundToProto(refund)}, nil
+}
+
 func (s *PaymentServer) ListPayments(ctx context.Context, req *pb.ListPaymentsRequest) (*pb.ListPaymentsResponse, error) {
-	// TODO: Реализовать получение списка платежей с фильтрацией
-	return nil, status.Errorf(codes.Unimplemented, "method ListPayments not implemented")
+	filter := service.PaymentFilter{
+		Status:        convertStatusFromProto(req.Status),
+		Provider:      convertProviderFromProto(req.Provider),
+		CustomerID:    req.CustomerId,
+		Currency:      req.Currency,
+		MinAmount:     req.MinAmount,
+		MaxAmount:     req.MaxAmount,
+		MetadataKey:   req.MetadataKey,
+		MetadataValue: req.MetadataValue,
+		PageSize:      int(req.PageSize),
+		PageToken:     req.PageToken,
+	}
+	if req.StartDate != nil {
+		from := req.StartDate.AsTime()
+		filter.From = &from
+	}
+	if req.EndDate != nil {
+		to := req.EndDate.AsTime()
+		filter.To = &to
+	}
+
+	page, err := s.paymentService.ListPayments(ctx, filter)
+	if err != nil {
+		return nil, statusError(err, nil)
+	}
+
+	payments := make([]*pb.Payment, len(page.Payments))
+	for i := range page.Payments {
+		payments[i] = convertPaymentToProto(&page.Payments[i])
+	}
+
+	return &pb.ListPaymentsResponse{
+		Payments:            payments,
+		NextPageToken:       page.NextPageToken,
+		TotalCount:          int32(min(page.TotalCount, math.MaxInt32)),
+		TotalCountEstimated: page.TotalCountEstimated,
+	}, nil
+}
+
+func (s *PaymentServer) WatchPayment(req *pb.WatchPaymentRequest, stream pb.PaymentService_WatchPaymentServer) error {
+	if req.OrderId == "" {
+		return invalidArgument("order_id", "is required")
+	}
+	if _, err := s.paymentService.GetPayment(req.OrderId); err != nil {
+		return statusError(err, map[string]string{"order_id": req.OrderId})
+	}
+
+	filter := service.PaymentWatchFilter{OrderID: req.OrderId}
+	return s.watch(stream.Context(), stream, filter, req.AfterSequence, true)
+}
+
+func (s *PaymentServer) WatchPayments(req *pb.WatchPaymentsRequest, stream pb.PaymentService_WatchPaymentsServer) error {
+	filter := service.PaymentWatchFilter{
+		CustomerID: req.CustomerId,
+		Status:     convertStatusFromProto(req.Status),
+		Provider:   convertProviderFromProto(req.Provider),
+	}
+	// Без after_sequence история всех платежей не передается
+	return s.watch(stream.Context(), stream, filter, req.AfterSequence, req.AfterSequence > 0)
+}
+
+// paymentEventStream — общий интерфейс потоков WatchPayment и WatchPayments
+type paymentEventStream interface {
+	Send(*pb.PaymentEvent) error
+}
+
+// watch передает историю статусов после afterSequence, если replay, а затем
+// живые изменения с heartbeat при их отсутствии
+func (s *PaymentServer) watch(ctx context.Context, stream paymentEventStream, filter service.PaymentWatchFilter, afterSequence uint64, replay bool) error {
+	sub := s.watcher.Watch(filter, afterSequence)
+	defer sub.Close()
+
+	last := afterSequence
+	if replay {
+		var err error
+		last, err = sub.Replay(ctx, func(event *models.PaymentStatusEvent) error {
+			return stream.Send(convertStatusEventToProto(event, true))
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return status.FromContextError(ctx.Err()).Err()
+			}
+			return status.Errorf(codes.Internal, "failed to replay payment status history: %v", err)
+		}
+	}
+	// Живые события, уже переданные из истории, пропускаются
+	replayed := last
+
+	heartbeat := time.NewTicker(s.heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-sub.Events():
+			if !ok {
+				return status.Errorf(codes.Aborted, "%v: last sequence %d", sub.Err(), last)
+			}
+			if event.Sequence <= replayed {
+				continue
+			}
+			if err := stream.Send(convertStatusEventToProto(event, false)); err != nil {
+				return err
+			}
+			if event.Sequence > last {
+				last = event.Sequence
+			}
+		case <-heartbeat.C:
+			err := stream.Send(&pb.PaymentEvent{
+				Event: &pb.PaymentEvent_Heartbeat{
+					Heartbeat: &pb.Heartbeat{
+						LastSequence: last,
+						SentAt:       timestamppb.Now(),
+					},
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
 }
 
 // Вспомогательные функции для конвертации типов
 func convertPaymentToProto(p *models.Payment) *pb.Payment {
 	return &pb.Payment{
-		OrderId:       p.OrderID,
-		Amount:        p.Amount,
-		Currency:      p.Currency,
-		Status:        convertStatusToProto(p.Status),
-		Provider:      convertProviderToProto(p.Provider),
-		ProviderTxnId: p.ProviderTxnID,
-		CustomerId:    p.CustomerID,
-		CustomerEmail: p.CustomerEmail,
-		Description:   p.Description,
-		ErrorMessage:  p.ErrorMessage,
-		Metadata:      convertJSONToMetadata(p.MetaData),
-		PaymentDate:   timestamppb.New(p.PaymentDate),
+		OrderId:        p.OrderID,
+		Amount:         p.Amount,
+		Currency:       p.Currency,
+		Status:         convertStatusToProto(p.Status),
+		Provider:       convertProviderToProto(p.ProviderType),
+		ProviderTxnId:  p.TransactionID,
+		CustomerId:     p.CustomerID,
+		CustomerEmail:  p.CustomerEmail,
+		Description:    p.Description,
+		ErrorMessage:   p.ErrorMessage,
+		Metadata:       convertJSONToMetadata(p.Metadata),
+		PaymentDate:    timestamppb.New(p.CreatedAt),
+		CaptureMethod:  convertCaptureMethodToProto(p.CaptureMethod),
+		CapturedAmount: p.CapturedAmount,
+		RefundedAmount: p.RefundedAmount,
+		UpdatedAt:      timestamppb.New(p.UpdatedAt),
+	}
+}
+
+func convertRefundToProto(r *models.Refund) *pb.Refund {
+	return &pb.Refund{
+		RefundId:   r.ID,
+		OrderId:    r.OrderID,
+		Amount:     r.Amount,
+		Currency:   r.Currency,
+		Status:     convertRefundStatusToProto(r.Status),
+		Reason:     r.Reason,
+		RefundedAt: timestamppb.New(r.RefundedAt),
 	}
 }
 
@@ -97,28 +314,129 @@ func convertStatusToProto(status models.PaymentStatus) pb.PaymentStatus {
 	switch status {
 	case models.PaymentStatusPending:
 		return pb.PaymentStatus_PAYMENT_STATUS_PENDING
-	case models.PaymentStatusSuccess:
+	case models.PaymentStatusCompleted:
 		return pb.PaymentStatus_PAYMENT_STATUS_SUCCESS
 	case models.PaymentStatusFailed:
 		return pb.PaymentStatus_PAYMENT_STATUS_FAILED
 	case models.PaymentStatusCancelled:
 		return pb.PaymentStatus_PAYMENT_STATUS_CANCELLED
+	case models.PaymentStatusAuthorized:
+		return pb.PaymentStatus_PAYMENT_STATUS_AUTHORIZED
+	case models.PaymentStatusRefunded:
+		return pb.PaymentStatus_PAYMENT_STATUS_REFUNDED
+	case models.PaymentStatusPartiallyRefunded:
+		return pb.PaymentStatus_PAYMENT_STATUS_PARTIALLY_REFUNDED
+	case models.PaymentStatusDisputed:
+		return pb.PaymentStatus_PAYMENT_STATUS_DISPUTED
+	case models.PaymentStatusChargedBack:
+		return pb.PaymentStatus_PAYMENT_STATUS_CHARGED_BACK
 	default:
 		return pb.PaymentStatus_PAYMENT_STATUS_UNSPECIFIED
 	}
 }
 
-func convertProviderToProto(provider models.PaymentProvider) pb.PaymentProvider {
+func convertRefundStatusToProto(status models.RefundStatus) pb.RefundStatus {
+	switch status {
+	case models.RefundStatusPending:
+		return pb.RefundStatus_REFUND_STATUS_PENDING
+	case models.RefundStatusCompleted:
+		return pb.RefundStatus_REFUND_STATUS_COMPLETED
+	case models.RefundStatusFailed:
+		return pb.RefundStatus_REFUND_STATUS_FAILED
+	default:
+		return pb.RefundStatus_REFUND_STATUS_UNSPECIFIED
+	}
+}
+
+func convertCaptureMethodToProto(method models.CaptureMethod) pb.CaptureMethod {
+	switch method {
+	case models.CaptureMethodAutomatic:
+		return pb.CaptureMethod_CAPTURE_METHOD_AUTOMATIC
+	case models.CaptureMethodManual:
+		return pb.CaptureMethod_CAPTURE_METHOD_MANUAL
+	default:
+		return pb.CaptureMethod_CAPTURE_METHOD_UNSPECIFIED
+	}
+}
+
+// convertCaptureMethodFromProto конвертирует способ списания. Неуказанный
+// способ означает автоматическое списание.
+func convertCaptureMethodFromProto(method pb.CaptureMethod) models.CaptureMethod {
+	if method == pb.CaptureMethod_CAPTURE_METHOD_MANUAL {
+		return models.CaptureMethodManual
+	}
+	return models.CaptureMethodAutomatic
+}
+
+func convertProviderToProto(provider payment.ProviderType) pb.PaymentProvider {
 	switch provider {
-	case models.PaymentProviderStripe:
+	case payment.ProviderStripe:
 		return pb.PaymentProvider_PAYMENT_PROVIDER_STRIPE
-	case models.PaymentProviderPayPal:
+	case payment.ProviderPayPal:
 		return pb.PaymentProvider_PAYMENT_PROVIDER_PAYPAL
 	default:
 		return pb.PaymentProvider_PAYMENT_PROVIDER_UNSPECIFIED
 	}
 }
 
+func convertStatusEventToProto(event *models.PaymentStatusEvent, replay bool) *pb.PaymentEvent {
+	return &pb.PaymentEvent{
+		Event: &pb.PaymentEvent_StatusChange{
+			StatusChange: &pb.PaymentStatusChange{
+				Sequence:   event.Sequence,
+				OrderId:    event.OrderID,
+				OldStatus:  convertStatusToProto(event.OldStatus),
+				NewStatus:  convertStatusToProto(event.NewStatus),
+				CustomerId: event.CustomerID,
+				Provider:   convertProviderToProto(event.Provider),
+				Amount:     event.Amount,
+				Currency:   event.Currency,
+				ChangedAt:  timestamppb.New(event.CreatedAt),
+				Replay:     replay,
+			},
+		},
+	}
+}
+
+// convertStatusFromProto конвертирует статус фильтра. Неуказанный статус
+// не ограничивает выборку.
+func convertStatusFromProto(status pb.PaymentStatus) models.PaymentStatus {
+	switch status {
+	case pb.PaymentStatus_PAYMENT_STATUS_PENDING:
+		return models.PaymentStatusPending
+	case pb.PaymentStatus_PAYMENT_STATUS_SUCCESS:
+		return models.PaymentStatusCompleted
+	case pb.PaymentStatus_PAYMENT_STATUS_FAILED:
+		return models.PaymentStatusFailed
+	case pb.PaymentStatus_PAYMENT_STATUS_CANCELLED:
+		return models.PaymentStatusCancelled
+	case pb.PaymentStatus_PAYMENT_STATUS_AUTHORIZED:
+		return models.PaymentStatusAuthorized
+	case pb.PaymentStatus_PAYMENT_STATUS_REFUNDED:
+		return models.PaymentStatusRefunded
+	case pb.PaymentStatus_PAYMENT_STATUS_PARTIALLY_REFUNDED:
+		return models.PaymentStatusPartiallyRefunded
+	case pb.PaymentStatus_PAYMENT_STATUS_DISPUTED:
+		return models.PaymentStatusDisputed
+	case pb.PaymentStatus_PAYMENT_STATUS_CHARGED_BACK:
+		return models.PaymentStatusChargedBack
+	default:
+		return ""
+	}
+}
+
+// convertProviderFromProto конвертирует провайдера фильтра
+func convertProviderFromProto(provider pb.PaymentProvider) payment.ProviderType {
+	switch provider {
+	case pb.PaymentProvider_PAYMENT_PROVIDER_STRIPE:
+		return payment.ProviderStripe
+	case pb.PaymentProvider_PAYMENT_PROVIDER_PAYPAL:
+		return payment.ProviderPayPal
+	default:
+		return ""
+	}
+}
+
 func convertMetadataToJSON(metadata map[string]string) models.JSON {
 	result := make(models.JSON)
 	for k, v := range metadata {
@@ -0,0 +1,150 @@
+package grpc
+
+import (
+	"context"
+	pb "go_payment/api/proto/payment/v1"
+	"go_payment/internal/models"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Размер страницы журнала доставки вебхуков
+const (
+	defaultDeliveryPageSize = 50
+	maxDeliveryPageSize     = 500
+)
+
+func (s *PaymentServer) RegisterWebhookEndpoint(ctx context.Context, req *pb.RegisterWebhookEndpointRequest) (*pb.RegisterWebhookEndpointResponse, error) {
+	if req.Url == "" {
+		return nil, invalidArgument("url", "is required")
+	}
+
+	endpoint := &models.WebhookEndpoint{
+		URL:         req.Url,
+		Secret:      req.Secret,
+		Description: req.Description,
+		EventTypes:  req.EventTypes,
+	}
+	if err := s.webhookService.RegisterEndpoint(ctx, endpoint); err != nil {
+		return nil, statusError(err, nil)
+	}
+	return &pb.RegisterWebhookEndpointResponse{
+		Endpoint: convertWebhookEndpointToProto(endpoint),
+		Secret:   endpoint.Secret,
+	}, nil
+}
+
+func (s *PaymentServer) ListWebhookEndpoints(ctx context.Context, req *pb.ListWebhookEndpointsRequest) (*pb.ListWebhookEndpointsResponse, error) {
+	endpoints, err := s.webhookService.ListEndpoints(ctx)
+	if err != nil {
+		return nil, statusError(err, nil)
+	}
+
+	result := make([]*pb.WebhookEndpoint, len(endpoints))
+	for i := range endpoints {
+		result[i] = convertWebhookEndpointToProto(&endpoints[i])
+	}
+	return &pb.ListWebhookEndpointsResponse{Endpoints: result}, nil
+}
+
+func (s *PaymentServer) GetWebhookEndpoint(ctx context.Context, req *pb.GetWebhookEndpointRequest) (*pb.GetWebhookEndpointResponse, error) {
+	endpoint, err := s.webhookService.GetEndpoint(ctx, req.EndpointId)
+	if err != nil {
+		return nil, statusError(err, map[string]string{"endpoint_id": req.EndpointId})
+	}
+	return &pb.GetWebhookEndpointResponse{Endpoint: convertWebhookEndpointToProto(endpoint)}, nil
+}
+
+func (s *PaymentServer) DeleteWebhookEndpoint(ctx context.Context, req *pb.DeleteWebhookEndpointRequest) (*pb.DeleteWebhookEndpointResponse, error) {
+	if err := s.webhookService.DeleteEndpoint(ctx, req.EndpointId); err != nil {
+		return nil, statusError(err, map[string]string{"endpoint_id": req.EndpointId})
+	}
+	return &pb.DeleteWebhookEndpointResponse{}, nil
+}
+
+func (s *PaymentServer) EnableWebhookEndpoint(ctx context.Context, req *pb.EnableWebhookEndpointRequest) (*pb.EnableWebhookEndpointResponse, error) {
+	endpoint, err := s.webhookService.EnableEndpoint(ctx, req.EndpointId)
+	if err != nil {
+		return nil, statusError(err, map[string]string{"endpoint_id": req.EndpointId})
+	}
+	return &pb.EnableWebhookEndpointResponse{Endpoint: convertWebhookEndpointToProto(endpoint)}, nil
+}
+
+func (s *PaymentServer) ListWebhookDeliveries(ctx context.Context, req *pb.ListWebhookDeliveriesRequest) (*pb.ListWebhookDeliveriesResponse, error) {
+	pageSize := int(req.PageSize)
+	switch {
+	case pageSize < 0:
+		return nil, invalidArgument("page_size", "must not be negative")
+	case pageSize == 0:
+		pageSize = defaultDeliveryPageSize
+	case pageSize > maxDeliveryPageSize:
+		pageSize = maxDeliveryPageSize
+	}
+
+	// Журнал удаленного endpoint'а не возвращается, как и сам endpoint
+	if _, err := s.webhookService.GetEndpoint(ctx, req.EndpointId); err != nil {
+		return nil, statusError(err, map[string]string{"endpoint_id": req.EndpointId})
+	}
+	deliveries, err := s.webhookService.ListDeliveries(ctx, req.EndpointId, pageSize)
+	if err != nil {
+		return nil, statusError(err, map[string]string{"endpoint_id": req.EndpointId})
+	}
+
+	result := make([]*pb.WebhookDelivery, len(deliveries))
+	for i := range deliveries {
+		result[i] = convertWebhookDeliveryToProto(&deliveries[i])
+	}
+	return &pb.ListWebhookDeliveriesResponse{Deliveries: result}, nil
+}
+
+// convertWebhookEndpointToProto конвертирует endpoint, секрет подписи
+// клиентам не передается
+func convertWebhookEndpointToProto(e *models.WebhookEndpoint) *pb.WebhookEndpoint {
+	endpoint := &pb.WebhookEndpoint{
+		EndpointId:          e.ID,
+		Url:                 e.URL,
+		Description:         e.Description,
+		EventTypes:          e.EventTypes,
+		IsActive:            e.IsActive,
+		ConsecutiveFailures: int32(e.ConsecutiveFailures),
+		CreatedAt:           timestamppb.New(e.CreatedAt),
+		UpdatedAt:           timestamppb.New(e.UpdatedAt),
+	}
+	if e.DisabledAt != nil {
+		endpoint.DisabledAt = timestamppb.New(*e.DisabledAt)
+	}
+	return endpoint
+}
+
+func convertWebhookDeliveryToProto(d *models.WebhookDelivery) *pb.WebhookDelivery {
+	delivery := &pb.WebhookDelivery{
+		DeliveryId:   d.ID,
+		EndpointId:   d.EndpointID,
+		EventId:      d.EventID,
+		EventType:    d.EventType,
+		Attempt:      int32(d.Attempt),
+		Status:       convertWebhookDeliveryStatusToProto(d.Status),
+		ResponseCode: int32(d.ResponseCode),
+		ResponseBody: d.ResponseBody,
+		Error:        d.Error,
+		DurationMs:   d.DurationMs,
+		CreatedAt:    timestamppb.New(d.CreatedAt),
+	}
+	if d.NextRetryAt != nil {
+		delivery.NextRetryAt = timestamppb.New(*d.NextRetryAt)
+	}
+	return delivery
+}
+
+func convertWebhookDeliveryStatusToProto(status models.WebhookDeliveryStatus) pb.WebhookDeliveryStatus {
+	switch status {
+	case models.WebhookDeliverySucceeded:
+		return pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_SUCCEEDED
+	case models.WebhookDeliveryRetrying:
+		return pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_RETRYING
+	case models.WebhookDeliveryFailed:
+		return pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_FAILED
+	default:
+		return pb.WebhookDeliveryStatus_WEBHOOK_DELIVERY_STATUS_UNSPECIFIED
+	}
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"errors"
+	"go_payment/internal/i18n"
 	"go_payment/internal/models"
 	"go_payment/internal/service"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,6 +26,7 @@ type RegisterRequest struct {
 	Password  string `json:"password" binding:"required,min=8"`
 	FirstName string `json:"first_name" binding:"required"`
 	LastName  string `json:"last_name" binding:"required"`
+	Locale    string `json:"locale"`
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -36,6 +40,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		Email:     req.Email,
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
+		Locale:    i18n.Normalize(req.Locale),
 		Role:      models.RoleCustomer, // По умолчанию роль customer
 	}
 
@@ -96,3 +101,61 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 
 	c.JSON(http.StatusOK, tokens)
 }
+
+// CreateAPIKeyRequest представляет запрос на выпуск ключа доступа
+type CreateAPIKeyRequest struct {
+	Name      string      `json:"name" binding:"required"`
+	Role      models.Role `json:"role" binding:"required"`
+	ExpiresAt *time.Time  `json:"expires_at"`
+}
+
+// CreateAPIKey выпускает ключ доступа для сервисного клиента. Ключ
+// возвращается только в этом ответе.
+func (h *AuthHandler) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, apiKey, err := h.authService.CreateAPIKey(c.Request.Context(), req.Name, req.Role, currentUserID(c), req.ExpiresAt)
+	if errors.Is(err, service.ErrInvalidRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"key":     key,
+		"api_key": apiKey,
+	})
+}
+
+// ListAPIKeys возвращает выпущенные ключи доступа без самих ключей
+func (h *AuthHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.authService.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey отзывает ключ доступа
+func (h *AuthHandler) RevokeAPIKey(c *gin.Context) {
+	err := h.authService.RevokeAPIKey(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, service.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "api key revoked"})
+}
@@ -1,10 +1,13 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"go_payment/internal/models"
+	"html"
 	"go_payment/internal/service"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -26,10 +29,12 @@ func NewNotificationHandler(notificationService *service.NotificationService) *N
 func (h *NotificationHandler) RegisterRoutes(router *gin.Engine) {
 	notifications := router.Group("/api/v1/notifications")
 	{
+		notifications.GET("", h.ListNotifications)
 		notifications.POST("/send", h.SendNotification)
 		notifications.GET("/preferences/:user_id", h.GetPreferences)
 		notifications.PUT("/preferences/:user_id", h.UpdatePreferences)
 		notifications.GET("/status/:notification_id", h.GetStatus)
+		notifications.POST("/cancel/:notification_id", h.CancelNotification)
 	}
 }
 
@@ -37,6 +42,8 @@ func (h *NotificationHandler) RegisterRoutes(router *gin.Engine) {
 type SendNotificationRequest struct {
 	TemplateID string                 `json:"template_id" binding:"required"`
 	Recipient  string                 `json:"recipient" binding:"required"`
+	UserID     string                 `json:"user_id"`
+	Locale     string                 `json:"locale"`
 	Data       map[string]interface{} `json:"data"`
 	Schedule   *time.Time             `json:"schedule,omitempty"`
 }
@@ -49,22 +56,47 @@ func (h *NotificationHandler) SendNotification(c *gin.Context) {
 		return
 	}
 
-	msg, err := h.notificationService.CreateNotification(c.Request.Context(), req.TemplateID, req.Recipient, req.Data)
+	msg, err := h.notificationService.CreateNotification(c.Request.Context(), req.TemplateID, req.Recipient, req.Locale, req.Data)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondTemplateError(c, err)
 		return
 	}
 
+	msg.UserID = req.UserID
 	if req.Schedule != nil {
 		msg.ScheduledAt = req.Schedule
 	}
 
-	// В реальном приложении здесь нужно сохранить уведомление в базу
-	// и отправить его в очередь для асинхронной обработки
+	if err := h.notificationService.Enqueue(c.Request.Context(), msg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusAccepted, msg)
 }
 
+// CancelNotification отменяет отложенное уведомление
+func (h *NotificationHandler) CancelNotification(c *gin.Context) {
+	if !h.authorizeNotification(c, c.Param("notification_id")) {
+		return
+	}
+
+	msg, err := h.notificationService.CancelNotification(c.Request.Context(), c.Param("notification_id"))
+	switch {
+	case errors.Is(err, service.ErrNotificationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrNotificationNotCancellable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "status": msg.Status})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, msg)
+}
+
 // GetPreferences возвращает настройки уведомлений пользователя
 func (h *NotificationHandler) GetPreferences(c *gin.Context) {
 	userID := c.Param("user_id")
@@ -89,9 +121,12 @@ func (h *NotificationHandler) UpdatePreferences(c *gin.Context) {
 	}
 
 	prefs.UserID = userID
-	prefs.UpdatedAt = time.Now()
 
 	if err := h.notificationService.UpdateUserPreferences(c.Request.Context(), &prefs); err != nil {
+		if errors.Is(err, service.ErrInvalidPreferences) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -99,15 +134,507 @@ func (h *NotificationHandler) UpdatePreferences(c *gin.Context) {
 	c.JSON(http.StatusOK, prefs)
 }
 
-// GetStatus возвращает статус уведомления
+// SMSStatusCallbackRequest представляет callback шлюза о статусе доставки SMS
+type SMSStatusCallbackRequest struct {
+	Reference string `json:"reference" binding:"required"`
+	MessageID string `json:"message_id"`
+	Status    string `json:"status" binding:"required"`
+	ErrorCode string `json:"error_code"`
+}
+
+// SMSStatusCallback обновляет статус уведомления по данным шлюза SMS
+func (h *NotificationHandler) SMSStatusCallback(c *gin.Context) {
+	var req SMSStatusCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.notificationService.HandleSMSStatus(c.Request.Context(), req.Reference, req.Status, req.ErrorCode); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "status accepted"})
+}
+
+// EmailEventCallback блокирует адрес по сообщению почтового провайдера о
+// возврате или жалобе
+func (h *NotificationHandler) EmailEventCallback(c *gin.Context) {
+	var event service.EmailEvent
+	if err := c.ShouldBindJSON(&event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.notificationService.HandleEmailEvent(c.Request.Context(), &event); err != nil {
+		if errors.Is(err, service.ErrInvalidSuppression) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "event accepted"})
+}
+
+// RegisterDeviceRequest представляет запрос на регистрацию устройства
+type RegisterDeviceRequest struct {
+	Platform   models.DevicePlatform `json:"platform" binding:"required,oneof=ios android web"`
+	Token      string                `json:"token" binding:"required"`
+	AppVersion string                `json:"app_version"`
+}
+
+// RegisterDevice регистрирует устройство текущего пользователя для push-уведомлений
+func (h *NotificationHandler) RegisterDevice(c *gin.Context) {
+	var req RegisterDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	device := &models.DeviceToken{
+		UserID:     currentUserID(c),
+		Platform:   req.Platform,
+		Token:      req.Token,
+		AppVersion: req.AppVersion,
+	}
+
+	if err := h.notificationService.RegisterDevice(c.Request.Context(), device); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, device)
+}
+
+// ListDevices возвращает устройства текущего пользователя
+func (h *NotificationHandler) ListDevices(c *gin.Context) {
+	devices, err := h.notificationService.ListDevices(c.Request.Context(), currentUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, devices)
+}
+
+// UnregisterDevice удаляет устройство текущего пользователя
+func (h *NotificationHandler) UnregisterDevice(c *gin.Context) {
+	if err := h.notificationService.UnregisterDevice(c.Request.Context(), currentUserID(c), c.Param("device_id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "device unregistered"})
+}
+
+// canAccessNotification разрешает доступ к уведомлению его владельцу,
+// администраторам и менеджерам
+func canAccessNotification(c *gin.Context, msg *models.NotificationMessage) bool {
+	switch models.Role(c.GetString("role")) {
+	case models.RoleAdmin, models.RoleManager:
+		return true
+	}
+	userID := currentUserID(c)
+	return userID != "" && msg.UserID == userID
+}
+
+// authorizeNotification проверяет доступ к уведомлению и отвечает 404,
+// если доступа нет: чужие уведомления неотличимы от несуществующих
+func (h *NotificationHandler) authorizeNotification(c *gin.Context, notificationID string) bool {
+	msg, err := h.notificationService.GetNotification(c.Request.Context(), notificationID)
+	switch {
+	case errors.Is(err, service.ErrNotificationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return false
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	case !canAccessNotification(c, msg):
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrNotificationNotFound.Error()})
+		return false
+	}
+	return true
+}
+
+// currentUserID возвращает идентификатор пользователя, установленный AuthMiddleware
+func currentUserID(c *gin.Context) string {
+	value, _ := c.Get("user_id")
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		// Числовые claims JWT разбираются как float64
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// TemplateRequest представляет запрос на создание или изменение шаблона
+type TemplateRequest struct {
+	Name string `json:"name" binding:"required"`
+	// Locale по умолчанию en при создании, при изменении пустая локаль
+	// сохраняет текущую локаль шаблона
+	Locale      string                  `json:"locale"`
+	Type        models.NotificationType `json:"type" binding:"required,oneof=email sms push webhook"`
+	Subject     string                  `json:"subject"`
+	Content     string                  `json:"content" binding:"required"`
+	TextContent string                  `json:"text_content"`
+	FromAddress string                  `json:"from_address" binding:"omitempty,email"`
+	ReplyTo     string                  `json:"reply_to" binding:"omitempty,email"`
+	Variables   map[string]string       `json:"variables"`
+	Metadata    map[string]interface{}  `json:"metadata"`
+	// Transactional шаблоны отправляются и во время тихих часов
+	Transactional bool `json:"transactional"`
+	// IsActive учитывается только при изменении шаблона. Если поле не
+	// передано, шаблон остается в текущем состоянии.
+	IsActive *bool `json:"is_active"`
+}
+
+// PreviewTemplateRequest представляет запрос на предпросмотр шаблона
+type PreviewTemplateRequest struct {
+	Version int                    `json:"version"`
+	Data    map[string]interface{} `json:"data"`
+}
+
+// CreateTemplate создает новый шаблон уведомления
+func (h *NotificationHandler) CreateTemplate(c *gin.Context) {
+	var req TemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tmpl := req.toModel()
+	if err := h.notificationService.CreateTemplate(c.Request.Context(), tmpl); err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, tmpl)
+}
+
+// ListTemplates возвращает все шаблоны уведомлений
+func (h *NotificationHandler) ListTemplates(c *gin.Context) {
+	templates, err := h.notificationService.ListTemplates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+// GetTemplate возвращает шаблон уведомления
+func (h *NotificationHandler) GetTemplate(c *gin.Context) {
+	tmpl, err := h.notificationService.GetTemplate(c.Request.Context(), c.Param("template_id"))
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// UpdateTemplate сохраняет новую версию шаблона уведомления
+func (h *NotificationHandler) UpdateTemplate(c *gin.Context) {
+	var req TemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tmpl := req.toModel()
+	tmpl.ID = c.Param("template_id")
+
+	if err := h.notificationService.UpdateTemplate(c.Request.Context(), tmpl, req.IsActive); err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// DeleteTemplate деактивирует шаблон уведомления
+func (h *NotificationHandler) DeleteTemplate(c *gin.Context) {
+	if err := h.notificationService.DeleteTemplate(c.Request.Context(), c.Param("template_id")); err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "template deleted"})
+}
+
+// ListTemplateVersions возвращает историю версий шаблона
+func (h *NotificationHandler) ListTemplateVersions(c *gin.Context) {
+	versions, err := h.notificationService.ListTemplateVersions(c.Request.Context(), c.Param("template_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// PreviewTemplate рендерит шаблон с переданными данными без отправки
+func (h *NotificationHandler) PreviewTemplate(c *gin.Context) {
+	var req PreviewTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rendered, err := h.notificationService.PreviewTemplate(c.Request.Context(), c.Param("template_id"), req.Version, req.Data)
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rendered)
+}
+
+// toModel преобразует запрос в модель шаблона
+func (r *TemplateRequest) toModel() *models.NotificationTemplate {
+	return &models.NotificationTemplate{
+		Name:          r.Name,
+		Locale:        r.Locale,
+		Type:          r.Type,
+		Subject:       r.Subject,
+		Content:       r.Content,
+		TextContent:   r.TextContent,
+		FromAddress:   r.FromAddress,
+		ReplyTo:       r.ReplyTo,
+		Variables:     r.Variables,
+		Metadata:      r.Metadata,
+		Transactional: r.Transactional,
+	}
+}
+
+// respondTemplateError преобразует ошибку работы с шаблоном в HTTP ответ
+func respondTemplateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrTemplateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidTemplate), errors.Is(err, service.ErrMissingTemplateVariables):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// NotificationStatusResponse представляет уведомление с журналом попыток отправки
+type NotificationStatusResponse struct {
+	*models.NotificationMessage
+	Attempts []models.NotificationAttempt `json:"attempts"`
+}
+
+// GetStatus возвращает статус уведомления и попытки его отправки
 func (h *NotificationHandler) GetStatus(c *gin.Context) {
 	notificationID := c.Param("notification_id")
 
-	// В реальном приложении здесь нужно получить статус из базы данных
-	status := models.NotificationMessage{
-		ID:     notificationID,
-		Status: models.NotificationStatusSent,
+	msg, err := h.notificationService.GetNotification(c.Request.Context(), notificationID)
+	if err != nil {
+		if errors.Is(err, service.ErrNotificationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !canAccessNotification(c, msg) {
+		c.JSON(http.StatusNotFound, gin.H{"error": service.ErrNotificationNotFound.Error()})
+		return
+	}
+
+	attempts, err := h.notificationService.ListAttempts(c.Request.Context(), notificationID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, NotificationStatusResponse{
+		NotificationMessage: msg,
+		Attempts:            attempts,
+	})
+}
+
+// ListNotifications возвращает уведомления с фильтрацией по получателю,
+// статусу и периоду создания: ?recipient=&user_id=&status=&type=&from=&to=&limit=&offset=
+func (h *NotificationHandler) ListNotifications(c *gin.Context) {
+	filter := service.NotificationFilter{
+		Recipient: c.Query("recipient"),
+		UserID:    c.Query("user_id"),
+		Status:    models.NotificationStatus(c.Query("status")),
+		Type:      models.NotificationType(c.Query("type")),
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "0")); err != nil || filter.Limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	if filter.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || filter.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+
+	notifications, err := h.notificationService.ListNotifications(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, notifications)
+}
+
+// parseTimeQuery разбирает необязательный параметр запроса в формате RFC 3339
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: expected RFC 3339 time", name)
+	}
+	return &t, nil
+}
+
+// unsubscribePage — страница подтверждения отписки. Отписка выполняется
+// POST запросом, чтобы почтовые сканеры ссылок не отписывали получателя.
+const unsubscribePage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Unsubscribe</title></head>
+<body><p>Unsubscribe %s from payment service emails?</p>
+<form method="post"><input type="hidden" name="token" value="%s"><button type="submit">Unsubscribe</button></form>
+</body></html>
+`
+
+// unsubscribedPage — страница результата отписки
+const unsubscribedPage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Unsubscribed</title></head>
+<body><p>%s has been unsubscribed. You will still receive receipts and other transactional emails.</p></body></html>
+`
+
+// UnsubscribePage показывает подтверждение отписки по ссылке из письма
+func (h *NotificationHandler) UnsubscribePage(c *gin.Context) {
+	token := c.Query("token")
+	email, err := h.notificationService.VerifyUnsubscribeToken(token)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page := fmt.Sprintf(unsubscribePage, html.EscapeString(email), html.EscapeString(token))
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// Unsubscribe отписывает получателя. Поддерживает отправку формы со страницы
+// подтверждения и one-click запрос почтового клиента по RFC 8058.
+func (h *NotificationHandler) Unsubscribe(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		token = c.PostForm("token")
+	}
+
+	email, err := h.notificationService.Unsubscribe(c.Request.Context(), token)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUnsubscribeToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	page := fmt.Sprintf(unsubscribedPage, html.EscapeString(email))
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+}
+
+// SuppressionRequest представляет запрос на блокировку адреса
+type SuppressionRequest struct {
+	Email   string                   `json:"email" binding:"required,email"`
+	Reason  models.SuppressionReason `json:"reason"`
+	Details string                   `json:"details"`
+}
+
+// ListSuppressions возвращает заблокированные адреса
+func (h *NotificationHandler) ListSuppressions(c *gin.Context) {
+	filter := service.SuppressionFilter{
+		Email:  c.Query("email"),
+		Reason: models.SuppressionReason(c.Query("reason")),
+	}
+
+	var err error
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "0")); err != nil || filter.Limit < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+		return
+	}
+	if filter.Offset, err = strconv.Atoi(c.DefaultQuery("offset", "0")); err != nil || filter.Offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+
+	suppressions, err := h.notificationService.ListSuppressions(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, suppressions)
+}
+
+// AddSuppression блокирует адрес вручную
+func (h *NotificationHandler) AddSuppression(c *gin.Context) {
+	var req SuppressionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = models.SuppressionReasonManual
+	}
+
+	suppression, err := h.notificationService.AddSuppression(c.Request.Context(), &models.EmailSuppression{
+		Email:   req.Email,
+		Reason:  req.Reason,
+		Source:  "admin:" + currentUserID(c),
+		Details: req.Details,
+	})
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSuppression) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, suppression)
+}
+
+// DeleteSuppression снимает блокировку адреса
+func (h *NotificationHandler) DeleteSuppression(c *gin.Context) {
+	err := h.notificationService.RemoveSuppression(c.Request.Context(), c.Param("email"))
+	if err != nil {
+		if errors.Is(err, service.ErrSuppressionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, status)
+	c.JSON(http.StatusOK, gin.H{"message": "suppression removed"})
 }
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"go_payment/internal/models"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCanAccessNotification(t *testing.T) {
+	msg := &models.NotificationMessage{ID: "n1", UserID: "42"}
+	tests := []struct {
+		name   string
+		userID interface{}
+		role   string
+		want   bool
+	}{
+		{"owner", "42", string(models.RoleCustomer), true},
+		{"owner with numeric claim", float64(42), string(models.RoleCustomer), true},
+		{"other customer", "7", string(models.RoleCustomer), false},
+		{"admin", "1", string(models.RoleAdmin), true},
+		{"manager", "2", string(models.RoleManager), true},
+		{"anonymous", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Set("user_id", tt.userID)
+			c.Set("role", tt.role)
+			if got := canAccessNotification(c, msg); got != tt.want {
+				t.Errorf("canAccessNotification() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("role", string(models.RoleCustomer))
+	if canAccessNotification(c, &models.NotificationMessage{ID: "n2"}) {
+		t.Error("notification without owner must not be visible to customers")
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"go_payment/internal/models"
+	"go_payment/internal/service"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReceiptHandler представляет обработчик платежных документов
+type ReceiptHandler struct {
+	receiptService *service.ReceiptService
+}
+
+// NewReceiptHandler создает новый обработчик платежных документов
+func NewReceiptHandler(receiptService *service.ReceiptService) *ReceiptHandler {
+	return &ReceiptHandler{
+		receiptService: receiptService,
+	}
+}
+
+// GetPaymentReceipt возвращает квитанцию по заказу. Формат выбирается
+// параметром format (html, pdf или json) или заголовком Accept.
+func (h *ReceiptHandler) GetPaymentReceipt(c *gin.Context) {
+	receipt, err := h.receiptService.GetOrderReceipt(c.Request.Context(), c.Param("orderID"))
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	writeReceipt(c, receipt)
+}
+
+// ListPaymentReceipts возвращает квитанцию и документы о возвратах по заказу
+func (h *ReceiptHandler) ListPaymentReceipts(c *gin.Context) {
+	receipts, err := h.receiptService.ListOrderReceipts(c.Request.Context(), c.Param("orderID"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, receipts)
+}
+
+// GetReceipt возвращает документ заказа по идентификатору
+func (h *ReceiptHandler) GetReceipt(c *gin.Context) {
+	receipt, err := h.receiptService.GetReceipt(c.Request.Context(), c.Param("receipt_id"))
+	if err == nil && receipt.OrderID != c.Param("orderID") {
+		err = service.ErrReceiptNotFound
+	}
+	if err != nil {
+		h.handleError(c, err)
+		return
+	}
+
+	writeReceipt(c, receipt)
+}
+
+// handleError преобразует ошибку сервиса в HTTP ответ
+func (h *ReceiptHandler) handleError(c *gin.Context, err error) {
+	if errors.Is(err, service.ErrReceiptNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
+
+// writeReceipt отправляет документ в запрошенном формате
+func writeReceipt(c *gin.Context, receipt *models.Receipt) {
+	format := c.Query("format")
+	if format == "" {
+		switch accept := c.GetHeader("Accept"); {
+		case strings.Contains(accept, "application/pdf"):
+			format = "pdf"
+		case strings.Contains(accept, "application/json"):
+			format = "json"
+		default:
+			format = "html"
+		}
+	}
+
+	switch format {
+	case "html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(receipt.HTML))
+	case "pdf":
+		c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s.pdf"`, receipt.Number))
+		c.Data(http.StatusOK, "application/pdf", receipt.PDF)
+	case "json":
+		c.JSON(http.StatusOK, receipt)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be html, pdf or json"})
+	}
+}
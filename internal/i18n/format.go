@@ -0,0 +1,251 @@
+package i18n
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// localeFormat содержит правила форматирования чисел и дат локали по данным CLDR
+type localeFormat struct {
+	decimal string
+	group   string
+	// currencyAfter означает, что символ валюты ставится после суммы
+	currencyAfter bool
+	// symbols переопределяет символы валют для локали
+	symbols map[string]string
+	// months содержит сокращенные названия месяцев в родительном падеже
+	months [12]string
+	// datePattern использует токены {d}, {dd}, {MM}, {MMM} и {y}
+	datePattern string
+	timeLayout  string
+}
+
+var formats = map[string]localeFormat{
+	"en": {
+		decimal:     ".",
+		group:       ",",
+		symbols:     map[string]string{"USD": "$", "EUR": "€", "GBP": "£", "JPY": "¥"},
+		months:      [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		datePattern: "{MMM} {d}, {y}",
+		timeLayout:  "3:04 PM",
+	},
+	"en-GB": {
+		decimal:     ".",
+		group:       ",",
+		symbols:     map[string]string{"USD": "US$", "EUR": "€", "GBP": "£", "JPY": "JP¥"},
+		months:      [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sept", "Oct", "Nov", "Dec"},
+		datePattern: "{d} {MMM} {y}",
+		timeLayout:  "15:04",
+	},
+	"ru": {
+		decimal:       ",",
+		group:         "\u00a0",
+		currencyAfter: true,
+		symbols:       map[string]string{"RUB": "₽", "USD": "$", "EUR": "€", "GBP": "£", "UAH": "₴", "KZT": "₸"},
+		months:        [12]string{"янв.", "февр.", "мар.", "апр.", "мая", "июн.", "июл.", "авг.", "сент.", "окт.", "нояб.", "дек."},
+		datePattern:   "{d} {MMM} {y} г.",
+		timeLayout:    "15:04",
+	},
+	"de": {
+		decimal:       ",",
+		group:         ".",
+		currencyAfter: true,
+		symbols:       map[string]string{"EUR": "€", "USD": "$", "GBP": "£"},
+		datePattern:   "{dd}.{MM}.{y}",
+		timeLayout:    "15:04",
+	},
+	"fr": {
+		decimal:       ",",
+		group:         "\u202f",
+		currencyAfter: true,
+		symbols:       map[string]string{"EUR": "€", "USD": "$US", "GBP": "£GB"},
+		months:        [12]string{"janv.", "févr.", "mars", "avr.", "mai", "juin", "juil.", "août", "sept.", "oct.", "nov.", "déc."},
+		datePattern:   "{d} {MMM} {y}",
+		timeLayout:    "15:04",
+	},
+	"es": {
+		decimal:       ",",
+		group:         ".",
+		currencyAfter: true,
+		symbols:       map[string]string{"EUR": "€", "USD": "US$", "GBP": "GBP"},
+		months:        [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sept", "oct", "nov", "dic"},
+		datePattern:   "{d} {MMM} {y}",
+		timeLayout:    "15:04",
+	},
+}
+
+// currencyDigits содержит количество знаков после запятой для валют,
+// у которых оно отличается от двух
+var currencyDigits = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"CLP": 0,
+	"ISK": 0,
+	"BHD": 3,
+	"KWD": 3,
+	"OMR": 3,
+	"JOD": 3,
+	"TND": 3,
+}
+
+// lookupFormat находит правила форматирования по цепочке fallback
+func lookupFormat(locale string) localeFormat {
+	for _, l := range Fallbacks(locale) {
+		if f, ok := formats[l]; ok {
+			return f
+		}
+	}
+	return formats[DefaultLocale]
+}
+
+// CurrencyDigits возвращает количество знаков после запятой для валюты
+func CurrencyDigits(currency string) int {
+	if digits, ok := currencyDigits[strings.ToUpper(currency)]; ok {
+		return digits
+	}
+	return 2
+}
+
+// FormatNumber форматирует число с разделителями локали
+func FormatNumber(value float64, digits int, locale string) string {
+	return formatNumber(value, digits, lookupFormat(locale))
+}
+
+// FormatMoney форматирует сумму в валюте по правилам локали:
+// "en" -> "$1,234.50", "ru" -> "1 234,50 ₽". Для неизвестных валют
+// используется ISO код.
+func FormatMoney(amount float64, currency, locale string) string {
+	f := lookupFormat(locale)
+	currency = strings.ToUpper(currency)
+
+	symbol, ok := f.symbols[currency]
+	if !ok {
+		symbol = currency
+	}
+
+	number := formatNumber(math.Abs(amount), CurrencyDigits(currency), f)
+
+	var result string
+	switch {
+	case f.currencyAfter:
+		result = number + "\u00a0" + symbol
+	case ok:
+		result = symbol + number
+	default:
+		// ISO код отделяется от суммы пробелом: "RUB 1,234.50"
+		result = symbol + " " + number
+	}
+
+	if amount < 0 {
+		return "-" + result
+	}
+	return result
+}
+
+// timeLayouts перечисляет форматы строковых дат, принимаемые ParseTime.
+// Строки без смещения относятся к переданной зоне.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseTime приводит значение данных шаблона к времени. Поддерживаются
+// time.Time, строки RFC3339 и "2006-01-02" и Unix время в секундах, в
+// котором числа приходят после разбора JSON. Строки без смещения
+// разбираются в зоне loc.
+func ParseTime(value interface{}, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.ParseInLocation(layout, strings.TrimSpace(v), loc); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("invalid date %q", v)
+	case int64:
+		return time.Unix(v, 0), nil
+	case int:
+		return time.Unix(int64(v), 0), nil
+	case float64:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date value of type %T", value)
+}
+
+// FormatDate форматирует дату в среднем формате CLDR. Дата берется в зоне
+// loc, nil означает UTC: локальная зона сервера не должна влиять на текст,
+// который видит получатель.
+func FormatDate(t time.Time, locale string, loc *time.Location) string {
+	f := lookupFormat(locale)
+	t = inLocation(t, loc)
+
+	month := f.months[t.Month()-1]
+	if month == "" {
+		month = strconv.Itoa(int(t.Month()))
+	}
+
+	return strings.NewReplacer(
+		"{dd}", t.Format("02"),
+		"{d}", strconv.Itoa(t.Day()),
+		"{MMM}", month,
+		"{MM}", t.Format("01"),
+		"{y}", strconv.Itoa(t.Year()),
+	).Replace(f.datePattern)
+}
+
+// FormatDateTime форматирует дату и время в зоне loc
+func FormatDateTime(t time.Time, locale string, loc *time.Location) string {
+	t = inLocation(t, loc)
+	return FormatDate(t, locale, t.Location()) + ", " + t.Format(lookupFormat(locale).timeLayout)
+}
+
+func inLocation(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc)
+}
+
+// formatNumber форматирует число с группировкой разрядов
+func formatNumber(value float64, digits int, f localeFormat) string {
+	negative := value < 0
+	s := strconv.FormatFloat(math.Abs(value), 'f', digits, 64)
+
+	intPart, fracPart := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		intPart, fracPart = s[:i], s[i+1:]
+	}
+
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteString(f.group)
+		}
+		b.WriteRune(r)
+	}
+	if fracPart != "" {
+		b.WriteString(f.decimal)
+		b.WriteString(fracPart)
+	}
+	return b.String()
+}
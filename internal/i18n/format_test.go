@@ -0,0 +1,96 @@
+package i18n
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone database is not available: %v", err)
+	}
+	return loc
+}
+
+func TestFormatDateUsesLocation(t *testing.T) {
+	// 23:30 UTC 31 января — уже 1 февраля в Москве и еще 31 января в Нью-Йорке
+	instant := time.Date(2024, time.January, 31, 23, 30, 0, 0, time.UTC)
+	moscow := mustLocation(t, "Europe/Moscow")
+	newYork := mustLocation(t, "America/New_York")
+
+	tests := []struct {
+		name   string
+		locale string
+		loc    *time.Location
+		date   string
+		dt     string
+	}{
+		{"nil means utc", "en", nil, "Jan 31, 2024", "Jan 31, 2024, 11:30 PM"},
+		{"utc", "en-GB", time.UTC, "31 Jan 2024", "31 Jan 2024, 23:30"},
+		{"east of utc", "ru", moscow, "1 февр. 2024\u00a0г.", "1 февр. 2024\u00a0г., 02:30"},
+		{"west of utc", "en", newYork, "Jan 31, 2024", "Jan 31, 2024, 6:30 PM"},
+		{"numeric months", "de", moscow, "01.02.2024", "01.02.2024, 02:30"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatDate(instant, tt.locale, tt.loc); got != tt.date {
+				t.Errorf("FormatDate() = %q, want %q", got, tt.date)
+			}
+			if got := FormatDateTime(instant, tt.locale, tt.loc); got != tt.dt {
+				t.Errorf("FormatDateTime() = %q, want %q", got, tt.dt)
+			}
+		})
+	}
+}
+
+func TestFormatDateIgnoresServerZone(t *testing.T) {
+	instant := time.Date(2024, time.March, 1, 1, 0, 0, 0, time.UTC)
+	local := time.Local
+	time.Local = mustLocation(t, "America/Los_Angeles")
+	defer func() { time.Local = local }()
+
+	if got := FormatDate(instant.Local(), "en", nil); got != "Mar 1, 2024" {
+		t.Errorf("FormatDate() = %q, want date in UTC", got)
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	moscow := mustLocation(t, "Europe/Moscow")
+	instant := time.Date(2024, time.May, 9, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  time.Time
+		valid bool
+	}{
+		{"time", instant, instant, true},
+		{"time pointer", &instant, instant, true},
+		{"rfc3339", "2024-05-09T12:00:00Z", instant, true},
+		{"rfc3339 with offset", "2024-05-09T15:00:00+03:00", instant, true},
+		{"rfc3339 nano", "2024-05-09T12:00:00.000000001Z", instant.Add(time.Nanosecond), true},
+		{"local datetime in location", "2024-05-09T15:00:00", instant, true},
+		{"date in location", "2024-05-09", time.Date(2024, time.May, 9, 0, 0, 0, 0, moscow), true},
+		{"unix seconds from json", float64(instant.Unix()), instant, true},
+		{"unix seconds", instant.Unix(), instant, true},
+		{"invalid string", "09/05/2024", time.Time{}, false},
+		{"nil pointer", (*time.Time)(nil), time.Time{}, false},
+		{"unsupported type", true, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTime(tt.value, moscow)
+			if !tt.valid {
+				if err == nil {
+					t.Errorf("ParseTime() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil || !got.Equal(tt.want) {
+				t.Errorf("ParseTime() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
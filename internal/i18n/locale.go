@@ -0,0 +1,53 @@
+package i18n
+
+import "strings"
+
+// DefaultLocale используется, если локаль клиента не задана или для нее
+// нет ни шаблона, ни правил форматирования
+const DefaultLocale = "en"
+
+// Normalize приводит тег локали к виду BCP 47: "ru_ru" -> "ru-RU".
+// Пустая строка возвращается без изменений.
+func Normalize(locale string) string {
+	locale = strings.TrimSpace(strings.ReplaceAll(locale, "_", "-"))
+	if locale == "" {
+		return ""
+	}
+
+	parts := strings.Split(locale, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		switch len(parts[i]) {
+		case 2:
+			// Регион: RU, US
+			parts[i] = strings.ToUpper(parts[i])
+		case 4:
+			// Письменность: Latn, Cyrl
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:])
+		default:
+			parts[i] = strings.ToLower(parts[i])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// Fallbacks возвращает цепочку локалей от наиболее точной к локали по
+// умолчанию: "ru-RU" -> ["ru-RU", "ru", "en"]
+func Fallbacks(locale string) []string {
+	locale = Normalize(locale)
+
+	var chain []string
+	for locale != "" {
+		chain = append(chain, locale)
+		i := strings.LastIndex(locale, "-")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+
+	if len(chain) == 0 || chain[len(chain)-1] != DefaultLocale {
+		chain = append(chain, DefaultLocale)
+	}
+	return chain
+}
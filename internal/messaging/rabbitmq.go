@@ -7,6 +7,7 @@ import (
 	"go_payment/internal/metrics"
 	"go_payment/internal/models"
 	"log"
+	"sync"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -17,16 +18,41 @@ const (
 	PaymentQueue          = "payments"
 	PaymentStatusQueue    = "payment_status"
 	NotificationQueue     = "notifications"
+	WebhookQueue          = "webhooks"
 	PaymentExchange      = "payment_exchange"
 	PaymentStatusExchange = "payment_status_exchange"
 	DeadLetterExchange   = "dead_letter_exchange"
 )
 
+// WebhookRetryDelays задает расписание повторной доставки вебхуков.
+// Суммарно повторы покрывают около четырех суток.
+var WebhookRetryDelays = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	30 * time.Minute,
+	2 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+	48 * time.Hour,
+}
+
+// webhookRetriesHeader хранит число отложенных повторов сообщения после
+// ошибок обработки, не связанных с доставкой
+const webhookRetriesHeader = "x-handler-retries"
+
+// webhookRetryQueue возвращает имя очереди отложенной доставки для задержки
+func webhookRetryQueue(delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%ds", WebhookQueue, int64(delay.Seconds()))
+}
+
 // RabbitMQ представляет клиент для работы с RabbitMQ
 type RabbitMQ struct {
 	conn       *amqp.Connection
 	channel    *amqp.Channel
 	collector  *metrics.QueueCollector
+	// consumers учитывает горутины потребителей, обрабатывающих сообщения
+	consumers sync.WaitGroup
 }
 
 // NewRabbitMQ создает новый экземпляр RabbitMQ клиента
@@ -51,7 +77,7 @@ func NewRabbitMQ(url string) (*RabbitMQ, error) {
 	}
 
 	// Инициализация коллектора метрик
-	queues := []string{PaymentQueue, PaymentStatusQueue, NotificationQueue}
+	queues := []string{PaymentQueue, PaymentStatusQueue, NotificationQueue, WebhookQueue}
 	rmq.collector = metrics.NewQueueCollector(conn, queues)
 	rmq.collector.Start(context.Background())
 
@@ -92,7 +118,7 @@ func (r *RabbitMQ) setupExchangesAndQueues() error {
 	}
 
 	// Настройка очередей с dead-letter
-	queues := []string{PaymentQueue, PaymentStatusQueue, NotificationQueue}
+	queues := []string{PaymentQueue, PaymentStatusQueue, NotificationQueue, WebhookQueue}
 	for _, queue := range queues {
 		args := amqp.Table{
 			"x-dead-letter-exchange": DeadLetterExchange,
@@ -112,6 +138,29 @@ func (r *RabbitMQ) setupExchangesAndQueues() error {
 		}
 	}
 
+	// Очереди отложенной доставки вебхуков: по истечении TTL сообщение
+	// возвращается в основную очередь вебхуков
+	for _, delay := range WebhookRetryDelays {
+		args := amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": WebhookQueue,
+			"x-message-ttl":             int32(delay.Milliseconds()),
+		}
+
+		queue := webhookRetryQueue(delay)
+		_, err := r.channel.QueueDeclare(
+			queue,
+			true,
+			false,
+			false,
+			false,
+			args,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to declare queue %s: %w", queue, err)
+		}
+	}
+
 	// Привязка очередей к обменам
 	err = r.channel.QueueBind(
 		PaymentQueue,
@@ -200,6 +249,29 @@ func (r *RabbitMQ) PublishPaymentStatus(ctx context.Context, msg *models.Payment
 	return nil
 }
 
+// PublishPaymentEvent публикует записанное в историю изменение статуса
+// для подписчиков потока статусов. Ключ event.* не попадает в очередь
+// обработки статусов, привязанную к status.#.
+func (r *RabbitMQ) PublishPaymentEvent(ctx context.Context, event *models.PaymentStatusEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payment event: %w", err)
+	}
+
+	return r.channel.PublishWithContext(ctx,
+		PaymentStatusExchange,
+		fmt.Sprintf("event.%s", event.OrderID),
+		false,
+		false,
+		amqp.Publishing{
+			ContentType: "application/json",
+			Body:        body,
+			MessageId:   fmt.Sprintf("%s:%d", event.OrderID, event.Sequence),
+			Timestamp:   time.Now(),
+		},
+	)
+}
+
 // PublishNotification публикует уведомление
 func (r *RabbitMQ) PublishNotification(ctx context.Context, msg *models.NotificationMessage) error {
 	body, err := json.Marshal(msg)
@@ -231,22 +303,62 @@ func (r *RabbitMQ) PublishNotification(ctx context.Context, msg *models.Notifica
 	return nil
 }
 
-// ConsumePayments начинает потребление сообщений о платежах
-func (r *RabbitMQ) ConsumePayments(handler func(msg *models.PaymentMessage) error) error {
-	msgs, err := r.channel.Consume(
-		PaymentQueue,
+// PublishWebhook публикует задание на доставку вебхука
+func (r *RabbitMQ) PublishWebhook(ctx context.Context, msg *models.WebhookMessage) error {
+	return r.publishWebhook(ctx, WebhookQueue, msg)
+}
+
+// PublishWebhookRetry откладывает повторную доставку вебхука согласно
+// WebhookRetryDelays. msg.Attempt задает номер уже выполненной попытки.
+func (r *RabbitMQ) PublishWebhookRetry(ctx context.Context, msg *models.WebhookMessage) error {
+	if msg.Attempt < 1 || msg.Attempt > len(WebhookRetryDelays) {
+		return fmt.Errorf("no retry scheduled for webhook attempt %d", msg.Attempt)
+	}
+	return r.publishWebhook(ctx, webhookRetryQueue(WebhookRetryDelays[msg.Attempt-1]), msg)
+}
+
+// publishWebhook публикует задание на доставку вебхука в указанную очередь
+func (r *RabbitMQ) publishWebhook(ctx context.Context, queue string, msg *models.WebhookMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		metrics.RecordProcessingError(WebhookQueue, "marshal_error")
+		return fmt.Errorf("failed to marshal webhook message: %w", err)
+	}
+
+	err = r.channel.PublishWithContext(ctx,
 		"",
+		queue,
 		false,
 		false,
-		false,
-		false,
-		nil,
+		amqp.Publishing{
+			ContentType:  "application/json",
+			Body:         body,
+			MessageId:    fmt.Sprintf("%s:%s:%d", msg.EventID, msg.EndpointID, msg.Attempt),
+			Timestamp:    time.Now(),
+			DeliveryMode: amqp.Persistent,
+		},
 	)
+
 	if err != nil {
-		return fmt.Errorf("failed to register a consumer: %w", err)
+		metrics.RecordProcessingError(WebhookQueue, "publish_error")
+		return err
 	}
 
+	metrics.IncrementPublishedMessage(WebhookQueue, msg.EventType)
+	return nil
+}
+
+// ConsumePayments начинает потребление сообщений о платежах до отмены ctx
+func (r *RabbitMQ) ConsumePayments(ctx context.Context, handler func(ctx context.Context, msg *models.PaymentMessage) error) error {
+	msgs, err := r.consume(ctx, PaymentQueue)
+	if err != nil {
+		return err
+	}
+
+	handlerCtx := context.WithoutCancel(ctx)
+	r.consumers.Add(1)
 	go func() {
+		defer r.consumers.Done()
 		for d := range msgs {
 			var paymentMsg models.PaymentMessage
 			done := metrics.TrackProcessingTime(PaymentQueue, "processing")
@@ -260,7 +372,7 @@ func (r *RabbitMQ) ConsumePayments(handler func(msg *models.PaymentMessage) erro
 				continue
 			}
 
-			if err := handler(&paymentMsg); err != nil {
+			if err := handler(handlerCtx, &paymentMsg); err != nil {
 				log.Printf("Error handling payment message: %v", err)
 				metrics.RecordProcessingError(PaymentQueue, "handler_error")
 				d.Reject(true)
@@ -278,22 +390,18 @@ func (r *RabbitMQ) ConsumePayments(handler func(msg *models.PaymentMessage) erro
 	return nil
 }
 
-// ConsumePaymentStatus начинает потребление сообщений о статусах платежей
-func (r *RabbitMQ) ConsumePaymentStatus(handler func(msg *models.PaymentStatusMessage) error) error {
-	msgs, err := r.channel.Consume(
-		PaymentStatusQueue,
-		"",
-		false,
-		false,
-		false,
-		false,
-		nil,
-	)
+// ConsumePaymentStatus начинает потребление сообщений о статусах платежей до
+// отмены ctx
+func (r *RabbitMQ) ConsumePaymentStatus(ctx context.Context, handler func(ctx context.Context, msg *models.PaymentStatusMessage) error) error {
+	msgs, err := r.consume(ctx, PaymentStatusQueue)
 	if err != nil {
-		return fmt.Errorf("failed to register a consumer: %w", err)
+		return err
 	}
 
+	handlerCtx := context.WithoutCancel(ctx)
+	r.consumers.Add(1)
 	go func() {
+		defer r.consumers.Done()
 		for d := range msgs {
 			var statusMsg models.PaymentStatusMessage
 			done := metrics.TrackProcessingTime(PaymentStatusQueue, "processing")
@@ -307,7 +415,7 @@ func (r *RabbitMQ) ConsumePaymentStatus(handler func(msg *models.PaymentStatusMe
 				continue
 			}
 
-			if err := handler(&statusMsg); err != nil {
+			if err := handler(handlerCtx, &statusMsg); err != nil {
 				log.Printf("Error handling status message: %v", err)
 				metrics.RecordProcessingError(PaymentStatusQueue, "handler_error")
 				d.Reject(true)
@@ -325,22 +433,17 @@ func (r *RabbitMQ) ConsumePaymentStatus(handler func(msg *models.PaymentStatusMe
 	return nil
 }
 
-// ConsumeNotifications начинает потребление уведомлений
-func (r *RabbitMQ) ConsumeNotifications(handler func(msg *models.NotificationMessage) error) error {
-	msgs, err := r.channel.Consume(
-		NotificationQueue,
-		"",
-		false,
-		false,
-		false,
-		false,
-		nil,
-	)
+// ConsumeNotifications начинает потребление уведомлений до отмены ctx
+func (r *RabbitMQ) ConsumeNotifications(ctx context.Context, handler func(ctx context.Context, msg *models.NotificationMessage) error) error {
+	msgs, err := r.consume(ctx, NotificationQueue)
 	if err != nil {
-		return fmt.Errorf("failed to register a consumer: %w", err)
+		return err
 	}
 
+	handlerCtx := context.WithoutCancel(ctx)
+	r.consumers.Add(1)
 	go func() {
+		defer r.consumers.Done()
 		for d := range msgs {
 			var notificationMsg models.NotificationMessage
 			done := metrics.TrackProcessingTime(NotificationQueue, "processing")
@@ -354,7 +457,7 @@ func (r *RabbitMQ) ConsumeNotifications(handler func(msg *models.NotificationMes
 				continue
 			}
 
-			if err := handler(&notificationMsg); err != nil {
+			if err := handler(handlerCtx, &notificationMsg); err != nil {
 				log.Printf("Error handling notification message: %v", err)
 				metrics.RecordProcessingError(NotificationQueue, "handler_error")
 				d.Reject(true)
@@ -372,6 +475,187 @@ func (r *RabbitMQ) ConsumeNotifications(handler func(msg *models.NotificationMes
 	return nil
 }
 
+// ConsumeWebhooks начинает потребление заданий на доставку вебхуков до
+// отмены ctx
+func (r *RabbitMQ) ConsumeWebhooks(ctx context.Context, handler func(ctx context.Context, msg *models.WebhookMessage) error) error {
+	msgs, err := r.consume(ctx, WebhookQueue)
+	if err != nil {
+		return err
+	}
+
+	handlerCtx := context.WithoutCancel(ctx)
+	r.consumers.Add(1)
+	go func() {
+		defer r.consumers.Done()
+		for d := range msgs {
+			var webhookMsg models.WebhookMessage
+			done := metrics.TrackProcessingTime(WebhookQueue, "processing")
+
+			if err := json.Unmarshal(d.Body, &webhookMsg); err != nil {
+				log.Printf("Error unmarshaling webhook message: %v", err)
+				metrics.RecordProcessingError(WebhookQueue, "unmarshal_error")
+				d.Reject(false)
+				metrics.RecordDeadLetterMessage(WebhookQueue, "unmarshal_error")
+				done()
+				continue
+			}
+
+			if err := handler(handlerCtx, &webhookMsg); err != nil {
+				log.Printf("Error handling webhook message: %v", err)
+				metrics.RecordProcessingError(WebhookQueue, "handler_error")
+				r.retryWebhookDelivery(d)
+				done()
+				continue
+			}
+
+			d.Ack(false)
+			metrics.IncrementProcessedMessage(WebhookQueue, webhookMsg.EventType)
+			done()
+		}
+	}()
+
+	return nil
+}
+
+// consume регистрирует потребителя очереди и отменяет его при отмене ctx.
+// После отмены брокер перестает выдавать сообщения, и канал доставок
+// закрывается, когда потребитель обработает уже полученные. Обработчики
+// получают контекст без отмены, чтобы начатая обработка завершилась до
+// закрытия соединений; Wait дожидается ее.
+func (r *RabbitMQ) consume(ctx context.Context, queue string) (<-chan amqp.Delivery, error) {
+	tag := fmt.Sprintf("%s-%d", queue, time.Now().UnixNano())
+	msgs, err := r.channel.Consume(
+		queue,
+		tag,
+		false,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register a consumer: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		if err := r.channel.Cancel(tag, false); err != nil {
+			log.Printf("Failed to cancel consumer %s: %v", tag, err)
+		}
+	}()
+	return msgs, nil
+}
+
+// Wait дожидается завершения потребителей, отмененных через контекст, и
+// обработки полученных ими сообщений
+func (r *RabbitMQ) Wait() {
+	r.consumers.Wait()
+}
+
+// retryWebhookDelivery откладывает сообщение, которое не удалось обработать
+// из-за ошибки сервиса. Сообщение не возвращается в начало очереди, иначе
+// недоступная база данных зациклит его обработку. После
+// len(WebhookRetryDelays) отложенных попыток или при ошибке публикации
+// сообщение уходит в dead-letter.
+func (r *RabbitMQ) retryWebhookDelivery(d amqp.Delivery) {
+	retries, _ := d.Headers[webhookRetriesHeader].(int32)
+	if int(retries) >= len(WebhookRetryDelays) {
+		d.Nack(false, false)
+		metrics.RecordDeadLetterMessage(WebhookQueue, "handler_error")
+		return
+	}
+
+	delay := WebhookRetryDelays[retries]
+	err := r.channel.PublishWithContext(context.Background(),
+		"",
+		webhookRetryQueue(delay),
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:  d.ContentType,
+			Body:         d.Body,
+			MessageId:    d.MessageId,
+			Timestamp:    time.Now(),
+			DeliveryMode: amqp.Persistent,
+			Headers:      amqp.Table{webhookRetriesHeader: retries + 1},
+		},
+	)
+	if err != nil {
+		log.Printf("Failed to schedule webhook message retry: %v", err)
+		d.Nack(false, false)
+		metrics.RecordDeadLetterMessage(WebhookQueue, "retry_publish_error")
+		return
+	}
+
+	d.Ack(false)
+	metrics.IncrementRetryAttempt(WebhookQueue)
+}
+
+// SubscribePaymentEvents подписывает экземпляр сервиса на все события
+// истории статусов. Каждый экземпляр получает собственную временную очередь,
+// которая удаляется при закрытии соединения.
+func (r *RabbitMQ) SubscribePaymentEvents(handler func(event *models.PaymentStatusEvent)) error {
+	queue, err := r.channel.QueueDeclare(
+		"",
+		false,
+		true,
+		true,
+		false,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare payment event queue: %w", err)
+	}
+
+	err = r.channel.QueueBind(
+		queue.Name,
+		"event.#",
+		PaymentStatusExchange,
+		false,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to bind payment event queue: %w", err)
+	}
+
+	msgs, err := r.channel.Consume(
+		queue.Name,
+		"",
+		true,
+		true,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register a consumer: %w", err)
+	}
+
+	go func() {
+		for d := range msgs {
+			var event models.PaymentStatusEvent
+			if err := json.Unmarshal(d.Body, &event); err != nil {
+				log.Printf("Error unmarshaling payment event: %v", err)
+				continue
+			}
+			handler(&event)
+		}
+	}()
+
+	return nil
+}
+
+// CheckHealth проверяет, что соединение и канал с RabbitMQ открыты
+func (r *RabbitMQ) CheckHealth() error {
+	if r.conn.IsClosed() {
+		return fmt.Errorf("rabbitmq connection is closed")
+	}
+	if r.channel.IsClosed() {
+		return fmt.Errorf("rabbitmq channel is closed")
+	}
+	return nil
+}
+
 // Close закрывает соединение с RabbitMQ
 func (r *RabbitMQ) Close() error {
 	r.collector.Stop()
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// RuntimeConfigInfo равна 1 для хэша содержимого действующих runtime
+	// настроек. Реплики с одинаковыми настройками публикуют одинаковый хэш,
+	// поэтому по метрике видно расхождение конфигурации при раскатке.
+	RuntimeConfigInfo = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "payment_runtime_config_info",
+			Help: "The content hash of the applied runtime configuration",
+		},
+		[]string{"hash"},
+	)
+
+	// RuntimeConfigReloads считает перечитывания runtime настроек по
+	// результату: applied, unchanged или rejected
+	RuntimeConfigReloads = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_runtime_config_reloads_total",
+			Help: "The total number of runtime configuration reloads by result",
+		},
+		[]string{"result"},
+	)
+)
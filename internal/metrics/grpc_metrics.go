@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// GRPCRequests считает вызовы gRPC по методу и коду ответа
+	GRPCRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_grpc_requests_total",
+			Help: "The total number of gRPC calls by method and status code",
+		},
+		[]string{"method", "code"},
+	)
+
+	// GRPCRequestDuration измеряет длительность вызовов gRPC. Для потоков
+	// измеряется время жизни потока.
+	GRPCRequestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "payment_grpc_request_duration_seconds",
+			Help:    "gRPC call duration in seconds by method and status code",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+		},
+		[]string{"method", "code"},
+	)
+
+	// GRPCActiveStreams показывает число открытых потоков по методу
+	GRPCActiveStreams = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "payment_grpc_active_streams",
+			Help: "The current number of open gRPC streams",
+		},
+		[]string{"method"},
+	)
+
+	// GRPCPanics считает паники, перехваченные в обработчиках gRPC
+	GRPCPanics = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "payment_grpc_panics_total",
+			Help: "The total number of panics recovered in gRPC handlers",
+		},
+		[]string{"method"},
+	)
+)
+
+// ObserveGRPCRequest записывает завершенный вызов gRPC
+func ObserveGRPCRequest(method, code string, duration time.Duration) {
+	GRPCRequests.WithLabelValues(method, code).Inc()
+	GRPCRequestDuration.WithLabelValues(method, code).Observe(duration.Seconds())
+}
@@ -65,13 +65,9 @@ func (c *QueueCollector) collectMetrics() error {
 
 		// Обновляем метрики
 		QueueSize.WithLabelValues(queueName).Set(float64(queue.Messages))
+		// Неподтвержденные сообщения AMQP не сообщает, они видны в метриках
+		// плагина rabbitmq_prometheus
 		QueueConsumers.WithLabelValues(queueName).Set(float64(queue.Consumers))
-
-		// Если очередь пуста и есть сообщения в unacked, возможно есть проблемы с обработкой
-		if queue.Messages == 0 && queue.Consumers > 0 && queue.MessagesUnacknowledged > 0 {
-			log.Printf("Warning: Queue %s has %d unacknowledged messages", 
-				queueName, queue.MessagesUnacknowledged)
-		}
 	}
 
 	return nil
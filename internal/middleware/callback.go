@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CallbackTokenHeader содержит общий секрет, которым внешние шлюзы
+// подтверждают callback-запросы
+const CallbackTokenHeader = "X-Callback-Token"
+
+// CallbackTokenMiddleware проверяет общий секрет в заголовке или параметре token
+func CallbackTokenMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := c.GetHeader(CallbackTokenHeader)
+		if provided == "" {
+			provided = c.Query("token")
+		}
+
+		if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid callback token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"fmt"
+	"go_payment/internal/ratelimit"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitMiddleware ограничивает частоту запросов пользователя, а до
+// аутентификации — IP адреса клиента
+func RateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if userID, ok := c.Get("user_id"); ok {
+			key = fmt.Sprintf("user:%v", userID)
+		}
+
+		if !limiter.Allow(key) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
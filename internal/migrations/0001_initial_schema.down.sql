@@ -0,0 +1,20 @@
+DROP TABLE IF EXISTS email_suppressions;
+DROP TABLE IF EXISTS device_tokens;
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS notification_template_versions;
+DROP TABLE IF EXISTS notification_templates;
+DROP TABLE IF EXISTS notification_attempts;
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_endpoints;
+DROP TABLE IF EXISTS document_sequences;
+DROP TABLE IF EXISTS receipts;
+DROP TABLE IF EXISTS payment_status_events;
+DROP TABLE IF EXISTS refunds;
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS payment_methods;
+DROP TABLE IF EXISTS customers;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS permissions;
+DROP TABLE IF EXISTS users;
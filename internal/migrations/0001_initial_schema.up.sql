@@ -0,0 +1,307 @@
+-- Исходная схема. Таблицы и индексы совпадают с созданными AutoMigrate,
+-- поэтому миграция применяется и к существующим базам: уже созданные
+-- объекты пропускаются, недостающие (payments, refunds) создаются.
+-- Migrator сверяет колонки пропущенных таблиц с этой схемой и не
+-- записывает версию, если таблица отличается (ErrSchemaMismatch).
+
+CREATE TABLE IF NOT EXISTS users (
+    id            bigserial PRIMARY KEY,
+    created_at    timestamptz,
+    updated_at    timestamptz,
+    deleted_at    timestamptz,
+    email         text,
+    password      text,
+    role          text,
+    first_name    text,
+    last_name     text,
+    locale        text,
+    last_login    timestamptz,
+    is_active     boolean DEFAULT true,
+    refresh_token text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users (email);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    id          bigserial PRIMARY KEY,
+    name        text,
+    description text
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_permissions_name ON permissions (name);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_id       text,
+    permission_id bigint,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           text PRIMARY KEY,
+    name         text,
+    prefix       text,
+    key_hash     text,
+    role         text,
+    created_by   text,
+    expires_at   timestamptz,
+    revoked_at   timestamptz,
+    last_used_at timestamptz,
+    created_at   timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_prefix ON api_keys (prefix);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_key_hash ON api_keys (key_hash);
+
+CREATE TABLE IF NOT EXISTS customers (
+    id         text PRIMARY KEY,
+    email      text,
+    name       text,
+    phone      text,
+    metadata   jsonb,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_customers_email ON customers (email);
+CREATE INDEX IF NOT EXISTS idx_customers_created_at ON customers (created_at);
+
+CREATE TABLE IF NOT EXISTS payment_methods (
+    id             text PRIMARY KEY,
+    customer_id    text,
+    provider_type  text,
+    provider_token text,
+    type           text,
+    brand          text,
+    last4          text,
+    exp_month      bigint,
+    exp_year       bigint,
+    is_default     boolean,
+    created_at     timestamptz,
+    updated_at     timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_payment_methods_customer_id ON payment_methods (customer_id);
+
+CREATE TABLE IF NOT EXISTS payments (
+    id              text PRIMARY KEY,
+    created_at      timestamptz,
+    updated_at      timestamptz,
+    deleted_at      timestamptz,
+    order_id        text,
+    customer_id     text,
+    customer_email  text,
+    amount          decimal,
+    currency        text,
+    description     text,
+    locale          text,
+    status          text,
+    provider_type   text,
+    transaction_id  text,
+    payment_details jsonb,
+    metadata        jsonb,
+    error_message   text,
+    completed_at    timestamptz,
+    capture_method  text,
+    captured_amount decimal,
+    refunded_amount decimal
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_order_id ON payments (order_id);
+CREATE INDEX IF NOT EXISTS idx_payments_deleted_at ON payments (deleted_at);
+
+CREATE TABLE IF NOT EXISTS refunds (
+    id          text PRIMARY KEY,
+    created_at  timestamptz,
+    updated_at  timestamptz,
+    deleted_at  timestamptz,
+    payment_id  text,
+    order_id    text,
+    amount      decimal,
+    currency    text,
+    status      text,
+    reason      text,
+    refunded_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_refunds_order_id ON refunds (order_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_deleted_at ON refunds (deleted_at);
+
+CREATE TABLE IF NOT EXISTS payment_status_events (
+    sequence    bigserial PRIMARY KEY,
+    order_id    text,
+    customer_id text,
+    provider    text,
+    old_status  text,
+    new_status  text,
+    amount      decimal,
+    currency    text,
+    created_at  timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_payment_status_events_order_id ON payment_status_events (order_id);
+CREATE INDEX IF NOT EXISTS idx_payment_status_events_customer_id ON payment_status_events (customer_id);
+
+CREATE TABLE IF NOT EXISTS receipts (
+    id             text PRIMARY KEY,
+    number         text,
+    kind           text,
+    payment_id     text,
+    refund_id      text,
+    order_id       text,
+    customer_email text,
+    locale         text,
+    currency       text,
+    line_items     text,
+    taxes          text,
+    merchant       text,
+    subtotal       decimal,
+    tax_total      decimal,
+    total          decimal,
+    html           text,
+    pdf            bytea,
+    issued_at      timestamptz,
+    created_at     timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_receipts_number ON receipts (number);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_receipt_source ON receipts (kind, payment_id, refund_id);
+CREATE INDEX IF NOT EXISTS idx_receipts_order_id ON receipts (order_id);
+
+CREATE TABLE IF NOT EXISTS document_sequences (
+    name       text PRIMARY KEY,
+    value      bigint NOT NULL,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id                   text PRIMARY KEY,
+    url                  text,
+    secret               text,
+    description          text,
+    event_types          jsonb,
+    is_active            boolean,
+    consecutive_failures bigint,
+    disabled_at          timestamptz,
+    created_at           timestamptz,
+    updated_at           timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id            text PRIMARY KEY,
+    endpoint_id   text,
+    event_id      text,
+    event_type    text,
+    attempt       bigint,
+    status        text,
+    response_code bigint,
+    response_body text,
+    error         text,
+    duration_ms   bigint,
+    next_retry_at timestamptz,
+    created_at    timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_id ON webhook_deliveries (endpoint_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_event_id ON webhook_deliveries (event_id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id            text PRIMARY KEY,
+    type          text,
+    status        text,
+    user_id       text,
+    recipient     text,
+    template      text,
+    data          text,
+    digest_id     text,
+    subject       text,
+    content       text,
+    text_content  text,
+    "from"        text,
+    reply_to      text,
+    attachments   text,
+    metadata      text,
+    transactional boolean,
+    retry_count   bigint,
+    created_at    timestamptz,
+    updated_at    timestamptz,
+    scheduled_at  timestamptz,
+    sent_at       timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_notifications_status ON notifications (status);
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications (user_id);
+CREATE INDEX IF NOT EXISTS idx_notifications_recipient ON notifications (recipient);
+CREATE INDEX IF NOT EXISTS idx_notifications_template ON notifications (template);
+CREATE INDEX IF NOT EXISTS idx_notifications_digest_id ON notifications (digest_id);
+CREATE INDEX IF NOT EXISTS idx_notifications_created_at ON notifications (created_at);
+CREATE INDEX IF NOT EXISTS idx_notifications_scheduled_at ON notifications (scheduled_at);
+
+CREATE TABLE IF NOT EXISTS notification_attempts (
+    id                  text PRIMARY KEY,
+    notification_id     text,
+    attempt             bigint,
+    channel             text,
+    provider            text,
+    status              text,
+    provider_message_id text,
+    response            text,
+    error               text,
+    duration_ms         bigint,
+    created_at          timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_notification_attempts_notification_id ON notification_attempts (notification_id);
+
+CREATE TABLE IF NOT EXISTS notification_templates (
+    id            text PRIMARY KEY,
+    name          text,
+    locale        text DEFAULT 'en',
+    type          text,
+    subject       text,
+    content       text,
+    text_content  text,
+    from_address  text,
+    reply_to      text,
+    variables     text,
+    metadata      text,
+    version       bigint,
+    transactional boolean,
+    is_active     boolean,
+    created_at    timestamptz,
+    updated_at    timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_template_name_locale ON notification_templates (name, locale);
+
+CREATE TABLE IF NOT EXISTS notification_template_versions (
+    id           text PRIMARY KEY,
+    template_id  text,
+    version      bigint,
+    subject      text,
+    content      text,
+    text_content text,
+    variables    text,
+    created_at   timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_template_version ON notification_template_versions (template_id, version);
+
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id    text PRIMARY KEY,
+    channels   text,
+    enabled    boolean,
+    schedule   text,
+    digest     text,
+    updated_at timestamptz
+);
+
+CREATE TABLE IF NOT EXISTS device_tokens (
+    id           text PRIMARY KEY,
+    user_id      text,
+    platform     text,
+    token        text,
+    app_version  text,
+    last_seen_at timestamptz,
+    created_at   timestamptz,
+    updated_at   timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_device_tokens_user_id ON device_tokens (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_device_tokens_token ON device_tokens (token);
+
+CREATE TABLE IF NOT EXISTS email_suppressions (
+    email           text PRIMARY KEY,
+    reason          text,
+    source          text,
+    details         text,
+    notification_id text,
+    created_at      timestamptz,
+    updated_at      timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_email_suppressions_reason ON email_suppressions (reason);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_refunds_payment_id;
+DROP INDEX IF EXISTS idx_customers_created_at_id;
+DROP INDEX IF EXISTS idx_payments_status;
+DROP INDEX IF EXISTS idx_payments_customer_id;
+DROP INDEX IF EXISTS idx_payments_created_at_id;
@@ -0,0 +1,7 @@
+-- Индексы постраничного списка платежей и клиентов: сортировка по
+-- (created_at, id) и частые фильтры ListPayments
+CREATE INDEX IF NOT EXISTS idx_payments_created_at_id ON payments (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_payments_customer_id ON payments (customer_id);
+CREATE INDEX IF NOT EXISTS idx_payments_status ON payments (status);
+CREATE INDEX IF NOT EXISTS idx_customers_created_at_id ON customers (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_refunds_payment_id ON refunds (payment_id);
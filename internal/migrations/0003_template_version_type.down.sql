@@ -0,0 +1 @@
+ALTER TABLE notification_template_versions DROP COLUMN IF EXISTS type;
@@ -0,0 +1,8 @@
+-- Тип шаблона сохраняется в каждой версии: предпросмотр старой версии
+-- должен рендериться для канала, для которого она была написана
+ALTER TABLE notification_template_versions ADD COLUMN IF NOT EXISTS type text;
+
+UPDATE notification_template_versions v
+SET type = t.type
+FROM notification_templates t
+WHERE v.template_id = t.id AND v.type IS NULL;
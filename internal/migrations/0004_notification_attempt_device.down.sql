@@ -0,0 +1 @@
+ALTER TABLE notification_attempts DROP COLUMN IF EXISTS device_id;
@@ -0,0 +1,3 @@
+-- Push-уведомления сохраняют попытку для каждого устройства, чтобы повтор
+-- досылал уведомление только устройствам, которые его не получили
+ALTER TABLE notification_attempts ADD COLUMN IF NOT EXISTS device_id text;
@@ -0,0 +1,3 @@
+SELECT setval('payment_status_events_sequence_seq', COALESCE((SELECT MAX(sequence) FROM payment_status_events), 0) + 1, false);
+ALTER TABLE payment_status_events ALTER COLUMN sequence SET DEFAULT nextval('payment_status_events_sequence_seq');
+DELETE FROM document_sequences WHERE name = 'payment_status_events';
@@ -0,0 +1,9 @@
+-- Sequence событий истории статусов выдается счетчиком document_sequences
+-- под блокировкой строки до конца транзакции, поэтому номера растут в порядке
+-- фиксации и не имеют пропусков. bigserial выдавал номера до фиксации, и
+-- подписчик мог пропустить событие, зафиксированное позже события с большим
+-- номером.
+INSERT INTO document_sequences (name, value, updated_at)
+SELECT 'payment_status_events', COALESCE(MAX(sequence), 0), now() FROM payment_status_events
+ON CONFLICT (name) DO NOTHING;
+ALTER TABLE payment_status_events ALTER COLUMN sequence DROP DEFAULT;
@@ -0,0 +1,200 @@
+package migrations
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// migrationFS собирает файловую систему из имен файлов с содержимым-заглушкой
+func migrationFS(names ...string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for _, name := range names {
+		fsys[name] = &fstest.MapFile{Data: []byte("-- " + name)}
+	}
+	return fsys
+}
+
+func TestLoadOrdersByVersion(t *testing.T) {
+	fsys := migrationFS(
+		"10_tenth.up.sql", "10_tenth.down.sql",
+		"2_second.up.sql", "2_second.down.sql",
+		"0001_first.down.sql", "0001_first.up.sql",
+	)
+
+	migrations, err := load(fsys)
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+
+	want := []struct {
+		version int64
+		name    string
+	}{{1, "first"}, {2, "second"}, {10, "tenth"}}
+	if len(migrations) != len(want) {
+		t.Fatalf("load() returned %d migrations, want %d", len(migrations), len(want))
+	}
+	for i, w := range want {
+		m := migrations[i]
+		if m.Version != w.version || m.Name != w.name {
+			t.Errorf("migrations[%d] = %d_%s, want %d_%s", i, m.Version, m.Name, w.version, w.name)
+		}
+		if !strings.Contains(m.Up, ".up.sql") || !strings.Contains(m.Down, ".down.sql") {
+			t.Errorf("migrations[%d] has up %q and down %q", i, m.Up, m.Down)
+		}
+	}
+}
+
+func TestLoadValidatesNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		wantErr string
+	}{
+		{name: "no version", files: []string{"initial.up.sql"}, wantErr: "invalid migration file name"},
+		{name: "no direction", files: []string{"1_initial.sql"}, wantErr: "invalid migration file name"},
+		{name: "upper case name", files: []string{"1_Initial.up.sql", "1_Initial.down.sql"}, wantErr: "invalid migration file name"},
+		{name: "not sql", files: []string{"1_initial.up.txt"}, wantErr: "invalid migration file name"},
+		{name: "zero version", files: []string{"0_initial.up.sql", "0_initial.down.sql"}, wantErr: "invalid migration version"},
+		{name: "different names", files: []string{"1_initial.up.sql", "1_schema.down.sql"}, wantErr: "has different names"},
+		{name: "missing down", files: []string{"1_initial.up.sql"}, wantErr: "must have both up and down files"},
+		{name: "missing up", files: []string{"1_initial.down.sql"}, wantErr: "must have both up and down files"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := load(migrationFS(tt.files...))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("load() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+var (
+	createdObject = regexp.MustCompile(`(?m)^CREATE (?:UNIQUE )?(TABLE|INDEX) IF NOT EXISTS (\w+)`)
+	addedColumn   = regexp.MustCompile(`(?m)^ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+)`)
+)
+
+// TestEmbeddedMigrationsRoundTrip проверяет, что откат каждой встроенной
+// миграции удаляет все созданные ею таблицы, индексы и колонки
+func TestEmbeddedMigrationsRoundTrip(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if len(migrations) == 0 || migrations[0].Version != baselineVersion {
+		t.Fatalf("first migration must be the baseline version %d", baselineVersion)
+	}
+
+	for _, m := range migrations {
+		var want []string
+		for _, match := range createdObject.FindAllStringSubmatch(m.Up, -1) {
+			want = append(want, "DROP "+match[1]+" IF EXISTS "+match[2]+";")
+		}
+		for _, match := range addedColumn.FindAllStringSubmatch(m.Up, -1) {
+			want = append(want, "ALTER TABLE "+match[1]+" DROP COLUMN IF EXISTS "+match[2]+";")
+		}
+		for _, stmt := range want {
+			if strings.Contains(stmt, "DROP INDEX") && tableDropped(m, stmt) {
+				continue
+			}
+			if !strings.Contains(m.Down, stmt) {
+				t.Errorf("migration %d_%s: down does not contain %q", m.Version, m.Name, stmt)
+			}
+		}
+	}
+}
+
+// tableDropped сообщает, удаляется ли индекс вместе со своей таблицей,
+// созданной той же миграцией
+func tableDropped(m Migration, dropIndex string) bool {
+	index := strings.TrimSuffix(strings.TrimPrefix(dropIndex, "DROP INDEX IF EXISTS "), ";")
+	match := regexp.MustCompile(`(?m)^CREATE (?:UNIQUE )?INDEX IF NOT EXISTS ` + index + ` ON (\w+)`).FindStringSubmatch(m.Up)
+	return match != nil && strings.Contains(m.Down, "DROP TABLE IF EXISTS "+match[1]+";")
+}
+
+func TestBaselineTableColumns(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	tables, err := tableColumns(migrations[0].Up)
+	if err != nil {
+		t.Fatalf("tableColumns() error = %v", err)
+	}
+
+	if got, want := len(tables), strings.Count(migrations[0].Up, "CREATE TABLE "); got != want {
+		t.Errorf("tableColumns() parsed %d tables, want %d", got, want)
+	}
+	checks := map[string]string{
+		"payments.id":                    "text",
+		"payments.amount":                "numeric",
+		"payments.metadata":              "jsonb",
+		"users.id":                       "int8",
+		"users.is_active":                "bool",
+		"notifications.from":             "text",
+		"receipts.pdf":                   "bytea",
+		"payment_status_events.sequence": "int8",
+	}
+	for column, want := range checks {
+		parts := strings.SplitN(column, ".", 2)
+		if got := tables[parts[0]][parts[1]]; got != want {
+			t.Errorf("%s type = %q, want %q", column, got, want)
+		}
+	}
+	if _, ok := tables["role_permissions"]["PRIMARY"]; ok {
+		t.Error("table constraint parsed as a column")
+	}
+}
+
+func TestSchemaDiff(t *testing.T) {
+	expected := map[string]map[string]string{
+		"payments": {"id": "text", "amount": "numeric"},
+		"refunds":  {"id": "text"},
+	}
+
+	tests := []struct {
+		name   string
+		actual map[string]map[string]string
+		want   []string
+	}{
+		{
+			name: "same schema",
+			actual: map[string]map[string]string{
+				"payments": {"id": "text", "amount": "numeric"},
+				"refunds":  {"id": "text"},
+			},
+		},
+		{
+			name: "extra columns are allowed",
+			actual: map[string]map[string]string{
+				"payments": {"id": "text", "amount": "numeric", "legacy": "text"},
+				"refunds":  {"id": "text"},
+			},
+		},
+		{
+			name: "missing column and different type",
+			actual: map[string]map[string]string{
+				"payments": {"id": "int8"},
+				"refunds":  {"id": "text"},
+			},
+			want: []string{"payments.amount is missing", "payments.id has type int8, expected text"},
+		},
+		{
+			name:   "missing table",
+			actual: map[string]map[string]string{"payments": {"id": "text", "amount": "numeric"}},
+			want:   []string{"refunds.id is missing"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := schemaDiff(expected, tt.actual)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("schemaDiff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
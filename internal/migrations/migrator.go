@@ -0,0 +1,329 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrSchemaVersion возвращается, если версия схемы базы данных не
+	// совпадает с версией, ожидаемой сборкой
+	ErrSchemaVersion = errors.New("unexpected database schema version")
+	// ErrUnknownVersion возвращается для версии, которой нет среди миграций
+	ErrUnknownVersion = errors.New("unknown migration version")
+)
+
+// lockID — ключ pg_advisory_lock, общий для всех экземпляров сервиса.
+// Реплики, запущенные одновременно, применяют миграции по очереди.
+const lockID int64 = 0x7061796d656e74
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    bigint PRIMARY KEY,
+    name       text NOT NULL,
+    applied_at timestamptz NOT NULL DEFAULT now()
+)`
+
+// Status представляет состояние одной миграции
+type Status struct {
+	Version int64
+	Name    string
+	// AppliedAt пуст для непримененной миграции
+	AppliedAt *time.Time
+	// Unknown означает миграцию, примененную более новой сборкой
+	Unknown bool
+}
+
+// Migrator применяет встроенные миграции к базе данных. Примененные
+// версии хранятся в таблице schema_migrations, каждая миграция
+// выполняется в отдельной транзакции вместе с записью о ней.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New создает Migrator для базы данных db
+func New(db *sql.DB) (*Migrator, error) {
+	migrations, err := load(files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest возвращает версию схемы, ожидаемую сборкой
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version возвращает текущую версию схемы. Для базы без примененных
+// миграций возвращается 0.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	applied, err := appliedMigrations(ctx, m.db)
+	if err != nil {
+		return 0, err
+	}
+	return currentVersion(applied), nil
+}
+
+// Check проверяет, что схема базы данных имеет версию Latest. Сервис не
+// должен работать со схемой, которую не ожидает: с непримененными
+// миграциями или с миграциями более новой сборки.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version != m.Latest() {
+		return fmt.Errorf("%w: database is at version %d, expected %d", ErrSchemaVersion, version, m.Latest())
+	}
+	return nil
+}
+
+// Status возвращает состояние всех миграций по возрастанию версии
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := appliedMigrations(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &record.appliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for version, record := range applied {
+		appliedAt := record.appliedAt
+		statuses = append(statuses, Status{Version: version, Name: record.name, AppliedAt: &appliedAt, Unknown: true})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Up применяет все непримененные миграции
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down откатывает последнюю примененную миграцию
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		current := currentVersion(applied)
+		if current == 0 {
+			log.Printf("No migrations to roll back")
+			return nil
+		}
+
+		var target int64
+		for _, migration := range m.migrations {
+			if migration.Version < current {
+				target = migration.Version
+			}
+		}
+		return m.migrate(ctx, conn, applied, target)
+	})
+}
+
+// To применяет или откатывает миграции до версии version. Версия 0
+// откатывает все миграции.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version != 0 && !m.known(version) {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		return m.migrate(ctx, conn, applied, version)
+	})
+}
+
+// migrate откатывает примененные миграции новее target по убыванию
+// версии, затем применяет непримененные до target включительно
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, applied map[int64]appliedMigration, target int64) error {
+	for version := range applied {
+		if !m.known(version) {
+			return fmt.Errorf("%w: migration %d was applied by a newer build", ErrSchemaVersion, version)
+		}
+	}
+
+	changed := false
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; ok && migration.Version > target {
+			if err := m.apply(ctx, conn, migration, false); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok && migration.Version <= target {
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			changed = true
+		}
+	}
+
+	if !changed {
+		log.Printf("Database schema is already at version %d", target)
+	}
+	return nil
+}
+
+// apply выполняет миграцию или ее откат в транзакции вместе с изменением
+// schema_migrations, поэтому ошибка не оставляет схему в промежуточном
+// состоянии. После исходной схемы проверяются колонки таблиц, принятых
+// из базы AutoMigrate.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	direction, script := "up", migration.Up
+	if !up {
+		direction, script = "down", migration.Down
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin migration transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	start := time.Now()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %d_%s %s failed: %w", migration.Version, migration.Name, direction, err)
+	}
+	if up && migration.Version == baselineVersion {
+		if err := verifySchema(ctx, tx, migration); err != nil {
+			return err
+		}
+	}
+	if up {
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	log.Printf("Migration %d_%s %s applied in %s", migration.Version, migration.Name, direction, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// withLock выполняет fn под pg_advisory_lock. Блокировка принадлежит
+// сессии, поэтому миграции выполняются в одном соединении с ней.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire database connection: %w", err)
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", lockID).Scan(&locked); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	if !locked {
+		log.Printf("Waiting for another instance to finish migrations")
+		if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+	}
+	defer func() {
+		// Соединение возвращается в пул, блокировка не должна остаться в нем
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID); err != nil {
+			log.Printf("Failed to release migration lock: %v", err)
+		}
+	}()
+
+	if _, err := conn.ExecContext(ctx, createTable); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return fn(conn)
+}
+
+func (m *Migrator) known(version int64) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// appliedMigration — запись таблицы schema_migrations
+type appliedMigration struct {
+	name      string
+	appliedAt time.Time
+}
+
+// querier — общие методы *sql.DB и *sql.Conn
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// appliedMigrations возвращает примененные миграции. Таблица
+// schema_migrations не создается, чтобы проверка версии не изменяла базу.
+func appliedMigrations(ctx context.Context, q querier) (map[int64]appliedMigration, error) {
+	var exists bool
+	if err := q.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	applied := map[int64]appliedMigration{}
+	if !exists {
+		return applied, nil
+	}
+
+	rows, err := q.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			version int64
+			record  appliedMigration
+		)
+		if err := rows.Scan(&version, &record.name, &record.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read schema version: %w", err)
+		}
+		applied[version] = record
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return applied, nil
+}
+
+// currentVersion возвращает наибольшую примененную версию
+func currentVersion(applied map[int64]appliedMigration) int64 {
+	var current int64
+	for version := range applied {
+		if version > current {
+			current = version
+		}
+	}
+	return current
+}
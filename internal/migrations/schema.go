@@ -0,0 +1,117 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrSchemaMismatch возвращается, если таблица, созданная до миграций,
+// не совпадает с таблицей исходной схемы
+var ErrSchemaMismatch = errors.New("existing table does not match the migration schema")
+
+// baselineVersion — миграция исходной схемы. Она применяется и к базам,
+// созданным AutoMigrate: существующие таблицы пропускаются CREATE TABLE
+// IF NOT EXISTS, поэтому после нее колонки всех таблиц сверяются со
+// схемой, и отличающаяся база не получает версию.
+const baselineVersion int64 = 1
+
+var createTableStatement = regexp.MustCompile(`(?ms)^CREATE TABLE IF NOT EXISTS (\w+) \((.*?)^\);`)
+
+// columnTypes сопоставляет типы колонок миграций с udt_name из
+// information_schema.columns
+var columnTypes = map[string]string{
+	"text":        "text",
+	"bigint":      "int8",
+	"bigserial":   "int8",
+	"decimal":     "numeric",
+	"boolean":     "bool",
+	"timestamptz": "timestamptz",
+	"jsonb":       "jsonb",
+	"bytea":       "bytea",
+}
+
+// tableColumns возвращает колонки таблиц, создаваемых скриптом, в виде
+// таблица -> колонка -> udt_name
+func tableColumns(script string) (map[string]map[string]string, error) {
+	tables := map[string]map[string]string{}
+	for _, match := range createTableStatement.FindAllStringSubmatch(script, -1) {
+		columns := map[string]string{}
+		for _, line := range strings.Split(match[2], "\n") {
+			line = strings.TrimSuffix(strings.TrimSpace(line), ",")
+			if line == "" || strings.HasPrefix(line, "PRIMARY KEY") {
+				continue
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("table %s: invalid column definition %q", match[1], line)
+			}
+			udt, ok := columnTypes[strings.ToLower(fields[1])]
+			if !ok {
+				return nil, fmt.Errorf("table %s: unsupported column type %q", match[1], fields[1])
+			}
+			columns[strings.Trim(fields[0], `"`)] = udt
+		}
+		tables[match[1]] = columns
+	}
+	return tables, nil
+}
+
+// schemaDiff описывает колонки expected, которых нет в actual или
+// которые имеют другой тип. Лишние колонки допускаются: AutoMigrate не
+// удаляет колонки удаленных полей.
+func schemaDiff(expected, actual map[string]map[string]string) []string {
+	var problems []string
+	for table, columns := range expected {
+		for column, udt := range columns {
+			got, ok := actual[table][column]
+			switch {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("%s.%s is missing", table, column))
+			case got != udt:
+				problems = append(problems, fmt.Sprintf("%s.%s has type %s, expected %s", table, column, got, udt))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// verifySchema сверяет колонки таблиц, создаваемых миграцией, с базой
+func verifySchema(ctx context.Context, q querier, migration Migration) error {
+	expected, err := tableColumns(migration.Up)
+	if err != nil {
+		return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	rows, err := q.QueryContext(ctx, `SELECT table_name, column_name, udt_name
+FROM information_schema.columns
+WHERE table_schema = current_schema()`)
+	if err != nil {
+		return fmt.Errorf("failed to read table columns: %w", err)
+	}
+	defer rows.Close()
+
+	actual := map[string]map[string]string{}
+	for rows.Next() {
+		var table, column, udt string
+		if err := rows.Scan(&table, &column, &udt); err != nil {
+			return fmt.Errorf("failed to read table columns: %w", err)
+		}
+		if actual[table] == nil {
+			actual[table] = map[string]string{}
+		}
+		actual[table][column] = udt
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read table columns: %w", err)
+	}
+
+	if problems := schemaDiff(expected, actual); len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrSchemaMismatch, strings.Join(problems, "; "))
+	}
+	return nil
+}
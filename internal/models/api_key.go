@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// APIKey представляет ключ доступа сервисного клиента. Сам ключ не хранится,
+// сохраняется только его SHA-256 хэш и префикс для поиска в журналах.
+type APIKey struct {
+	ID         string     `json:"id" gorm:"primaryKey"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix" gorm:"index"`
+	KeyHash    string     `json:"-" gorm:"uniqueIndex"`
+	Role       Role       `json:"role"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Active проверяет, что ключ не отозван и не истек
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Customer представляет клиента, от имени которого проводятся платежи
+type Customer struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	Email     string    `json:"email" gorm:"index"`
+	Name      string    `json:"name"`
+	Phone     string    `json:"phone,omitempty"`
+	Metadata  JSON      `json:"metadata"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PaymentMethodType определяет тип сохраненного способа оплаты
+type PaymentMethodType string
+
+const (
+	PaymentMethodTypeCard   PaymentMethodType = "card"
+	PaymentMethodTypePayPal PaymentMethodType = "paypal"
+)
+
+// PaymentMethod представляет сохраненный у провайдера способ оплаты клиента.
+// Данные карты хранятся только у провайдера, в системе хранится его токен и
+// сведения для отображения.
+type PaymentMethod struct {
+	ID            string            `json:"id" gorm:"primaryKey"`
+	CustomerID    string            `json:"customer_id" gorm:"index"`
+	ProviderType  PaymentProvider   `json:"provider_type"`
+	ProviderToken string            `json:"-"`
+	Type          PaymentMethodType `json:"type"`
+	Brand         string            `json:"brand,omitempty"`
+	Last4         string            `json:"last4,omitempty"`
+	ExpMonth      int               `json:"exp_month,omitempty"`
+	ExpYear       int               `json:"exp_year,omitempty"`
+	IsDefault     bool              `json:"is_default"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// DevicePlatform определяет платформу устройства для push-уведомлений
+type DevicePlatform string
+
+const (
+	DevicePlatformIOS     DevicePlatform = "ios"
+	DevicePlatformAndroid DevicePlatform = "android"
+	DevicePlatformWeb     DevicePlatform = "web"
+)
+
+// DeviceToken представляет зарегистрированное устройство пользователя
+type DeviceToken struct {
+	ID         string         `json:"id" gorm:"primaryKey"`
+	UserID     string         `json:"user_id" gorm:"index"`
+	Platform   DevicePlatform `json:"platform"`
+	Token      string         `json:"token" gorm:"uniqueIndex"`
+	AppVersion string         `json:"app_version,omitempty"`
+	LastSeenAt time.Time      `json:"last_seen_at"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // PaymentMessage представляет сообщение о платеже для очереди
 type PaymentMessage struct {
@@ -11,6 +14,7 @@ type PaymentMessage struct {
 	Provider      PaymentProvider `json:"provider"`
 	CustomerID    string          `json:"customer_id"`
 	CustomerEmail string          `json:"customer_email"`
+	Locale        string          `json:"locale,omitempty"`
 	CreatedAt     time.Time       `json:"created_at"`
 	MetaData      JSON           `json:"metadata,omitempty"`
 }
@@ -24,12 +28,12 @@ type PaymentStatusMessage struct {
 	Description string        `json:"description,omitempty"`
 }
 
-// NotificationMessage представляет сообщение для уведомления
-type NotificationMessage struct {
-	Type      string    `json:"type"`      // email, sms, webhook
-	Recipient string    `json:"recipient"` // email address, phone number, or webhook URL
-	Subject   string    `json:"subject"`
-	Content   string    `json:"content"`
-	Metadata  JSON      `json:"metadata,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
+// WebhookMessage представляет задание на доставку вебхука в endpoint
+type WebhookMessage struct {
+	EventID    string          `json:"event_id"`
+	EventType  string          `json:"event_type"`
+	EndpointID string          `json:"endpoint_id"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempt    int             `json:"attempt"`
+	CreatedAt  time.Time       `json:"created_at"`
 }
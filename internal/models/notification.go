@@ -20,48 +20,179 @@ const (
 	NotificationStatusSent      NotificationStatus = "sent"
 	NotificationStatusFailed    NotificationStatus = "failed"
 	NotificationStatusDelivered NotificationStatus = "delivered"
+	// NotificationStatusScheduled означает, что отправка отложена до ScheduledAt
+	NotificationStatusScheduled NotificationStatus = "scheduled"
+	// NotificationStatusCancelled означает, что отложенное уведомление отменено
+	NotificationStatusCancelled NotificationStatus = "cancelled"
+	// NotificationStatusSkipped означает, что пользователь отключил канал уведомления
+	NotificationStatusSkipped NotificationStatus = "skipped"
+	// NotificationStatusBatched означает, что уведомление ожидает сводки,
+	// которая будет сформирована в ScheduledAt
+	NotificationStatusBatched NotificationStatus = "batched"
+	// NotificationStatusDigested означает, что уведомление отправлено в
+	// составе сводки DigestID
+	NotificationStatusDigested NotificationStatus = "digested"
 )
 
-// NotificationMessage представляет сообщение уведомления
+// IsFinal сообщает, что обработка уведомления завершена и повторно
+// доставленное из очереди сообщение не должно его отправлять. Статус
+// отправленного уведомления дальше меняет только провайдер.
+func (s NotificationStatus) IsFinal() bool {
+	switch s {
+	case NotificationStatusSent, NotificationStatusDelivered, NotificationStatusFailed,
+		NotificationStatusCancelled, NotificationStatusSkipped, NotificationStatusDigested:
+		return true
+	}
+	return false
+}
+
+// NotificationMessage представляет сообщение уведомления. UserID связывает
+// сообщение с настройками уведомлений пользователя. Transactional сообщения
+// (например, чеки) отправляются и во время тихих часов.
 type NotificationMessage struct {
-	ID          string             `json:"id"`
+	ID          string             `json:"id" gorm:"primaryKey"`
 	Type        NotificationType   `json:"type"`
-	Status      NotificationStatus `json:"status"`
-	Recipient   string            `json:"recipient"`
+	Status      NotificationStatus `json:"status" gorm:"index"`
+	UserID      string            `json:"user_id,omitempty" gorm:"index"`
+	Recipient   string            `json:"recipient" gorm:"index"`
+	// Template и Data содержат имя шаблона и данные рендеринга, по ним
+	// уведомления группируются в сводки
+	Template    string                 `json:"template,omitempty" gorm:"index"`
+	Data        map[string]interface{} `json:"data,omitempty" gorm:"serializer:json"`
+	DigestID    string                 `json:"digest_id,omitempty" gorm:"index"`
 	Subject     string            `json:"subject"`
 	Content     string            `json:"content"`
-	Metadata    map[string]string `json:"metadata,omitempty"`
+	// TextContent содержит текстовую версию письма для multipart/alternative
+	TextContent string            `json:"text_content,omitempty"`
+	From        string            `json:"from,omitempty"`
+	ReplyTo     string            `json:"reply_to,omitempty"`
+	Attachments []NotificationAttachment `json:"attachments,omitempty" gorm:"serializer:json"`
+	Metadata    map[string]string `json:"metadata,omitempty" gorm:"serializer:json"`
+	Transactional bool            `json:"transactional"`
 	RetryCount  int               `json:"retry_count"`
-	CreatedAt   time.Time         `json:"created_at"`
+	CreatedAt   time.Time         `json:"created_at" gorm:"index"`
 	UpdatedAt   time.Time         `json:"updated_at"`
-	ScheduledAt *time.Time        `json:"scheduled_at,omitempty"`
+	ScheduledAt *time.Time        `json:"scheduled_at,omitempty" gorm:"index"`
 	SentAt      *time.Time        `json:"sent_at,omitempty"`
 }
 
-// NotificationTemplate представляет шаблон уведомления
+// TableName задает имя таблицы для NotificationMessage
+func (NotificationMessage) TableName() string {
+	return "notifications"
+}
+
+// NotificationAttachment описывает вложение письма. Содержимое передается
+// в Data либо формируется при отправке источником Source по ссылке Ref,
+// например квитанция по идентификатору платежа.
+type NotificationAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Source      string `json:"source,omitempty"`
+	Ref         string `json:"ref,omitempty"`
+	Data        []byte `json:"data,omitempty"`
+}
+
+// NotificationAttemptStatus определяет результат попытки отправки
+type NotificationAttemptStatus string
+
+const (
+	NotificationAttemptSucceeded NotificationAttemptStatus = "succeeded"
+	NotificationAttemptFailed    NotificationAttemptStatus = "failed"
+)
+
+// NotificationAttempt хранит одну попытку отправки уведомления через канал
+// и ответ провайдера. Push-уведомления сохраняют попытку для каждого
+// устройства с заполненным DeviceID.
+type NotificationAttempt struct {
+	ID                string                    `json:"id" gorm:"primaryKey"`
+	NotificationID    string                    `json:"notification_id" gorm:"index"`
+	Attempt           int                       `json:"attempt"`
+	Channel           NotificationType          `json:"channel"`
+	Provider          string                    `json:"provider"`
+	Status            NotificationAttemptStatus `json:"status"`
+	DeviceID          string                    `json:"device_id,omitempty"`
+	ProviderMessageID string                    `json:"provider_message_id,omitempty"`
+	Response          string                    `json:"response,omitempty"`
+	Error             string                    `json:"error,omitempty"`
+	DurationMs        int64                     `json:"duration_ms"`
+	CreatedAt         time.Time                 `json:"created_at"`
+}
+
+// Значения NotificationTemplate.Variables
+const (
+	TemplateVariableRequired = "required"
+	TemplateVariableOptional = "optional"
+)
+
+// NotificationTemplate представляет шаблон уведомления. Variables содержит
+// имена переменных шаблона со значением "required" или "optional".
+// Шаблоны с одним именем хранятся отдельно для каждой локали.
 type NotificationTemplate struct {
-	ID          string                 `json:"id"`
-	Name        string                 `json:"name"`
+	ID          string                 `json:"id" gorm:"primaryKey"`
+	Name        string                 `json:"name" gorm:"uniqueIndex:idx_template_name_locale"`
+	Locale      string                 `json:"locale" gorm:"uniqueIndex:idx_template_name_locale;default:en"`
 	Type        NotificationType       `json:"type"`
 	Subject     string                 `json:"subject"`
 	Content     string                 `json:"content"`
-	Variables   map[string]string      `json:"variables,omitempty"`
-	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	TextContent string                 `json:"text_content,omitempty"`
+	// FromAddress и ReplyTo переопределяют адреса отправителя по умолчанию
+	FromAddress string                 `json:"from_address,omitempty"`
+	ReplyTo     string                 `json:"reply_to,omitempty"`
+	Variables   map[string]string      `json:"variables,omitempty" gorm:"serializer:json"`
+	Metadata    map[string]interface{} `json:"metadata,omitempty" gorm:"serializer:json"`
+	Version     int                    `json:"version"`
+	Transactional bool                 `json:"transactional"`
 	IsActive    bool                   `json:"is_active"`
 	CreatedAt   time.Time             `json:"created_at"`
 	UpdatedAt   time.Time             `json:"updated_at"`
 }
 
+// NotificationTemplateVersion хранит снимок каждой версии шаблона
+type NotificationTemplateVersion struct {
+	ID          string            `json:"id" gorm:"primaryKey"`
+	TemplateID  string            `json:"template_id" gorm:"uniqueIndex:idx_template_version"`
+	Version     int               `json:"version" gorm:"uniqueIndex:idx_template_version"`
+	Type        NotificationType  `json:"type"`
+	Subject     string            `json:"subject"`
+	Content     string            `json:"content"`
+	TextContent string            `json:"text_content,omitempty"`
+	Variables   map[string]string `json:"variables,omitempty" gorm:"serializer:json"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
 // NotificationPreferences представляет настройки уведомлений пользователя
 type NotificationPreferences struct {
-	UserID    string           `json:"user_id"`
-	Channels  []NotificationType `json:"channels"`
+	UserID    string           `json:"user_id" gorm:"primaryKey"`
+	Channels  []NotificationType `json:"channels" gorm:"serializer:json"`
 	Enabled   bool             `json:"enabled"`
-	Schedule  *NotificationSchedule `json:"schedule,omitempty"`
+	Schedule  *NotificationSchedule `json:"schedule,omitempty" gorm:"serializer:json"`
+	Digest    *NotificationDigest   `json:"digest,omitempty" gorm:"serializer:json"`
 	UpdatedAt time.Time        `json:"updated_at"`
 }
 
-// NotificationSchedule представляет расписание уведомлений
+// DigestFrequency определяет период сводки уведомлений
+type DigestFrequency string
+
+const (
+	DigestFrequencyHourly DigestFrequency = "hourly"
+	DigestFrequencyDaily  DigestFrequency = "daily"
+)
+
+// NotificationDigest задает правило сводки: уведомления по шаблонам
+// Templates не отправляются по одному, а собираются в одно сообщение раз в
+// час или раз в день в Time по местному времени TimeZone. Пустой Templates
+// означает уведомления о платежах.
+type NotificationDigest struct {
+	Frequency DigestFrequency `json:"frequency"`
+	Time      string          `json:"time,omitempty"` // Format: "HH:MM", только для daily
+	TimeZone  string          `json:"timezone,omitempty"`
+	Templates []string        `json:"templates,omitempty"`
+}
+
+// NotificationSchedule задает тихие часы пользователя: с StartTime до
+// EndTime по местному времени TimeZone уведомления не отправляются. Если
+// EndTime меньше StartTime, период продолжается до следующего дня. Пустой
+// Days означает все дни недели.
 type NotificationSchedule struct {
 	TimeZone string   `json:"timezone"`
 	StartTime string   `json:"start_time"` // Format: "HH:MM"
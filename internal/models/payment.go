@@ -3,7 +3,6 @@ package models
 import (
 	"database/sql/driver"
 	"encoding/json"
-	"go_payment/internal/payment"
 	"time"
 
 	"gorm.io/gorm"
@@ -13,12 +12,59 @@ import (
 type PaymentStatus string
 
 const (
-	PaymentStatusPending   PaymentStatus = "pending"
-	PaymentStatusCompleted PaymentStatus = "completed"
-	PaymentStatusFailed    PaymentStatus = "failed"
-	PaymentStatusCancelled PaymentStatus = "cancelled"
-	PaymentStatusRefunded  PaymentStatus = "refunded"
-	PaymentStatusUnknown   PaymentStatus = "unknown"
+	PaymentStatusPending           PaymentStatus = "pending"
+	PaymentStatusAuthorized        PaymentStatus = "authorized"
+	PaymentStatusCompleted         PaymentStatus = "completed"
+	PaymentStatusFailed            PaymentStatus = "failed"
+	PaymentStatusCancelled         PaymentStatus = "cancelled"
+	PaymentStatusRefunded          PaymentStatus = "refunded"
+	PaymentStatusPartiallyRefunded PaymentStatus = "partially_refunded"
+	PaymentStatusDisputed          PaymentStatus = "disputed"
+	PaymentStatusChargedBack       PaymentStatus = "charged_back"
+	PaymentStatusUnknown           PaymentStatus = "unknown"
+)
+
+// paymentTransitions перечисляет допустимые переходы между статусами.
+// События провайдеров приходят в произвольном порядке, поэтому запоздавшее
+// событие не должно откатывать платеж к более раннему статусу.
+var paymentTransitions = map[PaymentStatus][]PaymentStatus{
+	PaymentStatusPending:           {PaymentStatusAuthorized, PaymentStatusCompleted, PaymentStatusFailed, PaymentStatusCancelled},
+	PaymentStatusAuthorized:        {PaymentStatusCompleted, PaymentStatusFailed, PaymentStatusCancelled},
+	PaymentStatusFailed:            {PaymentStatusAuthorized, PaymentStatusCompleted},
+	PaymentStatusCompleted:         {PaymentStatusPartiallyRefunded, PaymentStatusRefunded, PaymentStatusDisputed, PaymentStatusChargedBack},
+	PaymentStatusPartiallyRefunded: {PaymentStatusRefunded, PaymentStatusDisputed, PaymentStatusChargedBack},
+	PaymentStatusDisputed:          {PaymentStatusCompleted, PaymentStatusRefunded, PaymentStatusChargedBack},
+}
+
+// IsFinal сообщает, что платеж больше не может изменить статус
+func (s PaymentStatus) IsFinal() bool {
+	switch s {
+	case PaymentStatusCancelled, PaymentStatusRefunded, PaymentStatusChargedBack:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo сообщает, допустим ли переход платежа в статус next.
+// Платеж без статуса или с неизвестным статусом может перейти в любой.
+func (s PaymentStatus) CanTransitionTo(next PaymentStatus) bool {
+	if s == next || s == "" || s == PaymentStatusUnknown {
+		return true
+	}
+	for _, allowed := range paymentTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// PaymentProvider определяет платежного провайдера
+type PaymentProvider string
+
+const (
+	PaymentProviderStripe PaymentProvider = "stripe"
+	PaymentProviderPayPal PaymentProvider = "paypal"
 )
 
 // JSON представляет JSON данные в базе данных
@@ -32,6 +78,12 @@ func (j JSON) Value() (driver.Value, error) {
 	return json.Marshal(j)
 }
 
+// GormDataType возвращает тип колонки для JSON. Без него gorm не может
+// разобрать модели с полями JSON.
+func (JSON) GormDataType() string {
+	return "jsonb"
+}
+
 // Scan реализует интерфейс sql.Scanner для JSON
 func (j *JSON) Scan(value interface{}) error {
 	if value == nil {
@@ -51,20 +103,36 @@ type Payment struct {
 	Amount         float64               `json:"amount"`
 	Currency       string                `json:"currency"`
 	Description    string                `json:"description"`
+	Locale         string                `json:"locale,omitempty"`
 	Status         PaymentStatus         `json:"status"`
-	ProviderType   payment.ProviderType  `json:"provider_type"`
+	ProviderType   PaymentProvider       `json:"provider_type"`
 	TransactionID  string                `json:"transaction_id"`
 	PaymentDetails JSON                  `json:"payment_details"`
 	Metadata       JSON                  `json:"metadata"`
 	ErrorMessage   string                `json:"error_message,omitempty"`
 	CompletedAt    *time.Time            `json:"completed_at,omitempty"`
+	CaptureMethod  CaptureMethod         `json:"capture_method"`
+	CapturedAmount float64               `json:"captured_amount"`
+	RefundedAmount float64               `json:"refunded_amount"`
 }
 
+// CaptureMethod определяет, списываются ли средства сразу или после
+// отдельного подтверждения
+type CaptureMethod string
+
+const (
+	CaptureMethodAutomatic CaptureMethod = "automatic"
+	// CaptureMethodManual только авторизует сумму, списание выполняется
+	// вызовом CapturePayment или отменяется VoidPayment
+	CaptureMethodManual CaptureMethod = "manual"
+)
+
 // Refund представляет возврат платежа
 type Refund struct {
 	gorm.Model
 	ID            string       `json:"id" gorm:"primaryKey"`
 	PaymentID     string       `json:"payment_id"`
+	OrderID       string       `json:"order_id" gorm:"index"`
 	Amount        float64      `json:"amount"`
 	Currency      string       `json:"currency"`
 	Status        RefundStatus `json:"status"`
@@ -80,13 +148,3 @@ const (
 	RefundStatusCompleted RefundStatus = "completed"
 	RefundStatusFailed    RefundStatus = "failed"
 )
-
-// PaymentStatusMessage представляет сообщение об изменении статуса платежа
-type PaymentStatusMessage struct {
-	OrderID      string        `json:"order_id"`
-	OldStatus    PaymentStatus `json:"old_status"`
-	NewStatus    PaymentStatus `json:"new_status"`
-	TransactionID string       `json:"transaction_id,omitempty"`
-	UpdatedAt    time.Time     `json:"updated_at"`
-	Metadata     JSON          `json:"metadata,omitempty"`
-}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// PaymentStatusEvent представляет запись истории статусов платежа.
+// Sequence растет по всем платежам в порядке фиксации транзакций без
+// пропусков и позволяет подписчикам продолжить поток с последнего
+// полученного события.
+type PaymentStatusEvent struct {
+	Sequence   uint64          `json:"sequence" gorm:"primaryKey;autoIncrement:false"`
+	OrderID    string          `json:"order_id" gorm:"index"`
+	CustomerID string          `json:"customer_id,omitempty" gorm:"index"`
+	Provider   PaymentProvider `json:"provider,omitempty"`
+	OldStatus  PaymentStatus   `json:"old_status,omitempty"`
+	NewStatus  PaymentStatus   `json:"new_status"`
+	Amount     float64         `json:"amount"`
+	Currency   string          `json:"currency"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
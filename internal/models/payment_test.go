@@ -0,0 +1,119 @@
+package models
+
+import (
+	"sync"
+	"testing"
+
+	"gorm.io/gorm/schema"
+)
+
+func TestPaymentStatusCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from, to PaymentStatus
+		want     bool
+	}{
+		{PaymentStatusPending, PaymentStatusAuthorized, true},
+		{PaymentStatusPending, PaymentStatusCompleted, true},
+		{PaymentStatusAuthorized, PaymentStatusCompleted, true},
+		{PaymentStatusFailed, PaymentStatusCompleted, true},
+		{PaymentStatusCompleted, PaymentStatusPartiallyRefunded, true},
+		{PaymentStatusPartiallyRefunded, PaymentStatusRefunded, true},
+		{PaymentStatusDisputed, PaymentStatusCompleted, true},
+		{PaymentStatusDisputed, PaymentStatusChargedBack, true},
+		{PaymentStatusCompleted, PaymentStatusCompleted, true},
+		{"", PaymentStatusCompleted, true},
+		{PaymentStatusUnknown, PaymentStatusRefunded, true},
+
+		{PaymentStatusCompleted, PaymentStatusPending, false},
+		{PaymentStatusCompleted, PaymentStatusAuthorized, false},
+		{PaymentStatusCompleted, PaymentStatusFailed, false},
+		{PaymentStatusAuthorized, PaymentStatusPending, false},
+		{PaymentStatusPartiallyRefunded, PaymentStatusCompleted, false},
+		{PaymentStatusRefunded, PaymentStatusCompleted, false},
+		{PaymentStatusRefunded, PaymentStatusPartiallyRefunded, false},
+		{PaymentStatusCancelled, PaymentStatusCompleted, false},
+		{PaymentStatusChargedBack, PaymentStatusCompleted, false},
+		{PaymentStatusChargedBack, PaymentStatusDisputed, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+			t.Errorf("%q.CanTransitionTo(%q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+// TestPaymentStatusOutOfOrderEvents применяет события в порядке доставки
+// и проверяет, что запоздавшие события не меняют итоговый статус
+func TestPaymentStatusOutOfOrderEvents(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []PaymentStatus
+		want   PaymentStatus
+	}{
+		{
+			name:   "authorization after capture",
+			events: []PaymentStatus{PaymentStatusCompleted, PaymentStatusAuthorized},
+			want:   PaymentStatusCompleted,
+		},
+		{
+			name:   "pending after completion",
+			events: []PaymentStatus{PaymentStatusAuthorized, PaymentStatusCompleted, PaymentStatusPending},
+			want:   PaymentStatusCompleted,
+		},
+		{
+			name:   "capture after refund",
+			events: []PaymentStatus{PaymentStatusCompleted, PaymentStatusRefunded, PaymentStatusCompleted},
+			want:   PaymentStatusRefunded,
+		},
+		{
+			name:   "partial refund after full refund",
+			events: []PaymentStatus{PaymentStatusCompleted, PaymentStatusRefunded, PaymentStatusPartiallyRefunded},
+			want:   PaymentStatusRefunded,
+		},
+		{
+			name:   "dispute opened after it was lost",
+			events: []PaymentStatus{PaymentStatusCompleted, PaymentStatusChargedBack, PaymentStatusDisputed},
+			want:   PaymentStatusChargedBack,
+		},
+		{
+			name:   "failure after cancellation",
+			events: []PaymentStatus{PaymentStatusCancelled, PaymentStatusFailed},
+			want:   PaymentStatusCancelled,
+		},
+		{
+			name:   "retry after failure",
+			events: []PaymentStatus{PaymentStatusFailed, PaymentStatusCompleted},
+			want:   PaymentStatusCompleted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := PaymentStatusPending
+			for _, event := range tt.events {
+				if status.CanTransitionTo(event) {
+					status = event
+				}
+			}
+			if status != tt.want {
+				t.Errorf("final status = %q, want %q", status, tt.want)
+			}
+			for _, final := range []PaymentStatus{PaymentStatusCancelled, PaymentStatusRefunded, PaymentStatusChargedBack} {
+				if status == final && !status.IsFinal() {
+					t.Errorf("%q must be final", status)
+				}
+			}
+		})
+	}
+}
+
+func TestModelsWithJSONFieldsParse(t *testing.T) {
+	for _, model := range []interface{}{&Payment{}, &Customer{}} {
+		s, err := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+		if err != nil {
+			t.Fatalf("schema.Parse(%T) error = %v", model, err)
+		}
+		if field := s.LookUpField("metadata"); field == nil || field.DataType != "jsonb" {
+			t.Errorf("%T metadata field = %+v, want jsonb column", model, field)
+		}
+	}
+}
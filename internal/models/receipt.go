@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// ReceiptKind определяет тип платежного документа
+type ReceiptKind string
+
+const (
+	// ReceiptKindInvoice выставляется по завершенному платежу
+	ReceiptKindInvoice ReceiptKind = "invoice"
+	// ReceiptKindCreditNote выставляется по возврату платежа
+	ReceiptKindCreditNote ReceiptKind = "credit_note"
+)
+
+// Receipt представляет платежный документ: квитанцию с номером счета по
+// завершенному платежу или кредит-ноту по возврату. Документ неизменяем
+// после выпуска, HTML и PDF представления сохраняются вместе с ним.
+type Receipt struct {
+	ID            string            `json:"id" gorm:"primaryKey"`
+	Number        string            `json:"number" gorm:"uniqueIndex"`
+	Kind          ReceiptKind       `json:"kind" gorm:"uniqueIndex:idx_receipt_source"`
+	PaymentID     string            `json:"payment_id" gorm:"uniqueIndex:idx_receipt_source"`
+	RefundID      string            `json:"refund_id,omitempty" gorm:"uniqueIndex:idx_receipt_source"`
+	OrderID       string            `json:"order_id" gorm:"index"`
+	CustomerEmail string            `json:"customer_email"`
+	Locale        string            `json:"locale"`
+	Currency      string            `json:"currency"`
+	LineItems     []ReceiptLineItem `json:"line_items" gorm:"serializer:json"`
+	Taxes         []ReceiptTax      `json:"taxes" gorm:"serializer:json"`
+	Merchant      MerchantDetails   `json:"merchant" gorm:"serializer:json"`
+	Subtotal      float64           `json:"subtotal"`
+	TaxTotal      float64           `json:"tax_total"`
+	Total         float64           `json:"total"`
+	HTML          string            `json:"-"`
+	PDF           []byte            `json:"-"`
+	IssuedAt      time.Time         `json:"issued_at"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+// ReceiptLineItem представляет позицию документа. Цены указываются с учетом
+// налога, TaxRate задается в процентах.
+type ReceiptLineItem struct {
+	Description string  `json:"description"`
+	Quantity    float64 `json:"quantity"`
+	UnitPrice   float64 `json:"unit_price"`
+	TaxRate     float64 `json:"tax_rate"`
+	Amount      float64 `json:"amount"`
+}
+
+// ReceiptTax представляет сумму налога по одной ставке
+type ReceiptTax struct {
+	Rate  float64 `json:"rate"`
+	Net   float64 `json:"net"`
+	Tax   float64 `json:"tax"`
+	Gross float64 `json:"gross"`
+}
+
+// MerchantDetails содержит реквизиты продавца, печатаемые в документах
+type MerchantDetails struct {
+	Name    string `json:"name"`
+	Address string `json:"address,omitempty"`
+	TaxID   string `json:"tax_id,omitempty"`
+	Email   string `json:"email,omitempty"`
+	Phone   string `json:"phone,omitempty"`
+}
+
+// DocumentSequence хранит последний выданный номер документа в серии
+type DocumentSequence struct {
+	Name      string `gorm:"primaryKey"`
+	Value     int64  `gorm:"not null"`
+	UpdatedAt time.Time
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// SuppressionReason определяет причину блокировки адреса
+type SuppressionReason string
+
+const (
+	// SuppressionReasonBounce — постоянная ошибка доставки на адрес
+	SuppressionReasonBounce SuppressionReason = "bounce"
+	// SuppressionReasonComplaint — получатель пожаловался на спам
+	SuppressionReasonComplaint SuppressionReason = "complaint"
+	// SuppressionReasonUnsubscribe — получатель отписался от рассылок.
+	// Транзакционные письма на такой адрес продолжают отправляться.
+	SuppressionReasonUnsubscribe SuppressionReason = "unsubscribe"
+	// SuppressionReasonManual — адрес заблокирован администратором
+	SuppressionReasonManual SuppressionReason = "manual"
+)
+
+// EmailSuppression представляет адрес, на который письма не отправляются.
+// Email хранится в нижнем регистре.
+type EmailSuppression struct {
+	Email          string            `json:"email" gorm:"primaryKey"`
+	Reason         SuppressionReason `json:"reason" gorm:"index"`
+	Source         string            `json:"source,omitempty"`
+	Details        string            `json:"details,omitempty"`
+	NotificationID string            `json:"notification_id,omitempty"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+}
@@ -22,6 +22,7 @@ type User struct {
 	Role         Role      `json:"role"`
 	FirstName    string    `json:"first_name"`
 	LastName     string    `json:"last_name"`
+	Locale       string    `json:"locale"`
 	LastLogin    time.Time `json:"last_login"`
 	IsActive     bool      `json:"is_active" gorm:"default:true"`
 	RefreshToken string    `json:"-"`
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// Типы событий, отправляемых во внешние вебхуки
+const (
+	WebhookEventPaymentCreated       = "payment.created"
+	WebhookEventPaymentStatusChanged = "payment.status_changed"
+	WebhookEventRefundCreated        = "refund.created"
+	// WebhookEventAll подписывает endpoint на все события
+	WebhookEventAll = "*"
+)
+
+// StringList представляет список строк, хранимый в базе как JSON
+type StringList []string
+
+// Value реализует интерфейс driver.Valuer для StringList
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	return json.Marshal(l)
+}
+
+// Scan реализует интерфейс sql.Scanner для StringList
+func (l *StringList) Scan(value interface{}) error {
+	if value == nil {
+		*l = nil
+		return nil
+	}
+	return json.Unmarshal(value.([]byte), l)
+}
+
+// Contains проверяет наличие значения в списке
+func (l StringList) Contains(value string) bool {
+	for _, v := range l {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookEndpoint представляет зарегистрированный endpoint получателя вебхуков
+type WebhookEndpoint struct {
+	ID                  string     `json:"id" gorm:"primaryKey"`
+	URL                 string     `json:"url"`
+	Secret              string     `json:"-"`
+	Description         string     `json:"description,omitempty"`
+	EventTypes          StringList `json:"event_types" gorm:"type:jsonb"`
+	IsActive            bool       `json:"is_active"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// Subscribed проверяет, подписан ли endpoint на событие
+func (e *WebhookEndpoint) Subscribed(eventType string) bool {
+	return e.EventTypes.Contains(WebhookEventAll) || e.EventTypes.Contains(eventType)
+}
+
+// WebhookDeliveryStatus определяет результат попытки доставки
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryRetrying  WebhookDeliveryStatus = "retrying"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery представляет одну попытку доставки вебхука
+type WebhookDelivery struct {
+	ID           string                `json:"id" gorm:"primaryKey"`
+	EndpointID   string                `json:"endpoint_id" gorm:"index"`
+	EventID      string                `json:"event_id" gorm:"index"`
+	EventType    string                `json:"event_type"`
+	Attempt      int                   `json:"attempt"`
+	Status       WebhookDeliveryStatus `json:"status"`
+	ResponseCode int                   `json:"response_code,omitempty"`
+	ResponseBody string                `json:"response_body,omitempty"`
+	Error        string                `json:"error,omitempty"`
+	DurationMs   int64                 `json:"duration_ms"`
+	NextRetryAt  *time.Time            `json:"next_retry_at,omitempty"`
+	CreatedAt    time.Time             `json:"created_at"`
+}
@@ -1,13 +1,17 @@
 package payment
 
-import "fmt"
+import (
+	"fmt"
+	"go_payment/internal/models"
+)
 
-// ProviderType определяет тип платежного провайдера
-type ProviderType string
+// ProviderType определяет тип платежного провайдера. Тип объявлен в models,
+// чтобы модели не зависели от пакета провайдеров.
+type ProviderType = models.PaymentProvider
 
 const (
-	ProviderStripe ProviderType = "stripe"
-	ProviderPayPal ProviderType = "paypal"
+	ProviderStripe = models.PaymentProviderStripe
+	ProviderPayPal = models.PaymentProviderPayPal
 )
 
 // ProviderFactory создает экземпляры платежных провайдеров
@@ -1,14 +1,13 @@
 package payment
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"go_payment/internal/models"
-	"log"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/plutov/paypal/v4"
 )
@@ -58,20 +57,35 @@ func (p *PayPalProvider) Initialize(config map[string]string) error {
 	return nil
 }
 
+// CheckHealth проверяет доступность API PayPal получением токена доступа
+func (p *PayPalProvider) CheckHealth(ctx context.Context) error {
+	if p.client == nil {
+		return fmt.Errorf("paypal provider is not initialized")
+	}
+	if _, err := p.client.GetAccessToken(ctx); err != nil {
+		return fmt.Errorf("paypal is unavailable: %w", err)
+	}
+	return nil
+}
+
 // ProcessPayment обрабатывает платеж через PayPal
 func (p *PayPalProvider) ProcessPayment(ctx context.Context, req PaymentRequest) (*PaymentResponse, error) {
 	// Создаем заказ PayPal
-	order, err := p.client.CreateOrder(ctx, paypal.OrderIntentCapture, []paypal.PurchaseUnitRequest{
+	intent := paypal.OrderIntentCapture
+	if req.CaptureManually {
+		intent = paypal.OrderIntentAuthorize
+	}
+	order, err := p.client.CreateOrder(ctx, intent, []paypal.PurchaseUnitRequest{
 		{
 			ReferenceID: req.OrderID,
-			Amount: &paypal.Money{
+			Amount: &paypal.PurchaseUnitAmount{
 				Currency: req.Currency,
 				Value:    fmt.Sprintf("%.2f", req.Amount),
 			},
 			Description: req.Description,
 			CustomID:    req.OrderID,
 		},
-	})
+	}, nil, nil)
 
 	if err != nil {
 		return &PaymentResponse{
@@ -81,8 +95,13 @@ func (p *PayPalProvider) ProcessPayment(ctx context.Context, req PaymentRequest)
 		}, fmt.Errorf("failed to create PayPal order: %w", err)
 	}
 
+	// Для двухэтапного платежа сумма только авторизуется
+	if req.CaptureManually {
+		return p.authorizeOrder(ctx, order.ID)
+	}
+
 	// Захватываем платеж
-	capture, err := p.client.CaptureOrder(ctx, order.ID)
+	capture, err := p.client.CaptureOrder(ctx, order.ID, paypal.CaptureOrderRequest{})
 	if err != nil {
 		return &PaymentResponse{
 			Success:      false,
@@ -91,102 +110,100 @@ func (p *PayPalProvider) ProcessPayment(ctx context.Context, req PaymentRequest)
 		}, fmt.Errorf("failed to capture PayPal payment: %w", err)
 	}
 
+	// Возвраты и запросы статуса выполняются по идентификатору списания,
+	// а не заказа
+	var captured paypal.CaptureAmount
+	for _, unit := range capture.PurchaseUnits {
+		if unit.Payments != nil && len(unit.Payments.Captures) > 0 {
+			captured = unit.Payments.Captures[0]
+			break
+		}
+	}
+	if captured.ID == "" {
+		return nil, fmt.Errorf("PayPal order %s has no capture", order.ID)
+	}
+
 	// Определяем статус платежа
 	status := models.PaymentStatusPending
-	if capture.Status == "COMPLETED" {
+	if captured.Status == "COMPLETED" {
 		status = models.PaymentStatusCompleted
-	} else if capture.Status == "DECLINED" {
+	} else if captured.Status == "DECLINED" {
 		status = models.PaymentStatusFailed
 	}
 
 	// Формируем детали платежа
 	details := map[string]interface{}{
-		"order_id":        order.ID,
-		"capture_id":      capture.ID,
-		"payment_source":  capture.PaymentSource,
-		"status":          capture.Status,
-		"create_time":     capture.CreateTime,
-		"update_time":     capture.UpdateTime,
+		"order_id":     order.ID,
+		"capture_id":   captured.ID,
+		"status":       captured.Status,
+		"order_status": capture.Status,
 	}
 
 	return &PaymentResponse{
 		Success:        status == models.PaymentStatusCompleted,
-		TransactionID:  capture.ID,
-		Status:        status,
+		TransactionID:  captured.ID,
+		Status:         status,
 		PaymentDetails: details,
 	}, nil
 }
 
 // ValidateWebhook проверяет и обрабатывает вебхук от PayPal
 func (p *PayPalProvider) ValidateWebhook(payload []byte, signature string) (*WebhookEvent, error) {
-	// Проверяем подпись вебхука
-	headers := http.Header{}
-	headers.Set("Paypal-Transmission-Sig", signature)
-	valid, err := p.client.ValidateWebhookSignature(context.Background(), payload, headers, p.webhookID)
-	if err != nil || !valid {
+	// Проверяем подпись вебхука через API PayPal
+	req, err := http.NewRequest(http.MethodPost, "/", bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build webhook verification request: %w", err)
+	}
+	req.Header.Set("Paypal-Transmission-Sig", signature)
+	verification, err := p.client.VerifyWebhookSignature(context.Background(), req, p.webhookID)
+	if err != nil || verification.VerificationStatus != "SUCCESS" {
 		return nil, fmt.Errorf("invalid webhook signature")
 	}
 
 	// Разбираем payload
-	var event paypal.WebhookEvent
+	var event paypal.AnyEvent
 	if err := json.Unmarshal(payload, &event); err != nil {
 		return nil, fmt.Errorf("failed to parse webhook payload: %w", err)
 	}
 
-	var status models.PaymentStatus
-	var amount float64
-	var currency string
-	var transactionID string
-	details := make(map[string]interface{})
-
-	// Обрабатываем различные типы событий
-	switch event.ResourceType {
-	case "capture":
-		var capture paypal.CaptureResource
-		if err := json.Unmarshal(event.Resource, &capture); err != nil {
-			return nil, fmt.Errorf("failed to parse capture data: %w", err)
-		}
-
-		amount, _ = capture.Amount.Value.Float64()
-		currency = capture.Amount.Currency
-		transactionID = capture.ID
-
-		switch event.EventType {
-		case "PAYMENT.CAPTURE.COMPLETED":
-			status = models.PaymentStatusCompleted
-		case "PAYMENT.CAPTURE.DENIED":
-			status = models.PaymentStatusFailed
-		case "PAYMENT.CAPTURE.REFUNDED":
-			status = models.PaymentStatusRefunded
+	switch {
+	case strings.HasPrefix(event.EventType, "PAYMENT.CAPTURE."):
+		// Возвраты и реверсы приходят с ресурсом refund, а не capture
+		if event.ResourceType == "refund" {
+			return parsePayPalRefundEvent(event)
 		}
-
-		details["capture_id"] = capture.ID
-		details["status"] = capture.Status
-		details["create_time"] = capture.CreateTime
-		details["update_time"] = capture.UpdateTime
+		return parsePayPalCaptureEvent(event)
+	case strings.HasPrefix(event.EventType, "PAYMENT.AUTHORIZATION."):
+		return parsePayPalAuthorizationEvent(event)
+	case strings.HasPrefix(event.EventType, "CHECKOUT.ORDER."):
+		return parsePayPalOrderEvent(event)
+	case strings.HasPrefix(event.EventType, "CUSTOMER.DISPUTE."):
+		return parsePayPalDisputeEvent(event)
+	default:
+		return newIgnoredWebhookEvent(event.ID, event.EventType), nil
 	}
-
-	return &WebhookEvent{
-		Type:           event.EventType,
-		TransactionID:  transactionID,
-		Status:        status,
-		Amount:        amount,
-		Currency:      currency,
-		PaymentDetails: details,
-	}, nil
 }
 
 // RefundPayment выполняет возврат платежа
 func (p *PayPalProvider) RefundPayment(ctx context.Context, transactionID string, amount float64) error {
-	refundRequest := paypal.RefundRequest{
+	// Возврат выполняется в валюте списания
+	capture, err := p.client.CapturedDetail(ctx, transactionID)
+	if err != nil {
+		return fmt.Errorf("failed to get PayPal capture: %w", err)
+	}
+	if capture.Amount == nil {
+		return fmt.Errorf("PayPal capture %s has no amount", transactionID)
+	}
+
+	refundRequest := paypal.RefundCaptureRequest{
 		Amount: &paypal.Money{
 			Value:    fmt.Sprintf("%.2f", amount),
-			Currency: "USD", // Здесь можно добавить параметр для указания валюты
+			Currency: capture.Amount.Currency,
 		},
 		NoteToPayer: "Refund for order",
 	}
 
-	_, err := p.client.RefundCapture(ctx, transactionID, refundRequest)
+	_, err = p.client.RefundCapture(ctx, transactionID, refundRequest)
 	if err != nil {
 		return fmt.Errorf("failed to refund PayPal payment: %w", err)
 	}
@@ -194,9 +211,85 @@ func (p *PayPalProvider) RefundPayment(ctx context.Context, transactionID string
 	return nil
 }
 
+// authorizeOrder авторизует сумму заказа. Идентификатором транзакции
+// становится авторизация, по ней выполняются списание и отмена.
+func (p *PayPalProvider) authorizeOrder(ctx context.Context, orderID string) (*PaymentResponse, error) {
+	authorization, err := p.client.AuthorizeOrder(ctx, orderID, paypal.AuthorizeOrderRequest{})
+	if err != nil {
+		return &PaymentResponse{
+			Success:      false,
+			ErrorMessage: err.Error(),
+			Status:       models.PaymentStatusFailed,
+		}, fmt.Errorf("failed to authorize PayPal order: %w", err)
+	}
+
+	var authorizationID string
+	for _, unit := range authorization.PurchaseUnits {
+		if unit.Payments != nil && len(unit.Payments.Autthorizations) > 0 {
+			authorizationID = unit.Payments.Autthorizations[0].ID
+			break
+		}
+	}
+	if authorizationID == "" {
+		return nil, fmt.Errorf("PayPal order %s has no authorization", orderID)
+	}
+
+	return &PaymentResponse{
+		Success:       true,
+		TransactionID: authorizationID,
+		Status:        models.PaymentStatusAuthorized,
+		PaymentDetails: map[string]interface{}{
+			"order_id":         orderID,
+			"authorization_id": authorizationID,
+			"status":           authorization.Status,
+		},
+	}, nil
+}
+
+// CapturePayment списывает авторизованную сумму. Списание получает
+// собственный идентификатор, по которому затем выполняются возвраты.
+func (p *PayPalProvider) CapturePayment(ctx context.Context, transactionID string, amount float64, currency string) (*PaymentResponse, error) {
+	capture, err := p.client.CaptureAuthorization(ctx, transactionID, &paypal.PaymentCaptureRequest{
+		Amount: &paypal.Money{
+			Currency: currency,
+			Value:    fmt.Sprintf("%.2f", amount),
+		},
+		FinalCapture: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture PayPal authorization: %w", err)
+	}
+
+	status := models.PaymentStatusPending
+	if capture.Status == "COMPLETED" {
+		status = models.PaymentStatusCompleted
+	} else if capture.Status == "DECLINED" {
+		status = models.PaymentStatusFailed
+	}
+
+	return &PaymentResponse{
+		Success:       status == models.PaymentStatusCompleted,
+		TransactionID: capture.ID,
+		Status:        status,
+		PaymentDetails: map[string]interface{}{
+			"authorization_id": transactionID,
+			"capture_id":       capture.ID,
+			"status":           capture.Status,
+		},
+	}, nil
+}
+
+// VoidPayment отменяет авторизацию PayPal
+func (p *PayPalProvider) VoidPayment(ctx context.Context, transactionID string) error {
+	if _, err := p.client.VoidAuthorization(ctx, transactionID); err != nil {
+		return fmt.Errorf("failed to void PayPal authorization: %w", err)
+	}
+	return nil
+}
+
 // GetPaymentStatus получает текущий статус платежа
 func (p *PayPalProvider) GetPaymentStatus(ctx context.Context, transactionID string) (models.PaymentStatus, error) {
-	capture, err := p.client.GetCapture(ctx, transactionID)
+	capture, err := p.client.CapturedDetail(ctx, transactionID)
 	if err != nil {
 		return models.PaymentStatusUnknown, fmt.Errorf("failed to get PayPal capture: %w", err)
 	}
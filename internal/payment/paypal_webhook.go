@@ -0,0 +1,297 @@
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"go_payment/internal/models"
+	"strconv"
+	"strings"
+
+	"github.com/plutov/paypal/v4"
+)
+
+// paypalPaymentResource описывает ресурсы capture, refund и authorization
+type paypalPaymentResource struct {
+	ID            string        `json:"id"`
+	Status        string        `json:"status"`
+	Amount        *paypal.Money `json:"amount,omitempty"`
+	CustomID      string        `json:"custom_id,omitempty"`
+	Links         []paypal.Link `json:"links,omitempty"`
+	CreateTime    string        `json:"create_time,omitempty"`
+	UpdateTime    string        `json:"update_time,omitempty"`
+	StatusDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"status_details,omitempty"`
+	SellerPayableBreakdown *struct {
+		TotalRefundedAmount *paypal.Money `json:"total_refunded_amount,omitempty"`
+	} `json:"seller_payable_breakdown,omitempty"`
+}
+
+// paypalOrderResource описывает ресурс checkout-order
+type paypalOrderResource struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	PurchaseUnits []struct {
+		ReferenceID string        `json:"reference_id"`
+		Amount      *paypal.Money `json:"amount,omitempty"`
+		Payments    *struct {
+			Captures []paypalPaymentResource `json:"captures"`
+		} `json:"payments,omitempty"`
+	} `json:"purchase_units"`
+}
+
+// paypalDisputeResource описывает ресурс dispute
+type paypalDisputeResource struct {
+	DisputeID            string        `json:"dispute_id"`
+	Status               string        `json:"status"`
+	Reason               string        `json:"reason"`
+	DisputeAmount        *paypal.Money `json:"dispute_amount,omitempty"`
+	DisputedTransactions []struct {
+		SellerTransactionID string `json:"seller_transaction_id"`
+	} `json:"disputed_transactions"`
+	DisputeOutcome *struct {
+		OutcomeCode string `json:"outcome_code"`
+	} `json:"dispute_outcome,omitempty"`
+}
+
+// paypalCaptureStatuses сопоставляет события PAYMENT.CAPTURE.* со статусами платежа
+var paypalCaptureStatuses = map[string]models.PaymentStatus{
+	"PAYMENT.CAPTURE.COMPLETED": models.PaymentStatusCompleted,
+	"PAYMENT.CAPTURE.PENDING":   models.PaymentStatusPending,
+	"PAYMENT.CAPTURE.DENIED":    models.PaymentStatusFailed,
+	"PAYMENT.CAPTURE.DECLINED":  models.PaymentStatusFailed,
+	"PAYMENT.CAPTURE.REFUNDED":  models.PaymentStatusRefunded,
+	"PAYMENT.CAPTURE.REVERSED":  models.PaymentStatusChargedBack,
+}
+
+// paypalAuthorizationStatuses сопоставляет события PAYMENT.AUTHORIZATION.* со статусами платежа
+var paypalAuthorizationStatuses = map[string]models.PaymentStatus{
+	"PAYMENT.AUTHORIZATION.CREATED": models.PaymentStatusAuthorized,
+	"PAYMENT.AUTHORIZATION.VOIDED":  models.PaymentStatusCancelled,
+}
+
+// paypalOrderStatuses сопоставляет события CHECKOUT.ORDER.* со статусами платежа
+var paypalOrderStatuses = map[string]models.PaymentStatus{
+	"CHECKOUT.ORDER.SAVED":     models.PaymentStatusPending,
+	"CHECKOUT.ORDER.APPROVED":  models.PaymentStatusPending,
+	"CHECKOUT.ORDER.COMPLETED": models.PaymentStatusCompleted,
+	"CHECKOUT.ORDER.VOIDED":    models.PaymentStatusCancelled,
+}
+
+// paypalDisputeOutcomes сопоставляет результат спора со статусом платежа
+var paypalDisputeOutcomes = map[string]models.PaymentStatus{
+	"RESOLVED_SELLER_FAVOUR": models.PaymentStatusCompleted,
+	"CANCELED_BY_BUYER":      models.PaymentStatusCompleted,
+	"RESOLVED_BUYER_FAVOUR":  models.PaymentStatusChargedBack,
+	"ACCEPTED":               models.PaymentStatusChargedBack,
+	"REFUNDED":               models.PaymentStatusRefunded,
+}
+
+// parsePayPalCaptureEvent разбирает события PAYMENT.CAPTURE.* с ресурсом capture
+func parsePayPalCaptureEvent(event paypal.AnyEvent) (*WebhookEvent, error) {
+	status, known := paypalCaptureStatuses[event.EventType]
+	if !known {
+		return newIgnoredWebhookEvent(event.ID, event.EventType), nil
+	}
+
+	var capture paypalPaymentResource
+	if err := json.Unmarshal(event.Resource, &capture); err != nil {
+		return nil, fmt.Errorf("failed to parse capture data: %w", err)
+	}
+
+	result := newPayPalPaymentEvent(event, capture.ID, status, capture, "capture")
+	// Частично возвращенный capture остается открытым. Сумма возвратов в
+	// ресурсе capture не передается, поэтому сумма события не заполняется.
+	if status == models.PaymentStatusRefunded && capture.Status == "PARTIALLY_REFUNDED" {
+		result.Status = models.PaymentStatusPartiallyRefunded
+		result.Amount = 0
+	}
+
+	return result, nil
+}
+
+// parsePayPalRefundEvent разбирает возвраты и реверсы, связанные с capture
+func parsePayPalRefundEvent(event paypal.AnyEvent) (*WebhookEvent, error) {
+	status, known := paypalCaptureStatuses[event.EventType]
+	if !known {
+		return newIgnoredWebhookEvent(event.ID, event.EventType), nil
+	}
+
+	var refund paypalPaymentResource
+	if err := json.Unmarshal(event.Resource, &refund); err != nil {
+		return nil, fmt.Errorf("failed to parse refund data: %w", err)
+	}
+
+	// Идентификатор capture содержится в ссылке "up" на родительский ресурс
+	captureID := paypalParentID(refund.Links)
+	if captureID == "" {
+		return nil, fmt.Errorf("refund %s has no capture link", refund.ID)
+	}
+
+	result := newPayPalPaymentEvent(event, captureID, status, refund, "refund")
+	// PAYMENT.CAPTURE.REFUNDED приходит и при частичном возврате, а ресурс
+	// refund не сообщает, возвращен ли capture полностью. Событие передает
+	// сумму всех возвратов по capture, полный возврат определяется сравнением
+	// с суммой списания.
+	if status == models.PaymentStatusRefunded {
+		result.Status = models.PaymentStatusPartiallyRefunded
+		if breakdown := refund.SellerPayableBreakdown; breakdown != nil && breakdown.TotalRefundedAmount != nil {
+			result.Amount, _ = parsePayPalMoney(breakdown.TotalRefundedAmount)
+		}
+		result.PaymentDetails["amount_refunded"] = result.Amount
+	}
+
+	return result, nil
+}
+
+// parsePayPalAuthorizationEvent разбирает события PAYMENT.AUTHORIZATION.*
+func parsePayPalAuthorizationEvent(event paypal.AnyEvent) (*WebhookEvent, error) {
+	status, known := paypalAuthorizationStatuses[event.EventType]
+	if !known {
+		return newIgnoredWebhookEvent(event.ID, event.EventType), nil
+	}
+
+	var authorization paypalPaymentResource
+	if err := json.Unmarshal(event.Resource, &authorization); err != nil {
+		return nil, fmt.Errorf("failed to parse authorization data: %w", err)
+	}
+
+	result := newPayPalPaymentEvent(event, authorization.ID, status, authorization, "authorization")
+	// Истекшая авторизация приходит тем же событием, что и отмененная
+	if authorization.Status == "EXPIRED" {
+		result.PaymentDetails["cancellation_reason"] = "authorization_expired"
+	}
+
+	return result, nil
+}
+
+// parsePayPalOrderEvent разбирает события CHECKOUT.ORDER.*
+func parsePayPalOrderEvent(event paypal.AnyEvent) (*WebhookEvent, error) {
+	status, known := paypalOrderStatuses[event.EventType]
+	if !known {
+		return newIgnoredWebhookEvent(event.ID, event.EventType), nil
+	}
+
+	var order paypalOrderResource
+	if err := json.Unmarshal(event.Resource, &order); err != nil {
+		return nil, fmt.Errorf("failed to parse order data: %w", err)
+	}
+
+	// Платежи хранят идентификатор capture, поэтому предпочитаем его
+	transactionID := order.ID
+	var amount *paypal.Money
+	if len(order.PurchaseUnits) > 0 {
+		unit := order.PurchaseUnits[0]
+		amount = unit.Amount
+		if unit.Payments != nil && len(unit.Payments.Captures) > 0 {
+			transactionID = unit.Payments.Captures[0].ID
+		}
+	}
+
+	value, currency := parsePayPalMoney(amount)
+
+	return &WebhookEvent{
+		ID:            event.ID,
+		Type:          event.EventType,
+		TransactionID: transactionID,
+		Status:        status,
+		Amount:        value,
+		Currency:      currency,
+		PaymentDetails: map[string]interface{}{
+			"order_id":     order.ID,
+			"order_status": order.Status,
+		},
+	}, nil
+}
+
+// parsePayPalDisputeEvent разбирает события CUSTOMER.DISPUTE.*
+func parsePayPalDisputeEvent(event paypal.AnyEvent) (*WebhookEvent, error) {
+	var dispute paypalDisputeResource
+	if err := json.Unmarshal(event.Resource, &dispute); err != nil {
+		return nil, fmt.Errorf("failed to parse dispute data: %w", err)
+	}
+
+	if len(dispute.DisputedTransactions) == 0 {
+		return nil, fmt.Errorf("dispute %s has no disputed transactions", dispute.DisputeID)
+	}
+
+	details := map[string]interface{}{
+		"dispute_id":     dispute.DisputeID,
+		"dispute_status": dispute.Status,
+		"dispute_reason": dispute.Reason,
+	}
+
+	var status models.PaymentStatus
+	switch event.EventType {
+	case "CUSTOMER.DISPUTE.CREATED", "CUSTOMER.DISPUTE.UPDATED":
+		status = models.PaymentStatusDisputed
+	case "CUSTOMER.DISPUTE.RESOLVED":
+		if dispute.DisputeOutcome == nil {
+			return nil, fmt.Errorf("resolved dispute %s has no outcome", dispute.DisputeID)
+		}
+		outcome, ok := paypalDisputeOutcomes[dispute.DisputeOutcome.OutcomeCode]
+		if !ok {
+			return nil, fmt.Errorf("unexpected dispute outcome: %s", dispute.DisputeOutcome.OutcomeCode)
+		}
+		status = outcome
+		details["dispute_outcome"] = dispute.DisputeOutcome.OutcomeCode
+	default:
+		return newIgnoredWebhookEvent(event.ID, event.EventType), nil
+	}
+
+	amount, currency := parsePayPalMoney(dispute.DisputeAmount)
+
+	return &WebhookEvent{
+		ID:             event.ID,
+		Type:           event.EventType,
+		TransactionID:  dispute.DisputedTransactions[0].SellerTransactionID,
+		Status:         status,
+		Amount:         amount,
+		Currency:       currency,
+		PaymentDetails: details,
+	}, nil
+}
+
+// newPayPalPaymentEvent формирует событие из ресурса capture, refund или authorization
+func newPayPalPaymentEvent(event paypal.AnyEvent, transactionID string, status models.PaymentStatus, resource paypalPaymentResource, kind string) *WebhookEvent {
+	amount, currency := parsePayPalMoney(resource.Amount)
+
+	details := map[string]interface{}{
+		kind + "_id":  resource.ID,
+		"status":      resource.Status,
+		"create_time": resource.CreateTime,
+		"update_time": resource.UpdateTime,
+	}
+	if resource.StatusDetails != nil {
+		details["status_reason"] = resource.StatusDetails.Reason
+	}
+
+	return &WebhookEvent{
+		ID:             event.ID,
+		Type:           event.EventType,
+		TransactionID:  transactionID,
+		Status:         status,
+		Amount:         amount,
+		Currency:       currency,
+		PaymentDetails: details,
+	}
+}
+
+// parsePayPalMoney преобразует сумму PayPal в число и валюту
+func parsePayPalMoney(money *paypal.Money) (float64, string) {
+	if money == nil {
+		return 0, ""
+	}
+	value, _ := strconv.ParseFloat(money.Value, 64)
+	return value, money.Currency
+}
+
+// paypalParentID извлекает идентификатор родительского ресурса из ссылки "up"
+func paypalParentID(links []paypal.Link) string {
+	for _, link := range links {
+		if link.Rel == "up" {
+			return link.Href[strings.LastIndex(link.Href, "/")+1:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,299 @@
+package payment
+
+import (
+	"encoding/json"
+	"go_payment/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/plutov/paypal/v4"
+)
+
+// paypalEvent собирает событие PayPal так же, как его разбирает ValidateWebhook
+func paypalEvent(t *testing.T, eventType, resourceType, resource string) paypal.AnyEvent {
+	t.Helper()
+	payload := `{"id":"WH-1","event_type":"` + eventType + `","resource_type":"` + resourceType + `","resource":` + resource + `}`
+	var event paypal.AnyEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	return event
+}
+
+const paypalCaptureLink = `"links":[{"rel":"up","href":"https://api.paypal.com/v2/payments/captures/CAP-1"}]`
+
+func TestParsePayPalEvents(t *testing.T) {
+	tests := []struct {
+		name          string
+		eventType     string
+		resourceType  string
+		resource      string
+		parse         func(paypal.AnyEvent) (*WebhookEvent, error)
+		status        models.PaymentStatus
+		transactionID string
+		amount        float64
+		ignored       bool
+	}{
+		{
+			name:          "capture completed",
+			eventType:     "PAYMENT.CAPTURE.COMPLETED",
+			resourceType:  "capture",
+			resource:      `{"id":"CAP-1","status":"COMPLETED","amount":{"value":"10.50","currency_code":"EUR"}}`,
+			parse:         parsePayPalCaptureEvent,
+			status:        models.PaymentStatusCompleted,
+			transactionID: "CAP-1",
+			amount:        10.50,
+		},
+		{
+			name:          "capture denied",
+			eventType:     "PAYMENT.CAPTURE.DENIED",
+			resourceType:  "capture",
+			resource:      `{"id":"CAP-1","status":"DECLINED","amount":{"value":"10.50","currency_code":"EUR"}}`,
+			parse:         parsePayPalCaptureEvent,
+			status:        models.PaymentStatusFailed,
+			transactionID: "CAP-1",
+			amount:        10.50,
+		},
+		{
+			name:          "fully refunded capture",
+			eventType:     "PAYMENT.CAPTURE.REFUNDED",
+			resourceType:  "capture",
+			resource:      `{"id":"CAP-1","status":"REFUNDED","amount":{"value":"10.50","currency_code":"EUR"}}`,
+			parse:         parsePayPalCaptureEvent,
+			status:        models.PaymentStatusRefunded,
+			transactionID: "CAP-1",
+			amount:        10.50,
+		},
+		{
+			name:          "partially refunded capture",
+			eventType:     "PAYMENT.CAPTURE.REFUNDED",
+			resourceType:  "capture",
+			resource:      `{"id":"CAP-1","status":"PARTIALLY_REFUNDED","amount":{"value":"10.50","currency_code":"EUR"}}`,
+			parse:         parsePayPalCaptureEvent,
+			status:        models.PaymentStatusPartiallyRefunded,
+			transactionID: "CAP-1",
+		},
+		{
+			name:          "refund reports the total refunded amount",
+			eventType:     "PAYMENT.CAPTURE.REFUNDED",
+			resourceType:  "refund",
+			resource:      `{"id":"REF-2","status":"COMPLETED","amount":{"value":"3.00","currency_code":"EUR"},"seller_payable_breakdown":{"total_refunded_amount":{"value":"5.00","currency_code":"EUR"}},` + paypalCaptureLink + `}`,
+			parse:         parsePayPalRefundEvent,
+			status:        models.PaymentStatusPartiallyRefunded,
+			transactionID: "CAP-1",
+			amount:        5,
+		},
+		{
+			name:          "refund without breakdown",
+			eventType:     "PAYMENT.CAPTURE.REFUNDED",
+			resourceType:  "refund",
+			resource:      `{"id":"REF-1","status":"COMPLETED","amount":{"value":"3.00","currency_code":"EUR"},` + paypalCaptureLink + `}`,
+			parse:         parsePayPalRefundEvent,
+			status:        models.PaymentStatusPartiallyRefunded,
+			transactionID: "CAP-1",
+			amount:        3,
+		},
+		{
+			name:          "reversal",
+			eventType:     "PAYMENT.CAPTURE.REVERSED",
+			resourceType:  "refund",
+			resource:      `{"id":"REF-1","status":"COMPLETED","amount":{"value":"10.50","currency_code":"EUR"},` + paypalCaptureLink + `}`,
+			parse:         parsePayPalRefundEvent,
+			status:        models.PaymentStatusChargedBack,
+			transactionID: "CAP-1",
+			amount:        10.50,
+		},
+		{
+			name:         "unknown capture event",
+			eventType:    "PAYMENT.CAPTURE.UNKNOWN",
+			resourceType: "capture",
+			resource:     `{"id":"CAP-1"}`,
+			parse:        parsePayPalCaptureEvent,
+			ignored:      true,
+		},
+		{
+			name:          "authorization created",
+			eventType:     "PAYMENT.AUTHORIZATION.CREATED",
+			resourceType:  "authorization",
+			resource:      `{"id":"AUTH-1","status":"CREATED","amount":{"value":"10.50","currency_code":"EUR"}}`,
+			parse:         parsePayPalAuthorizationEvent,
+			status:        models.PaymentStatusAuthorized,
+			transactionID: "AUTH-1",
+			amount:        10.50,
+		},
+		{
+			name:          "authorization voided",
+			eventType:     "PAYMENT.AUTHORIZATION.VOIDED",
+			resourceType:  "authorization",
+			resource:      `{"id":"AUTH-1","status":"VOIDED"}`,
+			parse:         parsePayPalAuthorizationEvent,
+			status:        models.PaymentStatusCancelled,
+			transactionID: "AUTH-1",
+		},
+		{
+			name:          "authorization expired",
+			eventType:     "PAYMENT.AUTHORIZATION.VOIDED",
+			resourceType:  "authorization",
+			resource:      `{"id":"AUTH-1","status":"EXPIRED"}`,
+			parse:         parsePayPalAuthorizationEvent,
+			status:        models.PaymentStatusCancelled,
+			transactionID: "AUTH-1",
+		},
+		{
+			name:          "order approved",
+			eventType:     "CHECKOUT.ORDER.APPROVED",
+			resourceType:  "checkout-order",
+			resource:      `{"id":"ORDER-1","status":"APPROVED","purchase_units":[{"amount":{"value":"10.50","currency_code":"EUR"}}]}`,
+			parse:         parsePayPalOrderEvent,
+			status:        models.PaymentStatusPending,
+			transactionID: "ORDER-1",
+			amount:        10.50,
+		},
+		{
+			name:          "order completed prefers the capture",
+			eventType:     "CHECKOUT.ORDER.COMPLETED",
+			resourceType:  "checkout-order",
+			resource:      `{"id":"ORDER-1","status":"COMPLETED","purchase_units":[{"amount":{"value":"10.50","currency_code":"EUR"},"payments":{"captures":[{"id":"CAP-1"}]}}]}`,
+			parse:         parsePayPalOrderEvent,
+			status:        models.PaymentStatusCompleted,
+			transactionID: "CAP-1",
+			amount:        10.50,
+		},
+		{
+			name:         "unknown order event",
+			eventType:    "CHECKOUT.ORDER.PROCESSED",
+			resourceType: "checkout-order",
+			resource:     `{"id":"ORDER-1"}`,
+			parse:        parsePayPalOrderEvent,
+			ignored:      true,
+		},
+		{
+			name:          "dispute created",
+			eventType:     "CUSTOMER.DISPUTE.CREATED",
+			resourceType:  "dispute",
+			resource:      `{"dispute_id":"PP-D-1","status":"OPEN","dispute_amount":{"value":"10.50","currency_code":"EUR"},"disputed_transactions":[{"seller_transaction_id":"CAP-1"}]}`,
+			parse:         parsePayPalDisputeEvent,
+			status:        models.PaymentStatusDisputed,
+			transactionID: "CAP-1",
+			amount:        10.50,
+		},
+		{
+			name:          "dispute resolved for the seller",
+			eventType:     "CUSTOMER.DISPUTE.RESOLVED",
+			resourceType:  "dispute",
+			resource:      `{"dispute_id":"PP-D-1","status":"RESOLVED","disputed_transactions":[{"seller_transaction_id":"CAP-1"}],"dispute_outcome":{"outcome_code":"RESOLVED_SELLER_FAVOUR"}}`,
+			parse:         parsePayPalDisputeEvent,
+			status:        models.PaymentStatusCompleted,
+			transactionID: "CAP-1",
+		},
+		{
+			name:          "dispute resolved for the buyer",
+			eventType:     "CUSTOMER.DISPUTE.RESOLVED",
+			resourceType:  "dispute",
+			resource:      `{"dispute_id":"PP-D-1","status":"RESOLVED","disputed_transactions":[{"seller_transaction_id":"CAP-1"}],"dispute_outcome":{"outcome_code":"RESOLVED_BUYER_FAVOUR"}}`,
+			parse:         parsePayPalDisputeEvent,
+			status:        models.PaymentStatusChargedBack,
+			transactionID: "CAP-1",
+		},
+		{
+			name:          "dispute resolved by refund",
+			eventType:     "CUSTOMER.DISPUTE.RESOLVED",
+			resourceType:  "dispute",
+			resource:      `{"dispute_id":"PP-D-1","status":"RESOLVED","disputed_transactions":[{"seller_transaction_id":"CAP-1"}],"dispute_outcome":{"outcome_code":"REFUNDED"}}`,
+			parse:         parsePayPalDisputeEvent,
+			status:        models.PaymentStatusRefunded,
+			transactionID: "CAP-1",
+		},
+		{
+			name:         "unknown dispute event",
+			eventType:    "CUSTOMER.DISPUTE.OTHER",
+			resourceType: "dispute",
+			resource:     `{"dispute_id":"PP-D-1","disputed_transactions":[{"seller_transaction_id":"CAP-1"}]}`,
+			parse:        parsePayPalDisputeEvent,
+			ignored:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parse(paypalEvent(t, tt.eventType, tt.resourceType, tt.resource))
+			if err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+			if got.Ignored != tt.ignored {
+				t.Fatalf("Ignored = %v, want %v", got.Ignored, tt.ignored)
+			}
+			if got.Status != tt.status {
+				t.Errorf("Status = %q, want %q", got.Status, tt.status)
+			}
+			if got.TransactionID != tt.transactionID {
+				t.Errorf("TransactionID = %q, want %q", got.TransactionID, tt.transactionID)
+			}
+			if got.Amount != tt.amount {
+				t.Errorf("Amount = %v, want %v", got.Amount, tt.amount)
+			}
+			if got.ID != "WH-1" || got.Type != tt.eventType {
+				t.Errorf("event = %s/%s, want WH-1/%s", got.ID, got.Type, tt.eventType)
+			}
+		})
+	}
+}
+
+func TestParsePayPalAuthorizationExpired(t *testing.T) {
+	event := paypalEvent(t, "PAYMENT.AUTHORIZATION.VOIDED", "authorization", `{"id":"AUTH-1","status":"EXPIRED"}`)
+	got, err := parsePayPalAuthorizationEvent(event)
+	if err != nil {
+		t.Fatalf("parsePayPalAuthorizationEvent() error = %v", err)
+	}
+	if got.PaymentDetails["cancellation_reason"] != "authorization_expired" {
+		t.Errorf("cancellation_reason = %v, want authorization_expired", got.PaymentDetails["cancellation_reason"])
+	}
+}
+
+func TestParsePayPalEventErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		resource  string
+		parse     func(paypal.AnyEvent) (*WebhookEvent, error)
+		wantErr   string
+	}{
+		{
+			name:      "refund without capture link",
+			eventType: "PAYMENT.CAPTURE.REFUNDED",
+			resource:  `{"id":"REF-1","status":"COMPLETED"}`,
+			parse:     parsePayPalRefundEvent,
+			wantErr:   "has no capture link",
+		},
+		{
+			name:      "dispute without transactions",
+			eventType: "CUSTOMER.DISPUTE.CREATED",
+			resource:  `{"dispute_id":"PP-D-1"}`,
+			parse:     parsePayPalDisputeEvent,
+			wantErr:   "has no disputed transactions",
+		},
+		{
+			name:      "resolved dispute without outcome",
+			eventType: "CUSTOMER.DISPUTE.RESOLVED",
+			resource:  `{"dispute_id":"PP-D-1","disputed_transactions":[{"seller_transaction_id":"CAP-1"}]}`,
+			parse:     parsePayPalDisputeEvent,
+			wantErr:   "has no outcome",
+		},
+		{
+			name:      "unexpected dispute outcome",
+			eventType: "CUSTOMER.DISPUTE.RESOLVED",
+			resource:  `{"dispute_id":"PP-D-1","disputed_transactions":[{"seller_transaction_id":"CAP-1"}],"dispute_outcome":{"outcome_code":"SOMETHING_ELSE"}}`,
+			parse:     parsePayPalDisputeEvent,
+			wantErr:   "unexpected dispute outcome",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.parse(paypalEvent(t, tt.eventType, "", tt.resource))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parse() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -12,7 +12,11 @@ type PaymentRequest struct {
 	CustomerID    string
 	CustomerEmail string
 	Description   string
+	Locale        string
 	MetaData      map[string]interface{}
+	// CaptureManually только авторизует сумму, провайдер должен
+	// поддерживать Capturer
+	CaptureManually bool
 }
 
 type PaymentResponse struct {
@@ -31,11 +35,44 @@ type Provider interface {
 	GetPaymentStatus(ctx context.Context, transactionID string) (models.PaymentStatus, error)
 }
 
+// HealthChecker реализуется провайдерами, доступность API которых можно
+// проверить без побочных эффектов
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// Capturer реализуется провайдерами, поддерживающими двухэтапные платежи:
+// авторизацию суммы и последующее списание или отмену авторизации
+type Capturer interface {
+	// CapturePayment списывает авторизованную сумму, amount не больше
+	// авторизованной. Провайдер может выдать списанию новый идентификатор.
+	CapturePayment(ctx context.Context, transactionID string, amount float64, currency string) (*PaymentResponse, error)
+	// VoidPayment отменяет авторизацию без списания
+	VoidPayment(ctx context.Context, transactionID string) error
+}
+
+// WebhookEvent представляет событие провайдера, приведенное к модели платежа.
+// Пустой Status означает, что событие несет только детали и не меняет статус
+// платежа. Ignored выставляется для неизвестных событий: их нужно подтвердить
+// провайдеру, но не применять к платежу. Для возвратов Amount содержит сумму
+// всех возвратов по платежу, а не последнего из них.
 type WebhookEvent struct {
+	ID             string
 	Type           string
 	TransactionID  string
 	Status         models.PaymentStatus
 	Amount         float64
 	Currency       string
 	PaymentDetails map[string]interface{}
+	Ignored        bool
+}
+
+// newIgnoredWebhookEvent создает событие, которое подтверждается, но не обрабатывается
+func newIgnoredWebhookEvent(id, eventType string) *WebhookEvent {
+	return &WebhookEvent{
+		ID:             id,
+		Type:           eventType,
+		PaymentDetails: make(map[string]interface{}),
+		Ignored:        true,
+	}
 }
@@ -2,12 +2,12 @@ package payment
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"go_payment/internal/models"
-	"log"
+	"strings"
 
 	"github.com/stripe/stripe-go/v74"
+	"github.com/stripe/stripe-go/v74/balance"
 	"github.com/stripe/stripe-go/v74/charge"
 	"github.com/stripe/stripe-go/v74/refund"
 	"github.com/stripe/stripe-go/v74/webhook"
@@ -37,6 +37,17 @@ func (p *StripeProvider) Initialize(config map[string]string) error {
 	return nil
 }
 
+// CheckHealth проверяет доступность API Stripe и действительность ключа
+// запросом баланса аккаунта
+func (p *StripeProvider) CheckHealth(ctx context.Context) error {
+	params := &stripe.BalanceParams{}
+	params.Context = ctx
+	if _, err := balance.Get(params); err != nil {
+		return fmt.Errorf("stripe is unavailable: %w", err)
+	}
+	return nil
+}
+
 // ProcessPayment обрабатывает платеж через Stripe
 func (p *StripeProvider) ProcessPayment(ctx context.Context, req PaymentRequest) (*PaymentResponse, error) {
 	// Конвертируем сумму в центы (Stripe работает с наименьшими единицами валюты)
@@ -47,10 +58,9 @@ func (p *StripeProvider) ProcessPayment(ctx context.Context, req PaymentRequest)
 		Amount:      stripe.Int64(amountInCents),
 		Currency:    stripe.String(string(req.Currency)),
 		Description: stripe.String(req.Description),
-		Metadata: map[string]string{
-			"order_id": req.OrderID,
-		},
+		Capture:     stripe.Bool(!req.CaptureManually),
 	}
+	params.AddMetadata("order_id", req.OrderID)
 
 	// Добавляем информацию о клиенте, если есть
 	if req.CustomerEmail != "" {
@@ -76,7 +86,9 @@ func (p *StripeProvider) ProcessPayment(ctx context.Context, req PaymentRequest)
 
 	// Определяем статус платежа
 	status := models.PaymentStatusPending
-	if charge.Paid {
+	if charge.Paid && !charge.Captured {
+		status = models.PaymentStatusAuthorized
+	} else if charge.Paid {
 		status = models.PaymentStatusCompleted
 	} else if charge.Status == "failed" {
 		status = models.PaymentStatusFailed
@@ -107,60 +119,26 @@ func (p *StripeProvider) ValidateWebhook(payload []byte, signature string) (*Web
 		return nil, fmt.Errorf("failed to verify webhook signature: %w", err)
 	}
 
-	var status models.PaymentStatus
-	var amount float64
-	var currency string
-	var transactionID string
-	details := make(map[string]interface{})
+	var result *WebhookEvent
+	eventType := event.Type
 
-	switch event.Type {
-	case "charge.succeeded":
-		var charge stripe.Charge
-		err := json.Unmarshal(event.Data.Raw, &charge)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse charge data: %w", err)
-		}
-		status = models.PaymentStatusCompleted
-		amount = float64(charge.Amount) / 100
-		currency = string(charge.Currency)
-		transactionID = charge.ID
-		details["receipt_url"] = charge.ReceiptURL
-		details["payment_method"] = charge.PaymentMethod
-
-	case "charge.failed":
-		var charge stripe.Charge
-		err := json.Unmarshal(event.Data.Raw, &charge)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse charge data: %w", err)
-		}
-		status = models.PaymentStatusFailed
-		amount = float64(charge.Amount) / 100
-		currency = string(charge.Currency)
-		transactionID = charge.ID
-		details["failure_code"] = charge.FailureCode
-		details["failure_message"] = charge.FailureMessage
-
-	case "charge.refunded":
-		var charge stripe.Charge
-		err := json.Unmarshal(event.Data.Raw, &charge)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse charge data: %w", err)
-		}
-		status = models.PaymentStatusRefunded
-		amount = float64(charge.AmountRefunded) / 100
-		currency = string(charge.Currency)
-		transactionID = charge.ID
-		details["refund_reason"] = charge.RefundReason
+	switch {
+	case strings.HasPrefix(eventType, "charge.dispute."):
+		result, err = parseStripeDisputeEvent(event)
+	case eventType == "charge.refund.updated":
+		result, err = parseStripeRefundEvent(event)
+	case strings.HasPrefix(eventType, "charge."):
+		result, err = parseStripeChargeEvent(event)
+	case strings.HasPrefix(eventType, "payment_intent."):
+		result, err = parseStripePaymentIntentEvent(event)
+	default:
+		result = newIgnoredWebhookEvent(event.ID, eventType)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return &WebhookEvent{
-		Type:          event.Type,
-		TransactionID: transactionID,
-		Status:       status,
-		Amount:       amount,
-		Currency:     currency,
-		PaymentDetails: details,
-	}, nil
+	return result, nil
 }
 
 // RefundPayment выполняет возврат платежа
@@ -180,6 +158,43 @@ func (p *StripeProvider) RefundPayment(ctx context.Context, transactionID string
 	return nil
 }
 
+// CapturePayment списывает авторизованную сумму платежа
+func (p *StripeProvider) CapturePayment(ctx context.Context, transactionID string, amount float64, currency string) (*PaymentResponse, error) {
+	params := &stripe.ChargeCaptureParams{
+		Amount: stripe.Int64(int64(amount * 100)),
+	}
+	params.Context = ctx
+
+	ch, err := charge.Capture(transactionID, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture stripe charge: %w", err)
+	}
+
+	return &PaymentResponse{
+		Success:       ch.Captured,
+		TransactionID: ch.ID,
+		Status:        models.PaymentStatusCompleted,
+		PaymentDetails: map[string]interface{}{
+			"amount_captured": float64(ch.AmountCaptured) / 100,
+			"receipt_url":     ch.ReceiptURL,
+		},
+	}, nil
+}
+
+// VoidPayment отменяет авторизацию. В Stripe возврат несписанного платежа
+// освобождает авторизованную сумму.
+func (p *StripeProvider) VoidPayment(ctx context.Context, transactionID string) error {
+	params := &stripe.RefundParams{
+		Charge: stripe.String(transactionID),
+	}
+	params.Context = ctx
+
+	if _, err := refund.New(params); err != nil {
+		return fmt.Errorf("failed to release stripe authorization: %w", err)
+	}
+	return nil
+}
+
 // GetPaymentStatus получает текущий статус платежа
 func (p *StripeProvider) GetPaymentStatus(ctx context.Context, transactionID string) (models.PaymentStatus, error) {
 	ch, err := charge.Get(transactionID, nil)
@@ -190,6 +205,8 @@ func (p *StripeProvider) GetPaymentStatus(ctx context.Context, transactionID str
 	switch {
 	case ch.Refunded:
 		return models.PaymentStatusRefunded, nil
+	case ch.Paid && !ch.Captured:
+		return models.PaymentStatusAuthorized, nil
 	case ch.Paid:
 		return models.PaymentStatusCompleted, nil
 	case ch.Status == "failed":
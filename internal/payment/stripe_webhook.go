@@ -0,0 +1,196 @@
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"go_payment/internal/models"
+
+	"github.com/stripe/stripe-go/v74"
+)
+
+// stripeChargeStatuses сопоставляет события charge.* со статусами платежа
+var stripeChargeStatuses = map[string]models.PaymentStatus{
+	"charge.succeeded": models.PaymentStatusCompleted,
+	"charge.captured":  models.PaymentStatusCompleted,
+	"charge.pending":   models.PaymentStatusPending,
+	"charge.failed":    models.PaymentStatusFailed,
+	"charge.expired":   models.PaymentStatusCancelled,
+	"charge.refunded":  models.PaymentStatusRefunded,
+}
+
+// stripePaymentIntentStatuses сопоставляет события payment_intent.* со статусами платежа
+var stripePaymentIntentStatuses = map[string]models.PaymentStatus{
+	"payment_intent.created":                   models.PaymentStatusPending,
+	"payment_intent.processing":                models.PaymentStatusPending,
+	"payment_intent.requires_action":           models.PaymentStatusPending,
+	"payment_intent.amount_capturable_updated": models.PaymentStatusAuthorized,
+	"payment_intent.succeeded":                 models.PaymentStatusCompleted,
+	"payment_intent.payment_failed":            models.PaymentStatusFailed,
+	"payment_intent.canceled":                  models.PaymentStatusCancelled,
+}
+
+// stripeDisputeOutcomes сопоставляет итоговый статус спора со статусом платежа
+var stripeDisputeOutcomes = map[stripe.DisputeStatus]models.PaymentStatus{
+	stripe.DisputeStatusWon:            models.PaymentStatusCompleted,
+	stripe.DisputeStatusWarningClosed:  models.PaymentStatusCompleted,
+	stripe.DisputeStatusLost:           models.PaymentStatusChargedBack,
+	stripe.DisputeStatusChargeRefunded: models.PaymentStatusRefunded,
+}
+
+// parseStripeChargeEvent разбирает события charge.*
+func parseStripeChargeEvent(event stripe.Event) (*WebhookEvent, error) {
+	status, known := stripeChargeStatuses[event.Type]
+	if !known {
+		return newIgnoredWebhookEvent(event.ID, event.Type), nil
+	}
+
+	var ch stripe.Charge
+	if err := json.Unmarshal(event.Data.Raw, &ch); err != nil {
+		return nil, fmt.Errorf("failed to parse charge data: %w", err)
+	}
+
+	amount := float64(ch.Amount) / 100
+	details := map[string]interface{}{
+		"charge_status": ch.Status,
+	}
+
+	switch status {
+	case models.PaymentStatusCompleted:
+		details["receipt_url"] = ch.ReceiptURL
+		details["payment_method"] = ch.PaymentMethod
+	case models.PaymentStatusFailed:
+		details["failure_code"] = ch.FailureCode
+		details["failure_message"] = ch.FailureMessage
+	case models.PaymentStatusRefunded:
+		// Частичный возврат не закрывает платеж полностью
+		if !ch.Refunded {
+			status = models.PaymentStatusPartiallyRefunded
+		}
+		amount = float64(ch.AmountRefunded) / 100
+		details["amount_refunded"] = amount
+	}
+
+	return &WebhookEvent{
+		ID:             event.ID,
+		Type:           event.Type,
+		TransactionID:  ch.ID,
+		Status:         status,
+		Amount:         amount,
+		Currency:       string(ch.Currency),
+		PaymentDetails: details,
+	}, nil
+}
+
+// parseStripeRefundEvent разбирает обновления возвратов. Статус платежа
+// меняется событием charge.refunded, поэтому здесь передаются только детали.
+func parseStripeRefundEvent(event stripe.Event) (*WebhookEvent, error) {
+	var rf stripe.Refund
+	if err := json.Unmarshal(event.Data.Raw, &rf); err != nil {
+		return nil, fmt.Errorf("failed to parse refund data: %w", err)
+	}
+
+	if rf.Charge == nil {
+		return nil, fmt.Errorf("refund %s has no charge", rf.ID)
+	}
+
+	details := map[string]interface{}{
+		"refund_id":     rf.ID,
+		"refund_status": rf.Status,
+		"refund_reason": rf.Reason,
+	}
+	if rf.FailureReason != "" {
+		details["refund_failure_reason"] = rf.FailureReason
+	}
+
+	return &WebhookEvent{
+		ID:             event.ID,
+		Type:           event.Type,
+		TransactionID:  rf.Charge.ID,
+		Amount:         float64(rf.Amount) / 100,
+		Currency:       string(rf.Currency),
+		PaymentDetails: details,
+	}, nil
+}
+
+// parseStripeDisputeEvent разбирает события charge.dispute.*
+func parseStripeDisputeEvent(event stripe.Event) (*WebhookEvent, error) {
+	var dispute stripe.Dispute
+	if err := json.Unmarshal(event.Data.Raw, &dispute); err != nil {
+		return nil, fmt.Errorf("failed to parse dispute data: %w", err)
+	}
+
+	if dispute.Charge == nil {
+		return nil, fmt.Errorf("dispute %s has no charge", dispute.ID)
+	}
+
+	var status models.PaymentStatus
+	switch event.Type {
+	case "charge.dispute.created", "charge.dispute.updated", "charge.dispute.funds_withdrawn":
+		status = models.PaymentStatusDisputed
+	case "charge.dispute.funds_reinstated":
+		status = models.PaymentStatusCompleted
+	case "charge.dispute.closed":
+		outcome, ok := stripeDisputeOutcomes[dispute.Status]
+		if !ok {
+			return nil, fmt.Errorf("unexpected dispute outcome: %s", dispute.Status)
+		}
+		status = outcome
+	default:
+		return newIgnoredWebhookEvent(event.ID, event.Type), nil
+	}
+
+	return &WebhookEvent{
+		ID:            event.ID,
+		Type:          event.Type,
+		TransactionID: dispute.Charge.ID,
+		Status:        status,
+		Amount:        float64(dispute.Amount) / 100,
+		Currency:      string(dispute.Currency),
+		PaymentDetails: map[string]interface{}{
+			"dispute_id":     dispute.ID,
+			"dispute_status": dispute.Status,
+			"dispute_reason": dispute.Reason,
+		},
+	}, nil
+}
+
+// parseStripePaymentIntentEvent разбирает события payment_intent.*
+func parseStripePaymentIntentEvent(event stripe.Event) (*WebhookEvent, error) {
+	status, known := stripePaymentIntentStatuses[event.Type]
+	if !known {
+		return newIgnoredWebhookEvent(event.ID, event.Type), nil
+	}
+
+	var intent stripe.PaymentIntent
+	if err := json.Unmarshal(event.Data.Raw, &intent); err != nil {
+		return nil, fmt.Errorf("failed to parse payment intent data: %w", err)
+	}
+
+	// Платежи хранят идентификатор charge, поэтому предпочитаем его
+	transactionID := intent.ID
+	if intent.LatestCharge != nil && intent.LatestCharge.ID != "" {
+		transactionID = intent.LatestCharge.ID
+	}
+
+	details := map[string]interface{}{
+		"payment_intent_id":     intent.ID,
+		"payment_intent_status": intent.Status,
+	}
+	if intent.CancellationReason != "" {
+		details["cancellation_reason"] = intent.CancellationReason
+	}
+	if intent.LastPaymentError != nil {
+		details["failure_code"] = intent.LastPaymentError.Code
+		details["failure_message"] = intent.LastPaymentError.Msg
+	}
+
+	return &WebhookEvent{
+		ID:             event.ID,
+		Type:           event.Type,
+		TransactionID:  transactionID,
+		Status:         status,
+		Amount:         float64(intent.Amount) / 100,
+		Currency:       string(intent.Currency),
+		PaymentDetails: details,
+	}, nil
+}
@@ -0,0 +1,246 @@
+package payment
+
+import (
+	"encoding/json"
+	"go_payment/internal/models"
+	"strings"
+	"testing"
+
+	"github.com/stripe/stripe-go/v74"
+)
+
+// stripeEvent собирает событие Stripe так же, как его разбирает webhook.ConstructEvent
+func stripeEvent(t *testing.T, eventType, object string) stripe.Event {
+	t.Helper()
+	payload := `{"id":"evt_1","type":"` + eventType + `","data":{"object":` + object + `}}`
+	var event stripe.Event
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	return event
+}
+
+func TestParseStripeEvents(t *testing.T) {
+	tests := []struct {
+		name          string
+		eventType     string
+		object        string
+		parse         func(stripe.Event) (*WebhookEvent, error)
+		status        models.PaymentStatus
+		transactionID string
+		amount        float64
+		ignored       bool
+	}{
+		{
+			name:          "charge succeeded",
+			eventType:     "charge.succeeded",
+			object:        `{"id":"ch_1","amount":1050,"currency":"eur","status":"succeeded"}`,
+			parse:         parseStripeChargeEvent,
+			status:        models.PaymentStatusCompleted,
+			transactionID: "ch_1",
+			amount:        10.50,
+		},
+		{
+			name:          "charge failed",
+			eventType:     "charge.failed",
+			object:        `{"id":"ch_1","amount":1050,"currency":"eur","failure_code":"card_declined"}`,
+			parse:         parseStripeChargeEvent,
+			status:        models.PaymentStatusFailed,
+			transactionID: "ch_1",
+			amount:        10.50,
+		},
+		{
+			name:          "charge expired",
+			eventType:     "charge.expired",
+			object:        `{"id":"ch_1","amount":1050,"currency":"eur"}`,
+			parse:         parseStripeChargeEvent,
+			status:        models.PaymentStatusCancelled,
+			transactionID: "ch_1",
+			amount:        10.50,
+		},
+		{
+			name:          "full refund",
+			eventType:     "charge.refunded",
+			object:        `{"id":"ch_1","amount":1050,"amount_refunded":1050,"refunded":true,"currency":"eur"}`,
+			parse:         parseStripeChargeEvent,
+			status:        models.PaymentStatusRefunded,
+			transactionID: "ch_1",
+			amount:        10.50,
+		},
+		{
+			name:          "partial refund",
+			eventType:     "charge.refunded",
+			object:        `{"id":"ch_1","amount":1050,"amount_refunded":300,"refunded":false,"currency":"eur"}`,
+			parse:         parseStripeChargeEvent,
+			status:        models.PaymentStatusPartiallyRefunded,
+			transactionID: "ch_1",
+			amount:        3,
+		},
+		{
+			name:      "unknown charge event",
+			eventType: "charge.updated",
+			object:    `{"id":"ch_1"}`,
+			parse:     parseStripeChargeEvent,
+			ignored:   true,
+		},
+		{
+			name:          "refund updated carries only details",
+			eventType:     "charge.refund.updated",
+			object:        `{"id":"re_1","amount":300,"currency":"eur","charge":"ch_1","status":"failed","failure_reason":"expired_or_canceled_card"}`,
+			parse:         parseStripeRefundEvent,
+			transactionID: "ch_1",
+			amount:        3,
+		},
+		{
+			name:          "dispute created",
+			eventType:     "charge.dispute.created",
+			object:        `{"id":"dp_1","amount":1050,"currency":"eur","charge":"ch_1","status":"needs_response"}`,
+			parse:         parseStripeDisputeEvent,
+			status:        models.PaymentStatusDisputed,
+			transactionID: "ch_1",
+			amount:        10.50,
+		},
+		{
+			name:          "dispute funds reinstated",
+			eventType:     "charge.dispute.funds_reinstated",
+			object:        `{"id":"dp_1","amount":1050,"currency":"eur","charge":"ch_1","status":"won"}`,
+			parse:         parseStripeDisputeEvent,
+			status:        models.PaymentStatusCompleted,
+			transactionID: "ch_1",
+			amount:        10.50,
+		},
+		{
+			name:          "dispute won",
+			eventType:     "charge.dispute.closed",
+			object:        `{"id":"dp_1","amount":1050,"currency":"eur","charge":"ch_1","status":"won"}`,
+			parse:         parseStripeDisputeEvent,
+			status:        models.PaymentStatusCompleted,
+			transactionID: "ch_1",
+			amount:        10.50,
+		},
+		{
+			name:          "dispute lost",
+			eventType:     "charge.dispute.closed",
+			object:        `{"id":"dp_1","amount":1050,"currency":"eur","charge":"ch_1","status":"lost"}`,
+			parse:         parseStripeDisputeEvent,
+			status:        models.PaymentStatusChargedBack,
+			transactionID: "ch_1",
+			amount:        10.50,
+		},
+		{
+			name:          "dispute closed by refund",
+			eventType:     "charge.dispute.closed",
+			object:        `{"id":"dp_1","amount":1050,"currency":"eur","charge":"ch_1","status":"charge_refunded"}`,
+			parse:         parseStripeDisputeEvent,
+			status:        models.PaymentStatusRefunded,
+			transactionID: "ch_1",
+			amount:        10.50,
+		},
+		{
+			name:      "unknown dispute event",
+			eventType: "charge.dispute.unknown",
+			object:    `{"id":"dp_1","charge":"ch_1"}`,
+			parse:     parseStripeDisputeEvent,
+			ignored:   true,
+		},
+		{
+			name:          "payment intent with charge",
+			eventType:     "payment_intent.succeeded",
+			object:        `{"id":"pi_1","amount":1050,"currency":"eur","latest_charge":"ch_1","status":"succeeded"}`,
+			parse:         parseStripePaymentIntentEvent,
+			status:        models.PaymentStatusCompleted,
+			transactionID: "ch_1",
+			amount:        10.50,
+		},
+		{
+			name:          "payment intent authorized",
+			eventType:     "payment_intent.amount_capturable_updated",
+			object:        `{"id":"pi_1","amount":1050,"currency":"eur","status":"requires_capture"}`,
+			parse:         parseStripePaymentIntentEvent,
+			status:        models.PaymentStatusAuthorized,
+			transactionID: "pi_1",
+			amount:        10.50,
+		},
+		{
+			name:          "payment intent canceled",
+			eventType:     "payment_intent.canceled",
+			object:        `{"id":"pi_1","amount":1050,"currency":"eur","cancellation_reason":"abandoned"}`,
+			parse:         parseStripePaymentIntentEvent,
+			status:        models.PaymentStatusCancelled,
+			transactionID: "pi_1",
+			amount:        10.50,
+		},
+		{
+			name:      "unknown payment intent event",
+			eventType: "payment_intent.partially_funded",
+			object:    `{"id":"pi_1"}`,
+			parse:     parseStripePaymentIntentEvent,
+			ignored:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.parse(stripeEvent(t, tt.eventType, tt.object))
+			if err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+			if got.Ignored != tt.ignored {
+				t.Fatalf("Ignored = %v, want %v", got.Ignored, tt.ignored)
+			}
+			if got.Status != tt.status {
+				t.Errorf("Status = %q, want %q", got.Status, tt.status)
+			}
+			if got.TransactionID != tt.transactionID {
+				t.Errorf("TransactionID = %q, want %q", got.TransactionID, tt.transactionID)
+			}
+			if got.Amount != tt.amount {
+				t.Errorf("Amount = %v, want %v", got.Amount, tt.amount)
+			}
+			if got.ID != "evt_1" || got.Type != tt.eventType {
+				t.Errorf("event = %s/%s, want evt_1/%s", got.ID, got.Type, tt.eventType)
+			}
+		})
+	}
+}
+
+func TestParseStripeEventErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		object    string
+		parse     func(stripe.Event) (*WebhookEvent, error)
+		wantErr   string
+	}{
+		{
+			name:      "refund without charge",
+			eventType: "charge.refund.updated",
+			object:    `{"id":"re_1","amount":300}`,
+			parse:     parseStripeRefundEvent,
+			wantErr:   "has no charge",
+		},
+		{
+			name:      "dispute without charge",
+			eventType: "charge.dispute.created",
+			object:    `{"id":"dp_1","amount":1050}`,
+			parse:     parseStripeDisputeEvent,
+			wantErr:   "has no charge",
+		},
+		{
+			name:      "dispute closed with open status",
+			eventType: "charge.dispute.closed",
+			object:    `{"id":"dp_1","charge":"ch_1","status":"under_review"}`,
+			parse:     parseStripeDisputeEvent,
+			wantErr:   "unexpected dispute outcome",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.parse(stripeEvent(t, tt.eventType, tt.object))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parse() error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
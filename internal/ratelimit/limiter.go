@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"go_payment/internal/config"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval — период удаления корзин неактивных клиентов
+const sweepInterval = time.Minute
+
+// Limiter ограничивает частоту запросов клиентов алгоритмом token bucket.
+// Лимиты читаются из runtime настроек при каждом запросе, поэтому их
+// изменение применяется к уже накопленным корзинам без перезапуска.
+type Limiter struct {
+	runtime *config.RuntimeStore
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewLimiter создает Limiter с лимитами секции runtime.rate_limits
+func NewLimiter(runtime *config.RuntimeStore) *Limiter {
+	return &Limiter{
+		runtime: runtime,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow расходует токен клиента key и сообщает, разрешен ли запрос
+func (l *Limiter) Allow(key string) bool {
+	limit := l.runtime.Current().RateLimits
+	if limit.RequestsPerSecond <= 0 {
+		return true
+	}
+	burst := float64(limit.Burst)
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now, limit)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*limit.RequestsPerSecond)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep удаляет корзины, успевшие заполниться: они не отличаются от новых
+func (l *Limiter) sweep(now time.Time, limit config.RateLimitConfig) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	refill := time.Duration(float64(limit.Burst) / limit.RequestsPerSecond * float64(time.Second))
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= refill {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"go_payment/internal/config"
+	"testing"
+	"time"
+)
+
+// newTestLimiter создает Limiter с лимитами limit и управляемыми часами
+func newTestLimiter(limit config.RateLimitConfig) (*Limiter, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter(config.NewRuntimeStore("", &config.Config{
+		Runtime: config.Runtime{RateLimits: limit},
+	}))
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiterRefill(t *testing.T) {
+	l, now := newTestLimiter(config.RateLimitConfig{RequestsPerSecond: 2, Burst: 3})
+
+	steps := []struct {
+		advance time.Duration
+		key     string
+		want    bool
+	}{
+		{0, "a", true},
+		{0, "a", true},
+		{0, "a", true},
+		{0, "a", false},
+		{0, "b", true},
+		{250 * time.Millisecond, "a", false},
+		{250 * time.Millisecond, "a", true},
+		{0, "a", false},
+		{10 * time.Second, "a", true},
+		{0, "a", true},
+		{0, "a", true},
+		{0, "a", false},
+	}
+
+	for i, step := range steps {
+		*now = now.Add(step.advance)
+		if got := l.Allow(step.key); got != step.want {
+			t.Fatalf("step %d: Allow(%s) = %v, want %v", i, step.key, got, step.want)
+		}
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l, _ := newTestLimiter(config.RateLimitConfig{})
+	for i := 0; i < 100; i++ {
+		if !l.Allow("a") {
+			t.Fatalf("Allow() = false on request %d with rate limiting disabled", i)
+		}
+	}
+}
+
+func TestLimiterSweepsFullBuckets(t *testing.T) {
+	l, now := newTestLimiter(config.RateLimitConfig{RequestsPerSecond: 1, Burst: 2})
+
+	l.Allow("idle")
+	*now = now.Add(sweepInterval)
+	l.Allow("active")
+
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("refilled bucket was not swept")
+	}
+	if _, ok := l.buckets["active"]; !ok {
+		t.Error("active bucket was swept")
+	}
+}
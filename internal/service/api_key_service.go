@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go_payment/internal/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// apiKeyPrefix отличает ключи сервиса от прочих секретов в конфигурациях
+	apiKeyPrefix       = "gp_"
+	apiKeyDisplayChars = 8
+)
+
+var (
+	// ErrInvalidAPIKey возвращается для неизвестного, отозванного или
+	// истекшего ключа
+	ErrInvalidAPIKey = errors.New("invalid api key")
+	// ErrAPIKeyNotFound возвращается, если ключ с указанным ID не найден
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrInvalidRole возвращается для неизвестной роли ключа
+	ErrInvalidRole = errors.New("invalid role")
+)
+
+// CreateAPIKey выпускает ключ доступа с ролью role. Ключ возвращается только
+// при создании, повторно получить его нельзя.
+func (s *AuthService) CreateAPIKey(ctx context.Context, name string, role models.Role, createdBy string, expiresAt *time.Time) (string, *models.APIKey, error) {
+	switch role {
+	case models.RoleAdmin, models.RoleManager, models.RoleCustomer:
+	default:
+		return "", nil, fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, fmt.Errorf("failed to generate api key: %w", err)
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	apiKey := &models.APIKey{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+apiKeyDisplayChars],
+		KeyHash:   hashAPIKey(key),
+		Role:      role,
+		CreatedBy: createdBy,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.WithContext(ctx).Create(apiKey).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to save api key: %w", err)
+	}
+
+	return key, apiKey, nil
+}
+
+// ValidateAPIKey проверяет ключ и отмечает время его использования
+func (s *AuthService) ValidateAPIKey(ctx context.Context, key string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var apiKey models.APIKey
+	err := s.db.WithContext(ctx).Where("key_hash = ?", hashAPIKey(key)).First(&apiKey).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load api key: %w", err)
+	}
+
+	now := time.Now()
+	if !apiKey.Active(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Время использования нужно только для аудита, ошибка не блокирует вызов
+	s.db.WithContext(ctx).Model(&apiKey).Update("last_used_at", now)
+	return &apiKey, nil
+}
+
+// ListAPIKeys возвращает ключи доступа, начиная с последних
+func (s *AuthService) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := s.db.WithContext(ctx).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает ключ доступа
+func (s *AuthService) RevokeAPIKey(ctx context.Context, id string) error {
+	result := s.db.WithContext(ctx).Model(&models.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke api key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// hashAPIKey вычисляет хэш ключа. Ключ содержит 256 бит случайных данных,
+// поэтому медленное хэширование, как для паролей, не требуется.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
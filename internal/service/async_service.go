@@ -3,41 +3,67 @@ package service
 import (
 	"context"
 	"fmt"
+	"go_payment/internal/config"
 	"go_payment/internal/errors"
+	"go_payment/internal/i18n"
 	"go_payment/internal/messaging"
 	"go_payment/internal/models"
 	"go_payment/internal/retry"
 	"log"
+	"strconv"
 	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // AsyncService обрабатывает асинхронные операции
 type AsyncService struct {
-	db       *gorm.DB
-	rabbitmq *messaging.RabbitMQ
-	strategy *errors.RetryStrategy
+	db            *gorm.DB
+	rabbitmq      *messaging.RabbitMQ
+	webhooks      *WebhookService
+	notifications *NotificationService
+	receipts      *ReceiptService
+	strategy      *errors.RetryStrategy
+	runtime       *config.RuntimeStore
 }
 
 // NewAsyncService создает новый экземпляр AsyncService
-func NewAsyncService(db *gorm.DB, rabbitmq *messaging.RabbitMQ) *AsyncService {
+func NewAsyncService(db *gorm.DB, rabbitmq *messaging.RabbitMQ, webhooks *WebhookService, notifications *NotificationService, receipts *ReceiptService) *AsyncService {
 	return &AsyncService{
-		db:       db,
-		rabbitmq: rabbitmq,
-		strategy: errors.DefaultRetryStrategy(),
+		db:            db,
+		rabbitmq:      rabbitmq,
+		webhooks:      webhooks,
+		notifications: notifications,
+		receipts:      receipts,
+		strategy:      errors.DefaultRetryStrategy(),
 	}
 }
 
-// StartProcessing запускает обработку асинхронных операций
-func (s *AsyncService) StartProcessing() error {
+// ConfigureRuntime включает стратегию повтора из секции runtime.retry.
+// Изменения применяются к сообщениям, обработка которых начнется после них.
+func (s *AsyncService) ConfigureRuntime(runtime *config.RuntimeStore) {
+	s.runtime = runtime
+}
+
+// retryStrategy возвращает действующую стратегию повтора
+func (s *AsyncService) retryStrategy() *errors.RetryStrategy {
+	if s.runtime == nil {
+		return s.strategy
+	}
+	return s.runtime.Current().RetryStrategy()
+}
+
+// StartProcessing запускает обработку асинхронных операций до отмены ctx
+func (s *AsyncService) StartProcessing(ctx context.Context) error {
 	// Обработка платежей
-	if err := s.rabbitmq.ConsumePayments(s.handlePayment); err != nil {
+	if err := s.rabbitmq.ConsumePayments(ctx, s.handlePayment); err != nil {
 		return fmt.Errorf("failed to start payment consumer: %w", err)
 	}
 
 	// Обработка изменений статуса
-	if err := s.rabbitmq.ConsumePaymentStatus(s.handlePaymentStatus); err != nil {
+	if err := s.rabbitmq.ConsumePaymentStatus(ctx, s.handlePaymentStatus); err != nil {
 		return fmt.Errorf("failed to start status consumer: %w", err)
 	}
 
@@ -46,9 +72,7 @@ func (s *AsyncService) StartProcessing() error {
 }
 
 // handlePayment обрабатывает сообщение о платеже
-func (s *AsyncService) handlePayment(msg *models.PaymentMessage) error {
-	ctx := context.Background()
-
+func (s *AsyncService) handlePayment(ctx context.Context, msg *models.PaymentMessage) error {
 	// Создаем операцию для обработки платежа
 	operation := func(ctx context.Context) error {
 		// Проверяем, не был ли платеж уже обработан
@@ -61,16 +85,18 @@ func (s *AsyncService) handlePayment(msg *models.PaymentMessage) error {
 
 		// Создаем новый платеж в базе данных
 		payment := &models.Payment{
+			ID:            uuid.New().String(),
 			OrderID:       msg.OrderID,
 			Amount:        msg.Amount,
 			Currency:      msg.Currency,
 			Status:        msg.Status,
-			Provider:      msg.Provider,
+			ProviderType:  msg.Provider,
 			CustomerID:    msg.CustomerID,
 			CustomerEmail: msg.CustomerEmail,
-			PaymentDate:   msg.CreatedAt,
-			MetaData:      msg.MetaData,
+			Locale:        msg.Locale,
+			Metadata:      msg.MetaData,
 		}
+		payment.CreatedAt = msg.CreatedAt
 
 		if err := s.db.Create(payment).Error; err != nil {
 			return errors.NewPaymentError(
@@ -83,76 +109,169 @@ func (s *AsyncService) handlePayment(msg *models.PaymentMessage) error {
 			)
 		}
 
-		// Отправляем уведомление о создании платежа
-		notification := &models.NotificationMessage{
-			Type:      "email",
-			Recipient: msg.CustomerEmail,
-			Subject:   fmt.Sprintf("Payment Received - Order %s", msg.OrderID),
-			Content:   fmt.Sprintf("We have received your payment of %.2f %s", msg.Amount, msg.Currency),
-			CreatedAt: time.Now(),
+		if err := s.recordStatusEvent(ctx, payment, ""); err != nil {
+			log.Printf("Failed to record initial status of order %s: %v", msg.OrderID, err)
+		}
+
+		// Платеж, созданный сразу в статусе completed, получает квитанцию
+		var attachments []models.NotificationAttachment
+		if receipt := s.issueReceipt(ctx, payment); receipt != nil {
+			attachments = append(attachments, ReceiptAttachment(receipt))
 		}
 
-		if err := s.rabbitmq.PublishNotification(ctx, notification); err != nil {
+		// Отправляем уведомление о создании платежа
+		err := s.notifyCustomer(ctx, TemplatePaymentReceived, msg.CustomerEmail, msg.Locale, map[string]interface{}{
+			"order_id":   msg.OrderID,
+			"amount":     msg.Amount,
+			"currency":   msg.Currency,
+			"created_at": msg.CreatedAt,
+		}, attachments...)
+		if err != nil {
 			// Ошибка отправки уведомления не должна влиять на обработку платежа
 			log.Printf("Failed to send notification for order %s: %v", msg.OrderID, err)
 		}
 
+		s.DispatchWebhook(ctx, models.WebhookEventPaymentCreated, payment)
+
 		return nil
 	}
 
 	// Выполняем операцию с повторными попытками
-	return retry.WithRetry(ctx, operation, s.strategy)
+	return retry.WithRetry(ctx, operation, s.retryStrategy())
 }
 
 // handlePaymentStatus обрабатывает изменение статуса платежа
-func (s *AsyncService) handlePaymentStatus(msg *models.PaymentStatusMessage) error {
-	ctx := context.Background()
-
+func (s *AsyncService) handlePaymentStatus(ctx context.Context, msg *models.PaymentStatusMessage) error {
 	// Создаем операцию для обновления статуса
 	operation := func(ctx context.Context) error {
-		// Проверяем существование платежа
 		var payment models.Payment
-		if err := s.db.Where("order_id = ?", msg.OrderID).First(&payment).Error; err != nil {
-			return errors.NewPaymentError(
-				errors.ErrorTypeDatabase,
-				"PAYMENT_NOT_FOUND",
-				"Payment not found",
-				msg.OrderID,
-				false,
-				err,
-			)
+		var event *models.PaymentStatusEvent
+
+		// Статус и событие истории записываются вместе: событие не теряется,
+		// если повтор увидит уже сохраненный статус
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("order_id = ?", msg.OrderID).First(&payment).Error
+			if err != nil {
+				return errors.NewPaymentError(
+					errors.ErrorTypeDatabase,
+					"PAYMENT_NOT_FOUND",
+					"Payment not found",
+					msg.OrderID,
+					false,
+					err,
+				)
+			}
+
+			var last models.PaymentStatusEvent
+			err = tx.Where("order_id = ?", msg.OrderID).Order("sequence DESC").Limit(1).Find(&last).Error
+			if err != nil {
+				return errors.NewPaymentError(
+					errors.ErrorTypeDatabase,
+					"STATUS_EVENT_ERROR",
+					"Failed to load payment status events",
+					msg.OrderID,
+					true,
+					err,
+				)
+			}
+
+			update, record := planStatusUpdate(payment.Status, last.NewStatus, msg)
+			if update {
+				if err := tx.Model(&payment).Update("status", msg.NewStatus).Error; err != nil {
+					return errors.NewPaymentError(
+						errors.ErrorTypeDatabase,
+						"STATUS_UPDATE_ERROR",
+						"Failed to update payment status",
+						msg.OrderID,
+						true,
+						err,
+					)
+				}
+				payment.Status = msg.NewStatus
+			}
+			if !record {
+				return nil
+			}
+
+			// История статусов питает потоки WatchPayment, поэтому ошибка
+			// записи откатывает обновление и повторяет обработку сообщения
+			if event, err = insertStatusEvent(tx, &payment, msg.OldStatus); err != nil {
+				return errors.NewPaymentError(
+					errors.ErrorTypeDatabase,
+					"STATUS_EVENT_ERROR",
+					"Failed to record payment status event",
+					msg.OrderID,
+					true,
+					err,
+				)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
 		}
 
-		// Обновляем статус платежа
-		if err := s.db.Model(&payment).Update("status", msg.NewStatus).Error; err != nil {
-			return errors.NewPaymentError(
-				errors.ErrorTypeDatabase,
-				"STATUS_UPDATE_ERROR",
-				"Failed to update payment status",
-				msg.OrderID,
-				true,
-				err,
-			)
+		if event == nil {
+			log.Printf("Skipping status message %s -> %s for order %s in status %s",
+				msg.OldStatus, msg.NewStatus, msg.OrderID, payment.Status)
+			return nil
 		}
+		s.publishStatusEvent(ctx, event)
 
-		// Отправляем уведомление об изменении статуса
-		notification := &models.NotificationMessage{
-			Type:      "email",
-			Recipient: payment.CustomerEmail,
-			Subject:   fmt.Sprintf("Payment Status Updated - Order %s", msg.OrderID),
-			Content:   fmt.Sprintf("Your payment status has been updated to %s", msg.NewStatus),
-			CreatedAt: time.Now(),
+		// Квитанция выпускается после записи перехода в completed и
+		// прикладывается к уведомлению
+		var attachments []models.NotificationAttachment
+		if receipt := s.issueReceipt(ctx, &payment); receipt != nil {
+			attachments = append(attachments, ReceiptAttachment(receipt))
 		}
 
-		if err := s.rabbitmq.PublishNotification(ctx, notification); err != nil {
+		// Отправляем уведомление об изменении статуса
+		err = s.notifyCustomer(ctx, TemplatePaymentStatusChanged, payment.CustomerEmail, payment.Locale, map[string]interface{}{
+			"order_id":   msg.OrderID,
+			"amount":     payment.Amount,
+			"currency":   payment.Currency,
+			"status":     string(msg.NewStatus),
+			"updated_at": msg.UpdatedAt,
+		}, attachments...)
+		if err != nil {
 			log.Printf("Failed to send status notification for order %s: %v", msg.OrderID, err)
 		}
 
+		s.DispatchWebhook(ctx, models.WebhookEventPaymentStatusChanged, map[string]interface{}{
+			"order_id":   msg.OrderID,
+			"old_status": msg.OldStatus,
+			"new_status": msg.NewStatus,
+			"payment":    payment,
+		})
+
 		return nil
 	}
 
 	// Выполняем операцию с повторными попытками
-	return retry.WithRetry(ctx, operation, s.strategy)
+	return retry.WithRetry(ctx, operation, s.retryStrategy())
+}
+
+// planStatusUpdate определяет, как применить сообщение о смене статуса к
+// текущему статусу платежа: нужно ли сохранить новый статус и нужно ли
+// записать событие в историю. Отправитель мог уже сохранить новый статус,
+// тогда событие записывается, если оно еще не последнее в истории.
+// Устаревшие сообщения и запрещенные переходы не применяются.
+func planStatusUpdate(current, lastEvent models.PaymentStatus, msg *models.PaymentStatusMessage) (update, record bool) {
+	if msg.OldStatus == msg.NewStatus {
+		return false, false
+	}
+	switch current {
+	case msg.NewStatus:
+		return false, lastEvent != msg.NewStatus
+	case msg.OldStatus:
+		if !current.CanTransitionTo(msg.NewStatus) {
+			return false, false
+		}
+		return true, true
+	default:
+		return false, false
+	}
 }
 
 // ProcessPaymentAsync асинхронно обрабатывает платеж
@@ -162,11 +281,12 @@ func (s *AsyncService) ProcessPaymentAsync(ctx context.Context, payment *models.
 		Amount:        payment.Amount,
 		Currency:      payment.Currency,
 		Status:        payment.Status,
-		Provider:      payment.Provider,
+		Provider:      payment.ProviderType,
 		CustomerID:    payment.CustomerID,
 		CustomerEmail: payment.CustomerEmail,
+		Locale:        payment.Locale,
 		CreatedAt:     time.Now(),
-		MetaData:      payment.MetaData,
+		MetaData:      payment.Metadata,
 	}
 
 	operation := func(ctx context.Context) error {
@@ -183,7 +303,7 @@ func (s *AsyncService) ProcessPaymentAsync(ctx context.Context, payment *models.
 		return nil
 	}
 
-	return retry.WithRetry(ctx, operation, s.strategy)
+	return retry.WithRetry(ctx, operation, s.retryStrategy())
 }
 
 // UpdatePaymentStatusAsync асинхронно обновляет статус платежа
@@ -209,5 +329,69 @@ func (s *AsyncService) UpdatePaymentStatusAsync(ctx context.Context, orderID str
 		return nil
 	}
 
-	return retry.WithRetry(ctx, operation, s.strategy)
+	return retry.WithRetry(ctx, operation, s.retryStrategy())
+}
+
+// DispatchWebhook отправляет событие во внешние вебхуки. Ошибка отправки
+// не должна влиять на обработку платежа, поэтому она только логируется.
+func (s *AsyncService) DispatchWebhook(ctx context.Context, eventType string, data interface{}) {
+	if s.webhooks == nil {
+		return
+	}
+	if err := s.webhooks.Dispatch(ctx, eventType, data); err != nil {
+		log.Printf("Failed to dispatch %s webhook: %v", eventType, err)
+	}
+}
+
+// issueReceipt выпускает квитанцию по платежу, перешедшему в статус
+// completed. Выпуск идемпотентен, ошибка только логируется, чтобы не
+// задерживать обработку статуса.
+func (s *AsyncService) issueReceipt(ctx context.Context, payment *models.Payment) *models.Receipt {
+	if s.receipts == nil || payment.Status != models.PaymentStatusCompleted {
+		return nil
+	}
+
+	receipt, err := s.receipts.IssueInvoice(ctx, payment)
+	if err != nil {
+		log.Printf("Failed to issue receipt for order %s: %v", payment.OrderID, err)
+		return nil
+	}
+	return receipt
+}
+
+// notifyCustomer рендерит шаблон на языке клиента и ставит уведомление в очередь
+func (s *AsyncService) notifyCustomer(ctx context.Context, templateName, recipient, locale string, data map[string]interface{}, attachments ...models.NotificationAttachment) error {
+	if s.notifications == nil {
+		return nil
+	}
+
+	user := s.lookupCustomer(ctx, recipient)
+	if locale = i18n.Normalize(locale); locale == "" {
+		locale = i18n.DefaultLocale
+		if user != nil && user.Locale != "" {
+			locale = user.Locale
+		}
+	}
+
+	notification, err := s.notifications.CreateNotification(ctx, templateName, recipient, locale, data)
+	if err != nil {
+		return fmt.Errorf("failed to render %s notification: %w", templateName, err)
+	}
+	if user != nil {
+		// Связываем уведомление с настройками пользователя
+		notification.UserID = strconv.FormatUint(uint64(user.ID), 10)
+	}
+	notification.Attachments = append(notification.Attachments, attachments...)
+
+	return s.notifications.Enqueue(ctx, notification)
+}
+
+// lookupCustomer находит зарегистрированного пользователя по email клиента.
+// Возвращает nil для гостевых платежей.
+func (s *AsyncService) lookupCustomer(ctx context.Context, email string) *models.User {
+	var user models.User
+	if err := s.db.WithContext(ctx).Select("id", "locale").Where("email = ?", email).First(&user).Error; err != nil {
+		return nil
+	}
+	return &user
 }
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"go_payment/internal/models"
+	"testing"
+)
+
+func TestPlanStatusUpdate(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    models.PaymentStatus
+		lastEvent  models.PaymentStatus
+		old        models.PaymentStatus
+		new        models.PaymentStatus
+		wantUpdate bool
+		wantRecord bool
+	}{
+		{
+			name:    "status saved by the sender",
+			current: models.PaymentStatusCompleted, lastEvent: models.PaymentStatusPending,
+			old: models.PaymentStatusPending, new: models.PaymentStatusCompleted,
+			wantRecord: true,
+		},
+		{
+			name:    "redelivered message",
+			current: models.PaymentStatusCompleted, lastEvent: models.PaymentStatusCompleted,
+			old: models.PaymentStatusPending, new: models.PaymentStatusCompleted,
+		},
+		{
+			name:    "status not saved yet",
+			current: models.PaymentStatusPending, lastEvent: models.PaymentStatusPending,
+			old: models.PaymentStatusPending, new: models.PaymentStatusCompleted,
+			wantUpdate: true, wantRecord: true,
+		},
+		{
+			name:    "payment has no history yet",
+			current: models.PaymentStatusPending,
+			old:     models.PaymentStatusPending, new: models.PaymentStatusFailed,
+			wantUpdate: true, wantRecord: true,
+		},
+		{
+			name:    "stale message",
+			current: models.PaymentStatusRefunded, lastEvent: models.PaymentStatusRefunded,
+			old: models.PaymentStatusPending, new: models.PaymentStatusCompleted,
+		},
+		{
+			name:    "transition out of a final state",
+			current: models.PaymentStatusCancelled, lastEvent: models.PaymentStatusCancelled,
+			old: models.PaymentStatusCancelled, new: models.PaymentStatusPending,
+		},
+		{
+			name:    "no change",
+			current: models.PaymentStatusPending, lastEvent: models.PaymentStatusPending,
+			old: models.PaymentStatusPending, new: models.PaymentStatusPending,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &models.PaymentStatusMessage{OrderID: "order-1", OldStatus: tt.old, NewStatus: tt.new}
+			update, record := planStatusUpdate(tt.current, tt.lastEvent, msg)
+			if update != tt.wantUpdate || record != tt.wantRecord {
+				t.Errorf("planStatusUpdate() = (%v, %v), want (%v, %v)", update, record, tt.wantUpdate, tt.wantRecord)
+			}
+		})
+	}
+}
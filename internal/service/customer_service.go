@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_payment/internal/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultCustomerPageSize = 50
+	maxCustomerPageSize     = 500
+)
+
+var (
+	// ErrCustomerNotFound возвращается, если клиент не найден
+	ErrCustomerNotFound = errors.New("customer not found")
+	// ErrPaymentMethodNotFound возвращается, если способ оплаты не найден
+	// у указанного клиента
+	ErrPaymentMethodNotFound = errors.New("payment method not found")
+	// ErrInvalidCustomer возвращается для неполных данных клиента или
+	// способа оплаты
+	ErrInvalidCustomer = errors.New("invalid customer")
+)
+
+// CustomerService управляет клиентами и их сохраненными способами оплаты
+type CustomerService struct {
+	db *gorm.DB
+}
+
+// NewCustomerService создает новый экземпляр CustomerService
+func NewCustomerService(db *gorm.DB) *CustomerService {
+	return &CustomerService{db: db}
+}
+
+// CustomerPage представляет страницу клиентов
+type CustomerPage struct {
+	Customers     []models.Customer `json:"customers"`
+	NextPageToken string            `json:"next_page_token,omitempty"`
+}
+
+// CreateCustomer создает клиента
+func (s *CustomerService) CreateCustomer(ctx context.Context, customer *models.Customer) error {
+	customer.Email = strings.TrimSpace(customer.Email)
+	if customer.Email == "" {
+		return fmt.Errorf("%w: email is required", ErrInvalidCustomer)
+	}
+
+	customer.ID = uuid.New().String()
+	if err := s.db.WithContext(ctx).Create(customer).Error; err != nil {
+		return fmt.Errorf("failed to create customer: %w", err)
+	}
+	return nil
+}
+
+// GetCustomer возвращает клиента по идентификатору
+func (s *CustomerService) GetCustomer(ctx context.Context, id string) (*models.Customer, error) {
+	var customer models.Customer
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&customer).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCustomerNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer: %w", err)
+	}
+	return &customer, nil
+}
+
+// ListCustomers возвращает клиентов от новых к старым. Пустой email не
+// ограничивает выборку.
+func (s *CustomerService) ListCustomers(ctx context.Context, email string, pageSize int, pageToken string) (*CustomerPage, error) {
+	if pageSize <= 0 {
+		pageSize = defaultCustomerPageSize
+	}
+	if pageSize > maxCustomerPageSize {
+		pageSize = maxCustomerPageSize
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.Customer{})
+	if email != "" {
+		query = query.Where("email = ?", email)
+	}
+
+	// Курсор тот же, что у платежей, вместо хэша фильтра в нем email
+	if pageToken != "" {
+		cursor, err := decodePaymentCursor(pageToken)
+		if err != nil || cursor.Filter != email {
+			return nil, ErrInvalidPageToken
+		}
+		query = query.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+
+	var customers []models.Customer
+	if err := query.Order("created_at DESC, id DESC").Limit(pageSize + 1).Find(&customers).Error; err != nil {
+		return nil, fmt.Errorf("failed to list customers: %w", err)
+	}
+
+	page := &CustomerPage{Customers: customers}
+	if len(customers) > pageSize {
+		page.Customers = customers[:pageSize]
+		last := page.Customers[pageSize-1]
+		page.NextPageToken = encodePaymentCursor(paymentCursor{
+			CreatedAt: last.CreatedAt,
+			ID:        last.ID,
+			Filter:    email,
+		})
+	}
+	return page, nil
+}
+
+// AttachPaymentMethod сохраняет способ оплаты клиента. Первый способ оплаты
+// клиента становится основным.
+func (s *CustomerService) AttachPaymentMethod(ctx context.Context, method *models.PaymentMethod) error {
+	if method.ProviderType == "" || method.ProviderToken == "" {
+		return fmt.Errorf("%w: provider and provider token are required", ErrInvalidCustomer)
+	}
+	if _, err := s.GetCustomer(ctx, method.CustomerID); err != nil {
+		return err
+	}
+
+	method.ID = uuid.New().String()
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.PaymentMethod{}).Where("customer_id = ?", method.CustomerID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count payment methods: %w", err)
+		}
+		if count == 0 {
+			method.IsDefault = true
+		}
+
+		if method.IsDefault {
+			err := tx.Model(&models.PaymentMethod{}).
+				Where("customer_id = ? AND is_default", method.CustomerID).
+				Update("is_default", false).Error
+			if err != nil {
+				return fmt.Errorf("failed to reset default payment method: %w", err)
+			}
+		}
+
+		if err := tx.Create(method).Error; err != nil {
+			return fmt.Errorf("failed to save payment method: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListPaymentMethods возвращает способы оплаты клиента, основной первым
+func (s *CustomerService) ListPaymentMethods(ctx context.Context, customerID string) ([]models.PaymentMethod, error) {
+	if _, err := s.GetCustomer(ctx, customerID); err != nil {
+		return nil, err
+	}
+
+	var methods []models.PaymentMethod
+	err := s.db.WithContext(ctx).
+		Where("customer_id = ?", customerID).
+		Order("is_default DESC, created_at DESC").
+		Find(&methods).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payment methods: %w", err)
+	}
+	return methods, nil
+}
+
+// DetachPaymentMethod удаляет способ оплаты клиента. Если удален основной
+// способ, основным становится последний добавленный из оставшихся.
+func (s *CustomerService) DetachPaymentMethod(ctx context.Context, customerID, methodID string) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var method models.PaymentMethod
+		err := tx.Where("id = ? AND customer_id = ?", methodID, customerID).First(&method).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPaymentMethodNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get payment method: %w", err)
+		}
+
+		if err := tx.Delete(&method).Error; err != nil {
+			return fmt.Errorf("failed to delete payment method: %w", err)
+		}
+		if !method.IsDefault {
+			return nil
+		}
+
+		var next models.PaymentMethod
+		err = tx.Where("customer_id = ?", customerID).Order("created_at DESC").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get payment method: %w", err)
+		}
+		return tx.Model(&next).Updates(map[string]interface{}{
+			"is_default": true,
+			"updated_at": time.Now(),
+		}).Error
+	})
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+const (
+	defaultSMTPPoolSize    = 4
+	defaultSMTPIdleTimeout = time.Minute
+	defaultSMTPDialTimeout = 10 * time.Second
+	maxCapturedEmails      = 100
+
+	// NotificationIDHeader связывает письмо с уведомлением при обработке
+	// ответов и возвратов
+	NotificationIDHeader = "X-Notification-ID"
+)
+
+// EmailAttachment представляет вложение письма
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// EmailMessage представляет письмо, передаваемое отправителю. Если заданы
+// и Text, и HTML, письмо отправляется как multipart/alternative.
+type EmailMessage struct {
+	ID          string
+	From        string
+	ReplyTo     string
+	To          string
+	Subject     string
+	Text        string
+	HTML        string
+	Headers     map[string]string
+	Attachments []EmailAttachment
+}
+
+// EmailSender отправляет письма
+type EmailSender interface {
+	Send(ctx context.Context, email *EmailMessage) error
+}
+
+// SMTPConfig содержит настройки SMTP сервера и адреса по умолчанию
+type SMTPConfig struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	From        string
+	ReplyTo     string
+	PoolSize    int
+	IdleTimeout time.Duration
+	// DialTimeout ограничивает подключение к серверу вместе с приветствием
+	// и аутентификацией
+	DialTimeout time.Duration
+}
+
+// smtpConn представляет открытое SMTP соединение пула
+type smtpConn struct {
+	sender   gomail.SendCloser
+	lastUsed time.Time
+}
+
+// SMTPEmailSender отправляет письма через пул долгоживущих SMTP соединений.
+// Соединение, закрытое сервером, переоткрывается при следующей отправке.
+type SMTPEmailSender struct {
+	config SMTPConfig
+	// connect открывает и аутентифицирует SMTP соединение
+	connect func() (gomail.SendCloser, error)
+	// slots ограничивает число одновременных соединений
+	slots chan struct{}
+	idle  chan *smtpConn
+}
+
+// NewSMTPEmailSender создает отправителя с пулом SMTP соединений
+func NewSMTPEmailSender(config SMTPConfig) *SMTPEmailSender {
+	if config.PoolSize <= 0 {
+		config.PoolSize = defaultSMTPPoolSize
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaultSMTPIdleTimeout
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = defaultSMTPDialTimeout
+	}
+
+	return &SMTPEmailSender{
+		config:  config,
+		connect: gomail.NewDialer(config.Host, config.Port, config.Username, config.Password).Dial,
+		slots:   make(chan struct{}, config.PoolSize),
+		idle:    make(chan *smtpConn, config.PoolSize),
+	}
+}
+
+// Send отправляет письмо, переиспользуя свободное соединение пула
+func (s *SMTPEmailSender) Send(ctx context.Context, email *EmailMessage) error {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.slots }()
+
+	m := buildEmail(email, s.config.From, s.config.ReplyTo)
+	from, err := mail.ParseAddress(m.GetHeader("From")[0])
+	if err != nil {
+		return fmt.Errorf("%w: invalid sender: %v", ErrInvalidMessage, err)
+	}
+	to, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRecipient, err)
+	}
+
+	conn, err := s.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = conn.sender.Send(from.Address, []string{to.Address}, m)
+	if err != nil && !isSMTPReply(err) {
+		// Сервер мог закрыть простаивающее соединение, повторяем на новом
+		conn.sender.Close()
+		if conn, err = s.dial(ctx); err != nil {
+			return err
+		}
+		err = conn.sender.Send(from.Address, []string{to.Address}, m)
+	}
+	if err != nil {
+		// Состояние SMTP сессии после ошибки не определено
+		conn.sender.Close()
+		return err
+	}
+
+	conn.lastUsed = time.Now()
+	s.release(conn)
+	return nil
+}
+
+// Close закрывает простаивающие соединения пула
+func (s *SMTPEmailSender) Close() error {
+	for {
+		select {
+		case conn := <-s.idle:
+			conn.sender.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// acquire возвращает свободное соединение или открывает новое
+func (s *SMTPEmailSender) acquire(ctx context.Context) (*smtpConn, error) {
+	for {
+		select {
+		case conn := <-s.idle:
+			if time.Since(conn.lastUsed) < s.config.IdleTimeout {
+				return conn, nil
+			}
+			conn.sender.Close()
+		default:
+			return s.dial(ctx)
+		}
+	}
+}
+
+// release возвращает соединение в пул
+func (s *SMTPEmailSender) release(conn *smtpConn) {
+	select {
+	case s.idle <- conn:
+	default:
+		conn.sender.Close()
+	}
+}
+
+// dial открывает новое SMTP соединение. gomail не принимает контекст,
+// поэтому ожидание ограничивается ctx и DialTimeout, а соединение,
+// открытое после отказа от ожидания, закрывается.
+func (s *SMTPEmailSender) dial(ctx context.Context) (*smtpConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.config.DialTimeout)
+	defer cancel()
+
+	type dialResult struct {
+		sender gomail.SendCloser
+		err    error
+	}
+	done := make(chan dialResult, 1)
+	go func() {
+		sender, err := s.connect()
+		done <- dialResult{sender: sender, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		if result.err != nil {
+			return nil, fmt.Errorf("failed to connect to SMTP server: %w", result.err)
+		}
+		return &smtpConn{sender: result.sender, lastUsed: time.Now()}, nil
+	case <-ctx.Done():
+		go func() {
+			if result := <-done; result.err == nil {
+				result.sender.Close()
+			}
+		}()
+		return nil, fmt.Errorf("failed to connect to SMTP server: %w", ctx.Err())
+	}
+}
+
+// isSMTPReply проверяет, что ошибка является ответом SMTP сервера, а не
+// разрывом соединения
+func isSMTPReply(err error) bool {
+	var smtpErr *textproto.Error
+	return errors.As(err, &smtpErr)
+}
+
+// CaptureEmailSender сохраняет письма вместо отправки. Используется при
+// локальной разработке и в тестах: последние письма доступны через Messages,
+// а при заданном каталоге каждое письмо записывается в .eml файл.
+type CaptureEmailSender struct {
+	mu       sync.Mutex
+	dir      string
+	from     string
+	messages []*EmailMessage
+}
+
+// NewCaptureEmailSender создает sink писем. Пустой dir отключает запись на диск.
+func NewCaptureEmailSender(dir, from string) (*CaptureEmailSender, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create email capture directory: %w", err)
+		}
+	}
+	return &CaptureEmailSender{dir: dir, from: from}, nil
+}
+
+// Send сохраняет письмо
+func (s *CaptureEmailSender) Send(ctx context.Context, email *EmailMessage) error {
+	m := buildEmail(email, s.from, "")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.dir != "" {
+		name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405.000"), email.ID)
+		if err := writeEmail(filepath.Join(s.dir, name), m); err != nil {
+			return err
+		}
+	}
+
+	captured := *email
+	captured.From = m.GetHeader("From")[0]
+	s.messages = append(s.messages, &captured)
+	if len(s.messages) > maxCapturedEmails {
+		s.messages = s.messages[len(s.messages)-maxCapturedEmails:]
+	}
+
+	log.Printf("Captured email %s to %s: %s", email.ID, email.To, email.Subject)
+	return nil
+}
+
+// Messages возвращает последние сохраненные письма
+func (s *CaptureEmailSender) Messages() []*EmailMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]*EmailMessage, len(s.messages))
+	copy(messages, s.messages)
+	return messages
+}
+
+// writeEmail записывает письмо в формате RFC 5322
+func writeEmail(path string, m *gomail.Message) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create email capture file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := m.WriteTo(f); err != nil {
+		return fmt.Errorf("failed to write captured email: %w", err)
+	}
+	return nil
+}
+
+// buildEmail собирает MIME письмо, подставляя адреса по умолчанию
+func buildEmail(email *EmailMessage, defaultFrom, defaultReplyTo string) *gomail.Message {
+	from := email.From
+	if from == "" {
+		from = defaultFrom
+	}
+	replyTo := email.ReplyTo
+	if replyTo == "" {
+		replyTo = defaultReplyTo
+	}
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", from)
+	m.SetHeader("To", email.To)
+	m.SetHeader("Subject", email.Subject)
+	if replyTo != "" {
+		m.SetHeader("Reply-To", replyTo)
+	}
+	if email.ID != "" {
+		m.SetHeader(NotificationIDHeader, email.ID)
+	}
+	for name, value := range email.Headers {
+		m.SetHeader(name, value)
+	}
+
+	switch {
+	case email.Text != "" && email.HTML != "":
+		m.SetBody("text/plain", email.Text)
+		m.AddAlternative("text/html", email.HTML)
+	case email.HTML != "":
+		m.SetBody("text/html", email.HTML)
+	default:
+		m.SetBody("text/plain", email.Text)
+	}
+
+	for _, attachment := range email.Attachments {
+		data := attachment.Data
+		m.Attach(attachment.Filename,
+			gomail.SetHeader(map[string][]string{"Content-Type": {attachment.ContentType}}),
+			gomail.SetCopyFunc(func(w io.Writer) error {
+				_, err := w.Write(data)
+				return err
+			}),
+		)
+	}
+
+	return m
+}
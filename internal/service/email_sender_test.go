@@ -0,0 +1,270 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/gomail.v2"
+)
+
+// fakeSMTPConn запоминает отправленные письма и закрытие соединения
+type fakeSMTPConn struct {
+	mu      sync.Mutex
+	sendErr error
+	sent    int
+	closed  bool
+}
+
+func (c *fakeSMTPConn) Send(from string, to []string, msg io.WriterTo) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sendErr != nil {
+		return c.sendErr
+	}
+	c.sent++
+	return nil
+}
+
+func (c *fakeSMTPConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *fakeSMTPConn) state() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sent, c.closed
+}
+
+func TestSMTPEmailSenderPool(t *testing.T) {
+	tests := []struct {
+		name      string
+		idle      *fakeSMTPConn
+		idleAge   time.Duration
+		wantErr   bool
+		wantDials int
+		wantIdle  int
+	}{
+		{
+			name:     "idle connection is reused",
+			idle:     &fakeSMTPConn{},
+			wantIdle: 1,
+		},
+		{
+			name:      "connection closed by the server is replaced and the email resent",
+			idle:      &fakeSMTPConn{sendErr: io.EOF},
+			wantDials: 1,
+			wantIdle:  1,
+		},
+		{
+			name:      "expired idle connection is replaced before sending",
+			idle:      &fakeSMTPConn{},
+			idleAge:   2 * time.Minute,
+			wantDials: 1,
+			wantIdle:  1,
+		},
+		{
+			name:    "smtp reply is not retried",
+			idle:    &fakeSMTPConn{sendErr: &textproto.Error{Code: 550, Msg: "mailbox unavailable"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSMTPEmailSender(SMTPConfig{From: "shop@example.com", IdleTimeout: time.Minute})
+			fresh := &fakeSMTPConn{}
+			dials := 0
+			s.connect = func() (gomail.SendCloser, error) {
+				dials++
+				return fresh, nil
+			}
+			s.idle <- &smtpConn{sender: tt.idle, lastUsed: time.Now().Add(-tt.idleAge)}
+
+			err := s.Send(context.Background(), &EmailMessage{ID: "n1", To: "user@example.com", Subject: "Hi", Text: "Hello"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Send() error = %v, want error %v", err, tt.wantErr)
+			}
+			if dials != tt.wantDials {
+				t.Errorf("dials = %d, want %d", dials, tt.wantDials)
+			}
+			if len(s.idle) != tt.wantIdle {
+				t.Errorf("idle connections = %d, want %d", len(s.idle), tt.wantIdle)
+			}
+
+			idleSent, idleClosed := tt.idle.state()
+			freshSent, _ := fresh.state()
+			if tt.wantDials > 0 {
+				if !idleClosed || freshSent != 1 {
+					t.Errorf("stale connection closed %v, new connection sent %d, want closed and 1", idleClosed, freshSent)
+				}
+			} else if !tt.wantErr && idleSent != 1 {
+				t.Errorf("idle connection sent %d, want 1", idleSent)
+			}
+			if tt.wantErr && !idleClosed {
+				t.Error("connection must be closed after an SMTP error")
+			}
+		})
+	}
+}
+
+func TestSMTPEmailSenderDialTimeout(t *testing.T) {
+	s := NewSMTPEmailSender(SMTPConfig{From: "shop@example.com", PoolSize: 1, DialTimeout: 20 * time.Millisecond})
+	late := &fakeSMTPConn{}
+	unblock := make(chan struct{})
+	s.connect = func() (gomail.SendCloser, error) {
+		<-unblock
+		return late, nil
+	}
+
+	email := &EmailMessage{ID: "n1", To: "user@example.com", Subject: "Hi", Text: "Hello"}
+	err := s.Send(context.Background(), email)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Send() error = %v, want context.DeadlineExceeded", err)
+	}
+	// Зависший сервер не занимает слот пула
+	if len(s.slots) != 0 {
+		t.Errorf("pool slots in use = %d, want 0", len(s.slots))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Send(ctx, email); !errors.Is(err, context.Canceled) {
+		t.Errorf("Send() with canceled context error = %v, want context.Canceled", err)
+	}
+
+	// Соединение, открытое после таймаута, закрывается
+	close(unblock)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, closed := late.state(); closed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connection opened after the timeout was not closed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCaptureEmailSenderBuildsMultipartEmail(t *testing.T) {
+	dir := t.TempDir()
+	sender, err := NewCaptureEmailSender(dir, "GoPayment <noreply@example.com>")
+	if err != nil {
+		t.Fatalf("NewCaptureEmailSender() error = %v", err)
+	}
+
+	pdf := []byte("%PDF-1.4 receipt")
+	err = sender.Send(context.Background(), &EmailMessage{
+		ID:      "n1",
+		To:      "user@example.com",
+		ReplyTo: "support@example.com",
+		Subject: "Your receipt",
+		Text:    "Thank you",
+		HTML:    "<p>Thank you</p>",
+		Attachments: []EmailAttachment{
+			{Filename: "receipt.pdf", ContentType: "application/pdf", Data: pdf},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	messages := sender.Messages()
+	if len(messages) != 1 || messages[0].From != "GoPayment <noreply@example.com>" {
+		t.Fatalf("Messages() = %+v, want one email from the default sender", messages)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*-n1.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("captured files = %v, %v", files, err)
+	}
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	if msg.Header.Get(NotificationIDHeader) != "n1" || msg.Header.Get("Reply-To") != "support@example.com" {
+		t.Errorf("headers = %v", msg.Header)
+	}
+
+	// multipart/mixed: текст и HTML как alternative, затем PDF вложение
+	parts := readParts(t, msg.Header.Get("Content-Type"), msg.Body, "multipart/mixed")
+	if len(parts) != 2 {
+		t.Fatalf("multipart/mixed has %d parts, want 2", len(parts))
+	}
+
+	alternatives := readParts(t, parts[0].header.Get("Content-Type"), bytes.NewReader(parts[0].body), "multipart/alternative")
+	if len(alternatives) != 2 {
+		t.Fatalf("multipart/alternative has %d parts, want 2", len(alternatives))
+	}
+	for i, want := range []struct{ mediaType, body string }{{"text/plain", "Thank you"}, {"text/html", "<p>Thank you</p>"}} {
+		mediaType, _, _ := mime.ParseMediaType(alternatives[i].header.Get("Content-Type"))
+		if mediaType != want.mediaType || string(alternatives[i].body) != want.body {
+			t.Errorf("alternative %d = %s %q, want %s %q", i, mediaType, alternatives[i].body, want.mediaType, want.body)
+		}
+	}
+
+	attachment := parts[1]
+	if ct := attachment.header.Get("Content-Type"); ct != "application/pdf" {
+		t.Errorf("attachment Content-Type = %q, want application/pdf", ct)
+	}
+	disposition, params, _ := mime.ParseMediaType(attachment.header.Get("Content-Disposition"))
+	if disposition != "attachment" || params["filename"] != "receipt.pdf" {
+		t.Errorf("attachment Content-Disposition = %q", attachment.header.Get("Content-Disposition"))
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(attachment.body), "\r\n", ""))
+	if err != nil || !bytes.Equal(data, pdf) {
+		t.Errorf("attachment data = %q, %v, want %q", data, err, pdf)
+	}
+}
+
+// mimePart содержит заголовки и тело части письма
+type mimePart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// readParts читает части multipart тела с типом mediaType
+func readParts(t *testing.T, contentType string, body io.Reader, mediaType string) []mimePart {
+	t.Helper()
+	got, params, err := mime.ParseMediaType(contentType)
+	if err != nil || got != mediaType {
+		t.Fatalf("Content-Type = %q, want %s", contentType, mediaType)
+	}
+
+	var parts []mimePart
+	reader := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		if err != nil {
+			t.Fatalf("NextPart() error = %v", err)
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatalf("ReadAll() error = %v", err)
+		}
+		parts = append(parts, mimePart{header: part.Header, body: data})
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_payment/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Имена системных шаблонов, которые использует AsyncService
+const (
+	TemplatePaymentReceived      = "payment_received"
+	TemplatePaymentStatusChanged = "payment_status_changed"
+)
+
+// defaultTemplates содержит системные шаблоны, создаваемые при первом
+// запуске. Измененные через API шаблоны не перезаписываются.
+var defaultTemplates = []models.NotificationTemplate{
+	{
+		Name:          TemplatePaymentReceived,
+		Locale:        "en",
+		Type:          models.NotificationTypeEmail,
+		Transactional: true,
+		Subject:       "Payment Received - Order {{.order_id}}",
+		Content:       `<p>We have received your payment of {{money .amount .currency}} for order {{.order_id}} on {{date .created_at}}.</p>`,
+		TextContent:   `We have received your payment of {{money .amount .currency}} for order {{.order_id}} on {{date .created_at}}.`,
+		Variables: map[string]string{
+			"order_id":   models.TemplateVariableRequired,
+			"amount":     models.TemplateVariableRequired,
+			"currency":   models.TemplateVariableRequired,
+			"created_at": models.TemplateVariableRequired,
+		},
+	},
+	{
+		Name:          TemplatePaymentReceived,
+		Locale:        "ru",
+		Type:          models.NotificationTypeEmail,
+		Transactional: true,
+		Subject:       "Платеж получен - заказ {{.order_id}}",
+		Content:       `<p>Мы получили ваш платеж на сумму {{money .amount .currency}} по заказу {{.order_id}} от {{date .created_at}}.</p>`,
+		TextContent:   `Мы получили ваш платеж на сумму {{money .amount .currency}} по заказу {{.order_id}} от {{date .created_at}}.`,
+		Variables: map[string]string{
+			"order_id":   models.TemplateVariableRequired,
+			"amount":     models.TemplateVariableRequired,
+			"currency":   models.TemplateVariableRequired,
+			"created_at": models.TemplateVariableRequired,
+		},
+	},
+	{
+		Name:        TemplatePaymentStatusChanged,
+		Locale:      "en",
+		Type:        models.NotificationTypeEmail,
+		Subject:     "Payment Status Updated - Order {{.order_id}}",
+		Content:     `<p>The status of your payment of {{money .amount .currency}} for order {{.order_id}} has been updated to {{.status}} on {{datetime .updated_at}}.</p>`,
+		TextContent: `The status of your payment of {{money .amount .currency}} for order {{.order_id}} has been updated to {{.status}} on {{datetime .updated_at}}.`,
+		Variables: map[string]string{
+			"order_id":   models.TemplateVariableRequired,
+			"amount":     models.TemplateVariableRequired,
+			"currency":   models.TemplateVariableRequired,
+			"status":     models.TemplateVariableRequired,
+			"updated_at": models.TemplateVariableRequired,
+		},
+	},
+	{
+		Name:    TemplatePaymentStatusChanged,
+		Locale:  "ru",
+		Type:    models.NotificationTypeEmail,
+		Subject: "Статус платежа изменен - заказ {{.order_id}}",
+		Content: `<p>Статус вашего платежа на сумму {{money .amount .currency}} по заказу {{.order_id}} изменен на «` +
+			`{{if eq .status "completed"}}завершен` +
+			`{{else if eq .status "failed"}}ошибка` +
+			`{{else if eq .status "cancelled"}}отменен` +
+			`{{else if eq .status "refunded"}}возвращен` +
+			`{{else if eq .status "partially_refunded"}}частично возвращен` +
+			`{{else}}{{.status}}{{end}}» {{datetime .updated_at}}.</p>`,
+		Variables: map[string]string{
+			"order_id":   models.TemplateVariableRequired,
+			"amount":     models.TemplateVariableRequired,
+			"currency":   models.TemplateVariableRequired,
+			"status":     models.TemplateVariableRequired,
+			"updated_at": models.TemplateVariableRequired,
+		},
+	},
+	{
+		Name:    TemplateNotificationDigest,
+		Locale:  "en",
+		Type:    models.NotificationTypeEmail,
+		Subject: "Payment summary: {{.count}} notifications",
+		Content: `<p>{{.count}} payment notifications from {{datetime .period_start}} to {{datetime .period_end}}.</p>` +
+			`{{if .totals}}<h3>Received</h3><ul>{{range .totals}}<li>{{.Count}} payment(s): {{money .Amount .Currency}}</li>{{end}}</ul>{{end}}` +
+			`{{if .payments}}<h3>Payments</h3><ul>{{range .payments}}<li>{{.OrderID}}: {{money .Amount .Currency}}, {{datetime .At}}</li>{{end}}</ul>{{end}}` +
+			`{{if .refunds}}<h3>Refunds</h3><ul>{{range .refunds}}<li>{{.OrderID}}: {{money .Amount .Currency}}, {{.Status}}, {{datetime .At}}</li>{{end}}</ul>{{end}}` +
+			`{{if .failures}}<h3>Failed payments</h3><ul>{{range .failures}}<li>{{.OrderID}}: {{money .Amount .Currency}}, {{datetime .At}}</li>{{end}}</ul>{{end}}` +
+			`{{if .updates}}<h3>Other updates</h3><ul>{{range .updates}}<li>{{.OrderID}}: {{.Status}}, {{datetime .At}}</li>{{end}}</ul>{{end}}`,
+		TextContent: `{{.count}} payment notifications from {{datetime .period_start}} to {{datetime .period_end}}.
+{{range .totals}}
+Received {{.Count}} payment(s): {{money .Amount .Currency}}{{end}}
+{{range .payments}}
+Payment {{.OrderID}}: {{money .Amount .Currency}}, {{datetime .At}}{{end}}{{range .refunds}}
+Refund {{.OrderID}}: {{money .Amount .Currency}}, {{.Status}}, {{datetime .At}}{{end}}{{range .failures}}
+Failed {{.OrderID}}: {{money .Amount .Currency}}, {{datetime .At}}{{end}}{{range .updates}}
+Update {{.OrderID}}: {{.Status}}, {{datetime .At}}{{end}}
+`,
+		Variables: digestTemplateVariables,
+	},
+	{
+		Name:    TemplateNotificationDigest,
+		Locale:  "ru",
+		Type:    models.NotificationTypeEmail,
+		Subject: "Сводка по платежам: уведомлений {{.count}}",
+		Content: `<p>Уведомлений о платежах: {{.count}} за период с {{datetime .period_start}} по {{datetime .period_end}}.</p>` +
+			`{{if .totals}}<h3>Получено</h3><ul>{{range .totals}}<li>Платежей: {{.Count}}, сумма {{money .Amount .Currency}}</li>{{end}}</ul>{{end}}` +
+			`{{if .payments}}<h3>Платежи</h3><ul>{{range .payments}}<li>{{.OrderID}}: {{money .Amount .Currency}}, {{datetime .At}}</li>{{end}}</ul>{{end}}` +
+			`{{if .refunds}}<h3>Возвраты</h3><ul>{{range .refunds}}<li>{{.OrderID}}: {{money .Amount .Currency}}, {{datetime .At}}</li>{{end}}</ul>{{end}}` +
+			`{{if .failures}}<h3>Неуспешные платежи</h3><ul>{{range .failures}}<li>{{.OrderID}}: {{money .Amount .Currency}}, {{datetime .At}}</li>{{end}}</ul>{{end}}` +
+			`{{if .updates}}<h3>Другие изменения</h3><ul>{{range .updates}}<li>{{.OrderID}}: {{.Status}}, {{datetime .At}}</li>{{end}}</ul>{{end}}`,
+		TextContent: `Уведомлений о платежах: {{.count}} за период с {{datetime .period_start}} по {{datetime .period_end}}.
+{{range .totals}}
+Получено платежей: {{.Count}}, сумма {{money .Amount .Currency}}{{end}}
+{{range .payments}}
+Платеж {{.OrderID}}: {{money .Amount .Currency}}, {{datetime .At}}{{end}}{{range .refunds}}
+Возврат {{.OrderID}}: {{money .Amount .Currency}}, {{datetime .At}}{{end}}{{range .failures}}
+Неуспешный платеж {{.OrderID}}: {{money .Amount .Currency}}, {{datetime .At}}{{end}}{{range .updates}}
+Изменение {{.OrderID}}: {{.Status}}, {{datetime .At}}{{end}}
+`,
+		Variables: digestTemplateVariables,
+	},
+}
+
+// digestTemplateVariables описывает данные, которые формирует digestData
+var digestTemplateVariables = map[string]string{
+	"count":        models.TemplateVariableRequired,
+	"period_start": models.TemplateVariableRequired,
+	"period_end":   models.TemplateVariableRequired,
+	"payments":     models.TemplateVariableOptional,
+	"refunds":      models.TemplateVariableOptional,
+	"failures":     models.TemplateVariableOptional,
+	"updates":      models.TemplateVariableOptional,
+	"totals":       models.TemplateVariableOptional,
+}
+
+// EnsureDefaultTemplates создает отсутствующие системные шаблоны
+func (s *NotificationService) EnsureDefaultTemplates(ctx context.Context) error {
+	for i := range defaultTemplates {
+		def := defaultTemplates[i]
+
+		var existing models.NotificationTemplate
+		err := s.db.WithContext(ctx).
+			Where("name = ? AND locale = ?", def.Name, def.Locale).
+			First(&existing).Error
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to check default template %s/%s: %w", def.Name, def.Locale, err)
+		}
+
+		if err := s.CreateTemplate(ctx, &def); err != nil {
+			return fmt.Errorf("failed to create default template %s/%s: %w", def.Name, def.Locale, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go_payment/internal/models"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// TemplateNotificationDigest — системный шаблон сводки уведомлений
+	TemplateNotificationDigest = "notification_digest"
+
+	defaultDigestTime = "09:00"
+	digestBatchSize   = 1000
+
+	// digestExemptKey помечает в метаданных уведомление, которое не удалось
+	// включить в сводку. Такое уведомление отправляется отдельно.
+	digestExemptKey = "digest_exempt"
+)
+
+// defaultDigestTemplates попадают в сводку, если правило не задает шаблоны
+var defaultDigestTemplates = []string{TemplatePaymentReceived, TemplatePaymentStatusChanged}
+
+// DigestEntry представляет одно уведомление в сводке
+type DigestEntry struct {
+	OrderID  string
+	Amount   float64
+	Currency string
+	Status   string
+	At       time.Time
+}
+
+// DigestTotal содержит сумму платежей сводки в одной валюте
+type DigestTotal struct {
+	Currency string
+	Amount   float64
+	Count    int
+}
+
+// batchForDigest откладывает уведомление до ближайшей сводки, если оно
+// подпадает под правило пользователя. Возвращает false, если уведомление
+// нужно отправить отдельно.
+func (s *NotificationService) batchForDigest(ctx context.Context, msg *models.NotificationMessage, userID string, digest *models.NotificationDigest) (bool, error) {
+	if digest == nil || !digestIncludes(digest, msg.Template) || msg.Metadata[digestExemptKey] == "true" {
+		return false, nil
+	}
+
+	until, err := digestWindowEnd(digest, time.Now())
+	if err != nil {
+		// Некорректное правило не должно блокировать уведомления
+		log.Printf("Ignoring digest rule of user %s: %v", userID, err)
+		return false, nil
+	}
+
+	log.Printf("Batching notification %s for user %s into digest at %s", msg.ID, userID, until.Format(time.RFC3339))
+	msg.Status = models.NotificationStatusBatched
+	msg.ScheduledAt = &until
+	msg.UpdatedAt = time.Now()
+	// Даты сводки выводятся в часовом поясе правила пользователя
+	if digest.TimeZone != "" {
+		if msg.Metadata == nil {
+			msg.Metadata = make(map[string]string)
+		}
+		msg.Metadata[TemplateTimezoneKey] = digest.TimeZone
+	}
+	return true, s.saveNotification(ctx, msg)
+}
+
+// publishDigests собирает накопленные уведомления, период сводки которых
+// истек, в одно сообщение на получателя. Сводка сохраняется отложенной на
+// текущий момент и публикуется планировщиком вместе с остальными.
+func (s *NotificationService) publishDigests(ctx context.Context) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var due []models.NotificationMessage
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND scheduled_at <= ?", models.NotificationStatusBatched, time.Now()).
+			Order("type, recipient, created_at").
+			Limit(digestBatchSize).
+			Find(&due).Error
+		if err != nil {
+			return fmt.Errorf("failed to load batched notifications: %w", err)
+		}
+
+		for _, group := range groupDigest(due) {
+			if err := s.createDigest(ctx, tx, group); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// createDigest сохраняет сводку группы уведомлений и связывает их с ней.
+// Если сводку не удалось сформировать, уведомления отправляются по одному.
+func (s *NotificationService) createDigest(ctx context.Context, tx *gorm.DB, group []models.NotificationMessage) error {
+	first := group[0]
+	ids := make([]string, len(group))
+	for i := range group {
+		ids[i] = group[i].ID
+	}
+	now := time.Now()
+
+	digest, err := s.CreateNotification(ctx, TemplateNotificationDigest, first.Recipient, first.Metadata["locale"], digestData(group))
+	if err == nil && digest.Type != first.Type {
+		err = fmt.Errorf("digest template type %s does not match channel %s", digest.Type, first.Type)
+	}
+	if err != nil {
+		log.Printf("Failed to render digest for %s, sending %d notifications separately: %v", first.Recipient, len(group), err)
+		return exemptFromDigest(tx, group, now)
+	}
+
+	digest.UserID = first.UserID
+	digest.Status = models.NotificationStatusScheduled
+	digest.ScheduledAt = &now
+	digest.Metadata["digest_size"] = fmt.Sprint(len(group))
+	if err := tx.Create(digest).Error; err != nil {
+		return fmt.Errorf("failed to save digest for %s: %w", first.Recipient, err)
+	}
+
+	err = tx.Model(&models.NotificationMessage{}).
+		Where("id IN ?", ids).
+		Updates(map[string]interface{}{
+			"status":     models.NotificationStatusDigested,
+			"digest_id":  digest.ID,
+			"updated_at": now,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to link notifications to digest %s: %w", digest.ID, err)
+	}
+
+	log.Printf("Created digest %s of %d notifications for %s", digest.ID, len(group), first.Recipient)
+	return nil
+}
+
+// exemptFromDigest передает уведомления планировщику для отдельной отправки.
+// Метка digestExemptKey не дает batchForDigest снова отложить их в сводку,
+// которую не удается сформировать.
+func exemptFromDigest(tx *gorm.DB, group []models.NotificationMessage, now time.Time) error {
+	for i := range group {
+		msg := &group[i]
+		if msg.Metadata == nil {
+			msg.Metadata = make(map[string]string)
+		}
+		msg.Metadata[digestExemptKey] = "true"
+		msg.Status = models.NotificationStatusScheduled
+		msg.UpdatedAt = now
+
+		err := tx.Model(msg).Select("status", "metadata", "updated_at").Updates(msg).Error
+		if err != nil {
+			return fmt.Errorf("failed to reschedule notification %s: %w", msg.ID, err)
+		}
+	}
+	return nil
+}
+
+// groupDigest группирует уведомления по каналу и получателю. Уведомления
+// должны быть отсортированы по этим полям.
+func groupDigest(messages []models.NotificationMessage) [][]models.NotificationMessage {
+	var groups [][]models.NotificationMessage
+	for i := 0; i < len(messages); {
+		j := i + 1
+		for j < len(messages) && messages[j].Type == messages[i].Type && messages[j].Recipient == messages[i].Recipient {
+			j++
+		}
+		groups = append(groups, messages[i:j])
+		i = j
+	}
+	return groups
+}
+
+// digestData формирует данные шаблона сводки: платежи, возвраты, ошибки и
+// прочие изменения статуса, а также итоги платежей по валютам
+func digestData(group []models.NotificationMessage) map[string]interface{} {
+	var payments, refunds, failures, updates []DigestEntry
+	totals := make(map[string]*DigestTotal)
+
+	periodStart, periodEnd := group[0].CreatedAt, time.Now()
+	if group[0].ScheduledAt != nil {
+		periodEnd = *group[0].ScheduledAt
+	}
+	for _, msg := range group {
+		if msg.CreatedAt.Before(periodStart) {
+			periodStart = msg.CreatedAt
+		}
+
+		entry := digestEntry(msg)
+		switch {
+		case msg.Template == TemplatePaymentReceived:
+			payments = append(payments, entry)
+			total, ok := totals[entry.Currency]
+			if !ok {
+				total = &DigestTotal{Currency: entry.Currency}
+				totals[entry.Currency] = total
+			}
+			total.Amount = roundAmount(total.Amount+entry.Amount, entry.Currency)
+			total.Count++
+		case entry.Status == string(models.PaymentStatusRefunded),
+			entry.Status == string(models.PaymentStatusPartiallyRefunded):
+			refunds = append(refunds, entry)
+		case entry.Status == string(models.PaymentStatusFailed):
+			failures = append(failures, entry)
+		default:
+			updates = append(updates, entry)
+		}
+	}
+
+	currencyTotals := make([]DigestTotal, 0, len(totals))
+	for _, total := range totals {
+		currencyTotals = append(currencyTotals, *total)
+	}
+	sort.Slice(currencyTotals, func(i, j int) bool {
+		return currencyTotals[i].Currency < currencyTotals[j].Currency
+	})
+
+	return map[string]interface{}{
+		TemplateTimezoneKey: group[0].Metadata[TemplateTimezoneKey],
+		"count":             len(group),
+		"period_start":      periodStart,
+		"period_end":        periodEnd,
+		"payments":          payments,
+		"refunds":           refunds,
+		"failures":          failures,
+		"updates":           updates,
+		"totals":            currencyTotals,
+	}
+}
+
+// digestEntry извлекает данные платежа из уведомления. Данные хранятся в
+// JSON, поэтому время восстанавливается из строки RFC 3339.
+func digestEntry(msg models.NotificationMessage) DigestEntry {
+	entry := DigestEntry{At: msg.CreatedAt}
+	entry.OrderID, _ = msg.Data["order_id"].(string)
+	entry.Currency, _ = msg.Data["currency"].(string)
+	entry.Status, _ = msg.Data["status"].(string)
+	if amount, ok := metadataNumber(msg.Data["amount"], 0); ok {
+		entry.Amount = amount
+	}
+
+	for _, key := range []string{"updated_at", "created_at"} {
+		if value, ok := msg.Data[key].(string); ok {
+			if at, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				entry.At = at
+				break
+			}
+		}
+	}
+
+	return entry
+}
+
+// digestIncludes проверяет, попадает ли шаблон уведомления в сводку
+func digestIncludes(digest *models.NotificationDigest, template string) bool {
+	if template == "" || template == TemplateNotificationDigest {
+		return false
+	}
+
+	templates := digest.Templates
+	if len(templates) == 0 {
+		templates = defaultDigestTemplates
+	}
+	for _, t := range templates {
+		if t == template {
+			return true
+		}
+	}
+	return false
+}
+
+// digestWindowEnd возвращает время ближайшей сводки: начало следующего часа
+// или ближайшее наступление Time по местному времени
+func digestWindowEnd(digest *models.NotificationDigest, now time.Time) (time.Time, error) {
+	loc, err := digestLocation(digest)
+	if err != nil {
+		return time.Time{}, err
+	}
+	local := now.In(loc)
+
+	switch digest.Frequency {
+	case models.DigestFrequencyHourly:
+		return time.Date(local.Year(), local.Month(), local.Day(), local.Hour()+1, 0, 0, 0, loc), nil
+	case models.DigestFrequencyDaily:
+		value := digest.Time
+		if value == "" {
+			value = defaultDigestTime
+		}
+		at, err := parseClock(value)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		next := time.Date(local.Year(), local.Month(), local.Day(), 0, at, 0, 0, loc)
+		if !next.After(local) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next, nil
+	default:
+		return time.Time{}, fmt.Errorf("%w: unknown digest frequency %q", ErrInvalidPreferences, digest.Frequency)
+	}
+}
+
+// digestLocation возвращает часовой пояс сводки, по умолчанию UTC
+func digestLocation(digest *models.NotificationDigest) (*time.Location, error) {
+	if digest.TimeZone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(digest.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown timezone %q", ErrInvalidPreferences, digest.TimeZone)
+	}
+	return loc, nil
+}
+
+// validateDigest проверяет правило сводки
+func validateDigest(digest *models.NotificationDigest) error {
+	if _, err := digestWindowEnd(digest, time.Now()); err != nil {
+		return err
+	}
+	for _, template := range digest.Templates {
+		if template == "" || template == TemplateNotificationDigest {
+			return fmt.Errorf("%w: invalid digest template %q", ErrInvalidPreferences, template)
+		}
+	}
+	return nil
+}
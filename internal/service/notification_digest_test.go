@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+	"go_payment/internal/models"
+	"testing"
+)
+
+func TestBatchForDigestSkipsExemptNotifications(t *testing.T) {
+	s := &NotificationService{}
+	digest := &models.NotificationDigest{Frequency: models.DigestFrequencyDaily}
+	msg := &models.NotificationMessage{
+		ID:       "n1",
+		Template: TemplatePaymentReceived,
+		Status:   models.NotificationStatusScheduled,
+		Metadata: map[string]string{digestExemptKey: "true"},
+	}
+
+	batched, err := s.batchForDigest(context.Background(), msg, "u1", digest)
+	if err != nil || batched {
+		t.Fatalf("batchForDigest() = %v, %v, want false for exempt notification", batched, err)
+	}
+	if msg.Status != models.NotificationStatusScheduled {
+		t.Errorf("status = %s, exempt notification must not be batched", msg.Status)
+	}
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_payment/internal/models"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidPreferences возвращается для некорректных настроек уведомлений
+var ErrInvalidPreferences = errors.New("invalid notification preferences")
+
+// defaultChannels используются, пока пользователь не сохранил свои настройки:
+// до явного отказа пользователь получает уведомления по всем каналам
+var defaultChannels = []models.NotificationType{
+	models.NotificationTypeEmail,
+	models.NotificationTypeSMS,
+	models.NotificationTypePush,
+	models.NotificationTypeWebhook,
+}
+
+// GetUserPreferences получает настройки уведомлений пользователя. Если
+// настройки не сохранены, возвращаются настройки по умолчанию.
+func (s *NotificationService) GetUserPreferences(ctx context.Context, userID string) (*models.NotificationPreferences, error) {
+	var prefs models.NotificationPreferences
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&prefs).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.NotificationPreferences{
+			UserID:    userID,
+			Channels:  defaultChannels,
+			Enabled:   true,
+			UpdatedAt: time.Now(),
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	return &prefs, nil
+}
+
+// UpdateUserPreferences проверяет и сохраняет настройки уведомлений пользователя
+func (s *NotificationService) UpdateUserPreferences(ctx context.Context, prefs *models.NotificationPreferences) error {
+	if err := validatePreferences(prefs); err != nil {
+		return err
+	}
+
+	prefs.UpdatedAt = time.Now()
+	if err := s.db.WithContext(ctx).Save(prefs).Error; err != nil {
+		return fmt.Errorf("failed to save notification preferences: %w", err)
+	}
+	return nil
+}
+
+// applyPreferences проверяет настройки пользователя перед отправкой.
+// Возвращает false, если уведомление не нужно отправлять сейчас: канал
+// отключен пользователем, сообщение ожидает сводки или отложено до конца
+// тихих часов.
+func (s *NotificationService) applyPreferences(ctx context.Context, msg *models.NotificationMessage) (bool, error) {
+	userID := s.notificationUserID(ctx, msg)
+	if userID == "" {
+		return true, nil
+	}
+
+	prefs, err := s.GetUserPreferences(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	if skipReason := optOutReason(prefs, msg.Type); skipReason != "" {
+		log.Printf("Skipping notification %s: user %s %s", msg.ID, userID, skipReason)
+		if msg.Metadata == nil {
+			msg.Metadata = make(map[string]string)
+		}
+		msg.Metadata["skip_reason"] = skipReason
+		msg.Status = models.NotificationStatusSkipped
+		msg.UpdatedAt = time.Now()
+		return false, s.saveNotification(ctx, msg)
+	}
+
+	// Уведомления по правилу сводки отправляются одним сообщением за период
+	batched, err := s.batchForDigest(ctx, msg, userID, prefs.Digest)
+	if err != nil || batched {
+		return false, err
+	}
+
+	until, quiet, err := deliveryDelay(prefs, msg, time.Now())
+	if err != nil {
+		// Некорректное расписание не должно блокировать уведомления
+		log.Printf("Ignoring quiet hours of user %s: %v", userID, err)
+		return true, nil
+	}
+	if !quiet {
+		return true, nil
+	}
+
+	log.Printf("Deferring notification %s for user %s until %s (quiet hours)", msg.ID, userID, until.Format(time.RFC3339))
+	msg.Status = models.NotificationStatusScheduled
+	msg.ScheduledAt = &until
+	msg.UpdatedAt = time.Now()
+	return false, s.saveNotification(ctx, msg)
+}
+
+// optOutReason возвращает причину пропуска уведомления канала channel или
+// пустую строку, если пользователь его не отключал
+func optOutReason(prefs *models.NotificationPreferences, channel models.NotificationType) string {
+	switch {
+	case !prefs.Enabled:
+		return "notifications_disabled"
+	case !hasChannel(prefs.Channels, channel):
+		return "channel_opt_out"
+	}
+	return ""
+}
+
+// deliveryDelay возвращает окончание тихих часов, до которого откладывается
+// уведомление. Транзакционные уведомления отправляются без задержки.
+func deliveryDelay(prefs *models.NotificationPreferences, msg *models.NotificationMessage, now time.Time) (time.Time, bool, error) {
+	if msg.Transactional || prefs.Schedule == nil {
+		return time.Time{}, false, nil
+	}
+	return quietHoursEnd(prefs.Schedule, now)
+}
+
+// notificationUserID определяет пользователя, которому адресовано уведомление
+func (s *NotificationService) notificationUserID(ctx context.Context, msg *models.NotificationMessage) string {
+	if msg.UserID != "" {
+		return msg.UserID
+	}
+
+	switch msg.Type {
+	case models.NotificationTypePush:
+		// Получателем push-уведомления является пользователь
+		return msg.Recipient
+	case models.NotificationTypeEmail:
+		var user models.User
+		err := s.db.WithContext(ctx).Select("id").Where("email = ?", msg.Recipient).First(&user).Error
+		if err == nil {
+			return strconv.FormatUint(uint64(user.ID), 10)
+		}
+	}
+
+	return ""
+}
+
+// quietHoursEnd проверяет, попадает ли момент now в тихие часы расписания,
+// и возвращает время их окончания
+func quietHoursEnd(schedule *models.NotificationSchedule, now time.Time) (time.Time, bool, error) {
+	loc, start, end, err := parseSchedule(schedule)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if start == end {
+		return time.Time{}, false, nil
+	}
+
+	local := now.In(loc)
+
+	// Тихие часы, начавшиеся вчера, могут продолжаться сегодня
+	for offset := -1; offset <= 0; offset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, loc)
+		if !scheduleIncludesDay(schedule.Days, day.Weekday()) {
+			continue
+		}
+
+		periodStart := time.Date(day.Year(), day.Month(), day.Day(), 0, start, 0, 0, loc)
+		periodEnd := time.Date(day.Year(), day.Month(), day.Day(), 0, end, 0, 0, loc)
+		if end < start {
+			periodEnd = periodEnd.AddDate(0, 0, 1)
+		}
+
+		if !local.Before(periodStart) && local.Before(periodEnd) {
+			return periodEnd, true, nil
+		}
+	}
+
+	return time.Time{}, false, nil
+}
+
+// validatePreferences проверяет каналы, правило сводки и расписание тихих часов
+func validatePreferences(prefs *models.NotificationPreferences) error {
+	for _, channel := range prefs.Channels {
+		switch channel {
+		case models.NotificationTypeEmail, models.NotificationTypeSMS,
+			models.NotificationTypePush, models.NotificationTypeWebhook:
+		default:
+			return fmt.Errorf("%w: unknown channel %q", ErrInvalidPreferences, channel)
+		}
+	}
+
+	if prefs.Digest != nil {
+		if err := validateDigest(prefs.Digest); err != nil {
+			return err
+		}
+	}
+
+	if prefs.Schedule == nil {
+		return nil
+	}
+	if _, _, _, err := parseSchedule(prefs.Schedule); err != nil {
+		return err
+	}
+	for _, day := range prefs.Schedule.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("%w: unknown day %q", ErrInvalidPreferences, day)
+		}
+	}
+	return nil
+}
+
+// parseSchedule разбирает часовой пояс и границы тихих часов в минутах от полуночи
+func parseSchedule(schedule *models.NotificationSchedule) (*time.Location, int, int, error) {
+	loc, err := time.LoadLocation(schedule.TimeZone)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("%w: unknown timezone %q", ErrInvalidPreferences, schedule.TimeZone)
+	}
+
+	start, err := parseClock(schedule.StartTime)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	end, err := parseClock(schedule.EndTime)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	return loc, start, end, nil
+}
+
+// parseClock преобразует время "HH:MM" в минуты от полуночи
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: time %q must be in HH:MM format", ErrInvalidPreferences, value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// scheduleIncludesDay проверяет, действуют ли тихие часы в указанный день
+func scheduleIncludesDay(days []string, day time.Weekday) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, d := range days {
+		if wd, ok := weekdays[strings.ToLower(d)]; ok && wd == day {
+			return true
+		}
+	}
+	return false
+}
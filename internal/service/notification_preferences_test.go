@@ -0,0 +1,206 @@
+package service
+
+import (
+	"errors"
+	"go_payment/internal/models"
+	"testing"
+	"time"
+)
+
+func TestQuietHoursEnd(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Skipf("time zone database is not available: %v", err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("time zone database is not available: %v", err)
+	}
+
+	overnight := &models.NotificationSchedule{TimeZone: "Europe/Moscow", StartTime: "22:00", EndTime: "07:00"}
+	mondayNights := &models.NotificationSchedule{TimeZone: "Europe/Moscow", StartTime: "22:00", EndTime: "07:00", Days: []string{"Monday"}}
+
+	// 15 января 2024 года — понедельник
+	tests := []struct {
+		name      string
+		schedule  *models.NotificationSchedule
+		now       time.Time
+		wantQuiet bool
+		wantUntil time.Time
+	}{
+		{
+			name:      "overnight window before midnight",
+			schedule:  overnight,
+			now:       time.Date(2024, 1, 15, 23, 30, 0, 0, moscow),
+			wantQuiet: true,
+			wantUntil: time.Date(2024, 1, 16, 7, 0, 0, 0, moscow),
+		},
+		{
+			name:      "overnight window after midnight",
+			schedule:  overnight,
+			now:       time.Date(2024, 1, 16, 6, 59, 0, 0, moscow),
+			wantQuiet: true,
+			wantUntil: time.Date(2024, 1, 16, 7, 0, 0, 0, moscow),
+		},
+		{
+			name:     "end of the window is not quiet",
+			schedule: overnight,
+			now:      time.Date(2024, 1, 16, 7, 0, 0, 0, moscow),
+		},
+		{
+			name:     "before the window",
+			schedule: overnight,
+			now:      time.Date(2024, 1, 15, 21, 59, 0, 0, moscow),
+		},
+		{
+			name:      "schedule zone is used instead of the time zone of now",
+			schedule:  overnight,
+			now:       time.Date(2024, 1, 15, 19, 30, 0, 0, time.UTC),
+			wantQuiet: true,
+			wantUntil: time.Date(2024, 1, 16, 7, 0, 0, 0, moscow),
+		},
+		{
+			name:      "window started on an included day continues the next day",
+			schedule:  mondayNights,
+			now:       time.Date(2024, 1, 16, 1, 0, 0, 0, moscow),
+			wantQuiet: true,
+			wantUntil: time.Date(2024, 1, 16, 7, 0, 0, 0, moscow),
+		},
+		{
+			name:     "day not included",
+			schedule: mondayNights,
+			now:      time.Date(2024, 1, 16, 23, 0, 0, 0, moscow),
+		},
+		{
+			name:     "local day differs from the utc day",
+			schedule: &models.NotificationSchedule{TimeZone: "Europe/Moscow", StartTime: "00:00", EndTime: "06:00", Days: []string{"tuesday"}},
+			// Понедельник в UTC, но уже вторник в Москве
+			now:       time.Date(2024, 1, 15, 22, 0, 0, 0, time.UTC),
+			wantQuiet: true,
+			wantUntil: time.Date(2024, 1, 16, 6, 0, 0, 0, moscow),
+		},
+		{
+			name:      "daytime window",
+			schedule:  &models.NotificationSchedule{TimeZone: "UTC", StartTime: "09:00", EndTime: "17:00"},
+			now:       time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC),
+			wantQuiet: true,
+			wantUntil: time.Date(2024, 1, 15, 17, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "equal bounds disable quiet hours",
+			schedule: &models.NotificationSchedule{TimeZone: "UTC", StartTime: "22:00", EndTime: "22:00"},
+			now:      time.Date(2024, 1, 15, 22, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "daylight saving time switch",
+			schedule: &models.NotificationSchedule{TimeZone: "America/New_York", StartTime: "22:00", EndTime: "07:00"},
+			// 10 марта 2024 года часы в Нью-Йорке переводятся на час вперед
+			now:       time.Date(2024, 3, 10, 1, 0, 0, 0, newYork),
+			wantQuiet: true,
+			wantUntil: time.Date(2024, 3, 10, 11, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, quiet, err := quietHoursEnd(tt.schedule, tt.now)
+			if err != nil {
+				t.Fatalf("quietHoursEnd() error = %v", err)
+			}
+			if quiet != tt.wantQuiet || !until.Equal(tt.wantUntil) {
+				t.Errorf("quietHoursEnd() = %v, %v, want %v, %v", until, quiet, tt.wantUntil, tt.wantQuiet)
+			}
+		})
+	}
+}
+
+func TestQuietHoursEndInvalidSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule *models.NotificationSchedule
+	}{
+		{name: "unknown zone", schedule: &models.NotificationSchedule{TimeZone: "Mars/Olympus", StartTime: "22:00", EndTime: "07:00"}},
+		{name: "bad clock", schedule: &models.NotificationSchedule{TimeZone: "UTC", StartTime: "10pm", EndTime: "07:00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := quietHoursEnd(tt.schedule, time.Now()); !errors.Is(err, ErrInvalidPreferences) {
+				t.Errorf("quietHoursEnd() error = %v, want ErrInvalidPreferences", err)
+			}
+		})
+	}
+}
+
+func TestDeliveryDelay(t *testing.T) {
+	schedule := &models.NotificationSchedule{TimeZone: "UTC", StartTime: "22:00", EndTime: "07:00"}
+	now := time.Date(2024, 1, 15, 23, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		prefs     *models.NotificationPreferences
+		msg       *models.NotificationMessage
+		wantQuiet bool
+	}{
+		{
+			name:      "quiet hours defer the notification",
+			prefs:     &models.NotificationPreferences{Enabled: true, Schedule: schedule},
+			msg:       &models.NotificationMessage{ID: "n1"},
+			wantQuiet: true,
+		},
+		{
+			name:  "transactional notification bypasses quiet hours",
+			prefs: &models.NotificationPreferences{Enabled: true, Schedule: schedule},
+			msg:   &models.NotificationMessage{ID: "n1", Transactional: true},
+		},
+		{
+			name:  "no schedule",
+			prefs: &models.NotificationPreferences{Enabled: true},
+			msg:   &models.NotificationMessage{ID: "n1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			until, quiet, err := deliveryDelay(tt.prefs, tt.msg, now)
+			if err != nil {
+				t.Fatalf("deliveryDelay() error = %v", err)
+			}
+			if quiet != tt.wantQuiet {
+				t.Errorf("deliveryDelay() quiet = %v, want %v", quiet, tt.wantQuiet)
+			}
+			if quiet && !until.Equal(time.Date(2024, 1, 16, 7, 0, 0, 0, time.UTC)) {
+				t.Errorf("deliveryDelay() until = %v", until)
+			}
+		})
+	}
+}
+
+func TestOptOutReason(t *testing.T) {
+	defaults := &models.NotificationPreferences{Channels: defaultChannels, Enabled: true}
+	emailOnly := &models.NotificationPreferences{Channels: []models.NotificationType{models.NotificationTypeEmail}, Enabled: true}
+	disabled := &models.NotificationPreferences{Channels: defaultChannels}
+
+	tests := []struct {
+		name    string
+		prefs   *models.NotificationPreferences
+		channel models.NotificationType
+		want    string
+	}{
+		{name: "defaults allow email", prefs: defaults, channel: models.NotificationTypeEmail},
+		{name: "defaults allow sms", prefs: defaults, channel: models.NotificationTypeSMS},
+		{name: "defaults allow push", prefs: defaults, channel: models.NotificationTypePush},
+		{name: "defaults allow webhook", prefs: defaults, channel: models.NotificationTypeWebhook},
+		{name: "saved channel", prefs: emailOnly, channel: models.NotificationTypeEmail},
+		{name: "channel opt out", prefs: emailOnly, channel: models.NotificationTypeSMS, want: "channel_opt_out"},
+		{name: "notifications disabled", prefs: disabled, channel: models.NotificationTypeEmail, want: "notifications_disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := optOutReason(tt.prefs, tt.channel); got != tt.want {
+				t.Errorf("optOutReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
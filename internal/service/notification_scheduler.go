@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_payment/internal/models"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultSchedulerInterval = 30 * time.Second
+	scheduledBatchSize       = 100
+)
+
+var (
+	// ErrNotificationNotFound возвращается, если уведомление не найдено
+	ErrNotificationNotFound = errors.New("notification not found")
+	// ErrNotificationNotCancellable возвращается при отмене уведомления,
+	// которое уже передано на отправку
+	ErrNotificationNotCancellable = errors.New("only scheduled or batched notifications can be cancelled")
+)
+
+// Enqueue сохраняет уведомление и публикует его в очередь. Если ScheduledAt
+// находится в будущем, уведомление хранится до этого времени и публикуется
+// планировщиком.
+func (s *NotificationService) Enqueue(ctx context.Context, msg *models.NotificationMessage) error {
+	now := time.Now()
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = now
+	}
+	msg.UpdatedAt = now
+
+	if msg.ScheduledAt != nil && msg.ScheduledAt.After(now) {
+		msg.Status = models.NotificationStatusScheduled
+		if err := s.db.WithContext(ctx).Create(msg).Error; err != nil {
+			return fmt.Errorf("failed to save scheduled notification: %w", err)
+		}
+		return nil
+	}
+
+	msg.Status = models.NotificationStatusPending
+	if err := s.db.WithContext(ctx).Create(msg).Error; err != nil {
+		return fmt.Errorf("failed to save notification: %w", err)
+	}
+
+	if err := s.rabbitmq.PublishNotification(ctx, msg); err != nil {
+		// Уведомление сохранено, его опубликует планировщик
+		log.Printf("Failed to publish notification %s, deferring to scheduler: %v", msg.ID, err)
+		if err := s.markScheduled(ctx, msg, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CancelNotification отменяет отложенное уведомление или уведомление,
+// ожидающее сводки
+func (s *NotificationService) CancelNotification(ctx context.Context, id string) (*models.NotificationMessage, error) {
+	result := s.db.WithContext(ctx).Model(&models.NotificationMessage{}).
+		Where("id = ? AND status IN ?", id, []models.NotificationStatus{models.NotificationStatusScheduled, models.NotificationStatusBatched}).
+		Updates(map[string]interface{}{"status": models.NotificationStatusCancelled, "updated_at": time.Now()})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to cancel notification: %w", result.Error)
+	}
+
+	msg, err := s.GetNotification(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return msg, ErrNotificationNotCancellable
+	}
+
+	return msg, nil
+}
+
+// GetNotification возвращает сохраненное уведомление
+func (s *NotificationService) GetNotification(ctx context.Context, id string) (*models.NotificationMessage, error) {
+	var msg models.NotificationMessage
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&msg).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotificationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification: %w", err)
+	}
+	return &msg, nil
+}
+
+// RunScheduler периодически публикует отложенные уведомления и сводки до
+// отмены ctx. Начатый проход завершается: его транзакция публикует
+// сообщения, и откат после публикации привел бы к повторной отправке.
+// Отложенные уведомления хранятся в базе, поэтому переживают перезапуск.
+func (s *NotificationService) RunScheduler(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultSchedulerInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	passCtx := context.WithoutCancel(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Сводки сохраняются отложенными и публикуются тем же проходом
+		if err := s.publishDigests(passCtx); err != nil {
+			log.Printf("Failed to create notification digests: %v", err)
+		}
+		if err := s.publishDue(passCtx); err != nil {
+			log.Printf("Failed to publish scheduled notifications: %v", err)
+		}
+	}
+}
+
+// publishDue публикует отложенные уведомления, время которых наступило.
+// Строки блокируются с SKIP LOCKED, поэтому несколько реплик не публикуют
+// одно уведомление дважды. Если реплика упадет до фиксации транзакции,
+// уведомления останутся отложенными и будут опубликованы повторно.
+func (s *NotificationService) publishDue(ctx context.Context) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return s.claimDue(ctx, tx, time.Now())
+	})
+}
+
+// claimDue публикует в транзакции tx отложенные уведомления, время которых
+// наступило к now. Переход в pending выполняется только из scheduled, поэтому
+// отмененное уведомление не возвращается в очередь.
+func (s *NotificationService) claimDue(ctx context.Context, tx *gorm.DB, now time.Time) error {
+	var due []models.NotificationMessage
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("status = ? AND scheduled_at <= ?", models.NotificationStatusScheduled, now).
+		Order("scheduled_at").
+		Limit(scheduledBatchSize).
+		Find(&due).Error
+	if err != nil {
+		return fmt.Errorf("failed to load scheduled notifications: %w", err)
+	}
+
+	for i := range due {
+		msg := &due[i]
+		msg.Status = models.NotificationStatusPending
+		msg.UpdatedAt = time.Now()
+
+		if err := s.rabbitmq.PublishNotification(ctx, msg); err != nil {
+			// Остальные уведомления будут опубликованы при следующем запуске
+			log.Printf("Failed to publish scheduled notification %s: %v", msg.ID, err)
+			break
+		}
+
+		err := tx.Model(&models.NotificationMessage{}).
+			Where("id = ? AND status = ?", msg.ID, models.NotificationStatusScheduled).
+			Updates(map[string]interface{}{"status": msg.Status, "updated_at": msg.UpdatedAt}).Error
+		if err != nil {
+			return fmt.Errorf("failed to update scheduled notification %s: %w", msg.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// markScheduled передает уведомление планировщику
+func (s *NotificationService) markScheduled(ctx context.Context, msg *models.NotificationMessage, at time.Time) error {
+	msg.Status = models.NotificationStatusScheduled
+	msg.ScheduledAt = &at
+
+	err := s.db.WithContext(ctx).Model(&models.NotificationMessage{}).
+		Where("id = ?", msg.ID).
+		Updates(map[string]interface{}{"status": msg.Status, "scheduled_at": at}).Error
+	if err != nil {
+		return fmt.Errorf("failed to schedule notification: %w", err)
+	}
+	return nil
+}
+
+// isNotificationHandled проверяет, завершена ли обработка уведомления или
+// оно ожидает сводки. Очередь гарантирует доставку хотя бы один раз, поэтому
+// повторные сообщения пропускаются: уведомление, не прошедшее блокировку или
+// настройки пользователя, не должно быть отправлено при повторной доставке.
+func (s *NotificationService) isNotificationHandled(ctx context.Context, id string) bool {
+	var msg models.NotificationMessage
+	if err := s.db.WithContext(ctx).Select("status").Where("id = ?", id).First(&msg).Error; err != nil {
+		return false
+	}
+	return msg.Status.IsFinal() || msg.Status == models.NotificationStatusBatched
+}
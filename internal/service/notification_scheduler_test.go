@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"go_payment/internal/models"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// recordingPublisher запоминает опубликованные уведомления
+type recordingPublisher struct {
+	err       error
+	published []string
+}
+
+func (p *recordingPublisher) PublishNotification(ctx context.Context, msg *models.NotificationMessage) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, msg.ID)
+	return nil
+}
+
+// dryRunPool открывает транзакции без подключения к базе. В режиме DryRun
+// запросы не выполняются, поэтому методы ConnPool не вызываются.
+type dryRunPool struct{ gorm.ConnPool }
+
+func (p dryRunPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return &dryRunTx{p.ConnPool}, nil
+}
+
+type dryRunTx struct{ gorm.ConnPool }
+
+func (*dryRunTx) Commit() error   { return nil }
+func (*dryRunTx) Rollback() error { return nil }
+
+// dryRunDB открывает базу в режиме DryRun и записывает запросы с
+// подставленными значениями. Выборки возвращают строки rows подходящего
+// типа: в срез попадают все строки, в структуру — первая, а First без
+// подходящей строки возвращает gorm.ErrRecordNotFound.
+func dryRunDB(t *testing.T, rows ...interface{}) (*gorm.DB, *[]string) {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: dryRunPool{}}), &gorm.Config{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+
+	var statements []string
+	record := func(tx *gorm.DB) {
+		statements = append(statements, tx.Dialector.Explain(tx.Statement.SQL.String(), tx.Statement.Vars...))
+	}
+	err = db.Callback().Query().After("gorm:query").Register("test:rows", func(tx *gorm.DB) {
+		record(tx)
+		dest := reflect.ValueOf(tx.Statement.Dest).Elem()
+		for _, row := range rows {
+			value := reflect.ValueOf(row)
+			switch {
+			case dest.Kind() == reflect.Slice && dest.Type().Elem() == value.Type():
+				dest.Set(reflect.Append(dest, value))
+			case dest.Type() == value.Type():
+				dest.Set(value)
+				return
+			}
+		}
+		if dest.Kind() == reflect.Struct && tx.Statement.RaiseErrorOnNotFound {
+			tx.AddError(gorm.ErrRecordNotFound)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	for _, register := range []func() error{
+		func() error { return db.Callback().Create().After("gorm:create").Register("test:record", record) },
+		func() error { return db.Callback().Update().After("gorm:update").Register("test:record", record) },
+		func() error { return db.Callback().Delete().After("gorm:delete").Register("test:record", record) },
+	} {
+		if err := register(); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+	}
+	return db, &statements
+}
+
+func TestEnqueue(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name          string
+		scheduledAt   *time.Time
+		publishErr    error
+		wantStatus    models.NotificationStatus
+		wantPublished int
+		wantUpdate    bool
+	}{
+		{name: "future notification waits for the scheduler", scheduledAt: &future, wantStatus: models.NotificationStatusScheduled},
+		{name: "notification without a time is published", wantStatus: models.NotificationStatusPending, wantPublished: 1},
+		{name: "publish failure defers to the scheduler", publishErr: errors.New("connection closed"), wantStatus: models.NotificationStatusScheduled, wantUpdate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, statements := dryRunDB(t)
+			publisher := &recordingPublisher{err: tt.publishErr}
+			s := &NotificationService{db: db, rabbitmq: publisher}
+			msg := &models.NotificationMessage{ID: "n1", Type: models.NotificationTypeEmail, ScheduledAt: tt.scheduledAt}
+
+			if err := s.Enqueue(context.Background(), msg); err != nil {
+				t.Fatalf("Enqueue() error = %v", err)
+			}
+			if msg.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", msg.Status, tt.wantStatus)
+			}
+			if len(publisher.published) != tt.wantPublished {
+				t.Errorf("published %v, want %d notification(s)", publisher.published, tt.wantPublished)
+			}
+			if msg.Status == models.NotificationStatusScheduled && msg.ScheduledAt == nil {
+				t.Error("scheduled notification has no scheduled_at")
+			}
+			if !strings.HasPrefix((*statements)[0], `INSERT INTO "notifications"`) {
+				t.Errorf("first statement = %s, want the notification to be saved", (*statements)[0])
+			}
+			if updated := len(*statements) > 1 && strings.Contains((*statements)[1], "'scheduled'"); updated != tt.wantUpdate {
+				t.Errorf("statements = %v, want scheduling update %v", *statements, tt.wantUpdate)
+			}
+		})
+	}
+}
+
+func TestClaimDuePublishesDueNotifications(t *testing.T) {
+	due := []interface{}{
+		models.NotificationMessage{ID: "n1", Status: models.NotificationStatusScheduled},
+		models.NotificationMessage{ID: "n2", Status: models.NotificationStatusScheduled},
+	}
+	db, statements := dryRunDB(t, due...)
+	publisher := &recordingPublisher{}
+	s := &NotificationService{db: db, rabbitmq: publisher}
+
+	if err := s.claimDue(context.Background(), db, time.Now()); err != nil {
+		t.Fatalf("claimDue() error = %v", err)
+	}
+	if strings.Join(publisher.published, ",") != "n1,n2" {
+		t.Errorf("published %v, want [n1 n2]", publisher.published)
+	}
+
+	// Реплики пропускают строки, заблокированные другой репликой, и не
+	// публикуют их повторно
+	selectSQL := (*statements)[0]
+	for _, want := range []string{"status = 'scheduled' AND scheduled_at <=", "ORDER BY scheduled_at", "LIMIT 100", "FOR UPDATE SKIP LOCKED"} {
+		if !strings.Contains(selectSQL, want) {
+			t.Errorf("select %s does not contain %q", selectSQL, want)
+		}
+	}
+
+	// Отмена, выполненная до блокировки, не откатывается в pending
+	if len(*statements) != 3 {
+		t.Fatalf("statements = %v, want select and two updates", *statements)
+	}
+	for i, id := range []string{"n1", "n2"} {
+		update := (*statements)[i+1]
+		if !strings.Contains(update, "id = '"+id+"' AND status = 'scheduled'") || !strings.Contains(update, `"status"='pending'`) {
+			t.Errorf("update %s does not claim %s from scheduled", update, id)
+		}
+	}
+}
+
+func TestClaimDueStopsOnPublishFailure(t *testing.T) {
+	db, statements := dryRunDB(t, models.NotificationMessage{ID: "n1"}, models.NotificationMessage{ID: "n2"})
+	s := &NotificationService{db: db, rabbitmq: &recordingPublisher{err: errors.New("connection closed")}}
+
+	if err := s.claimDue(context.Background(), db, time.Now()); err != nil {
+		t.Fatalf("claimDue() error = %v", err)
+	}
+	// Неопубликованные уведомления остаются отложенными до следующего прохода
+	if len(*statements) != 1 {
+		t.Errorf("statements = %v, want only the select", *statements)
+	}
+}
+
+func TestCancelNotificationOnlyUnclaimed(t *testing.T) {
+	db, statements := dryRunDB(t, models.NotificationMessage{ID: "n1", Status: models.NotificationStatusPending})
+	s := &NotificationService{db: db}
+
+	// Уведомление, уже переданное планировщиком в очередь, не отменяется
+	msg, err := s.CancelNotification(context.Background(), "n1")
+	if !errors.Is(err, ErrNotificationNotCancellable) {
+		t.Fatalf("CancelNotification() error = %v, want ErrNotificationNotCancellable", err)
+	}
+	if msg.Status != models.NotificationStatusPending {
+		t.Errorf("status = %s, want pending", msg.Status)
+	}
+	if update := (*statements)[0]; !strings.Contains(update, "id = 'n1' AND status IN ('scheduled','batched')") {
+		t.Errorf("cancel %s is not limited to scheduled and batched notifications", update)
+	}
+}
+
+func TestIsNotificationHandled(t *testing.T) {
+	tests := []struct {
+		status models.NotificationStatus
+		want   bool
+	}{
+		{models.NotificationStatusPending, false},
+		{models.NotificationStatusScheduled, false},
+		{models.NotificationStatusSent, true},
+		{models.NotificationStatusDelivered, true},
+		{models.NotificationStatusFailed, true},
+		{models.NotificationStatusCancelled, true},
+		{models.NotificationStatusSkipped, true},
+		{models.NotificationStatusBatched, true},
+		{models.NotificationStatusDigested, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			db, _ := dryRunDB(t, models.NotificationMessage{ID: "n1", Status: tt.status})
+			s := &NotificationService{db: db}
+			if got := s.isNotificationHandled(context.Background(), "n1"); got != tt.want {
+				t.Errorf("isNotificationHandled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
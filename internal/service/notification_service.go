@@ -3,32 +3,70 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go_payment/internal/messaging"
 	"go_payment/internal/metrics"
 	"go_payment/internal/models"
-	"html/template"
 	"log"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	"gopkg.in/gomail.v2"
+	"gorm.io/gorm"
 )
 
 // NotificationService представляет сервис для работы с уведомлениями
 type NotificationService struct {
-	templates map[string]*template.Template
-	mailer    *gomail.Dialer
-	// Можно добавить другие провайдеры уведомлений (SMS, Push и т.д.)
+	db          *gorm.DB
+	rabbitmq    notificationPublisher
+	templates   map[string]*compiledTemplate
+	templatesMu sync.RWMutex
+	email       EmailSender
+	webhooks  *WebhookService
+	sms       SMSSender
+	push      PushSender
+	// attachmentSources формируют вложения писем по ссылке
+	attachmentSources map[string]AttachmentSource
+	// unsubscribeURL и unsubscribeSecret задают ссылки отписки
+	unsubscribeURL    string
+	unsubscribeSecret []byte
+	// location — зона дат в шаблонах, если зона получателя не передана
+	location *time.Location
 }
 
+// notificationPublisher публикует уведомления в очередь отправки
+type notificationPublisher interface {
+	PublishNotification(ctx context.Context, msg *models.NotificationMessage) error
+}
+
+// AttachmentSource формирует содержимое вложения по ссылке, например
+// PDF квитанцию по идентификатору платежа
+type AttachmentSource func(ctx context.Context, ref string) ([]byte, error)
+
 // NewNotificationService создает новый экземпляр сервиса уведомлений
-func NewNotificationService(smtpHost string, smtpPort int, smtpUser, smtpPassword string) *NotificationService {
-	mailer := gomail.NewDialer(smtpHost, smtpPort, smtpUser, smtpPassword)
-	
-	return &NotificationService{
-		templates: make(map[string]*template.Template),
-		mailer:    mailer,
+func NewNotificationService(db *gorm.DB, rabbitmq *messaging.RabbitMQ, email EmailSender, webhooks *WebhookService, sms SMSSender, push PushSender) *NotificationService {
+	s := &NotificationService{
+		db:                db,
+		rabbitmq:          rabbitmq,
+		templates:         make(map[string]*compiledTemplate),
+		email:             email,
+		webhooks:          webhooks,
+		sms:               sms,
+		push:              push,
+		attachmentSources: make(map[string]AttachmentSource),
+		location:          time.UTC,
+	}
+
+	// Результаты доставки вебхуков меняют статус уведомлений
+	if webhooks != nil {
+		webhooks.OnDelivery(s.handleWebhookDelivery)
 	}
+
+	return s
 }
 
 // ProcessNotification обрабатывает уведомление
@@ -39,7 +77,32 @@ func (s *NotificationService) ProcessNotification(ctx context.Context, msg *mode
 	log.Printf("Processing notification: %s of type %s for recipient %s", 
 		msg.ID, msg.Type, msg.Recipient)
 
-	var err error
+	if s.isNotificationHandled(ctx, msg.ID) {
+		log.Printf("Notification %s was already handled, skipping", msg.ID)
+		return nil
+	}
+
+	// Письма на заблокированные адреса не отправляются
+	deliver, err := s.checkSuppression(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("failed to check suppression list: %w", err)
+	}
+	if !deliver {
+		metrics.IncrementProcessedMessage("notifications", string(msg.Status))
+		return nil
+	}
+
+	// Проверяем отключенные каналы и тихие часы пользователя
+	deliver, err = s.applyPreferences(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("failed to apply notification preferences: %w", err)
+	}
+	if !deliver {
+		metrics.IncrementProcessedMessage("notifications", string(msg.Status))
+		return nil
+	}
+
+	start := time.Now()
 	switch msg.Type {
 	case models.NotificationTypeEmail:
 		err = s.sendEmail(ctx, msg)
@@ -52,34 +115,145 @@ func (s *NotificationService) ProcessNotification(ctx context.Context, msg *mode
 	default:
 		err = fmt.Errorf("unsupported notification type: %s", msg.Type)
 	}
+	s.recordAttempt(ctx, msg, start, err)
 
 	if err != nil {
 		metrics.RecordProcessingError("notifications", fmt.Sprintf("%s_error", msg.Type))
+
+		// Ошибки данных не исправятся повторной отправкой, поэтому сообщение
+		// помечается как неудачное и не возвращается в очередь
+		if isPermanentNotificationError(err) {
+			log.Printf("Dropping notification %s: %v", msg.ID, err)
+			if msg.Type == models.NotificationTypeEmail && errors.Is(err, ErrInvalidRecipient) {
+				s.suppressBounced(ctx, msg, err)
+			}
+			msg.Status = models.NotificationStatusFailed
+			msg.UpdatedAt = time.Now()
+			return s.saveNotification(ctx, msg)
+		}
+
+		s.incrementRetryCount(ctx, msg)
 		return fmt.Errorf("failed to send notification: %w", err)
 	}
 
+	if err := s.markSent(ctx, msg); err != nil {
+		log.Printf("Failed to save notification %s: %v", msg.ID, err)
+	}
+
 	metrics.IncrementProcessedMessage("notifications", string(msg.Status))
 	return nil
 }
 
-// CreateNotification создает новое уведомление
-func (s *NotificationService) CreateNotification(ctx context.Context, templateID string, recipient string, data map[string]interface{}) (*models.NotificationMessage, error) {
-	// Здесь должна быть логика получения шаблона из базы данных
-	template := &models.NotificationTemplate{
-		ID:      templateID,
-		Type:    models.NotificationTypeEmail,
-		Subject: "Payment Notification",
-		Content: "Your payment has been processed",
+// HandleSMSStatus обрабатывает callback шлюза о статусе доставки SMS
+func (s *NotificationService) HandleSMSStatus(ctx context.Context, notificationID, gatewayStatus, errorCode string) error {
+	var status models.NotificationStatus
+	switch strings.ToLower(gatewayStatus) {
+	case "delivered":
+		status = models.NotificationStatusDelivered
+	case "failed", "undelivered", "rejected", "expired":
+		status = models.NotificationStatusFailed
+	default:
+		// Промежуточные статусы (queued, sent, accepted) не меняют состояние уведомления
+		return nil
+	}
+
+	if _, err := s.GetNotification(ctx, notificationID); err != nil {
+		return err
+	}
+
+	// Callback'и могут приходить повторно и не по порядку, поэтому
+	// окончательный статус не перезаписывается
+	changed, err := s.transitionStatus(ctx, notificationID, status,
+		models.NotificationStatusPending, models.NotificationStatusSent)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		log.Printf("Ignoring SMS status %s for notification %s in final state", gatewayStatus, notificationID)
+	}
+
+	if errorCode != "" {
+		log.Printf("SMS notification %s reported %s with error code %s", notificationID, gatewayStatus, errorCode)
+	}
+
+	return nil
+}
+
+// saveNotification сохраняет текущее состояние уведомления
+func (s *NotificationService) saveNotification(ctx context.Context, msg *models.NotificationMessage) error {
+	if err := s.db.WithContext(ctx).Save(msg).Error; err != nil {
+		return fmt.Errorf("failed to save notification: %w", err)
+	}
+	return nil
+}
+
+// classifySMTPError помечает постоянные ответы SMTP сервера, после которых
+// повторная отправка не имеет смысла
+func classifySMTPError(err error) error {
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		switch smtpErr.Code {
+		case 550, 551, 553:
+			// Почтовый ящик не существует или адрес недопустим
+			return fmt.Errorf("%w: %v", ErrInvalidRecipient, err)
+		case 552, 554:
+			// Сообщение отклонено сервером
+			return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+		}
+	}
+	return fmt.Errorf("failed to send email: %w", err)
+}
+
+// isPermanentNotificationError определяет ошибки, которые не исправит повторная отправка
+func isPermanentNotificationError(err error) bool {
+	return errors.Is(err, ErrInvalidRecipient) || errors.Is(err, ErrInvalidMessage)
+}
+
+// CreateNotification создает новое уведомление из шаблона. templateID может
+// быть идентификатором или именем шаблона. Если задана локаль, шаблон ищется
+// по имени с учетом цепочки fallback локалей.
+func (s *NotificationService) CreateNotification(ctx context.Context, templateID, recipient, locale string, data map[string]interface{}) (*models.NotificationMessage, error) {
+	// Ссылка отписки доступна шаблонам как {{.unsubscribe_url}}
+	if link := s.UnsubscribeLink(recipient); link != "" && strings.Contains(recipient, "@") {
+		values := make(map[string]interface{}, len(data)+1)
+		for k, v := range data {
+			values[k] = v
+		}
+		values["unsubscribe_url"] = link
+		data = values
+	}
+
+	var (
+		rendered *RenderedNotification
+		err      error
+	)
+	if locale != "" {
+		rendered, err = s.RenderLocalizedTemplate(ctx, templateID, locale, data)
+	} else {
+		rendered, err = s.RenderTemplate(ctx, templateID, data)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	msg := &models.NotificationMessage{
-		ID:        uuid.New().String(),
-		Type:      template.Type,
-		Status:    models.NotificationStatusPending,
-		Recipient: recipient,
-		Subject:   template.Subject,
-		Content:   template.Content,
-		Metadata:  make(map[string]string),
+		ID:            uuid.New().String(),
+		Type:          rendered.Type,
+		Status:        models.NotificationStatusPending,
+		Recipient:     recipient,
+		Template:      rendered.TemplateName,
+		Data:          data,
+		Subject:       rendered.Subject,
+		Content:       rendered.Content,
+		TextContent:   rendered.TextContent,
+		From:          rendered.From,
+		ReplyTo:       rendered.ReplyTo,
+		Transactional: rendered.Transactional,
+		Metadata: map[string]string{
+			"template_id":      rendered.TemplateID,
+			"template_version": strconv.Itoa(rendered.Version),
+			"locale":           rendered.Locale,
+		},
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
@@ -94,16 +268,36 @@ func (s *NotificationService) CreateNotification(ctx context.Context, templateID
 	return msg, nil
 }
 
+// RegisterAttachmentSource регистрирует источник вложений писем. Источники
+// регистрируются при инициализации, до запуска обработки уведомлений.
+func (s *NotificationService) RegisterAttachmentSource(name string, source AttachmentSource) {
+	s.attachmentSources[name] = source
+}
+
 // sendEmail отправляет email уведомление
 func (s *NotificationService) sendEmail(ctx context.Context, msg *models.NotificationMessage) error {
-	m := gomail.NewMessage()
-	m.SetHeader("From", "noreply@payment-service.com")
-	m.SetHeader("To", msg.Recipient)
-	m.SetHeader("Subject", msg.Subject)
-	m.SetBody("text/html", msg.Content)
+	if s.email == nil {
+		return fmt.Errorf("email notifications are not configured")
+	}
 
-	if err := s.mailer.DialAndSend(m); err != nil {
-		return fmt.Errorf("failed to send email: %w", err)
+	attachments, err := s.resolveAttachments(ctx, msg.Attachments)
+	if err != nil {
+		return err
+	}
+
+	err = s.email.Send(ctx, &EmailMessage{
+		ID:          msg.ID,
+		From:        msg.From,
+		ReplyTo:     msg.ReplyTo,
+		To:          msg.Recipient,
+		Subject:     msg.Subject,
+		Text:        msg.TextContent,
+		HTML:        msg.Content,
+		Headers:     s.unsubscribeHeaders(msg),
+		Attachments: attachments,
+	})
+	if err != nil {
+		return classifySMTPError(err)
 	}
 
 	now := time.Now()
@@ -114,46 +308,252 @@ func (s *NotificationService) sendEmail(ctx context.Context, msg *models.Notific
 	return nil
 }
 
+// resolveAttachments загружает содержимое вложений из их источников
+func (s *NotificationService) resolveAttachments(ctx context.Context, attachments []models.NotificationAttachment) ([]EmailAttachment, error) {
+	result := make([]EmailAttachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		data := attachment.Data
+		if data == nil {
+			source, ok := s.attachmentSources[attachment.Source]
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown attachment source %q", ErrInvalidMessage, attachment.Source)
+			}
+
+			var err error
+			if data, err = source(ctx, attachment.Ref); err != nil {
+				return nil, fmt.Errorf("failed to build attachment %s: %w", attachment.Filename, err)
+			}
+		}
+
+		result = append(result, EmailAttachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Data:        data,
+		})
+	}
+	return result, nil
+}
+
 // sendSMS отправляет SMS уведомление
 func (s *NotificationService) sendSMS(ctx context.Context, msg *models.NotificationMessage) error {
-	// Здесь должна быть реализация отправки SMS
-	// Например, через Twilio или другой сервис
-	return fmt.Errorf("SMS notifications not implemented yet")
+	if s.sms == nil {
+		return fmt.Errorf("SMS notifications are not configured")
+	}
+
+	phone, err := NormalizePhoneNumber(msg.Recipient)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.sms.Send(ctx, &SMSMessage{
+		ID:   msg.ID,
+		To:   phone,
+		Body: msg.Content,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send SMS: %w", err)
+	}
+
+	if msg.Metadata == nil {
+		msg.Metadata = make(map[string]string)
+	}
+	msg.Metadata["sms_message_id"] = result.ProviderMessageID
+	msg.Metadata["sms_segments"] = strconv.Itoa(result.Segments)
+
+	now := time.Now()
+	msg.Status = models.NotificationStatusSent
+	msg.SentAt = &now
+	msg.UpdatedAt = now
+
+	return nil
 }
 
-// sendPushNotification отправляет push-уведомление
+// sendPushNotification отправляет push-уведомление на все устройства
+// пользователя. Получателем является идентификатор пользователя. Результат
+// сохраняется для каждого устройства, поэтому повторная обработка досылает
+// уведомление только устройствам, которые его еще не получили.
 func (s *NotificationService) sendPushNotification(ctx context.Context, msg *models.NotificationMessage) error {
-	// Здесь должна быть реализация отправки push-уведомлений
-	// Например, через Firebase Cloud Messaging
-	return fmt.Errorf("push notifications not implemented yet")
+	if s.push == nil {
+		return fmt.Errorf("push notifications are not configured")
+	}
+
+	devices, err := s.ListDevices(ctx, msg.Recipient)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return fmt.Errorf("%w: user %s has no registered devices", ErrInvalidRecipient, msg.Recipient)
+	}
+
+	sent, err := s.pushDeliveredDevices(ctx, msg.ID)
+	if err != nil {
+		return err
+	}
+	return s.pushToDevices(ctx, msg, devices, sent)
 }
 
-// sendWebhook отправляет webhook уведомление
-func (s *NotificationService) sendWebhook(ctx context.Context, msg *models.NotificationMessage) error {
-	// Здесь должна быть реализация отправки webhook
-	// Например, через HTTP POST запрос
-	return fmt.Errorf("webhook notifications not implemented yet")
+// pushToDevices отправляет push-уведомление на устройства, не входящие в
+// sent. Временная ошибка любого устройства возвращается, чтобы сообщение
+// было обработано повторно.
+func (s *NotificationService) pushToDevices(ctx context.Context, msg *models.NotificationMessage, devices []models.DeviceToken, sent map[string]bool) error {
+	push := &PushMessage{
+		ID:    msg.ID,
+		Title: msg.Subject,
+		Body:  msg.Content,
+		Data:  msg.Metadata,
+	}
+
+	delivered, pending := 0, 0
+	var lastErr error
+	for i := range devices {
+		device := &devices[i]
+		if sent[device.ID] {
+			delivered++
+			continue
+		}
+
+		start := time.Now()
+		err := s.push.Send(ctx, device, push)
+		s.recordDeviceAttempt(ctx, msg, device, start, err)
+		switch {
+		case err == nil:
+			delivered++
+		case errors.Is(err, ErrInvalidDeviceToken):
+			// Провайдер больше не принимает токен, удаляем устройство
+			log.Printf("Pruning invalid device %s of user %s: %v", device.ID, device.UserID, err)
+			if err := s.db.WithContext(ctx).Delete(device).Error; err != nil {
+				log.Printf("Failed to prune device %s: %v", device.ID, err)
+			}
+		case errors.Is(err, ErrUnsupportedPlatform):
+			// Токен действителен, но платформа не настроена: устройство
+			// сохраняется до подключения провайдера, повтор не поможет
+			log.Printf("Skipping push %s to device %s: %v", msg.ID, device.ID, err)
+			lastErr = err
+		default:
+			log.Printf("Failed to send push %s to device %s: %v", msg.ID, device.ID, err)
+			pending++
+			lastErr = err
+		}
+	}
+
+	if pending > 0 {
+		return fmt.Errorf("failed to send push notification to %d of %d device(s): %w", pending, len(devices), lastErr)
+	}
+	if delivered == 0 {
+		if lastErr != nil {
+			return fmt.Errorf("failed to send push notification: %w", lastErr)
+		}
+		return fmt.Errorf("%w: all devices of user %s were rejected", ErrInvalidRecipient, msg.Recipient)
+	}
+
+	if msg.Metadata == nil {
+		msg.Metadata = make(map[string]string)
+	}
+	msg.Metadata["push_devices"] = strconv.Itoa(delivered)
+
+	now := time.Now()
+	msg.Status = models.NotificationStatusSent
+	msg.SentAt = &now
+	msg.UpdatedAt = now
+
+	return nil
 }
 
-// LoadTemplates загружает шаблоны уведомлений
-func (s *NotificationService) LoadTemplates() error {
-	// Здесь должна быть логика загрузки шаблонов из файлов или базы данных
+// RegisterDevice регистрирует устройство пользователя. Повторная регистрация
+// того же токена обновляет владельца, платформу и версию приложения.
+func (s *NotificationService) RegisterDevice(ctx context.Context, device *models.DeviceToken) error {
+	now := time.Now()
+
+	var existing models.DeviceToken
+	err := s.db.WithContext(ctx).Where("token = ?", device.Token).First(&existing).Error
+	switch {
+	case err == nil:
+		device.ID = existing.ID
+		device.CreatedAt = existing.CreatedAt
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		device.ID = uuid.New().String()
+		device.CreatedAt = now
+	default:
+		return fmt.Errorf("failed to look up device: %w", err)
+	}
+
+	device.LastSeenAt = now
+	device.UpdatedAt = now
+
+	if err := s.db.WithContext(ctx).Save(device).Error; err != nil {
+		return fmt.Errorf("failed to save device: %w", err)
+	}
 	return nil
 }
 
-// GetUserPreferences получает настройки уведомлений пользователя
-func (s *NotificationService) GetUserPreferences(ctx context.Context, userID string) (*models.NotificationPreferences, error) {
-	// Здесь должна быть логика получения настроек из базы данных
-	return &models.NotificationPreferences{
-		UserID:   userID,
-		Channels: []models.NotificationType{models.NotificationTypeEmail},
-		Enabled:  true,
-		UpdatedAt: time.Now(),
-	}, nil
+// ListDevices возвращает устройства пользователя
+func (s *NotificationService) ListDevices(ctx context.Context, userID string) ([]models.DeviceToken, error) {
+	var devices []models.DeviceToken
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	return devices, nil
 }
 
-// UpdateUserPreferences обновляет настройки уведомлений пользователя
-func (s *NotificationService) UpdateUserPreferences(ctx context.Context, prefs *models.NotificationPreferences) error {
-	// Здесь должна быть логика сохранения настроек в базу данных
+// UnregisterDevice удаляет устройство пользователя
+func (s *NotificationService) UnregisterDevice(ctx context.Context, userID, deviceID string) error {
+	result := s.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", deviceID, userID).
+		Delete(&models.DeviceToken{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete device: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("device %s not found", deviceID)
+	}
+	return nil
+}
+
+// hasChannel проверяет, включен ли канал в настройках пользователя
+func hasChannel(channels []models.NotificationType, channel models.NotificationType) bool {
+	for _, c := range channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// sendWebhook ставит webhook уведомление в очередь доставки. Получателем
+// является идентификатор зарегистрированного endpoint'а, тип события
+// передается в метаданных "event_type".
+func (s *NotificationService) sendWebhook(ctx context.Context, msg *models.NotificationMessage) error {
+	if s.webhooks == nil {
+		return fmt.Errorf("webhook notifications are not configured")
+	}
+
+	eventType := msg.Metadata["event_type"]
+	if eventType == "" {
+		eventType = "notification"
+	}
+
+	payload, err := json.Marshal(WebhookEvent{
+		ID:        msg.ID,
+		Type:      eventType,
+		CreatedAt: msg.CreatedAt,
+		Data: map[string]interface{}{
+			"subject":  msg.Subject,
+			"content":  msg.Content,
+			"metadata": msg.Metadata,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	if err := s.webhooks.Enqueue(ctx, msg.Recipient, msg.ID, eventType, payload); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	msg.Status = models.NotificationStatusSent
+	msg.SentAt = &now
+	msg.UpdatedAt = now
+
 	return nil
 }
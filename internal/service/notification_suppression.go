@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go_payment/internal/models"
+	"log"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSuppressionListLimit = 50
+	maxSuppressionListLimit     = 500
+)
+
+var (
+	// ErrInvalidUnsubscribeToken возвращается для поддельной или
+	// поврежденной ссылки отписки
+	ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe token")
+	// ErrSuppressionNotFound возвращается, если адрес не заблокирован
+	ErrSuppressionNotFound = errors.New("suppression not found")
+	// ErrInvalidSuppression возвращается для некорректного адреса или причины
+	ErrInvalidSuppression = errors.New("invalid suppression")
+)
+
+// EmailEventType определяет тип события почтового провайдера
+type EmailEventType string
+
+const (
+	EmailEventBounce    EmailEventType = "bounce"
+	EmailEventComplaint EmailEventType = "complaint"
+)
+
+// EmailEvent представляет сообщение провайдера о возврате или жалобе.
+// Временные возвраты (Permanent = false) не блокируют адрес.
+type EmailEvent struct {
+	Type           EmailEventType `json:"type" binding:"required"`
+	Email          string         `json:"email" binding:"required,email"`
+	NotificationID string         `json:"notification_id"`
+	Permanent      bool           `json:"permanent"`
+	Details        string         `json:"details"`
+}
+
+// SuppressionFilter задает условия выборки заблокированных адресов
+type SuppressionFilter struct {
+	Email  string
+	Reason models.SuppressionReason
+	Limit  int
+	Offset int
+}
+
+// ConfigureUnsubscribe включает ссылки отписки в письмах, не являющихся
+// транзакционными. baseURL указывает на публичный endpoint отписки,
+// secret используется для подписи токенов.
+func (s *NotificationService) ConfigureUnsubscribe(baseURL, secret string) {
+	s.unsubscribeURL = baseURL
+	s.unsubscribeSecret = []byte(secret)
+}
+
+// UnsubscribeToken возвращает подписанный токен отписки адреса. Токен не
+// истекает, чтобы ссылки в старых письмах продолжали работать.
+func (s *NotificationService) UnsubscribeToken(email string) string {
+	email = normalizeEmail(email)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(email))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.signUnsubscribe(email))
+}
+
+// UnsubscribeLink возвращает ссылку отписки адреса или пустую строку, если
+// отписка не настроена
+func (s *NotificationService) UnsubscribeLink(email string) string {
+	if s.unsubscribeURL == "" || len(s.unsubscribeSecret) == 0 {
+		return ""
+	}
+
+	separator := "?"
+	if strings.Contains(s.unsubscribeURL, "?") {
+		separator = "&"
+	}
+	return s.unsubscribeURL + separator + "token=" + url.QueryEscape(s.UnsubscribeToken(email))
+}
+
+// VerifyUnsubscribeToken проверяет подпись токена и возвращает адрес
+func (s *NotificationService) VerifyUnsubscribeToken(token string) (string, error) {
+	if len(s.unsubscribeSecret) == 0 {
+		return "", ErrInvalidUnsubscribeToken
+	}
+
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidUnsubscribeToken
+	}
+	email, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrInvalidUnsubscribeToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.signUnsubscribe(string(email))) {
+		return "", ErrInvalidUnsubscribeToken
+	}
+
+	return string(email), nil
+}
+
+// Unsubscribe отписывает адрес из токена от писем, не являющихся транзакционными
+func (s *NotificationService) Unsubscribe(ctx context.Context, token string) (string, error) {
+	email, err := s.VerifyUnsubscribeToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.AddSuppression(ctx, &models.EmailSuppression{
+		Email:  email,
+		Reason: models.SuppressionReasonUnsubscribe,
+		Source: "unsubscribe_link",
+	})
+	return email, err
+}
+
+// HandleEmailEvent блокирует адрес после постоянного возврата или жалобы
+func (s *NotificationService) HandleEmailEvent(ctx context.Context, event *EmailEvent) error {
+	var reason models.SuppressionReason
+	switch event.Type {
+	case EmailEventBounce:
+		if !event.Permanent {
+			log.Printf("Ignoring transient bounce for %s: %s", event.Email, event.Details)
+			return nil
+		}
+		reason = models.SuppressionReasonBounce
+	case EmailEventComplaint:
+		reason = models.SuppressionReasonComplaint
+	default:
+		return fmt.Errorf("%w: unknown email event type %q", ErrInvalidSuppression, event.Type)
+	}
+
+	_, err := s.AddSuppression(ctx, &models.EmailSuppression{
+		Email:          event.Email,
+		Reason:         reason,
+		Source:         "provider",
+		Details:        event.Details,
+		NotificationID: event.NotificationID,
+	})
+	return err
+}
+
+// AddSuppression блокирует адрес. Отписка не ослабляет уже действующую
+// блокировку по возврату, жалобе или решению администратора.
+func (s *NotificationService) AddSuppression(ctx context.Context, suppression *models.EmailSuppression) (*models.EmailSuppression, error) {
+	if err := validateSuppression(suppression); err != nil {
+		return nil, err
+	}
+
+	var result *models.EmailSuppression
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var existing models.EmailSuppression
+		err := tx.Where("email = ?", suppression.Email).First(&existing).Error
+		switch {
+		case err == nil:
+			if suppression.Reason == models.SuppressionReasonUnsubscribe && existing.Reason != models.SuppressionReasonUnsubscribe {
+				result = &existing
+				return nil
+			}
+			suppression.CreatedAt = existing.CreatedAt
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			suppression.CreatedAt = time.Now()
+		default:
+			return err
+		}
+
+		suppression.UpdatedAt = time.Now()
+		result = suppression
+		return tx.Save(suppression).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save suppression: %w", err)
+	}
+
+	log.Printf("Suppressed email %s: %s", result.Email, result.Reason)
+	return result, nil
+}
+
+// RemoveSuppression снимает блокировку адреса
+func (s *NotificationService) RemoveSuppression(ctx context.Context, email string) error {
+	result := s.db.WithContext(ctx).Where("email = ?", normalizeEmail(email)).Delete(&models.EmailSuppression{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove suppression: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSuppressionNotFound
+	}
+	return nil
+}
+
+// GetSuppression возвращает блокировку адреса
+func (s *NotificationService) GetSuppression(ctx context.Context, email string) (*models.EmailSuppression, error) {
+	var suppression models.EmailSuppression
+	err := s.db.WithContext(ctx).Where("email = ?", normalizeEmail(email)).First(&suppression).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSuppressionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get suppression: %w", err)
+	}
+	return &suppression, nil
+}
+
+// ListSuppressions возвращает заблокированные адреса, начиная с последних
+func (s *NotificationService) ListSuppressions(ctx context.Context, filter SuppressionFilter) ([]models.EmailSuppression, error) {
+	query := s.db.WithContext(ctx).Model(&models.EmailSuppression{})
+	if filter.Email != "" {
+		query = query.Where("email = ?", normalizeEmail(filter.Email))
+	}
+	if filter.Reason != "" {
+		query = query.Where("reason = ?", filter.Reason)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultSuppressionListLimit
+	}
+	if limit > maxSuppressionListLimit {
+		limit = maxSuppressionListLimit
+	}
+
+	var suppressions []models.EmailSuppression
+	err := query.Order("updated_at DESC, email").Limit(limit).Offset(filter.Offset).Find(&suppressions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list suppressions: %w", err)
+	}
+	return suppressions, nil
+}
+
+// checkSuppression пропускает письмо на заблокированный адрес. Отписка
+// блокирует только письма, не являющиеся транзакционными.
+func (s *NotificationService) checkSuppression(ctx context.Context, msg *models.NotificationMessage) (bool, error) {
+	if msg.Type != models.NotificationTypeEmail {
+		return true, nil
+	}
+
+	suppression, err := s.GetSuppression(ctx, msg.Recipient)
+	if errors.Is(err, ErrSuppressionNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if suppression.Reason == models.SuppressionReasonUnsubscribe && msg.Transactional {
+		return true, nil
+	}
+
+	log.Printf("Skipping notification %s: %s is suppressed (%s)", msg.ID, msg.Recipient, suppression.Reason)
+	if msg.Metadata == nil {
+		msg.Metadata = make(map[string]string)
+	}
+	msg.Metadata["skip_reason"] = "suppressed_" + string(suppression.Reason)
+	msg.Status = models.NotificationStatusSkipped
+	msg.UpdatedAt = time.Now()
+	return false, s.saveNotification(ctx, msg)
+}
+
+// suppressBounced блокирует адрес, отклоненный SMTP сервером
+func (s *NotificationService) suppressBounced(ctx context.Context, msg *models.NotificationMessage, sendErr error) {
+	_, err := s.AddSuppression(ctx, &models.EmailSuppression{
+		Email:          msg.Recipient,
+		Reason:         models.SuppressionReasonBounce,
+		Source:         "smtp",
+		Details:        truncate(sendErr.Error(), maxAttemptResponseLength),
+		NotificationID: msg.ID,
+	})
+	if err != nil {
+		log.Printf("Failed to suppress bounced email %s: %v", msg.Recipient, err)
+	}
+}
+
+// unsubscribeHeaders возвращает заголовки отписки RFC 8058 для писем, не
+// являющихся транзакционными
+func (s *NotificationService) unsubscribeHeaders(msg *models.NotificationMessage) map[string]string {
+	if msg.Transactional {
+		return nil
+	}
+	link := s.UnsubscribeLink(msg.Recipient)
+	if link == "" {
+		return nil
+	}
+
+	return map[string]string{
+		"List-Unsubscribe":      "<" + link + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// signUnsubscribe подписывает адрес секретом отписки
+func (s *NotificationService) signUnsubscribe(email string) []byte {
+	mac := hmac.New(sha256.New, s.unsubscribeSecret)
+	mac.Write([]byte("unsubscribe:" + email))
+	return mac.Sum(nil)
+}
+
+// validateSuppression нормализует адрес и проверяет причину блокировки
+func validateSuppression(suppression *models.EmailSuppression) error {
+	address, err := mail.ParseAddress(suppression.Email)
+	if err != nil {
+		return fmt.Errorf("%w: invalid email %q", ErrInvalidSuppression, suppression.Email)
+	}
+	suppression.Email = normalizeEmail(address.Address)
+
+	switch suppression.Reason {
+	case models.SuppressionReasonBounce, models.SuppressionReasonComplaint,
+		models.SuppressionReasonUnsubscribe, models.SuppressionReasonManual:
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown reason %q", ErrInvalidSuppression, suppression.Reason)
+	}
+}
+
+// normalizeEmail приводит адрес к виду, в котором он хранится в списке блокировок
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
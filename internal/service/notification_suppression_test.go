@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"go_payment/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestUnsubscribeToken(t *testing.T) {
+	s := &NotificationService{}
+	s.ConfigureUnsubscribe("https://pay.example.com/unsubscribe", "secret")
+	token := s.UnsubscribeToken(" User@Example.com ")
+	payload, signature, _ := strings.Cut(token, ".")
+
+	other := &NotificationService{}
+	other.ConfigureUnsubscribe("https://pay.example.com/unsubscribe", "other-secret")
+	unconfigured := &NotificationService{}
+
+	tests := []struct {
+		name      string
+		service   *NotificationService
+		token     string
+		wantEmail string
+		wantErr   bool
+	}{
+		{name: "round trip normalizes the address", service: s, token: token, wantEmail: "user@example.com"},
+		{
+			name:    "tampered payload",
+			service: s,
+			token:   base64.RawURLEncoding.EncodeToString([]byte("victim@example.com")) + "." + signature,
+			wantErr: true,
+		},
+		{
+			name:    "tampered signature",
+			service: s,
+			token:   payload + "." + base64.RawURLEncoding.EncodeToString([]byte("forged signature")),
+			wantErr: true,
+		},
+		{name: "signature of another secret", service: s, token: other.UnsubscribeToken("user@example.com"), wantErr: true},
+		{name: "missing separator", service: s, token: payload + signature, wantErr: true},
+		{name: "invalid base64", service: s, token: "%%%." + signature, wantErr: true},
+		{name: "empty token", service: s, wantErr: true},
+		// Без секрета любая подпись предсказуема, поэтому токены не принимаются
+		{name: "missing secret", service: unconfigured, token: unconfigured.UnsubscribeToken("user@example.com"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email, err := tt.service.VerifyUnsubscribeToken(tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidUnsubscribeToken) {
+					t.Errorf("VerifyUnsubscribeToken() = %q, %v, want ErrInvalidUnsubscribeToken", email, err)
+				}
+				return
+			}
+			if err != nil || email != tt.wantEmail {
+				t.Errorf("VerifyUnsubscribeToken() = %q, %v, want %q", email, err, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestUnsubscribeLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		secret  string
+		want    string
+	}{
+		{name: "not configured"},
+		{name: "missing secret", baseURL: "https://pay.example.com/unsubscribe"},
+		{name: "new query", baseURL: "https://pay.example.com/unsubscribe", secret: "secret", want: "https://pay.example.com/unsubscribe?token="},
+		{name: "existing query", baseURL: "https://pay.example.com/unsubscribe?lang=ru", secret: "secret", want: "https://pay.example.com/unsubscribe?lang=ru&token="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &NotificationService{}
+			s.ConfigureUnsubscribe(tt.baseURL, tt.secret)
+			link := s.UnsubscribeLink("user@example.com")
+			if tt.want == "" {
+				if link != "" {
+					t.Errorf("UnsubscribeLink() = %q, want empty", link)
+				}
+				return
+			}
+			if link != tt.want+s.UnsubscribeToken("user@example.com") {
+				t.Errorf("UnsubscribeLink() = %q, want prefix %q and the token", link, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddSuppressionPrecedence(t *testing.T) {
+	tests := []struct {
+		name       string
+		existing   models.SuppressionReason
+		reason     models.SuppressionReason
+		wantReason models.SuppressionReason
+		wantSave   bool
+	}{
+		{name: "unsubscribe keeps bounce", existing: models.SuppressionReasonBounce, reason: models.SuppressionReasonUnsubscribe, wantReason: models.SuppressionReasonBounce},
+		{name: "unsubscribe keeps complaint", existing: models.SuppressionReasonComplaint, reason: models.SuppressionReasonUnsubscribe, wantReason: models.SuppressionReasonComplaint},
+		{name: "repeated unsubscribe", existing: models.SuppressionReasonUnsubscribe, reason: models.SuppressionReasonUnsubscribe, wantReason: models.SuppressionReasonUnsubscribe, wantSave: true},
+		{name: "bounce replaces unsubscribe", existing: models.SuppressionReasonUnsubscribe, reason: models.SuppressionReasonBounce, wantReason: models.SuppressionReasonBounce, wantSave: true},
+		{name: "complaint replaces bounce", existing: models.SuppressionReasonBounce, reason: models.SuppressionReasonComplaint, wantReason: models.SuppressionReasonComplaint, wantSave: true},
+		{name: "new address", reason: models.SuppressionReasonUnsubscribe, wantReason: models.SuppressionReasonUnsubscribe, wantSave: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rows []interface{}
+			if tt.existing != "" {
+				rows = append(rows, models.EmailSuppression{Email: "user@example.com", Reason: tt.existing, Source: "provider"})
+			}
+			db, statements := dryRunDB(t, rows...)
+			s := &NotificationService{db: db}
+
+			result, err := s.AddSuppression(context.Background(), &models.EmailSuppression{
+				Email:  "User@Example.com",
+				Reason: tt.reason,
+				Source: "unsubscribe_link",
+			})
+			if err != nil {
+				t.Fatalf("AddSuppression() error = %v", err)
+			}
+			if result.Reason != tt.wantReason {
+				t.Errorf("reason = %s, want %s", result.Reason, tt.wantReason)
+			}
+
+			saved := false
+			for _, statement := range (*statements)[1:] {
+				if strings.Contains(statement, "'"+string(tt.reason)+"'") {
+					saved = true
+				}
+			}
+			if saved != tt.wantSave {
+				t.Errorf("statements = %v, want save %v", *statements, tt.wantSave)
+			}
+		})
+	}
+}
@@ -0,0 +1,506 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go_payment/internal/i18n"
+	"go_payment/internal/models"
+	htmltemplate "html/template"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrTemplateNotFound возвращается, если шаблон не найден или неактивен
+	ErrTemplateNotFound = errors.New("notification template not found")
+	// ErrInvalidTemplate возвращается для шаблона с синтаксической ошибкой
+	ErrInvalidTemplate = errors.New("invalid notification template")
+	// ErrMissingTemplateVariables возвращается, если не переданы обязательные переменные
+	ErrMissingTemplateVariables = errors.New("missing required template variables")
+)
+
+// TemplateTimezoneKey — ключ данных шаблона с IANA зоной получателя. Даты
+// форматируются в этой зоне, а без нее в зоне ConfigureLocation.
+const TemplateTimezoneKey = "timezone"
+
+// templateExecutor объединяет html/template и text/template
+type templateExecutor interface {
+	Execute(w io.Writer, data interface{}) error
+}
+
+// compiledTemplate хранит скомпилированную версию шаблона
+type compiledTemplate struct {
+	version int
+	subject *texttemplate.Template
+	content templateExecutor
+	// text равен nil, если у шаблона нет текстовой версии
+	text *texttemplate.Template
+}
+
+// RenderedNotification представляет результат рендеринга шаблона
+type RenderedNotification struct {
+	TemplateID   string                  `json:"template_id"`
+	TemplateName string                  `json:"template_name"`
+	Version      int                     `json:"version"`
+	Locale       string                  `json:"locale"`
+	Type         models.NotificationType `json:"type"`
+	Subject      string                  `json:"subject"`
+	Content      string                  `json:"content"`
+	// TextContent содержит текстовую версию письма
+	TextContent string `json:"text_content,omitempty"`
+	From        string `json:"from,omitempty"`
+	ReplyTo     string `json:"reply_to,omitempty"`
+	// Transactional сообщения отправляются и во время тихих часов
+	Transactional bool `json:"transactional"`
+}
+
+// LoadTemplates загружает и компилирует все активные шаблоны
+func (s *NotificationService) LoadTemplates() error {
+	var templates []models.NotificationTemplate
+	if err := s.db.Where("is_active = ?", true).Find(&templates).Error; err != nil {
+		return fmt.Errorf("failed to load notification templates: %w", err)
+	}
+
+	for i := range templates {
+		if _, err := s.compileTemplate(&templates[i], s.location); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateTemplate создает новый шаблон с версией 1
+func (s *NotificationService) CreateTemplate(ctx context.Context, tmpl *models.NotificationTemplate) error {
+	tmpl.Locale = templateLocale(tmpl.Locale)
+	if _, err := parseTemplate(tmpl, time.UTC); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tmpl.ID = uuid.New().String()
+	tmpl.Version = 1
+	tmpl.IsActive = true
+	tmpl.CreatedAt = now
+	tmpl.UpdatedAt = now
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(tmpl).Error; err != nil {
+			return fmt.Errorf("failed to save notification template: %w", err)
+		}
+		return saveTemplateVersion(tx, tmpl)
+	})
+}
+
+// UpdateTemplate сохраняет новую версию шаблона. Если active равен nil,
+// шаблон сохраняет текущее значение IsActive. Шаблон без локали сохраняет
+// текущую локаль.
+func (s *NotificationService) UpdateTemplate(ctx context.Context, tmpl *models.NotificationTemplate, active *bool) error {
+	tmpl.Locale = i18n.Normalize(tmpl.Locale)
+	if _, err := parseTemplate(tmpl, time.UTC); err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var current models.NotificationTemplate
+		if err := tx.Where("id = ?", tmpl.ID).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTemplateNotFound
+			}
+			return fmt.Errorf("failed to get notification template: %w", err)
+		}
+
+		if tmpl.Locale == "" {
+			tmpl.Locale = current.Locale
+		}
+		tmpl.Version = current.Version + 1
+		tmpl.IsActive = current.IsActive
+		if active != nil {
+			tmpl.IsActive = *active
+		}
+		tmpl.CreatedAt = current.CreatedAt
+		tmpl.UpdatedAt = time.Now()
+
+		if err := tx.Save(tmpl).Error; err != nil {
+			return fmt.Errorf("failed to update notification template: %w", err)
+		}
+		return saveTemplateVersion(tx, tmpl)
+	})
+}
+
+// GetTemplate возвращает шаблон по идентификатору или имени. По имени
+// возвращается шаблон локали по умолчанию.
+func (s *NotificationService) GetTemplate(ctx context.Context, ref string) (*models.NotificationTemplate, error) {
+	var tmpl models.NotificationTemplate
+	err := s.db.WithContext(ctx).
+		Where("id = ? OR (name = ? AND locale = ?)", ref, ref, i18n.DefaultLocale).
+		First(&tmpl).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTemplateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification template: %w", err)
+	}
+	return &tmpl, nil
+}
+
+// FindTemplate возвращает активный шаблон с указанным именем для наиболее
+// подходящей локали из цепочки fallback: ru-RU -> ru -> en
+func (s *NotificationService) FindTemplate(ctx context.Context, name, locale string) (*models.NotificationTemplate, error) {
+	chain := i18n.Fallbacks(locale)
+
+	var templates []models.NotificationTemplate
+	err := s.db.WithContext(ctx).
+		Where("name = ? AND locale IN ? AND is_active = ?", name, chain, true).
+		Find(&templates).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find notification template: %w", err)
+	}
+
+	for _, l := range chain {
+		for i := range templates {
+			if templates[i].Locale == l {
+				return &templates[i], nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s (%s)", ErrTemplateNotFound, name, strings.Join(chain, ", "))
+}
+
+// ListTemplates возвращает все шаблоны
+func (s *NotificationService) ListTemplates(ctx context.Context) ([]models.NotificationTemplate, error) {
+	var templates []models.NotificationTemplate
+	if err := s.db.WithContext(ctx).Order("name, locale").Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to list notification templates: %w", err)
+	}
+	return templates, nil
+}
+
+// ListTemplateVersions возвращает историю версий шаблона
+func (s *NotificationService) ListTemplateVersions(ctx context.Context, templateID string) ([]models.NotificationTemplateVersion, error) {
+	var versions []models.NotificationTemplateVersion
+	err := s.db.WithContext(ctx).
+		Where("template_id = ?", templateID).
+		Order("version DESC").
+		Find(&versions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list template versions: %w", err)
+	}
+	return versions, nil
+}
+
+// DeleteTemplate деактивирует шаблон. История версий сохраняется.
+func (s *NotificationService) DeleteTemplate(ctx context.Context, templateID string) error {
+	result := s.db.WithContext(ctx).Model(&models.NotificationTemplate{}).
+		Where("id = ?", templateID).
+		Updates(map[string]interface{}{"is_active": false, "updated_at": time.Now()})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete notification template: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrTemplateNotFound
+	}
+
+	s.templatesMu.Lock()
+	for key := range s.templates {
+		if strings.HasPrefix(key, templateID+"@") {
+			delete(s.templates, key)
+		}
+	}
+	s.templatesMu.Unlock()
+
+	return nil
+}
+
+// RenderTemplate рендерит активный шаблон с переданными данными
+func (s *NotificationService) RenderTemplate(ctx context.Context, ref string, data map[string]interface{}) (*RenderedNotification, error) {
+	tmpl, err := s.GetTemplate(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if !tmpl.IsActive {
+		return nil, ErrTemplateNotFound
+	}
+
+	compiled, err := s.compileTemplate(tmpl, s.renderLocation(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return renderTemplate(tmpl, compiled, data)
+}
+
+// RenderLocalizedTemplate рендерит шаблон с указанным именем на языке
+// клиента. Суммы и даты форматируются по правилам выбранной локали.
+func (s *NotificationService) RenderLocalizedTemplate(ctx context.Context, name, locale string, data map[string]interface{}) (*RenderedNotification, error) {
+	tmpl, err := s.FindTemplate(ctx, name, locale)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled, err := s.compileTemplate(tmpl, s.renderLocation(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return renderTemplate(tmpl, compiled, data)
+}
+
+// PreviewTemplate рендерит шаблон без отправки. Если version больше нуля,
+// используется сохраненная версия шаблона.
+func (s *NotificationService) PreviewTemplate(ctx context.Context, templateID string, version int, data map[string]interface{}) (*RenderedNotification, error) {
+	tmpl, err := s.GetTemplate(ctx, templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	if version > 0 && version != tmpl.Version {
+		var snapshot models.NotificationTemplateVersion
+		err := s.db.WithContext(ctx).
+			Where("template_id = ? AND version = ?", tmpl.ID, version).
+			First(&snapshot).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get template version: %w", err)
+		}
+
+		tmpl.Version = snapshot.Version
+		// Версии, сохраненные до появления типа, используют тип шаблона
+		if snapshot.Type != "" {
+			tmpl.Type = snapshot.Type
+		}
+		tmpl.Subject = snapshot.Subject
+		tmpl.Content = snapshot.Content
+		tmpl.TextContent = snapshot.TextContent
+		tmpl.Variables = snapshot.Variables
+	}
+
+	compiled, err := parseTemplate(tmpl, s.renderLocation(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return renderTemplate(tmpl, compiled, data)
+}
+
+// ConfigureLocation задает зону, в которой шаблоны форматируют даты, если
+// зона получателя не передана. По умолчанию используется UTC.
+func (s *NotificationService) ConfigureLocation(loc *time.Location) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	s.location = loc
+}
+
+// renderLocation возвращает зону получателя из данных шаблона или зону
+// сервиса. Неизвестная зона не мешает отправке уведомления.
+func (s *NotificationService) renderLocation(data map[string]interface{}) *time.Location {
+	name, _ := data[TemplateTimezoneKey].(string)
+	if name == "" {
+		return s.location
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Ignoring invalid recipient timezone %q: %v", name, err)
+		return s.location
+	}
+	return loc
+}
+
+// templateCacheKey возвращает ключ кеша шаблона: функции форматирования
+// дат скомпилированы под конкретную зону
+func templateCacheKey(templateID string, loc *time.Location) string {
+	return templateID + "@" + loc.String()
+}
+
+// compileTemplate возвращает скомпилированный шаблон из кеша, перекомпилируя
+// его при смене версии
+func (s *NotificationService) compileTemplate(tmpl *models.NotificationTemplate, loc *time.Location) (*compiledTemplate, error) {
+	key := templateCacheKey(tmpl.ID, loc)
+
+	s.templatesMu.RLock()
+	compiled, ok := s.templates[key]
+	s.templatesMu.RUnlock()
+	if ok && compiled.version == tmpl.Version {
+		return compiled, nil
+	}
+
+	compiled, err := parseTemplate(tmpl, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	s.templatesMu.Lock()
+	s.templates[key] = compiled
+	s.templatesMu.Unlock()
+
+	return compiled, nil
+}
+
+// parseTemplate компилирует шаблон. Содержимое email рендерится через
+// html/template с экранированием, остальные каналы через text/template.
+func parseTemplate(tmpl *models.NotificationTemplate, loc *time.Location) (*compiledTemplate, error) {
+	funcs := templateFuncs(tmpl.Locale, loc)
+
+	subject, err := texttemplate.New(tmpl.Name + ":subject").Funcs(funcs).Parse(tmpl.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: subject: %v", ErrInvalidTemplate, err)
+	}
+
+	var content templateExecutor
+	if tmpl.Type == models.NotificationTypeEmail {
+		content, err = htmltemplate.New(tmpl.Name + ":content").Funcs(htmltemplate.FuncMap(funcs)).Parse(tmpl.Content)
+	} else {
+		content, err = texttemplate.New(tmpl.Name + ":content").Funcs(funcs).Parse(tmpl.Content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: content: %v", ErrInvalidTemplate, err)
+	}
+
+	compiled := &compiledTemplate{
+		version: tmpl.Version,
+		subject: subject,
+		content: content,
+	}
+
+	if tmpl.TextContent != "" {
+		compiled.text, err = texttemplate.New(tmpl.Name + ":text").Funcs(funcs).Parse(tmpl.TextContent)
+		if err != nil {
+			return nil, fmt.Errorf("%w: text content: %v", ErrInvalidTemplate, err)
+		}
+	}
+
+	return compiled, nil
+}
+
+// templateFuncs возвращает функции форматирования для локали шаблона:
+// {{money .amount .currency}}, {{number .value 2}}, {{date .created_at}}
+// и {{datetime .created_at}}. Даты принимаются как time.Time, строки
+// RFC3339 или Unix время и выводятся в зоне loc.
+func templateFuncs(locale string, loc *time.Location) texttemplate.FuncMap {
+	return texttemplate.FuncMap{
+		"money": func(amount float64, currency string) string {
+			return i18n.FormatMoney(amount, currency, locale)
+		},
+		"number": func(value float64, digits int) string {
+			return i18n.FormatNumber(value, digits, locale)
+		},
+		"date": func(value interface{}) (string, error) {
+			t, err := i18n.ParseTime(value, loc)
+			if err != nil {
+				return "", err
+			}
+			return i18n.FormatDate(t, locale, loc), nil
+		},
+		"datetime": func(value interface{}) (string, error) {
+			t, err := i18n.ParseTime(value, loc)
+			if err != nil {
+				return "", err
+			}
+			return i18n.FormatDateTime(t, locale, loc), nil
+		},
+	}
+}
+
+// templateLocale нормализует локаль шаблона, подставляя локаль по умолчанию
+func templateLocale(locale string) string {
+	if locale = i18n.Normalize(locale); locale == "" {
+		return i18n.DefaultLocale
+	}
+	return locale
+}
+
+// renderTemplate проверяет переменные и рендерит тему и содержимое
+func renderTemplate(tmpl *models.NotificationTemplate, compiled *compiledTemplate, data map[string]interface{}) (*RenderedNotification, error) {
+	values, err := templateData(tmpl.Variables, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var subject, content, text bytes.Buffer
+	if err := compiled.subject.Execute(&subject, values); err != nil {
+		return nil, fmt.Errorf("failed to render template subject: %w", err)
+	}
+	if err := compiled.content.Execute(&content, values); err != nil {
+		return nil, fmt.Errorf("failed to render template content: %w", err)
+	}
+	if compiled.text != nil {
+		if err := compiled.text.Execute(&text, values); err != nil {
+			return nil, fmt.Errorf("failed to render template text content: %w", err)
+		}
+	}
+
+	return &RenderedNotification{
+		TemplateID:    tmpl.ID,
+		TemplateName:  tmpl.Name,
+		Version:       tmpl.Version,
+		Locale:        tmpl.Locale,
+		Type:          tmpl.Type,
+		Subject:       strings.TrimSpace(subject.String()),
+		Content:       content.String(),
+		TextContent:   text.String(),
+		From:          tmpl.FromAddress,
+		ReplyTo:       tmpl.ReplyTo,
+		Transactional: tmpl.Transactional,
+	}, nil
+}
+
+// templateData проверяет наличие обязательных переменных и подставляет
+// пустые значения для необязательных
+func templateData(variables map[string]string, data map[string]interface{}) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(data)+len(variables))
+	for k, v := range data {
+		values[k] = v
+	}
+
+	var missing []string
+	for name, kind := range variables {
+		if _, ok := values[name]; ok {
+			continue
+		}
+		if kind == models.TemplateVariableOptional {
+			values[name] = ""
+			continue
+		}
+		missing = append(missing, name)
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("%w: %s", ErrMissingTemplateVariables, strings.Join(missing, ", "))
+	}
+
+	return values, nil
+}
+
+// saveTemplateVersion сохраняет снимок текущей версии шаблона
+func saveTemplateVersion(tx *gorm.DB, tmpl *models.NotificationTemplate) error {
+	version := &models.NotificationTemplateVersion{
+		ID:          uuid.New().String(),
+		TemplateID:  tmpl.ID,
+		Version:     tmpl.Version,
+		Type:        tmpl.Type,
+		Subject:     tmpl.Subject,
+		Content:     tmpl.Content,
+		TextContent: tmpl.TextContent,
+		Variables:   tmpl.Variables,
+		CreatedAt:   time.Now(),
+	}
+
+	if err := tx.Create(version).Error; err != nil {
+		return fmt.Errorf("failed to save template version: %w", err)
+	}
+	return nil
+}
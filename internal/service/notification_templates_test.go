@@ -0,0 +1,62 @@
+package service
+
+import (
+	"go_payment/internal/models"
+	"testing"
+	"time"
+)
+
+func TestRenderTemplateDatesInRecipientZone(t *testing.T) {
+	if _, err := time.LoadLocation("Asia/Tokyo"); err != nil {
+		t.Skipf("time zone database is not available: %v", err)
+	}
+	s := &NotificationService{templates: make(map[string]*compiledTemplate), location: time.UTC}
+	tmpl := &models.NotificationTemplate{
+		ID:      "t1",
+		Name:    "status",
+		Locale:  "en-GB",
+		Type:    models.NotificationTypeSMS,
+		Subject: "Order {{.order_id}}",
+		Content: "{{date .updated_at}} {{datetime .updated_at}}",
+		Version: 1,
+	}
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want string
+	}{
+		{"time in service zone", map[string]interface{}{"updated_at": time.Date(2024, 1, 31, 20, 0, 0, 0, time.UTC)}, "31 Jan 2024 31 Jan 2024, 20:00"},
+		{"string from json", map[string]interface{}{"updated_at": "2024-01-31T20:00:00Z"}, "31 Jan 2024 31 Jan 2024, 20:00"},
+		{"recipient zone", map[string]interface{}{"updated_at": "2024-01-31T20:00:00Z", TemplateTimezoneKey: "Asia/Tokyo"}, "1 Feb 2024 1 Feb 2024, 05:00"},
+		{"invalid recipient zone", map[string]interface{}{"updated_at": "2024-01-31T20:00:00Z", TemplateTimezoneKey: "Mars/Base"}, "31 Jan 2024 31 Jan 2024, 20:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compiled, err := s.compileTemplate(tmpl, s.renderLocation(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rendered, err := renderTemplate(tmpl, compiled, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rendered.Content != tt.want {
+				t.Errorf("content = %q, want %q", rendered.Content, tt.want)
+			}
+		})
+	}
+
+	if _, err := renderTemplate(tmpl, mustCompile(t, s, tmpl), map[string]interface{}{"updated_at": "yesterday"}); err == nil {
+		t.Error("invalid date must fail rendering")
+	}
+}
+
+func mustCompile(t *testing.T, s *NotificationService, tmpl *models.NotificationTemplate) *compiledTemplate {
+	t.Helper()
+	compiled, err := s.compileTemplate(tmpl, s.location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compiled
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go_payment/internal/models"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultNotificationListLimit = 50
+	maxNotificationListLimit     = 200
+	maxAttemptResponseLength     = 1024
+)
+
+// NotificationFilter задает условия выборки уведомлений
+type NotificationFilter struct {
+	Recipient string
+	UserID    string
+	Status    models.NotificationStatus
+	Type      models.NotificationType
+	From      *time.Time
+	To        *time.Time
+	Limit     int
+	Offset    int
+}
+
+// ListNotifications возвращает уведомления по фильтру, начиная с последних
+func (s *NotificationService) ListNotifications(ctx context.Context, filter NotificationFilter) ([]models.NotificationMessage, error) {
+	query := s.db.WithContext(ctx).Model(&models.NotificationMessage{})
+
+	if filter.Recipient != "" {
+		query = query.Where("recipient = ?", filter.Recipient)
+	}
+	if filter.UserID != "" {
+		query = query.Where("user_id = ?", filter.UserID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultNotificationListLimit
+	}
+	if limit > maxNotificationListLimit {
+		limit = maxNotificationListLimit
+	}
+
+	var notifications []models.NotificationMessage
+	err := query.Order("created_at DESC, id").Limit(limit).Offset(filter.Offset).Find(&notifications).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+// ListAttempts возвращает попытки отправки уведомления в порядке выполнения
+func (s *NotificationService) ListAttempts(ctx context.Context, notificationID string) ([]models.NotificationAttempt, error) {
+	var attempts []models.NotificationAttempt
+	err := s.db.WithContext(ctx).
+		Where("notification_id = ?", notificationID).
+		Order("attempt, created_at").
+		Find(&attempts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notification attempts: %w", err)
+	}
+	return attempts, nil
+}
+
+// recordAttempt сохраняет результат попытки отправки через канал уведомления.
+// Ошибка сохранения только логируется, чтобы не повторять уже выполненную отправку.
+func (s *NotificationService) recordAttempt(ctx context.Context, msg *models.NotificationMessage, start time.Time, sendErr error) {
+	attempt := &models.NotificationAttempt{
+		ID:             uuid.New().String(),
+		NotificationID: msg.ID,
+		Channel:        msg.Type,
+		Provider:       notificationProvider(msg.Type),
+		Status:         models.NotificationAttemptSucceeded,
+		DurationMs:     time.Since(start).Milliseconds(),
+		CreatedAt:      time.Now(),
+	}
+
+	if sendErr != nil {
+		attempt.Status = models.NotificationAttemptFailed
+		attempt.Error = sendErr.Error()
+	}
+
+	switch msg.Type {
+	case models.NotificationTypeSMS:
+		attempt.ProviderMessageID = msg.Metadata["sms_message_id"]
+	case models.NotificationTypePush:
+		if devices := msg.Metadata["push_devices"]; devices != "" {
+			attempt.Response = "delivered to " + devices + " device(s)"
+		}
+	case models.NotificationTypeWebhook:
+		if sendErr == nil {
+			attempt.Response = "queued for webhook delivery"
+		}
+	}
+
+	s.saveAttempt(ctx, attempt)
+}
+
+// recordDeviceAttempt сохраняет результат отправки push-уведомления на одно
+// устройство
+func (s *NotificationService) recordDeviceAttempt(ctx context.Context, msg *models.NotificationMessage, device *models.DeviceToken, start time.Time, sendErr error) {
+	attempt := &models.NotificationAttempt{
+		ID:             uuid.New().String(),
+		NotificationID: msg.ID,
+		Channel:        models.NotificationTypePush,
+		Provider:       notificationProvider(models.NotificationTypePush) + ":" + string(device.Platform),
+		DeviceID:       device.ID,
+		Status:         models.NotificationAttemptSucceeded,
+		DurationMs:     time.Since(start).Milliseconds(),
+		CreatedAt:      time.Now(),
+	}
+	if sendErr != nil {
+		attempt.Status = models.NotificationAttemptFailed
+		attempt.Error = sendErr.Error()
+	}
+	s.saveAttempt(ctx, attempt)
+}
+
+// pushDeliveredDevices возвращает устройства, уже получившие push-уведомление
+// в предыдущих попытках
+func (s *NotificationService) pushDeliveredDevices(ctx context.Context, notificationID string) (map[string]bool, error) {
+	var deviceIDs []string
+	err := s.db.WithContext(ctx).Model(&models.NotificationAttempt{}).
+		Where("notification_id = ? AND device_id <> '' AND status = ?", notificationID, models.NotificationAttemptSucceeded).
+		Pluck("device_id", &deviceIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load push attempts: %w", err)
+	}
+
+	sent := make(map[string]bool, len(deviceIDs))
+	for _, id := range deviceIDs {
+		sent[id] = true
+	}
+	return sent, nil
+}
+
+// saveAttempt сохраняет попытку с очередным порядковым номером
+func (s *NotificationService) saveAttempt(ctx context.Context, attempt *models.NotificationAttempt) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.NotificationAttempt{}).
+			Where("notification_id = ?", attempt.NotificationID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		attempt.Attempt = int(count) + 1
+		return tx.Create(attempt).Error
+	})
+	if err != nil {
+		log.Printf("Failed to save attempt of notification %s: %v", attempt.NotificationID, err)
+	}
+}
+
+// markSent переводит уведомление в статус sent. Уведомление, уже получившее
+// окончательный статус от провайдера, не изменяется.
+func (s *NotificationService) markSent(ctx context.Context, msg *models.NotificationMessage) error {
+	result := s.db.WithContext(ctx).Model(msg).
+		Where("status IN ?", []models.NotificationStatus{models.NotificationStatusPending, models.NotificationStatusScheduled}).
+		Select("status", "sent_at", "updated_at", "metadata").
+		Updates(msg)
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark notification as sent: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		return nil
+	}
+
+	// Уведомление могло быть опубликовано без сохранения в базе
+	if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(msg).Error; err != nil {
+		return fmt.Errorf("failed to save notification: %w", err)
+	}
+	return nil
+}
+
+// incrementRetryCount учитывает неудачную попытку, после которой сообщение
+// возвращается в очередь
+func (s *NotificationService) incrementRetryCount(ctx context.Context, msg *models.NotificationMessage) {
+	err := s.db.WithContext(ctx).Model(&models.NotificationMessage{}).
+		Where("id = ?", msg.ID).
+		Updates(map[string]interface{}{
+			"retry_count": gorm.Expr("retry_count + 1"),
+			"updated_at":  time.Now(),
+		}).Error
+	if err != nil {
+		log.Printf("Failed to update retry count of notification %s: %v", msg.ID, err)
+	}
+}
+
+// transitionStatus меняет статус уведомления, только если текущий статус
+// входит в from. Возвращает false, если переход не выполнен.
+func (s *NotificationService) transitionStatus(ctx context.Context, id string, to models.NotificationStatus, from ...models.NotificationStatus) (bool, error) {
+	result := s.db.WithContext(ctx).Model(&models.NotificationMessage{}).
+		Where("id = ? AND status IN ?", id, from).
+		Updates(map[string]interface{}{"status": to, "updated_at": time.Now()})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update notification status: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// handleWebhookDelivery учитывает результат доставки вебхука, отправленного
+// как уведомление. События платежей, не связанные с уведомлениями, пропускаются.
+func (s *NotificationService) handleWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) {
+	if _, err := s.GetNotification(ctx, delivery.EventID); err != nil {
+		return
+	}
+
+	attempt := &models.NotificationAttempt{
+		ID:             uuid.New().String(),
+		NotificationID: delivery.EventID,
+		Channel:        models.NotificationTypeWebhook,
+		Provider:       "webhook:" + delivery.EndpointID,
+		Status:         models.NotificationAttemptFailed,
+		Error:          delivery.Error,
+		DurationMs:     delivery.DurationMs,
+		CreatedAt:      delivery.CreatedAt,
+	}
+	if delivery.ResponseCode != 0 {
+		attempt.Response = truncate(fmt.Sprintf("%d %s", delivery.ResponseCode, delivery.ResponseBody), maxAttemptResponseLength)
+	}
+
+	var status models.NotificationStatus
+	switch delivery.Status {
+	case models.WebhookDeliverySucceeded:
+		attempt.Status = models.NotificationAttemptSucceeded
+		status = models.NotificationStatusDelivered
+	case models.WebhookDeliveryFailed:
+		status = models.NotificationStatusFailed
+	}
+
+	s.saveAttempt(ctx, attempt)
+
+	if status == "" {
+		// Доставка будет повторена
+		return
+	}
+
+	_, err := s.transitionStatus(ctx, delivery.EventID, status,
+		models.NotificationStatusPending, models.NotificationStatusSent)
+	if err != nil {
+		log.Printf("Failed to update webhook notification %s: %v", delivery.EventID, err)
+	}
+}
+
+// notificationProvider возвращает имя провайдера канала для журнала попыток
+func notificationProvider(channel models.NotificationType) string {
+	switch channel {
+	case models.NotificationTypeEmail:
+		return "smtp"
+	case models.NotificationTypeSMS:
+		return "sms_gateway"
+	case models.NotificationTypePush:
+		return "push"
+	case models.NotificationTypeWebhook:
+		return "webhook"
+	default:
+		return string(channel)
+	}
+}
+
+// truncate обрезает строку до указанной длины
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
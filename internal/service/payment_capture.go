@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"go_payment/internal/models"
+	"go_payment/internal/payment"
+	"log"
+	"time"
+)
+
+// CapturePayment списывает авторизованную сумму платежа с ручным списанием.
+// Нулевая сумма означает списание всей авторизованной суммы, остаток
+// авторизации освобождается провайдером.
+func (s *PaymentService) CapturePayment(ctx context.Context, p *models.Payment, amount float64) error {
+	if p.Status != models.PaymentStatusAuthorized {
+		return fmt.Errorf("%w: cannot capture %s payment", ErrInvalidPaymentState, p.Status)
+	}
+	if amount == 0 {
+		amount = p.Amount
+	}
+	if amount < 0 || amount > p.Amount {
+		return fmt.Errorf("%w: capture amount must not exceed %.2f", ErrInvalidAmount, p.Amount)
+	}
+
+	capturer, err := s.capturer(p.ProviderType)
+	if err != nil {
+		return err
+	}
+
+	resp, err := capturer.CapturePayment(ctx, p.TransactionID, amount, p.Currency)
+	if err != nil {
+		return fmt.Errorf("%w: failed to capture payment: %w", ErrProviderFailed, err)
+	}
+
+	oldStatus := p.Status
+	p.TransactionID = resp.TransactionID
+	p.Status = resp.Status
+	if p.PaymentDetails == nil {
+		p.PaymentDetails = make(models.JSON)
+	}
+	for k, v := range resp.PaymentDetails {
+		p.PaymentDetails[k] = v
+	}
+	if p.Status == models.PaymentStatusCompleted {
+		now := time.Now()
+		p.CapturedAmount = amount
+		p.CompletedAt = &now
+	}
+	p.UpdatedAt = time.Now()
+
+	if err := s.db.WithContext(ctx).Save(p).Error; err != nil {
+		return fmt.Errorf("failed to save payment: %w", err)
+	}
+	s.statusChanged(ctx, p, oldStatus)
+	return nil
+}
+
+// VoidPayment отменяет авторизацию платежа с ручным списанием
+func (s *PaymentService) VoidPayment(ctx context.Context, p *models.Payment) error {
+	if p.Status != models.PaymentStatusAuthorized {
+		return fmt.Errorf("%w: cannot void %s payment", ErrInvalidPaymentState, p.Status)
+	}
+
+	capturer, err := s.capturer(p.ProviderType)
+	if err != nil {
+		return err
+	}
+
+	if err := capturer.VoidPayment(ctx, p.TransactionID); err != nil {
+		return fmt.Errorf("%w: failed to void payment: %w", ErrProviderFailed, err)
+	}
+
+	oldStatus := p.Status
+	p.Status = models.PaymentStatusCancelled
+	p.UpdatedAt = time.Now()
+
+	if err := s.db.WithContext(ctx).Save(p).Error; err != nil {
+		return fmt.Errorf("failed to save payment: %w", err)
+	}
+	s.statusChanged(ctx, p, oldStatus)
+	return nil
+}
+
+// provider возвращает инициализированного провайдера
+func (s *PaymentService) provider(providerType payment.ProviderType) (payment.Provider, error) {
+	provider, exists := s.providers[providerType]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedProvider, providerType)
+	}
+	return provider, nil
+}
+
+// capturer возвращает провайдера с поддержкой двухэтапных платежей
+func (s *PaymentService) capturer(providerType payment.ProviderType) (payment.Capturer, error) {
+	provider, err := s.provider(providerType)
+	if err != nil {
+		return nil, err
+	}
+	capturer, ok := provider.(payment.Capturer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrCaptureNotSupported, providerType)
+	}
+	return capturer, nil
+}
+
+// supportsCapture проверяет поддержку двухэтапных платежей провайдером
+func supportsCapture(provider payment.Provider) bool {
+	_, ok := provider.(payment.Capturer)
+	return ok
+}
+
+// refundableAmountExpr вычисляет в SQL сумму, доступную для возврата, так же,
+// как refundableAmount
+const refundableAmountExpr = "ROUND((COALESCE(NULLIF(captured_amount, 0), amount) - refunded_amount)::numeric, ?)"
+
+// refundableAmount возвращает сумму, доступную для возврата, округленную до
+// минимальных единиц валюты. Платежи, списанные до учета списанной суммы,
+// возвращаются в пределах Amount.
+func refundableAmount(p *models.Payment) float64 {
+	captured := p.CapturedAmount
+	if captured == 0 {
+		captured = p.Amount
+	}
+	return roundAmount(captured-p.RefundedAmount, p.Currency)
+}
+
+// statusChanged публикует изменение статуса, сохраненное вызовом API, тем же
+// сообщением, что и изменения из вебхуков провайдеров. Обработчик сообщения
+// записывает событие в историю, выпускает квитанцию, уведомляет клиента и
+// отправляет вебхук. Статус уже сохранен, поэтому ошибка только логируется.
+func (s *PaymentService) statusChanged(ctx context.Context, p *models.Payment, oldStatus models.PaymentStatus) {
+	if s.asyncService == nil || oldStatus == p.Status {
+		return
+	}
+	if err := s.asyncService.UpdatePaymentStatusAsync(ctx, p.OrderID, oldStatus, p.Status); err != nil {
+		log.Printf("Failed to publish status update for order %s: %v", p.OrderID, err)
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"errors"
+	"go_payment/internal/models"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestRefundableAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		payment  models.Payment
+		refunds  []float64
+		expected float64
+	}{
+		{name: "nothing refunded", payment: models.Payment{Amount: 10.10, Currency: "EUR"}, expected: 10.10},
+		{name: "captured amount limits refunds", payment: models.Payment{Amount: 20, CapturedAmount: 15, Currency: "EUR"}, refunds: []float64{5}, expected: 10},
+		{name: "float residue is rounded away", payment: models.Payment{Amount: 10.10, Currency: "EUR"}, refunds: []float64{10.00, 0.10}, expected: 0},
+		{name: "thirds", payment: models.Payment{Amount: 1, Currency: "USD"}, refunds: []float64{0.33, 0.33, 0.34}, expected: 0},
+		{name: "zero decimal currency", payment: models.Payment{Amount: 1000, Currency: "JPY"}, refunds: []float64{999.6}, expected: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.payment
+			for _, amount := range tt.refunds {
+				p.RefundedAmount += amount
+			}
+			if got := refundableAmount(&p); got != tt.expected {
+				t.Errorf("refundableAmount() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestReserveRefundChecksRemainingInSQL(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+
+	var sql string
+	err = db.Callback().Update().After("gorm:update").Register("test:capture_sql", func(tx *gorm.DB) {
+		sql = tx.Statement.SQL.String()
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	p := &models.Payment{ID: "pay_1", OrderID: "order-1", Currency: "EUR"}
+	err = reserveRefund(db, p, 5)
+	// Запрос не выполняется, поэтому резерв не находит строку
+	if !errors.Is(err, ErrInvalidAmount) {
+		t.Fatalf("reserveRefund() error = %v, want %v", err, ErrInvalidAmount)
+	}
+
+	for _, want := range []string{
+		`SET "refunded_amount"=refunded_amount + $`,
+		"ROUND((COALESCE(NULLIF(captured_amount, 0), amount) - refunded_amount)::numeric, $",
+		") >= $",
+		"status IN ($",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("query %q does not contain %q", sql, want)
+		}
+	}
+}
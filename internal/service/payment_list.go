@@ -0,0 +1,259 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_payment/internal/models"
+	"go_payment/internal/payment"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPaymentPageSize = 50
+	maxPaymentPageSize     = 500
+	// paymentCountLimit ограничивает точный подсчет, дальше возвращается оценка
+	paymentCountLimit = 10000
+	paymentsTable     = "payments"
+)
+
+var (
+	// ErrInvalidPageToken возвращается для поврежденного курсора или курсора,
+	// выданного для других условий выборки
+	ErrInvalidPageToken = errors.New("invalid page token")
+	// ErrInvalidPaymentFilter возвращается для противоречивых условий выборки
+	ErrInvalidPaymentFilter = errors.New("invalid payment filter")
+)
+
+// PaymentFilter задает условия выборки платежей. Нулевые значения не
+// ограничивают выборку, From включается в период, To нет.
+type PaymentFilter struct {
+	Status        models.PaymentStatus
+	Provider      payment.ProviderType
+	CustomerID    string
+	Currency      string
+	From          *time.Time
+	To            *time.Time
+	MinAmount     *float64
+	MaxAmount     *float64
+	MetadataKey   string
+	MetadataValue string
+	PageSize      int
+	PageToken     string
+}
+
+// PaymentPage представляет страницу платежей. Если TotalCountEstimated,
+// TotalCount является оценкой планировщика или нижней границей.
+type PaymentPage struct {
+	Payments            []models.Payment `json:"payments"`
+	NextPageToken       string           `json:"next_page_token,omitempty"`
+	TotalCount          int64            `json:"total_count"`
+	TotalCountEstimated bool             `json:"total_count_estimated"`
+}
+
+// paymentCursor указывает на последний платеж страницы. Filter содержит
+// хэш условий выборки, для которых выдан курсор.
+type paymentCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+	Filter    string    `json:"f"`
+}
+
+// ListPayments возвращает платежи от новых к старым с пагинацией по курсору.
+// Порядок (created_at, id) стабилен, поэтому новые платежи не сдвигают
+// следующие страницы.
+func (s *PaymentService) ListPayments(ctx context.Context, filter PaymentFilter) (*PaymentPage, error) {
+	if err := validatePaymentFilter(filter); err != nil {
+		return nil, err
+	}
+
+	pageSize := filter.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPaymentPageSize
+	}
+	if pageSize > maxPaymentPageSize {
+		pageSize = maxPaymentPageSize
+	}
+
+	filterHash := paymentFilterHash(filter)
+	query := applyPaymentFilter(s.db.WithContext(ctx).Model(&models.Payment{}), filter)
+
+	cursor, err := parsePageToken(filter.PageToken, filterHash)
+	if err != nil {
+		return nil, err
+	}
+
+	// Лишняя запись показывает, что есть следующая страница
+	var payments []models.Payment
+	err = paymentPageQuery(query, cursor, pageSize).Find(&payments).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list payments: %w", err)
+	}
+
+	page := newPaymentPage(payments, pageSize, filterHash)
+	if page.TotalCount, page.TotalCountEstimated, err = s.countPayments(ctx, filter); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// parsePageToken разбирает токен страницы. Пустой токен означает первую
+// страницу, курсор другой выборки отклоняется.
+func parsePageToken(token, filterHash string) (*paymentCursor, error) {
+	if token == "" {
+		return nil, nil
+	}
+	cursor, err := decodePaymentCursor(token)
+	if err != nil || cursor.Filter != filterHash {
+		return nil, ErrInvalidPageToken
+	}
+	return cursor, nil
+}
+
+// paymentPageQuery ограничивает запрос платежами после курсора. Сравнение
+// пары (created_at, id) не пропускает платежи с тем же created_at, что и
+// последний платеж предыдущей страницы.
+func paymentPageQuery(query *gorm.DB, cursor *paymentCursor, pageSize int) *gorm.DB {
+	if cursor != nil {
+		query = query.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+	}
+	return query.Order("created_at DESC, id DESC").Limit(pageSize + 1)
+}
+
+// newPaymentPage формирует страницу из pageSize+1 выбранных платежей и
+// курсор следующей страницы, если лишняя запись была выбрана
+func newPaymentPage(payments []models.Payment, pageSize int, filterHash string) *PaymentPage {
+	page := &PaymentPage{Payments: payments}
+	if len(payments) > pageSize {
+		page.Payments = payments[:pageSize]
+		last := page.Payments[pageSize-1]
+		page.NextPageToken = encodePaymentCursor(paymentCursor{
+			CreatedAt: last.CreatedAt,
+			ID:        last.ID,
+			Filter:    filterHash,
+		})
+	}
+	return page
+}
+
+// countPayments считает платежи по фильтру. Без фильтров используется
+// статистика таблицы, с фильтрами подсчет ограничен paymentCountLimit.
+func (s *PaymentService) countPayments(ctx context.Context, filter PaymentFilter) (int64, bool, error) {
+	db := s.db.WithContext(ctx)
+
+	if isEmptyPaymentFilter(filter) {
+		var estimate int64
+		err := db.Raw("SELECT reltuples::bigint FROM pg_class WHERE relname = ?", paymentsTable).
+			Scan(&estimate).Error
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to estimate payment count: %w", err)
+		}
+		// Для таблиц, которые еще не анализировались, статистики нет
+		if estimate > paymentCountLimit {
+			return estimate, true, nil
+		}
+	}
+
+	var count int64
+	limited := applyPaymentFilter(db.Model(&models.Payment{}), filter).Select("1").Limit(paymentCountLimit + 1)
+	if err := db.Table("(?) AS limited", limited).Count(&count).Error; err != nil {
+		return 0, false, fmt.Errorf("failed to count payments: %w", err)
+	}
+	if count > paymentCountLimit {
+		return paymentCountLimit, true, nil
+	}
+	return count, false, nil
+}
+
+// applyPaymentFilter добавляет условия выборки к запросу
+func applyPaymentFilter(query *gorm.DB, filter PaymentFilter) *gorm.DB {
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Provider != "" {
+		query = query.Where("provider_type = ?", filter.Provider)
+	}
+	if filter.CustomerID != "" {
+		query = query.Where("customer_id = ?", filter.CustomerID)
+	}
+	if filter.Currency != "" {
+		query = query.Where("currency = ?", filter.Currency)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	if filter.MinAmount != nil {
+		query = query.Where("amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where("amount <= ?", *filter.MaxAmount)
+	}
+	if filter.MetadataKey != "" {
+		if filter.MetadataValue != "" {
+			query = query.Where("metadata::jsonb ->> ? = ?", filter.MetadataKey, filter.MetadataValue)
+		} else {
+			query = query.Where("jsonb_exists(metadata::jsonb, ?)", filter.MetadataKey)
+		}
+	}
+	return query
+}
+
+// validatePaymentFilter проверяет согласованность условий выборки
+func validatePaymentFilter(filter PaymentFilter) error {
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return fmt.Errorf("%w: start date must be before end date", ErrInvalidPaymentFilter)
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return fmt.Errorf("%w: min amount must not exceed max amount", ErrInvalidPaymentFilter)
+	}
+	if filter.MetadataValue != "" && filter.MetadataKey == "" {
+		return fmt.Errorf("%w: metadata value requires metadata key", ErrInvalidPaymentFilter)
+	}
+	if filter.PageSize < 0 {
+		return fmt.Errorf("%w: page size must not be negative", ErrInvalidPaymentFilter)
+	}
+	return nil
+}
+
+// isEmptyPaymentFilter проверяет, что выборка не ограничена условиями
+func isEmptyPaymentFilter(filter PaymentFilter) bool {
+	filter.PageSize, filter.PageToken = 0, ""
+	return paymentFilterHash(filter) == paymentFilterHash(PaymentFilter{})
+}
+
+// paymentFilterHash вычисляет хэш условий выборки без параметров страницы
+func paymentFilterHash(filter PaymentFilter) string {
+	filter.PageSize, filter.PageToken = 0, ""
+	data, _ := json.Marshal(filter)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// encodePaymentCursor кодирует курсор в непрозрачный токен страницы
+func encodePaymentCursor(cursor paymentCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodePaymentCursor разбирает токен страницы
+func decodePaymentCursor(token string) (*paymentCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var cursor paymentCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
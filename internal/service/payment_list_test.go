@@ -0,0 +1,186 @@
+package service
+
+import (
+	"errors"
+	"go_payment/internal/models"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestPaymentCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2026, 3, 14, 9, 26, 53, 589793000, time.UTC)
+	tests := []struct {
+		name   string
+		cursor paymentCursor
+	}{
+		{name: "full cursor", cursor: paymentCursor{CreatedAt: createdAt, ID: "pay_1", Filter: "0011223344556677"}},
+		{name: "empty filter hash", cursor: paymentCursor{CreatedAt: createdAt, ID: "pay_2"}},
+		{name: "zero time", cursor: paymentCursor{ID: "pay_3", Filter: "ffffffffffffffff"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := encodePaymentCursor(tt.cursor)
+			if strings.ContainsAny(token, "+/=") {
+				t.Fatalf("token %q is not URL safe", token)
+			}
+			got, err := decodePaymentCursor(token)
+			if err != nil {
+				t.Fatalf("decodePaymentCursor() error = %v", err)
+			}
+			if !got.CreatedAt.Equal(tt.cursor.CreatedAt) || got.ID != tt.cursor.ID || got.Filter != tt.cursor.Filter {
+				t.Errorf("decodePaymentCursor() = %+v, want %+v", *got, tt.cursor)
+			}
+		})
+	}
+}
+
+func TestParsePageToken(t *testing.T) {
+	filter := PaymentFilter{Status: models.PaymentStatusCompleted, Currency: "EUR"}
+	hash := paymentFilterHash(filter)
+	valid := encodePaymentCursor(paymentCursor{CreatedAt: time.Now().UTC(), ID: "pay_1", Filter: hash})
+
+	other := filter
+	other.Currency = "USD"
+	foreign := encodePaymentCursor(paymentCursor{CreatedAt: time.Now().UTC(), ID: "pay_1", Filter: paymentFilterHash(other)})
+
+	tests := []struct {
+		name       string
+		token      string
+		wantCursor bool
+		wantErr    error
+	}{
+		{name: "first page", token: ""},
+		{name: "cursor of the same filter", token: valid, wantCursor: true},
+		{name: "cursor of another filter", token: foreign, wantErr: ErrInvalidPageToken},
+		{name: "not base64", token: "%%%", wantErr: ErrInvalidPageToken},
+		{name: "not json", token: "bm90IGpzb24", wantErr: ErrInvalidPageToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor, err := parsePageToken(tt.token, hash)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parsePageToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if (cursor != nil) != tt.wantCursor {
+				t.Errorf("parsePageToken() cursor = %+v, want cursor %v", cursor, tt.wantCursor)
+			}
+		})
+	}
+}
+
+func TestPaymentFilterHashIgnoresPaging(t *testing.T) {
+	filter := PaymentFilter{CustomerID: "cus_1"}
+	paged := filter
+	paged.PageSize = 10
+	paged.PageToken = "token"
+
+	if paymentFilterHash(filter) != paymentFilterHash(paged) {
+		t.Error("page size and token must not change the filter hash")
+	}
+
+	filter.CustomerID = "cus_2"
+	if paymentFilterHash(filter) == paymentFilterHash(paged) {
+		t.Error("different conditions must change the filter hash")
+	}
+}
+
+func TestPaymentPageQueryUsesKeyset(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+
+	createdAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cursor := &paymentCursor{CreatedAt: createdAt, ID: "pay_5"}
+	var rows []map[string]interface{}
+	stmt := paymentPageQuery(db.Table(paymentsTable), cursor, 2).Find(&rows).Statement
+
+	sql := stmt.SQL.String()
+	for _, want := range []string{"(created_at, id) < ($1, $2)", "ORDER BY created_at DESC, id DESC", "LIMIT 3"} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("query %q does not contain %q", sql, want)
+		}
+	}
+	if len(stmt.Vars) != 2 || stmt.Vars[0] != createdAt || stmt.Vars[1] != "pay_5" {
+		t.Errorf("query vars = %v, want [%v pay_5]", stmt.Vars, createdAt)
+	}
+}
+
+// TestPaymentPagesWithEqualCreatedAt листает платежи с одинаковым created_at
+// так же, как это делает запрос с условием (created_at, id) < (?, ?).
+func TestPaymentPagesWithEqualCreatedAt(t *testing.T) {
+	same := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	var all []models.Payment
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		p := models.Payment{ID: id}
+		p.CreatedAt = same
+		all = append(all, p)
+	}
+	older := models.Payment{ID: "z"}
+	older.CreatedAt = same.Add(-time.Second)
+	all = append(all, older)
+
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].CreatedAt.Equal(all[j].CreatedAt) {
+			return all[i].CreatedAt.After(all[j].CreatedAt)
+		}
+		return all[i].ID > all[j].ID
+	})
+
+	const pageSize = 2
+	hash := paymentFilterHash(PaymentFilter{})
+	var seen []string
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > len(all) {
+			t.Fatal("pagination does not terminate")
+		}
+		cursor, err := parsePageToken(token, hash)
+		if err != nil {
+			t.Fatalf("parsePageToken() error = %v", err)
+		}
+
+		var rows []models.Payment
+		for _, p := range all {
+			if cursor != nil && !paymentBeforeCursor(p, cursor) {
+				continue
+			}
+			if len(rows) == pageSize+1 {
+				break
+			}
+			rows = append(rows, p)
+		}
+
+		page := newPaymentPage(rows, pageSize, hash)
+		for _, p := range page.Payments {
+			seen = append(seen, p.ID)
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		token = page.NextPageToken
+	}
+
+	want := "e,d,c,b,a,z"
+	if got := strings.Join(seen, ","); got != want {
+		t.Errorf("paged ids = %s, want %s", got, want)
+	}
+}
+
+// paymentBeforeCursor повторяет сравнение (created_at, id) < (?, ?)
+func paymentBeforeCursor(p models.Payment, cursor *paymentCursor) bool {
+	if !p.CreatedAt.Equal(cursor.CreatedAt) {
+		return p.CreatedAt.Before(cursor.CreatedAt)
+	}
+	return p.ID < cursor.ID
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_payment/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrRefundNotFound возвращается, если возврат с указанным идентификатором не найден
+var ErrRefundNotFound = errors.New("refund not found")
+
+// ListRefunds возвращает возвраты платежа в порядке создания
+func (s *PaymentService) ListRefunds(ctx context.Context, orderID string) ([]models.Refund, error) {
+	if _, err := s.GetPayment(orderID); err != nil {
+		return nil, err
+	}
+
+	var refunds []models.Refund
+	err := s.db.WithContext(ctx).
+		Where("order_id = ?", orderID).
+		Order("created_at, id").
+		Find(&refunds).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refunds: %w", err)
+	}
+	return refunds, nil
+}
+
+// GetRefund возвращает возврат по идентификатору
+func (s *PaymentService) GetRefund(ctx context.Context, refundID string) (*models.Refund, error) {
+	var refund models.Refund
+	err := s.db.WithContext(ctx).Where("id = ?", refundID).First(&refund).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRefundNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refund: %w", err)
+	}
+	return &refund, nil
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"fmt"
+	"go_payment/internal/config"
+	"go_payment/internal/models"
+	"go_payment/internal/payment"
+)
+
+// ConfigureRuntime включает маршрутизацию, лимиты риска и флаги функций
+// из секции runtime. Настройки читаются при каждой операции, поэтому
+// перезагрузка конфигурации применяется к следующему платежу.
+func (s *PaymentService) ConfigureRuntime(runtime *config.RuntimeStore) {
+	s.runtime = runtime
+}
+
+// applyRuntime выбирает провайдера и способ списания платежа по
+// действующим runtime настройкам
+func (s *PaymentService) applyRuntime(p *models.Payment) error {
+	if s.runtime == nil {
+		if p.ProviderType == "" {
+			return fmt.Errorf("%w: provider is required", ErrUnsupportedProvider)
+		}
+		return nil
+	}
+	runtime := s.runtime.Current()
+
+	if p.ProviderType == "" {
+		p.ProviderType = payment.ProviderType(runtime.Route(p.Currency, p.Amount))
+		if p.ProviderType == "" {
+			return fmt.Errorf("%w: no routing rule matches %.2f %s", ErrUnsupportedProvider, p.Amount, p.Currency)
+		}
+	}
+
+	if p.CaptureMethod == models.CaptureMethodManual && !runtime.FeatureEnabled(config.FeatureManualCapture) {
+		return fmt.Errorf("%w: manual capture", ErrFeatureDisabled)
+	}
+
+	if limit, ok := runtime.RiskLimit(p.Currency); ok {
+		if limit.MaxAmount > 0 && p.Amount > limit.MaxAmount {
+			return fmt.Errorf("%w: amount exceeds %.2f %s", ErrRiskRejected, limit.MaxAmount, p.Currency)
+		}
+		// Крупный платеж только авторизуется, списание после проверки
+		if limit.ReviewAmount > 0 && p.Amount >= limit.ReviewAmount {
+			p.CaptureMethod = models.CaptureMethodManual
+		}
+	}
+	return nil
+}
+
+// featureEnabled сообщает, включен ли флаг функции. Без runtime настроек
+// все функции включены.
+func (s *PaymentService) featureEnabled(name string) bool {
+	if s.runtime == nil {
+		return true
+	}
+	return s.runtime.Current().FeatureEnabled(name)
+}
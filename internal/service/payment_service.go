@@ -2,25 +2,54 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go_payment/internal/config"
+	"go_payment/internal/i18n"
 	"go_payment/internal/models"
 	"go_payment/internal/payment"
+	"log"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrPaymentNotFound возвращается, если платеж с указанным заказом не найден
+	ErrPaymentNotFound = errors.New("payment not found")
+	// ErrInvalidPaymentState возвращается, если операция недопустима в
+	// текущем статусе платежа
+	ErrInvalidPaymentState = errors.New("invalid payment state")
+	// ErrInvalidAmount возвращается для суммы, превышающей доступную
+	ErrInvalidAmount = errors.New("invalid amount")
+	// ErrUnsupportedProvider возвращается для неинициализированного провайдера
+	ErrUnsupportedProvider = errors.New("unsupported payment provider")
+	// ErrCaptureNotSupported возвращается, если провайдер не поддерживает
+	// двухэтапные платежи
+	ErrCaptureNotSupported = errors.New("provider does not support manual capture")
+	// ErrProviderFailed оборачивает ошибки API платежного провайдера
+	ErrProviderFailed = errors.New("payment provider request failed")
+	// ErrFeatureDisabled возвращается для операции, отключенной флагом
+	// секции runtime.features
+	ErrFeatureDisabled = errors.New("feature is disabled")
+	// ErrRiskRejected возвращается для платежа сверх лимита суммы валюты
+	ErrRiskRejected = errors.New("payment rejected by risk limits")
+)
+
 // PaymentService представляет сервис для работы с платежами
 type PaymentService struct {
 	db              *gorm.DB
 	asyncService    *AsyncService
+	receipts        *ReceiptService
 	providerFactory *payment.ProviderFactory
 	providers       map[payment.ProviderType]payment.Provider
+	runtime         *config.RuntimeStore
 }
 
 // NewPaymentService создает новый экземпляр сервиса платежей
-func NewPaymentService(db *gorm.DB, asyncService *AsyncService) *PaymentService {
+func NewPaymentService(db *gorm.DB, asyncService *AsyncService, receipts *ReceiptService) *PaymentService {
 	factory := payment.NewProviderFactory()
 	
 	// Регистрируем поддерживаемые провайдеры
@@ -30,6 +59,7 @@ func NewPaymentService(db *gorm.DB, asyncService *AsyncService) *PaymentService
 	return &PaymentService{
 		db:              db,
 		asyncService:    asyncService,
+		receipts:        receipts,
 		providerFactory: factory,
 		providers:       make(map[payment.ProviderType]payment.Provider),
 	}
@@ -48,81 +78,174 @@ func (s *PaymentService) InitializeProviders(config map[payment.ProviderType]map
 }
 
 // ProcessPayment обрабатывает платеж
-func (s *PaymentService) ProcessPayment(ctx context.Context, payment *models.Payment) error {
+func (s *PaymentService) ProcessPayment(ctx context.Context, p *models.Payment) error {
+	if err := s.applyRuntime(p); err != nil {
+		return err
+	}
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+
 	// Получаем провайдера для платежа
-	provider, exists := s.providers[payment.ProviderType]
-	if !exists {
-		return fmt.Errorf("unsupported payment provider: %s", payment.ProviderType)
+	provider, err := s.provider(p.ProviderType)
+	if err != nil {
+		return err
+	}
+	if p.CaptureMethod == "" {
+		p.CaptureMethod = models.CaptureMethodAutomatic
+	}
+	if p.CaptureMethod == models.CaptureMethodManual && !supportsCapture(provider) {
+		return fmt.Errorf("%w: %s", ErrCaptureNotSupported, p.ProviderType)
 	}
 
 	// Создаем запрос к провайдеру
 	req := payment.PaymentRequest{
-		OrderID:       payment.OrderID,
-		Amount:        payment.Amount,
-		Currency:      payment.Currency,
-		CustomerID:    payment.CustomerID,
-		CustomerEmail: payment.CustomerEmail,
-		Description:   payment.Description,
-		MetaData:      payment.Metadata,
+		OrderID:       p.OrderID,
+		Amount:        p.Amount,
+		Currency:      p.Currency,
+		CustomerID:    p.CustomerID,
+		CustomerEmail: p.CustomerEmail,
+		Description:   p.Description,
+		MetaData:      p.Metadata,
+		CaptureManually: p.CaptureMethod == models.CaptureMethodManual,
 	}
 
 	// Обрабатываем платеж через провайдера
 	resp, err := provider.ProcessPayment(ctx, req)
 	if err != nil {
-		payment.Status = models.PaymentStatusFailed
-		payment.ErrorMessage = err.Error()
-		s.db.Save(payment)
-		return fmt.Errorf("failed to process payment: %w", err)
+		p.Status = models.PaymentStatusFailed
+		p.ErrorMessage = err.Error()
+		s.db.Save(p)
+		return fmt.Errorf("%w: failed to process payment: %w", ErrProviderFailed, err)
 	}
 
 	// Обновляем информацию о платеже
-	payment.TransactionID = resp.TransactionID
-	payment.Status = resp.Status
-	payment.PaymentDetails = resp.PaymentDetails
-	payment.UpdatedAt = time.Now()
+	p.TransactionID = resp.TransactionID
+	p.Status = resp.Status
+	p.PaymentDetails = resp.PaymentDetails
+	p.UpdatedAt = time.Now()
+	if p.Status == models.PaymentStatusCompleted {
+		p.CapturedAmount = p.Amount
+	}
 
-	if err := s.db.Save(payment).Error; err != nil {
+	if err := s.db.Save(p).Error; err != nil {
 		return fmt.Errorf("failed to save payment: %w", err)
 	}
+	s.statusChanged(ctx, p, models.PaymentStatusPending)
 
 	return nil
 }
 
-// RefundPayment выполняет возврат платежа
-func (s *PaymentService) RefundPayment(ctx context.Context, payment *models.Payment, amount float64) error {
-	provider, exists := s.providers[payment.ProviderType]
-	if !exists {
-		return fmt.Errorf("unsupported payment provider: %s", payment.ProviderType)
+// RefundPayment выполняет полный или частичный возврат списанного платежа.
+// Нулевая сумма означает возврат всего остатка.
+func (s *PaymentService) RefundPayment(ctx context.Context, payment *models.Payment, amount float64, reason string) (*models.Refund, error) {
+	if payment.Status != models.PaymentStatusCompleted && payment.Status != models.PaymentStatusPartiallyRefunded {
+		return nil, fmt.Errorf("%w: cannot refund %s payment", ErrInvalidPaymentState, payment.Status)
+	}
+
+	remaining := refundableAmount(payment)
+	if amount == 0 {
+		amount = remaining
+	}
+	amount = roundAmount(amount, payment.Currency)
+	if amount <= 0 || amount > remaining {
+		return nil, fmt.Errorf("%w: refund amount must not exceed %.2f", ErrInvalidAmount, remaining)
+	}
+	if amount < remaining && !s.featureEnabled(config.FeaturePartialRefunds) {
+		return nil, fmt.Errorf("%w: partial refunds", ErrFeatureDisabled)
+	}
+
+	provider, err := s.provider(payment.ProviderType)
+	if err != nil {
+		return nil, err
+	}
+
+	// Сумма резервируется до запроса к провайдеру: параллельный возврат
+	// увидит уменьшенный остаток и не превысит списанную сумму
+	db := s.db.WithContext(ctx)
+	if err := reserveRefund(db, payment, amount); err != nil {
+		return nil, err
 	}
 
 	if err := provider.RefundPayment(ctx, payment.TransactionID, amount); err != nil {
-		return fmt.Errorf("failed to refund payment: %w", err)
+		if releaseErr := releaseRefund(db, payment, amount); releaseErr != nil {
+			log.Printf("Failed to release refund reservation of order %s: %v", payment.OrderID, releaseErr)
+		}
+		return nil, fmt.Errorf("%w: failed to refund payment: %w", ErrProviderFailed, err)
 	}
 
 	// Создаем запись о возврате
 	refund := &models.Refund{
-		ID:            uuid.New().String(),
-		PaymentID:     payment.ID,
-		Amount:        amount,
-		Currency:      payment.Currency,
-		Status:        models.RefundStatusCompleted,
-		RefundedAt:    time.Now(),
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
+		ID:         uuid.New().String(),
+		PaymentID:  payment.ID,
+		OrderID:    payment.OrderID,
+		Amount:     amount,
+		Currency:   payment.Currency,
+		Status:     models.RefundStatusCompleted,
+		Reason:     reason,
+		RefundedAt: time.Now(),
 	}
 
-	if err := s.db.Create(refund).Error; err != nil {
-		return fmt.Errorf("failed to save refund: %w", err)
+	if err := db.Create(refund).Error; err != nil {
+		return nil, fmt.Errorf("failed to save refund: %w", err)
 	}
 
-	// Обновляем статус платежа
-	payment.Status = models.PaymentStatusRefunded
+	if s.asyncService != nil {
+		s.asyncService.DispatchWebhook(ctx, models.WebhookEventRefundCreated, refund)
+	}
+
+	// Документ о возврате выпускается после сохранения возврата, ошибка
+	// выпуска не отменяет возврат
+	if s.receipts != nil {
+		if _, err := s.receipts.IssueCreditNote(ctx, payment, refund); err != nil {
+			log.Printf("Failed to issue credit note for order %s: %v", payment.OrderID, err)
+		}
+	}
+
+	// Статус вычисляется в базе по сумме всех возвратов, включая параллельные
+	oldStatus := payment.Status
 	payment.UpdatedAt = time.Now()
-	
-	if err := s.db.Save(payment).Error; err != nil {
-		return fmt.Errorf("failed to update payment status: %w", err)
+	err = db.Model(payment).Updates(map[string]interface{}{
+		"status": gorm.Expr("CASE WHEN "+refundableAmountExpr+" <= 0 THEN ? ELSE ? END",
+			i18n.CurrencyDigits(payment.Currency), models.PaymentStatusRefunded, models.PaymentStatusPartiallyRefunded),
+		"updated_at": payment.UpdatedAt,
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to update payment status: %w", err)
+	}
+	if err := db.First(payment, "id = ?", payment.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to reload payment: %w", err)
+	}
+	s.statusChanged(ctx, payment, oldStatus)
+
+	return refund, nil
+}
+
+// reserveRefund увеличивает сумму возвратов платежа, если остаток не меньше
+// amount. Проверка и увеличение выполняются одним запросом.
+func reserveRefund(db *gorm.DB, p *models.Payment, amount float64) error {
+	result := db.Model(&models.Payment{}).
+		Where("id = ? AND status IN ?", p.ID, []models.PaymentStatus{models.PaymentStatusCompleted, models.PaymentStatusPartiallyRefunded}).
+		Where(refundableAmountExpr+" >= ?", i18n.CurrencyDigits(p.Currency), amount).
+		Update("refunded_amount", gorm.Expr("refunded_amount + ?", amount))
+	if result.Error != nil {
+		return fmt.Errorf("failed to reserve refund: %w", result.Error)
 	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: refund amount exceeds the remaining amount of order %s", ErrInvalidAmount, p.OrderID)
+	}
+	p.RefundedAmount = roundAmount(p.RefundedAmount+amount, p.Currency)
+	return nil
+}
 
+// releaseRefund возвращает зарезервированную сумму после отказа провайдера
+func releaseRefund(db *gorm.DB, p *models.Payment, amount float64) error {
+	err := db.Model(&models.Payment{}).Where("id = ?", p.ID).
+		Update("refunded_amount", gorm.Expr("refunded_amount - ?", amount)).Error
+	if err != nil {
+		return err
+	}
+	p.RefundedAmount = roundAmount(p.RefundedAmount-amount, p.Currency)
 	return nil
 }
 
@@ -139,31 +262,82 @@ func (s *PaymentService) HandleWebhook(ctx context.Context, providerType payment
 		return fmt.Errorf("failed to validate webhook: %w", err)
 	}
 
+	// Неизвестные события подтверждаем, но к платежу не применяем
+	if event.Ignored {
+		log.Printf("Ignoring unsupported %s webhook event %s (%s)", providerType, event.Type, event.ID)
+		return nil
+	}
+
 	// Находим платеж по TransactionID
 	var payment models.Payment
 	if err := s.db.Where("transaction_id = ?", event.TransactionID).First(&payment).Error; err != nil {
 		return fmt.Errorf("payment not found: %w", err)
 	}
 
-	// Обновляем статус платежа
-	payment.Status = event.Status
+	// Дополняем детали платежа данными события
+	if payment.PaymentDetails == nil {
+		payment.PaymentDetails = make(models.JSON)
+	}
+	for k, v := range event.PaymentDetails {
+		payment.PaymentDetails[k] = v
+	}
 	payment.UpdatedAt = time.Now()
-	payment.PaymentDetails = event.PaymentDetails
 
-	if err := s.db.Save(&payment).Error; err != nil {
-		return fmt.Errorf("failed to update payment: %w", err)
+	// События без статуса несут только детали
+	if event.Status == "" {
+		if err := s.db.Save(&payment).Error; err != nil {
+			return fmt.Errorf("failed to update payment: %w", err)
+		}
+		return nil
 	}
 
-	// Отправляем уведомление об изменении статуса
-	if err := s.asyncService.PublishPaymentStatus(ctx, &models.PaymentStatusMessage{
-		OrderID:   payment.OrderID,
-		Status:    payment.Status,
-		UpdatedAt: payment.UpdatedAt,
-	}); err != nil {
-		return fmt.Errorf("failed to publish status update: %w", err)
+	// Запоздавшее событие не откатывает статус, детали при этом сохраняются
+	oldStatus := payment.Status
+	refunded, status := webhookRefund(&payment, event)
+	if !oldStatus.CanTransitionTo(status) {
+		log.Printf("Ignoring %s webhook event %s for order %s: transition %s -> %s is not allowed",
+			providerType, event.ID, payment.OrderID, oldStatus, status)
+		if err := s.db.WithContext(ctx).Save(&payment).Error; err != nil {
+			return fmt.Errorf("failed to update payment: %w", err)
+		}
+		return nil
 	}
 
-	return nil
+	payment.Status = status
+	if refunded <= payment.RefundedAmount {
+		return s.updateStatus(ctx, &payment, oldStatus)
+	}
+
+	// Сумма возвратов только растет: параллельный RefundPayment мог уже
+	// зарезервировать большую сумму
+	payment.RefundedAmount = refunded
+	return s.updateStatusColumns(ctx, &payment, oldStatus, map[string]interface{}{
+		"refunded_amount": gorm.Expr("GREATEST(refunded_amount, ?)", refunded),
+	})
+}
+
+// webhookRefund возвращает сумму возвратов платежа после события провайдера
+// и статус, в который переходит платеж. Полный возврат, в том числе по
+// итогам спора, закрывает всю списанную сумму. Частичный возврат становится
+// полным, когда сумма всех возвратов достигает суммы списания.
+func webhookRefund(p *models.Payment, event *payment.WebhookEvent) (float64, models.PaymentStatus) {
+	captured := p.CapturedAmount
+	if captured == 0 {
+		captured = p.Amount
+	}
+	captured = roundAmount(captured, p.Currency)
+
+	switch event.Status {
+	case models.PaymentStatusRefunded:
+		return captured, event.Status
+	case models.PaymentStatusPartiallyRefunded:
+		refunded := roundAmount(event.Amount, p.Currency)
+		if refunded >= captured {
+			return captured, models.PaymentStatusRefunded
+		}
+		return refunded, event.Status
+	}
+	return p.RefundedAmount, event.Status
 }
 
 // GetPaymentStatus получает актуальный статус платежа от провайдера
@@ -179,23 +353,94 @@ func (s *PaymentService) GetPaymentStatus(ctx context.Context, payment *models.P
 	}
 
 	// Обновляем статус в базе данных, если он изменился
-	if status != payment.Status {
-		payment.Status = status
-		payment.UpdatedAt = time.Now()
-		
-		if err := s.db.Save(payment).Error; err != nil {
-			return status, fmt.Errorf("failed to update payment status: %w", err)
-		}
-
-		// Публикуем обновление статуса
-		if err := s.asyncService.PublishPaymentStatus(ctx, &models.PaymentStatusMessage{
-			OrderID:   payment.OrderID,
-			Status:    payment.Status,
-			UpdatedAt: payment.UpdatedAt,
-		}); err != nil {
-			return status, fmt.Errorf("failed to publish status update: %w", err)
-		}
+	if status == payment.Status {
+		return status, nil
+	}
+	oldStatus := payment.Status
+	if !oldStatus.CanTransitionTo(status) {
+		log.Printf("Ignoring provider status %s for order %s: transition from %s is not allowed",
+			status, payment.OrderID, oldStatus)
+		return oldStatus, nil
 	}
 
+	payment.Status = status
+	payment.UpdatedAt = time.Now()
+	if err := s.updateStatus(ctx, payment, oldStatus); err != nil {
+		return status, err
+	}
 	return status, nil
 }
+
+// updateStatus сохраняет статус платежа, если с момента чтения он остался
+// oldStatus, и публикует изменение. Параллельное обновление возвращает
+// ошибку, чтобы провайдер повторил доставку события.
+func (s *PaymentService) updateStatus(ctx context.Context, p *models.Payment, oldStatus models.PaymentStatus) error {
+	return s.updateStatusColumns(ctx, p, oldStatus, nil)
+}
+
+// updateStatusColumns работает как updateStatus и в том же запросе
+// обновляет дополнительные колонки
+func (s *PaymentService) updateStatusColumns(ctx context.Context, p *models.Payment, oldStatus models.PaymentStatus, columns map[string]interface{}) error {
+	updates := map[string]interface{}{
+		"status":          p.Status,
+		"payment_details": p.PaymentDetails,
+		"updated_at":      p.UpdatedAt,
+	}
+	for column, value := range columns {
+		updates[column] = value
+	}
+	result := s.db.WithContext(ctx).Model(p).Where("status = ?", oldStatus).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update payment status: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: status of order %s changed concurrently", ErrInvalidPaymentState, p.OrderID)
+	}
+	if oldStatus == p.Status || s.asyncService == nil {
+		return nil
+	}
+
+	// Отправляем уведомление об изменении статуса
+	if err := s.asyncService.UpdatePaymentStatusAsync(ctx, p.OrderID, oldStatus, p.Status); err != nil {
+		return fmt.Errorf("failed to publish status update: %w", err)
+	}
+	return nil
+}
+
+// GetPayment возвращает платеж по идентификатору заказа
+func (s *PaymentService) GetPayment(orderID string) (*models.Payment, error) {
+	var payment models.Payment
+	err := s.db.Where("order_id = ?", orderID).First(&payment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+	return &payment, nil
+}
+
+// Providers возвращает инициализированных провайдеров в порядке имен
+func (s *PaymentService) Providers() []payment.ProviderType {
+	providers := make([]payment.ProviderType, 0, len(s.providers))
+	for providerType := range s.providers {
+		providers = append(providers, providerType)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i] < providers[j]
+	})
+	return providers
+}
+
+// CheckProviderHealth проверяет доступность API провайдера. Провайдер без
+// проверки считается доступным, если он инициализирован.
+func (s *PaymentService) CheckProviderHealth(ctx context.Context, providerType payment.ProviderType) error {
+	provider, exists := s.providers[providerType]
+	if !exists {
+		return fmt.Errorf("unsupported payment provider: %s", providerType)
+	}
+	if checker, ok := provider.(payment.HealthChecker); ok {
+		return checker.CheckHealth(ctx)
+	}
+	return nil
+}
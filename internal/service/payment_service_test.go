@@ -0,0 +1,69 @@
+package service
+
+import (
+	"go_payment/internal/models"
+	"go_payment/internal/payment"
+	"testing"
+)
+
+func TestWebhookRefund(t *testing.T) {
+	tests := []struct {
+		name         string
+		payment      models.Payment
+		event        payment.WebhookEvent
+		wantRefunded float64
+		wantStatus   models.PaymentStatus
+	}{
+		{
+			name:         "status without refund keeps the refunded amount",
+			payment:      models.Payment{Amount: 10, RefundedAmount: 2, Currency: "EUR"},
+			event:        payment.WebhookEvent{Status: models.PaymentStatusDisputed, Amount: 10},
+			wantRefunded: 2,
+			wantStatus:   models.PaymentStatusDisputed,
+		},
+		{
+			name:         "partial refund",
+			payment:      models.Payment{Amount: 10, Currency: "EUR"},
+			event:        payment.WebhookEvent{Status: models.PaymentStatusPartiallyRefunded, Amount: 3},
+			wantRefunded: 3,
+			wantStatus:   models.PaymentStatusPartiallyRefunded,
+		},
+		{
+			name:         "refunds reaching the amount close the payment",
+			payment:      models.Payment{Amount: 10.10, RefundedAmount: 5, Currency: "EUR"},
+			event:        payment.WebhookEvent{Status: models.PaymentStatusPartiallyRefunded, Amount: 10.1},
+			wantRefunded: 10.10,
+			wantStatus:   models.PaymentStatusRefunded,
+		},
+		{
+			name:         "captured amount limits refunds",
+			payment:      models.Payment{Amount: 20, CapturedAmount: 15, Currency: "EUR"},
+			event:        payment.WebhookEvent{Status: models.PaymentStatusPartiallyRefunded, Amount: 15},
+			wantRefunded: 15,
+			wantStatus:   models.PaymentStatusRefunded,
+		},
+		{
+			name:         "full refund covers the captured amount",
+			payment:      models.Payment{Amount: 20, CapturedAmount: 15, Currency: "EUR"},
+			event:        payment.WebhookEvent{Status: models.PaymentStatusRefunded},
+			wantRefunded: 15,
+			wantStatus:   models.PaymentStatusRefunded,
+		},
+		{
+			name:         "dispute closed by refund",
+			payment:      models.Payment{Amount: 10, Currency: "EUR"},
+			event:        payment.WebhookEvent{Status: models.PaymentStatusRefunded, Amount: 10, Type: "charge.dispute.closed"},
+			wantRefunded: 10,
+			wantStatus:   models.PaymentStatusRefunded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refunded, status := webhookRefund(&tt.payment, &tt.event)
+			if refunded != tt.wantRefunded || status != tt.wantStatus {
+				t.Errorf("webhookRefund() = %v, %s, want %v, %s", refunded, status, tt.wantRefunded, tt.wantStatus)
+			}
+		})
+	}
+}
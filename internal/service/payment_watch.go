@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_payment/internal/messaging"
+	"go_payment/internal/models"
+	"go_payment/internal/payment"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// watchBufferSize ограничивает число событий, ожидающих отправки подписчику
+	watchBufferSize     = 256
+	watchReplayPageSize = 500
+
+	// statusEventSequence — счетчик document_sequences, выдающий Sequence
+	// событий истории статусов
+	statusEventSequence = "payment_status_events"
+)
+
+// ErrWatchLagging возвращается, если подписчик не успевает забирать события.
+// Клиент может переподключиться с последнего полученного Sequence.
+var ErrWatchLagging = errors.New("watcher is lagging behind, resume from last sequence")
+
+// PaymentWatchFilter задает платежи, изменения статуса которых получает
+// подписчик. Нулевые значения не ограничивают выборку, Status сравнивается
+// с новым статусом.
+type PaymentWatchFilter struct {
+	OrderID    string
+	CustomerID string
+	Status     models.PaymentStatus
+	Provider   payment.ProviderType
+}
+
+// matches проверяет, подходит ли событие под фильтр
+func (f PaymentWatchFilter) matches(event *models.PaymentStatusEvent) bool {
+	return (f.OrderID == "" || f.OrderID == event.OrderID) &&
+		(f.CustomerID == "" || f.CustomerID == event.CustomerID) &&
+		(f.Status == "" || f.Status == event.NewStatus) &&
+		(f.Provider == "" || f.Provider == event.Provider)
+}
+
+// PaymentWatcher раздает изменения статусов платежей подписчикам потоков.
+// События приходят из PaymentStatusExchange после записи в историю.
+// Публикация идет после фиксации и может менять порядок или теряться,
+// поэтому пропущенные номера дочитываются из истории и подписчики получают
+// события строго по возрастанию Sequence.
+type PaymentWatcher struct {
+	db       *gorm.DB
+	rabbitmq *messaging.RabbitMQ
+
+	// last — последний разосланный Sequence. Изменяется только в Start и
+	// в обработчике очереди.
+	last uint64
+
+	mu          sync.Mutex
+	subscribers map[*PaymentSubscription]struct{}
+}
+
+// PaymentSubscription представляет подписку на изменения статусов
+type PaymentSubscription struct {
+	watcher       *PaymentWatcher
+	filter        PaymentWatchFilter
+	afterSequence uint64
+	events        chan *models.PaymentStatusEvent
+
+	closeOnce sync.Once
+	err       error
+}
+
+// NewPaymentWatcher создает новый экземпляр PaymentWatcher
+func NewPaymentWatcher(db *gorm.DB, rabbitmq *messaging.RabbitMQ) *PaymentWatcher {
+	return &PaymentWatcher{
+		db:          db,
+		rabbitmq:    rabbitmq,
+		subscribers: make(map[*PaymentSubscription]struct{}),
+	}
+}
+
+// Start подписывает экземпляр сервиса на события истории статусов
+func (w *PaymentWatcher) Start() error {
+	// События, записанные до подписки на очередь, дочитываются из истории
+	// при получении следующего события
+	err := w.db.Model(&models.PaymentStatusEvent{}).Select("COALESCE(MAX(sequence), 0)").Scan(&w.last).Error
+	if err != nil {
+		return fmt.Errorf("failed to load last payment status event: %w", err)
+	}
+	if err := w.rabbitmq.SubscribePaymentEvents(w.dispatch); err != nil {
+		return fmt.Errorf("failed to subscribe to payment events: %w", err)
+	}
+	log.Println("Started payment status watcher")
+	return nil
+}
+
+// Watch создает подписку на изменения статусов после afterSequence.
+// Подписка регистрируется до чтения истории, поэтому между историей и
+// живыми событиями нет пропусков. Подписку нужно закрыть методом Close.
+func (w *PaymentWatcher) Watch(filter PaymentWatchFilter, afterSequence uint64) *PaymentSubscription {
+	sub := &PaymentSubscription{
+		watcher:       w,
+		filter:        filter,
+		afterSequence: afterSequence,
+		events:        make(chan *models.PaymentStatusEvent, watchBufferSize),
+	}
+
+	w.mu.Lock()
+	w.subscribers[sub] = struct{}{}
+	w.mu.Unlock()
+
+	return sub
+}
+
+// dispatch рассылает событие после пропущенных перед ним событий истории.
+// Sequence выдаются без пропусков, поэтому пропуск номера означает, что
+// событие еще не пришло из очереди, хотя уже зафиксировано. Такие события
+// читаются из истории, а при их позднем получении отбрасываются.
+func (w *PaymentWatcher) dispatch(event *models.PaymentStatusEvent) {
+	if event.Sequence <= w.last {
+		return
+	}
+
+	if event.Sequence > w.last+1 {
+		var missed []models.PaymentStatusEvent
+		err := w.db.Where("sequence > ? AND sequence < ?", w.last, event.Sequence).
+			Order("sequence").
+			Find(&missed).Error
+		if err != nil {
+			// Подписчики продолжат поток из истории после переподключения
+			log.Printf("Failed to load payment status events %d-%d: %v", w.last+1, event.Sequence-1, err)
+			w.disconnectAll(ErrWatchLagging)
+		}
+		for i := range missed {
+			w.broadcast(&missed[i])
+		}
+	}
+
+	w.broadcast(event)
+	w.last = event.Sequence
+}
+
+// disconnectAll отключает всех подписчиков с причиной err
+func (w *PaymentWatcher) disconnectAll(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for sub := range w.subscribers {
+		delete(w.subscribers, sub)
+		sub.close(err)
+	}
+}
+
+// broadcast передает событие подходящим подписчикам. Подписчик с
+// заполненным буфером отключается, чтобы не задерживать остальных.
+func (w *PaymentWatcher) broadcast(event *models.PaymentStatusEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for sub := range w.subscribers {
+		if !sub.filter.matches(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			log.Printf("Dropping lagging payment watcher at sequence %d", event.Sequence)
+			delete(w.subscribers, sub)
+			sub.close(ErrWatchLagging)
+		}
+	}
+}
+
+// Replay передает fn историю статусов после afterSequence в порядке Sequence
+// и возвращает последний переданный Sequence
+func (s *PaymentSubscription) Replay(ctx context.Context, fn func(event *models.PaymentStatusEvent) error) (uint64, error) {
+	last := s.afterSequence
+	for {
+		query := s.watcher.db.WithContext(ctx).Where("sequence > ?", last)
+		if s.filter.OrderID != "" {
+			query = query.Where("order_id = ?", s.filter.OrderID)
+		}
+		if s.filter.CustomerID != "" {
+			query = query.Where("customer_id = ?", s.filter.CustomerID)
+		}
+		if s.filter.Status != "" {
+			query = query.Where("new_status = ?", s.filter.Status)
+		}
+		if s.filter.Provider != "" {
+			query = query.Where("provider = ?", s.filter.Provider)
+		}
+
+		var events []models.PaymentStatusEvent
+		if err := query.Order("sequence").Limit(watchReplayPageSize).Find(&events).Error; err != nil {
+			return last, fmt.Errorf("failed to load payment status history: %w", err)
+		}
+
+		for i := range events {
+			if err := fn(&events[i]); err != nil {
+				return last, err
+			}
+			last = events[i].Sequence
+		}
+		if len(events) < watchReplayPageSize {
+			return last, nil
+		}
+	}
+}
+
+// Events возвращает канал живых событий. Канал закрывается при отключении
+// подписки, причина доступна через Err.
+func (s *PaymentSubscription) Events() <-chan *models.PaymentStatusEvent {
+	return s.events
+}
+
+// Err возвращает причину отключения подписки
+func (s *PaymentSubscription) Err() error {
+	return s.err
+}
+
+// Close отменяет подписку
+func (s *PaymentSubscription) Close() {
+	s.watcher.mu.Lock()
+	defer s.watcher.mu.Unlock()
+
+	delete(s.watcher.subscribers, s)
+	s.close(nil)
+}
+
+// close закрывает канал событий. Вызывается под блокировкой watcher.
+func (s *PaymentSubscription) close(err error) {
+	s.closeOnce.Do(func() {
+		s.err = err
+		close(s.events)
+	})
+}
+
+// recordStatusEvent записывает изменение статуса в историю и публикует его
+// подписчикам потоков.
+func (s *AsyncService) recordStatusEvent(ctx context.Context, p *models.Payment, oldStatus models.PaymentStatus) error {
+	event, err := insertStatusEvent(s.db.WithContext(ctx), p, oldStatus)
+	if err != nil {
+		return err
+	}
+	s.publishStatusEvent(ctx, event)
+	return nil
+}
+
+// insertStatusEvent записывает изменение статуса в историю. Принимает
+// транзакцию, чтобы событие сохранялось вместе со статусом. Счетчик
+// Sequence блокируется до фиксации, поэтому вызов должен быть последним
+// в транзакции.
+func insertStatusEvent(tx *gorm.DB, p *models.Payment, oldStatus models.PaymentStatus) (*models.PaymentStatusEvent, error) {
+	event := &models.PaymentStatusEvent{
+		OrderID:    p.OrderID,
+		CustomerID: p.CustomerID,
+		Provider:   p.ProviderType,
+		OldStatus:  oldStatus,
+		NewStatus:  p.Status,
+		Amount:     p.Amount,
+		Currency:   p.Currency,
+	}
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		sequence, err := nextStatusEventSequence(tx)
+		if err != nil {
+			return err
+		}
+		event.Sequence = sequence
+		return tx.Create(event).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record status event: %w", err)
+	}
+	return event, nil
+}
+
+// nextStatusEventSequence выделяет Sequence следующего события. Строка
+// счетчика блокируется до конца транзакции: следующая транзакция получит
+// номер только после фиксации этой, поэтому номера растут в порядке
+// фиксации, а откат транзакции возвращает номер.
+func nextStatusEventSequence(tx *gorm.DB) (uint64, error) {
+	var sequence models.DocumentSequence
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("name = ?", statusEventSequence).
+		First(&sequence).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock status event sequence: %w", err)
+	}
+
+	sequence.Value++
+	sequence.UpdatedAt = time.Now()
+	if err := tx.Save(&sequence).Error; err != nil {
+		return 0, fmt.Errorf("failed to update status event sequence: %w", err)
+	}
+	return uint64(sequence.Value), nil
+}
+
+// publishStatusEvent публикует записанное событие подписчикам потоков.
+// Ошибка публикации только логируется: подписчики получат событие из
+// истории при переподключении.
+func (s *AsyncService) publishStatusEvent(ctx context.Context, event *models.PaymentStatusEvent) {
+	if err := s.rabbitmq.PublishPaymentEvent(ctx, event); err != nil {
+		log.Printf("Failed to publish status event %d for order %s: %v", event.Sequence, event.OrderID, err)
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"go_payment/internal/models"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestInsertStatusEventTakesSequenceUnderLock(t *testing.T) {
+	db, statements := dryRunDB(t, models.DocumentSequence{Name: statusEventSequence, Value: 41})
+	p := &models.Payment{OrderID: "order-1", Status: models.PaymentStatusCompleted, Amount: 10, Currency: "EUR"}
+
+	event, err := insertStatusEvent(db, p, models.PaymentStatusPending)
+	if err != nil {
+		t.Fatalf("insertStatusEvent() error = %v", err)
+	}
+	if event.Sequence != 42 {
+		t.Errorf("sequence = %d, want 42", event.Sequence)
+	}
+
+	if len(*statements) != 3 {
+		t.Fatalf("statements = %v, want lock, counter update and insert", *statements)
+	}
+	if lock := (*statements)[0]; !strings.Contains(lock, "name = 'payment_status_events'") || !strings.HasSuffix(lock, "FOR UPDATE") {
+		t.Errorf("counter select %s is not locked", lock)
+	}
+	if update := (*statements)[1]; !strings.Contains(update, `"value"=42`) {
+		t.Errorf("counter update %s does not store 42", update)
+	}
+	if insert := (*statements)[2]; !strings.HasPrefix(insert, `INSERT INTO "payment_status_events"`) || !strings.Contains(insert, "42") {
+		t.Errorf("insert %s does not use the allocated sequence", insert)
+	}
+}
+
+func TestInsertStatusEventWithoutSequence(t *testing.T) {
+	db, _ := dryRunDB(t)
+	p := &models.Payment{OrderID: "order-1", Status: models.PaymentStatusCompleted}
+
+	if _, err := insertStatusEvent(db, p, models.PaymentStatusPending); err == nil {
+		t.Error("insertStatusEvent() without the counter row succeeded")
+	}
+}
+
+func TestPaymentWatcherDispatchInOrder(t *testing.T) {
+	// События 6 и 7 зафиксированы, но еще не пришли из очереди
+	db, statements := dryRunDB(t,
+		models.PaymentStatusEvent{Sequence: 6, OrderID: "order-1"},
+		models.PaymentStatusEvent{Sequence: 7, OrderID: "order-2"},
+	)
+	w := NewPaymentWatcher(db, nil)
+	w.last = 5
+	all := w.Watch(PaymentWatchFilter{}, 0)
+	order := w.Watch(PaymentWatchFilter{OrderID: "order-1"}, 0)
+
+	for _, sequence := range []uint64{8, 6, 7, 9} {
+		w.dispatch(&models.PaymentStatusEvent{Sequence: sequence, OrderID: "order-1"})
+	}
+
+	if got := receivedSequences(all); got != "6,7,8,9" {
+		t.Errorf("subscriber received %s, want 6,7,8,9", got)
+	}
+	if got := receivedSequences(order); got != "6,8,9" {
+		t.Errorf("filtered subscriber received %s, want 6,8,9", got)
+	}
+	// История читается один раз, только для пропущенных номеров
+	if len(*statements) != 1 || !strings.Contains((*statements)[0], "sequence > 5 AND sequence < 8") {
+		t.Errorf("statements = %v, want one history read of 6-7", *statements)
+	}
+}
+
+// receivedSequences возвращает номера событий в буфере подписки
+func receivedSequences(sub *PaymentSubscription) string {
+	var sequences []string
+	for len(sub.events) > 0 {
+		event := <-sub.events
+		sequences = append(sequences, strconv.FormatUint(event.Sequence, 10))
+	}
+	return strings.Join(sequences, ",")
+}
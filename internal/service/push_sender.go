@@ -0,0 +1,266 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_payment/internal/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const pushProviderTimeout = 10 * time.Second
+
+var (
+	// ErrInvalidDeviceToken возвращается, если провайдер отклонил токен устройства
+	ErrInvalidDeviceToken = errors.New("invalid device token")
+	// ErrUnsupportedPlatform возвращается для устройства, платформа которого
+	// не обслуживается настроенными провайдерами. Токен при этом остается
+	// действительным и не удаляется.
+	ErrUnsupportedPlatform = errors.New("unsupported device platform")
+)
+
+// PushMessage представляет push-уведомление для одного устройства
+type PushMessage struct {
+	ID    string
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// PushSender отправляет push-уведомления через внешнего провайдера.
+// Если провайдер отклонил токен, реализация должна вернуть ошибку,
+// оборачивающую ErrInvalidDeviceToken.
+type PushSender interface {
+	Send(ctx context.Context, device *models.DeviceToken, push *PushMessage) error
+}
+
+// PlatformPushSender выбирает провайдера по платформе устройства
+type PlatformPushSender struct {
+	senders map[models.DevicePlatform]PushSender
+}
+
+// NewPlatformPushSender создает PlatformPushSender. Платформы без
+// провайдера получают ErrUnsupportedPlatform.
+func NewPlatformPushSender(senders map[models.DevicePlatform]PushSender) *PlatformPushSender {
+	return &PlatformPushSender{senders: senders}
+}
+
+// Send отправляет push-уведомление через провайдера платформы устройства
+func (s *PlatformPushSender) Send(ctx context.Context, device *models.DeviceToken, push *PushMessage) error {
+	sender, ok := s.senders[device.Platform]
+	if !ok || sender == nil {
+		return fmt.Errorf("%w: %s", ErrUnsupportedPlatform, device.Platform)
+	}
+	return sender.Send(ctx, device, push)
+}
+
+// HTTP2PushConfig содержит настройки HTTP/2 провайдера push-уведомлений
+type HTTP2PushConfig struct {
+	BaseURL   string
+	AuthToken string
+	Topic     string
+}
+
+// HTTP2PushSender отправляет push-уведомления по протоколу APNs поверх HTTP/2
+type HTTP2PushSender struct {
+	config HTTP2PushConfig
+	client *http.Client
+}
+
+// NewHTTP2PushSender создает новый HTTP/2 провайдер push-уведомлений
+func NewHTTP2PushSender(config HTTP2PushConfig) *HTTP2PushSender {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+
+	return &HTTP2PushSender{
+		config: config,
+		client: &http.Client{
+			Timeout:   pushProviderTimeout,
+			Transport: transport,
+		},
+	}
+}
+
+// http2PushPayload представляет тело запроса к провайдеру
+type http2PushPayload struct {
+	APS  http2PushAPS      `json:"aps"`
+	Data map[string]string `json:"data,omitempty"`
+}
+
+type http2PushAPS struct {
+	Alert struct {
+		Title string `json:"title"`
+		Body  string `json:"body"`
+	} `json:"alert"`
+	Sound string `json:"sound,omitempty"`
+}
+
+// http2PushError представляет ответ провайдера с ошибкой
+type http2PushError struct {
+	Reason string `json:"reason"`
+}
+
+// Send отправляет push-уведомление на устройство iOS
+func (s *HTTP2PushSender) Send(ctx context.Context, device *models.DeviceToken, push *PushMessage) error {
+	if device.Platform != models.DevicePlatformIOS {
+		return fmt.Errorf("%w: %s device sent to APNs", ErrUnsupportedPlatform, device.Platform)
+	}
+
+	payload := http2PushPayload{Data: push.Data}
+	payload.APS.Alert.Title = push.Title
+	payload.APS.Alert.Body = push.Body
+	payload.APS.Sound = "default"
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal push payload: %w", err)
+	}
+
+	url := strings.TrimSuffix(s.config.BaseURL, "/") + "/3/device/" + device.Token
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create push request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "bearer "+s.config.AuthToken)
+	req.Header.Set("apns-topic", s.config.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-id", push.ID)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call push provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var providerErr http2PushError
+	_ = json.NewDecoder(resp.Body).Decode(&providerErr)
+
+	switch {
+	case resp.StatusCode == http.StatusGone,
+		providerErr.Reason == "BadDeviceToken",
+		providerErr.Reason == "DeviceTokenNotForTopic",
+		providerErr.Reason == "Unregistered":
+		return fmt.Errorf("%w: %s", ErrInvalidDeviceToken, providerErr.Reason)
+	default:
+		return fmt.Errorf("push provider returned status %d: %s", resp.StatusCode, providerErr.Reason)
+	}
+}
+
+// FCMPushConfig содержит настройки Firebase Cloud Messaging HTTP v1 API.
+// AccessToken — OAuth2 токен сервисного аккаунта с правом
+// firebase.messaging.
+type FCMPushConfig struct {
+	BaseURL     string
+	ProjectID   string
+	AccessToken string
+}
+
+// FCMPushSender отправляет push-уведомления на устройства Android через
+// FCM HTTP v1 API
+type FCMPushSender struct {
+	config FCMPushConfig
+	client *http.Client
+}
+
+// NewFCMPushSender создает новый провайдер FCM
+func NewFCMPushSender(config FCMPushConfig) *FCMPushSender {
+	if config.BaseURL == "" {
+		config.BaseURL = "https://fcm.googleapis.com"
+	}
+	return &FCMPushSender{
+		config: config,
+		client: &http.Client{Timeout: pushProviderTimeout},
+	}
+}
+
+// fcmPushPayload представляет тело запроса messages:send
+type fcmPushPayload struct {
+	Message struct {
+		Token        string            `json:"token"`
+		Notification fcmNotification   `json:"notification"`
+		Data         map[string]string `json:"data,omitempty"`
+	} `json:"message"`
+}
+
+type fcmNotification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// fcmPushError представляет ответ FCM с ошибкой
+type fcmPushError struct {
+	Error struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Details []struct {
+			ErrorCode string `json:"errorCode"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// errorCode возвращает код ошибки FCM, если он указан в деталях ответа
+func (e *fcmPushError) errorCode() string {
+	for _, detail := range e.Error.Details {
+		if detail.ErrorCode != "" {
+			return detail.ErrorCode
+		}
+	}
+	return e.Error.Status
+}
+
+// Send отправляет push-уведомление на устройство Android
+func (s *FCMPushSender) Send(ctx context.Context, device *models.DeviceToken, push *PushMessage) error {
+	if device.Platform != models.DevicePlatformAndroid {
+		return fmt.Errorf("%w: %s device sent to FCM", ErrUnsupportedPlatform, device.Platform)
+	}
+
+	var payload fcmPushPayload
+	payload.Message.Token = device.Token
+	payload.Message.Notification = fcmNotification{Title: push.Title, Body: push.Body}
+	payload.Message.Data = push.Data
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal push payload: %w", err)
+	}
+
+	url := strings.TrimSuffix(s.config.BaseURL, "/") + "/v1/projects/" + s.config.ProjectID + "/messages:send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create push request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.config.AccessToken)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call push provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var providerErr fcmPushError
+	_ = json.NewDecoder(resp.Body).Decode(&providerErr)
+
+	code := providerErr.errorCode()
+	switch {
+	case resp.StatusCode == http.StatusNotFound, code == "UNREGISTERED":
+		return fmt.Errorf("%w: %s", ErrInvalidDeviceToken, code)
+	case code == "INVALID_ARGUMENT" && strings.Contains(providerErr.Error.Message, "registration token"):
+		return fmt.Errorf("%w: %s", ErrInvalidDeviceToken, providerErr.Error.Message)
+	default:
+		return fmt.Errorf("push provider returned status %d: %s", resp.StatusCode, code)
+	}
+}
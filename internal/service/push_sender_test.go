@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"go_payment/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// recordingPushSender запоминает устройства, на которые отправлялись push
+type recordingPushSender struct {
+	devices []string
+}
+
+func (s *recordingPushSender) Send(ctx context.Context, device *models.DeviceToken, push *PushMessage) error {
+	s.devices = append(s.devices, device.Token)
+	return nil
+}
+
+func TestPlatformPushSenderRoutesByPlatform(t *testing.T) {
+	ios, android := &recordingPushSender{}, &recordingPushSender{}
+	sender := NewPlatformPushSender(map[models.DevicePlatform]PushSender{
+		models.DevicePlatformIOS:     ios,
+		models.DevicePlatformAndroid: android,
+	})
+	push := &PushMessage{ID: "n1", Title: "title", Body: "body"}
+
+	devices := []models.DeviceToken{
+		{Token: "ios-token", Platform: models.DevicePlatformIOS},
+		{Token: "android-token", Platform: models.DevicePlatformAndroid},
+	}
+	for i := range devices {
+		if err := sender.Send(context.Background(), &devices[i], push); err != nil {
+			t.Fatalf("Send(%s) = %v", devices[i].Platform, err)
+		}
+	}
+	if len(ios.devices) != 1 || ios.devices[0] != "ios-token" {
+		t.Errorf("ios sender got %v", ios.devices)
+	}
+	if len(android.devices) != 1 || android.devices[0] != "android-token" {
+		t.Errorf("android sender got %v", android.devices)
+	}
+
+	err := sender.Send(context.Background(), &models.DeviceToken{Token: "web-token", Platform: models.DevicePlatformWeb}, push)
+	if !errors.Is(err, ErrUnsupportedPlatform) || errors.Is(err, ErrInvalidDeviceToken) {
+		t.Errorf("web device: err = %v, want ErrUnsupportedPlatform", err)
+	}
+}
+
+// failingPushSender возвращает заданную ошибку для токена и запоминает
+// устройства, на которые отправлялись push
+type failingPushSender struct {
+	errs    map[string]error
+	devices []string
+}
+
+func (s *failingPushSender) Send(ctx context.Context, device *models.DeviceToken, push *PushMessage) error {
+	s.devices = append(s.devices, device.Token)
+	return s.errs[device.Token]
+}
+
+func TestPushToDevicesRetriesOnlyUndelivered(t *testing.T) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+	})
+	if err != nil {
+		t.Fatalf("gorm.Open() error = %v", err)
+	}
+
+	devices := []models.DeviceToken{
+		{ID: "d1", Token: "ok", Platform: models.DevicePlatformIOS},
+		{ID: "d2", Token: "unavailable", Platform: models.DevicePlatformAndroid},
+		{ID: "d3", Token: "web", Platform: models.DevicePlatformWeb},
+	}
+	sender := &failingPushSender{errs: map[string]error{
+		"unavailable": errors.New("push provider returned status 503"),
+		"web":         ErrUnsupportedPlatform,
+	}}
+	s := &NotificationService{db: db, push: sender}
+	msg := &models.NotificationMessage{ID: "n1", Type: models.NotificationTypePush, Recipient: "user-1"}
+
+	// Временная ошибка одного устройства возвращает сообщение в очередь
+	err = s.pushToDevices(context.Background(), msg, devices, map[string]bool{})
+	if err == nil || isPermanentNotificationError(err) {
+		t.Fatalf("first pushToDevices() = %v, want a retryable error", err)
+	}
+	if len(sender.devices) != 3 {
+		t.Fatalf("first attempt sent to %v, want all devices", sender.devices)
+	}
+
+	// Повтор не отправляет push устройству, уже получившему его
+	sender.devices = nil
+	sender.errs["unavailable"] = nil
+	err = s.pushToDevices(context.Background(), msg, devices, map[string]bool{"d1": true})
+	if err != nil {
+		t.Fatalf("retry pushToDevices() = %v", err)
+	}
+	if len(sender.devices) != 2 || sender.devices[0] != "unavailable" || sender.devices[1] != "web" {
+		t.Errorf("retry sent to %v, want [unavailable web]", sender.devices)
+	}
+	if msg.Status != models.NotificationStatusSent || msg.Metadata["push_devices"] != "2" {
+		t.Errorf("status = %s, push_devices = %q, want sent to 2 devices", msg.Status, msg.Metadata["push_devices"])
+	}
+}
+
+func TestPushToDevicesWithoutDelivery(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		permanent bool
+	}{
+		{name: "unsupported platform", err: ErrUnsupportedPlatform},
+		{name: "invalid token", err: ErrInvalidDeviceToken, permanent: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{
+				DryRun:                 true,
+				DisableAutomaticPing:   true,
+				SkipDefaultTransaction: true,
+			})
+			if err != nil {
+				t.Fatalf("gorm.Open() error = %v", err)
+			}
+			s := &NotificationService{db: db, push: &failingPushSender{errs: map[string]error{"t": tt.err}}}
+			msg := &models.NotificationMessage{ID: "n1", Type: models.NotificationTypePush, Recipient: "user-1"}
+
+			err = s.pushToDevices(context.Background(), msg, []models.DeviceToken{{ID: "d1", Token: "t"}}, map[string]bool{})
+			if err == nil || isPermanentNotificationError(err) != tt.permanent {
+				t.Errorf("pushToDevices() = %v, permanent %v", err, tt.permanent)
+			}
+		})
+	}
+}
+
+func TestHTTP2PushSenderRejectsOtherPlatforms(t *testing.T) {
+	sender := NewHTTP2PushSender(HTTP2PushConfig{BaseURL: "https://127.0.0.1:1"})
+	err := sender.Send(context.Background(), &models.DeviceToken{Token: "t", Platform: models.DevicePlatformAndroid}, &PushMessage{})
+	if !errors.Is(err, ErrUnsupportedPlatform) {
+		t.Errorf("err = %v, want ErrUnsupportedPlatform", err)
+	}
+}
+
+func TestFCMPushSenderErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		invalid bool
+	}{
+		{"ok", http.StatusOK, `{"name":"projects/p/messages/1"}`, false},
+		{"unregistered", http.StatusNotFound, `{"error":{"status":"NOT_FOUND","details":[{"errorCode":"UNREGISTERED"}]}}`, true},
+		{"invalid token", http.StatusBadRequest, `{"error":{"status":"INVALID_ARGUMENT","message":"The registration token is not a valid FCM registration token"}}`, true},
+		{"unavailable", http.StatusServiceUnavailable, `{"error":{"status":"UNAVAILABLE"}}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/projects/project/messages:send" || r.Header.Get("Authorization") != "Bearer token" {
+					t.Errorf("unexpected request %s %s", r.URL.Path, r.Header.Get("Authorization"))
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			sender := NewFCMPushSender(FCMPushConfig{BaseURL: server.URL, ProjectID: "project", AccessToken: "token"})
+			err := sender.Send(context.Background(), &models.DeviceToken{Token: "t", Platform: models.DevicePlatformAndroid}, &PushMessage{Title: "title"})
+			if tt.status == http.StatusOK {
+				if err != nil {
+					t.Errorf("Send() = %v", err)
+				}
+				return
+			}
+			if err == nil || errors.Is(err, ErrInvalidDeviceToken) != tt.invalid {
+				t.Errorf("Send() = %v, invalid token %v", err, tt.invalid)
+			}
+		})
+	}
+}
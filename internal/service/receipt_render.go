@@ -0,0 +1,450 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"go_payment/internal/i18n"
+	"go_payment/internal/models"
+	htmltemplate "html/template"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// receiptLabels содержит подписи платежных документов по локалям
+var receiptLabels = map[string]map[string]string{
+	"en": {
+		"invoice":     "Receipt",
+		"credit_note": "Credit note",
+		"number":      "Number",
+		"date":        "Date",
+		"order":       "Order",
+		"billed_to":   "Billed to",
+		"tax_id":      "Tax ID",
+		"description": "Description",
+		"quantity":    "Qty",
+		"unit_price":  "Unit price",
+		"tax_rate":    "Tax rate",
+		"amount":      "Amount",
+		"taxes":       "Tax breakdown",
+		"net":         "Net",
+		"tax":         "Tax",
+		"gross":       "Gross",
+		"subtotal":    "Subtotal",
+		"tax_total":   "Tax total",
+		"total":       "Total",
+		"tax_note":    "All prices include tax.",
+		"payment_for": "Payment for order %s",
+		"refund_for":  "Refund for order %s",
+	},
+	"ru": {
+		"invoice":     "Квитанция",
+		"credit_note": "Документ о возврате",
+		"number":      "Номер",
+		"date":        "Дата",
+		"order":       "Заказ",
+		"billed_to":   "Покупатель",
+		"tax_id":      "ИНН",
+		"description": "Наименование",
+		"quantity":    "Кол-во",
+		"unit_price":  "Цена",
+		"tax_rate":    "Ставка налога",
+		"amount":      "Сумма",
+		"taxes":       "Налоги",
+		"net":         "Без налога",
+		"tax":         "Налог",
+		"gross":       "С налогом",
+		"subtotal":    "Итого без налога",
+		"tax_total":   "Сумма налога",
+		"total":       "Итого",
+		"tax_note":    "Все цены указаны с учетом налога.",
+		"payment_for": "Оплата заказа %s",
+		"refund_for":  "Возврат по заказу %s",
+	},
+}
+
+// receiptLabel возвращает подпись документа по цепочке fallback локали
+func receiptLabel(locale, key string) string {
+	for _, l := range i18n.Fallbacks(locale) {
+		if label, ok := receiptLabels[l][key]; ok {
+			return label
+		}
+	}
+	return key
+}
+
+// formatTaxRate форматирует ставку налога: 20 -> "20%", 8.5 -> "8.5%"
+func formatTaxRate(rate float64, locale string) string {
+	digits := 0
+	if rate != math.Trunc(rate) {
+		digits = 2
+		if rate*10 == math.Trunc(rate*10) {
+			digits = 1
+		}
+	}
+	return i18n.FormatNumber(rate, digits, locale) + "%"
+}
+
+// formatQuantity форматирует количество без лишних знаков после запятой
+func formatQuantity(quantity float64, locale string) string {
+	if quantity == math.Trunc(quantity) {
+		return i18n.FormatNumber(quantity, 0, locale)
+	}
+	return i18n.FormatNumber(quantity, 3, locale)
+}
+
+// receiptHTML — шаблон HTML представления документа
+const receiptHTML = `<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head>
+<meta charset="utf-8">
+<title>{{label .Kind}} {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; margin: 40px; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+table { width: 100%; border-collapse: collapse; margin-top: 16px; }
+th, td { padding: 6px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+.num { text-align: right; white-space: nowrap; }
+.totals td { border: none; }
+.total td { font-weight: bold; border-top: 2px solid #222; }
+.muted { color: #666; font-size: 12px; }
+</style>
+</head>
+<body>
+<h1>{{label .Kind}} {{.Number}}</h1>
+<p>{{label "date"}}: {{date .IssuedAt}}<br>{{label "order"}}: {{.OrderID}}</p>
+<p><strong>{{.Merchant.Name}}</strong>{{with .Merchant.Address}}<br>{{.}}{{end}}{{with .Merchant.TaxID}}<br>{{label "tax_id"}}: {{.}}{{end}}{{with .Merchant.Email}}<br>{{.}}{{end}}{{with .Merchant.Phone}}<br>{{.}}{{end}}</p>
+{{with .CustomerEmail}}<p>{{label "billed_to"}}: {{.}}</p>{{end}}
+<table>
+<tr><th>{{label "description"}}</th><th class="num">{{label "quantity"}}</th><th class="num">{{label "unit_price"}}</th><th class="num">{{label "tax_rate"}}</th><th class="num">{{label "amount"}}</th></tr>
+{{range .LineItems}}<tr><td>{{.Description}}</td><td class="num">{{quantity .Quantity}}</td><td class="num">{{money .UnitPrice}}</td><td class="num">{{rate .TaxRate}}</td><td class="num">{{money .Amount}}</td></tr>
+{{end}}</table>
+<table>
+<tr><th>{{label "taxes"}}</th><th class="num">{{label "net"}}</th><th class="num">{{label "tax"}}</th><th class="num">{{label "gross"}}</th></tr>
+{{range .Taxes}}<tr><td>{{rate .Rate}}</td><td class="num">{{money .Net}}</td><td class="num">{{money .Tax}}</td><td class="num">{{money .Gross}}</td></tr>
+{{end}}</table>
+<table class="totals">
+<tr><td>{{label "subtotal"}}</td><td class="num">{{money .Subtotal}}</td></tr>
+<tr><td>{{label "tax_total"}}</td><td class="num">{{money .TaxTotal}}</td></tr>
+<tr class="total"><td>{{label "total"}}</td><td class="num">{{money .Total}}</td></tr>
+</table>
+<p class="muted">{{label "tax_note"}}</p>
+</body>
+</html>
+`
+
+// renderReceiptHTML рендерит документ в HTML на языке покупателя
+func renderReceiptHTML(receipt *models.Receipt) (string, error) {
+	tmpl, err := htmltemplate.New("receipt").Funcs(receiptFuncs(receipt, receipt.Locale)).Parse(receiptHTML)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse receipt template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, receipt); err != nil {
+		return "", fmt.Errorf("failed to render receipt %s: %w", receipt.Number, err)
+	}
+	return buf.String(), nil
+}
+
+// receiptFuncs возвращает функции форматирования документа для локали.
+// Документы датируются в UTC.
+func receiptFuncs(receipt *models.Receipt, locale string) htmltemplate.FuncMap {
+	return htmltemplate.FuncMap{
+		"label": func(key interface{}) string {
+			return receiptLabel(locale, fmt.Sprint(key))
+		},
+		"money": func(amount float64) string {
+			return i18n.FormatMoney(amount, receipt.Currency, locale)
+		},
+		"rate": func(rate float64) string {
+			return formatTaxRate(rate, locale)
+		},
+		"quantity": func(quantity float64) string {
+			return formatQuantity(quantity, locale)
+		},
+		"date": func(t time.Time) string {
+			return i18n.FormatDate(t, locale, nil)
+		},
+	}
+}
+
+// Параметры страницы PDF в пунктах: A4 с полями 50pt
+const (
+	pdfPageWidth  = 595.0
+	pdfPageHeight = 842.0
+	pdfMargin     = 50.0
+	pdfLineHeight = 16.0
+)
+
+// renderReceiptPDF рендерит документ в PDF. Используются стандартные шрифты
+// Helvetica без встраивания, они не содержат кириллицы, поэтому подписи
+// печатаются на английском, а кириллица в данных транслитерируется.
+func renderReceiptPDF(receipt *models.Receipt) []byte {
+	const locale = i18n.DefaultLocale
+	label := func(key string) string { return receiptLabel(locale, key) }
+	money := func(amount float64) string { return i18n.FormatMoney(amount, receipt.Currency, locale) }
+	right := pdfPageWidth - pdfMargin
+
+	doc := newPDFDocument()
+	doc.text(pdfMargin, 20, true, label(string(receipt.Kind))+" "+receipt.Number)
+	doc.space(8)
+	doc.text(pdfMargin, 10, false, label("date")+": "+i18n.FormatDate(receipt.IssuedAt, locale, nil))
+	doc.text(pdfMargin, 10, false, label("order")+": "+receipt.OrderID)
+	doc.space(8)
+
+	doc.text(pdfMargin, 11, true, receipt.Merchant.Name)
+	for _, line := range []string{receipt.Merchant.Address, receipt.Merchant.Email, receipt.Merchant.Phone} {
+		if line != "" {
+			doc.text(pdfMargin, 10, false, line)
+		}
+	}
+	if receipt.Merchant.TaxID != "" {
+		doc.text(pdfMargin, 10, false, label("tax_id")+": "+receipt.Merchant.TaxID)
+	}
+	if receipt.CustomerEmail != "" {
+		doc.space(8)
+		doc.text(pdfMargin, 10, false, label("billed_to")+": "+receipt.CustomerEmail)
+	}
+
+	// Позиции документа
+	doc.space(12)
+	doc.row(10, true,
+		pdfCell{x: pdfMargin, text: label("description")},
+		pdfCell{x: 330, text: label("quantity"), right: true},
+		pdfCell{x: 420, text: label("unit_price"), right: true},
+		pdfCell{x: 475, text: label("tax_rate"), right: true},
+		pdfCell{x: right, text: label("amount"), right: true},
+	)
+	doc.rule()
+	for _, item := range receipt.LineItems {
+		doc.row(10, false,
+			pdfCell{x: pdfMargin, text: pdfFit(item.Description, 10, 240)},
+			pdfCell{x: 330, text: formatQuantity(item.Quantity, locale), right: true},
+			pdfCell{x: 420, text: money(item.UnitPrice), right: true},
+			pdfCell{x: 475, text: formatTaxRate(item.TaxRate, locale), right: true},
+			pdfCell{x: right, text: money(item.Amount), right: true},
+		)
+	}
+
+	// Налоги по ставкам
+	doc.space(12)
+	doc.row(10, true,
+		pdfCell{x: pdfMargin, text: label("taxes")},
+		pdfCell{x: 330, text: label("net"), right: true},
+		pdfCell{x: 420, text: label("tax"), right: true},
+		pdfCell{x: right, text: label("gross"), right: true},
+	)
+	doc.rule()
+	for _, tax := range receipt.Taxes {
+		doc.row(10, false,
+			pdfCell{x: pdfMargin, text: formatTaxRate(tax.Rate, locale)},
+			pdfCell{x: 330, text: money(tax.Net), right: true},
+			pdfCell{x: 420, text: money(tax.Tax), right: true},
+			pdfCell{x: right, text: money(tax.Gross), right: true},
+		)
+	}
+
+	// Итоги
+	doc.space(12)
+	doc.row(10, false, pdfCell{x: 400, text: label("subtotal")}, pdfCell{x: right, text: money(receipt.Subtotal), right: true})
+	doc.row(10, false, pdfCell{x: 400, text: label("tax_total")}, pdfCell{x: right, text: money(receipt.TaxTotal), right: true})
+	doc.row(12, true, pdfCell{x: 400, text: label("total")}, pdfCell{x: right, text: money(receipt.Total), right: true})
+	doc.space(16)
+	doc.text(pdfMargin, 9, false, label("tax_note"))
+
+	return doc.bytes()
+}
+
+// pdfCell представляет текст строки таблицы. При right текст выравнивается
+// по правому краю относительно x.
+type pdfCell struct {
+	x     float64
+	text  string
+	right bool
+}
+
+// pdfDocument формирует многостраничный PDF из текстовых строк
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func newPDFDocument() *pdfDocument {
+	d := &pdfDocument{}
+	d.newPage()
+	return d
+}
+
+// newPage начинает новую страницу
+func (d *pdfDocument) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// advance переводит курсор на строку заданной высоты, начиная новую
+// страницу при достижении нижнего поля
+func (d *pdfDocument) advance(height float64) {
+	if d.y-height < pdfMargin {
+		d.newPage()
+	}
+	d.y -= height
+}
+
+// space добавляет вертикальный отступ
+func (d *pdfDocument) space(height float64) {
+	d.y -= height
+}
+
+// text выводит строку текста
+func (d *pdfDocument) text(x, size float64, bold bool, s string) {
+	d.row(size, bold, pdfCell{x: x, text: s})
+}
+
+// row выводит строку таблицы
+func (d *pdfDocument) row(size float64, bold bool, cells ...pdfCell) {
+	d.advance(math.Max(pdfLineHeight, size*1.4))
+
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+
+	page := d.pages[len(d.pages)-1]
+	for _, cell := range cells {
+		encoded := pdfEncode(cell.text)
+		x := cell.x
+		if cell.right {
+			x -= pdfTextWidth(encoded, size)
+		}
+		fmt.Fprintf(page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, d.y, pdfEscape(encoded))
+	}
+}
+
+// rule выводит горизонтальную линию под строкой
+func (d *pdfDocument) rule() {
+	page := d.pages[len(d.pages)-1]
+	y := d.y - 4
+	fmt.Fprintf(page, "0.5 w %.2f %.2f m %.2f %.2f l S\n", pdfMargin, y, pdfPageWidth-pdfMargin, y)
+	d.y -= 4
+}
+
+// bytes собирает PDF файл: каталог, дерево страниц, шрифты и страницы
+func (d *pdfDocument) bytes() []byte {
+	var out bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	const firstPage = 5
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+i*2)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, firstPage+i*2+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return out.Bytes()
+}
+
+// pdfCyrillic содержит транслитерацию кириллицы для стандартных шрифтов PDF
+var pdfCyrillic = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+}
+
+// pdfEncode переводит строку в кодировку WinAnsi. Кириллица
+// транслитерируется, остальные символы вне кодировки заменяются на '?'.
+func pdfEncode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '\u00a0' || r == '\u202f':
+			out = append(out, ' ')
+		case r == '€':
+			out = append(out, 0x80)
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			out = append(out, byte(r))
+		default:
+			lower := []rune(strings.ToLower(string(r)))[0]
+			translit, ok := pdfCyrillic[lower]
+			if !ok {
+				out = append(out, '?')
+				continue
+			}
+			if lower != r && translit != "" {
+				translit = strings.ToUpper(translit[:1]) + translit[1:]
+			}
+			out = append(out, translit...)
+		}
+	}
+	return out
+}
+
+// pdfEscape экранирует строку PDF
+func pdfEscape(b []byte) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(string(b))
+}
+
+// helveticaWidths содержит ширины символов ASCII 32-126 шрифта Helvetica
+// в тысячных долях кегля
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// pdfTextWidth оценивает ширину закодированной строки в пунктах
+func pdfTextWidth(b []byte, size float64) float64 {
+	var width int
+	for _, c := range b {
+		if c >= 32 && c <= 126 {
+			width += helveticaWidths[c-32]
+		} else {
+			width += 556
+		}
+	}
+	return float64(width) * size / 1000
+}
+
+// pdfFit обрезает строку до заданной ширины, добавляя многоточие
+func pdfFit(s string, size, width float64) string {
+	if pdfTextWidth(pdfEncode(s), size) <= width {
+		return s
+	}
+	for len(s) > 0 {
+		_, n := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-n]
+		if pdfTextWidth(pdfEncode(s+"..."), size) <= width {
+			return s + "..."
+		}
+	}
+	return ""
+}
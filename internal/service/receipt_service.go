@@ -0,0 +1,445 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_payment/internal/i18n"
+	"go_payment/internal/models"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReceiptAttachmentSource — имя источника вложений, формирующего PDF
+// документа по его идентификатору
+const ReceiptAttachmentSource = "receipt"
+
+var (
+	// ErrReceiptNotFound возвращается, если документ не найден
+	ErrReceiptNotFound = errors.New("receipt not found")
+	// ErrReceiptNotAvailable возвращается при выпуске квитанции по
+	// незавершенному платежу
+	ErrReceiptNotAvailable = errors.New("receipt is available only for completed payments")
+)
+
+// ReceiptConfig содержит реквизиты продавца и настройки нумерации документов
+type ReceiptConfig struct {
+	Merchant models.MerchantDetails
+	// TaxRate в процентах применяется к позициям без собственной ставки
+	TaxRate          float64
+	InvoicePrefix    string
+	CreditNotePrefix string
+}
+
+// ReceiptService выпускает и хранит платежные документы
+type ReceiptService struct {
+	db     *gorm.DB
+	config ReceiptConfig
+}
+
+// NewReceiptService создает новый экземпляр сервиса документов
+func NewReceiptService(db *gorm.DB, config ReceiptConfig) *ReceiptService {
+	if config.InvoicePrefix == "" {
+		config.InvoicePrefix = "INV"
+	}
+	if config.CreditNotePrefix == "" {
+		config.CreditNotePrefix = "CN"
+	}
+
+	return &ReceiptService{
+		db:     db,
+		config: config,
+	}
+}
+
+// IssueInvoice выпускает квитанцию по завершенному платежу. Позиции берутся
+// из metadata.items платежа, повторный вызов возвращает выпущенный документ.
+func (s *ReceiptService) IssueInvoice(ctx context.Context, payment *models.Payment) (*models.Receipt, error) {
+	if payment.Status != models.PaymentStatusCompleted {
+		return nil, ErrReceiptNotAvailable
+	}
+
+	issuedAt := time.Now()
+	if payment.CompletedAt != nil {
+		issuedAt = *payment.CompletedAt
+	}
+
+	return s.issue(ctx, &models.Receipt{
+		Kind:          models.ReceiptKindInvoice,
+		PaymentID:     payment.ID,
+		OrderID:       payment.OrderID,
+		CustomerEmail: payment.CustomerEmail,
+		Locale:        payment.Locale,
+		Currency:      payment.Currency,
+		LineItems:     s.invoiceLineItems(payment),
+		IssuedAt:      issuedAt,
+	})
+}
+
+// IssueCreditNote выпускает кредит-ноту по возврату. Сумма возврата
+// распределяется по ставкам налога исходной квитанции.
+func (s *ReceiptService) IssueCreditNote(ctx context.Context, payment *models.Payment, refund *models.Refund) (*models.Receipt, error) {
+	invoice, err := s.findBySource(ctx, models.ReceiptKindInvoice, payment.ID, "")
+	if err != nil && !errors.Is(err, ErrReceiptNotFound) {
+		return nil, err
+	}
+
+	locale := templateLocale(payment.Locale)
+	description := fmt.Sprintf(receiptLabel(locale, "refund_for"), payment.OrderID)
+
+	return s.issue(ctx, &models.Receipt{
+		Kind:          models.ReceiptKindCreditNote,
+		PaymentID:     payment.ID,
+		RefundID:      refund.ID,
+		OrderID:       payment.OrderID,
+		CustomerEmail: payment.CustomerEmail,
+		Locale:        payment.Locale,
+		Currency:      refund.Currency,
+		LineItems:     s.creditNoteLineItems(invoice, description, refund),
+		IssuedAt:      refund.RefundedAt,
+	})
+}
+
+// GetReceipt возвращает документ по идентификатору
+func (s *ReceiptService) GetReceipt(ctx context.Context, id string) (*models.Receipt, error) {
+	var receipt models.Receipt
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&receipt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrReceiptNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get receipt: %w", err)
+	}
+	return &receipt, nil
+}
+
+// GetOrderReceipt возвращает квитанцию по заказу
+func (s *ReceiptService) GetOrderReceipt(ctx context.Context, orderID string) (*models.Receipt, error) {
+	var receipt models.Receipt
+	err := s.db.WithContext(ctx).
+		Where("order_id = ? AND kind = ?", orderID, models.ReceiptKindInvoice).
+		First(&receipt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrReceiptNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get receipt: %w", err)
+	}
+	return &receipt, nil
+}
+
+// ListOrderReceipts возвращает все документы заказа без HTML и PDF содержимого
+func (s *ReceiptService) ListOrderReceipts(ctx context.Context, orderID string) ([]models.Receipt, error) {
+	var receipts []models.Receipt
+	err := s.db.WithContext(ctx).
+		Omit("html", "pdf").
+		Where("order_id = ?", orderID).
+		Order("issued_at, number").
+		Find(&receipts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list receipts: %w", err)
+	}
+	return receipts, nil
+}
+
+// ReceiptPDF возвращает PDF документа. Используется как источник вложений
+// уведомлений ReceiptAttachmentSource.
+func (s *ReceiptService) ReceiptPDF(ctx context.Context, id string) ([]byte, error) {
+	receipt, err := s.GetReceipt(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return receipt.PDF, nil
+}
+
+// ReceiptAttachment возвращает вложение уведомления со ссылкой на PDF документа
+func ReceiptAttachment(receipt *models.Receipt) models.NotificationAttachment {
+	return models.NotificationAttachment{
+		Filename:    receipt.Number + ".pdf",
+		ContentType: "application/pdf",
+		Source:      ReceiptAttachmentSource,
+		Ref:         receipt.ID,
+	}
+}
+
+// issue присваивает документу очередной номер, рендерит его и сохраняет.
+// Номер выделяется в одной транзакции с сохранением, поэтому неудачный
+// выпуск не оставляет пропусков в нумерации.
+func (s *ReceiptService) issue(ctx context.Context, receipt *models.Receipt) (*models.Receipt, error) {
+	existing, err := s.findBySource(ctx, receipt.Kind, receipt.PaymentID, receipt.RefundID)
+	if err == nil {
+		return existing, nil
+	}
+	if !errors.Is(err, ErrReceiptNotFound) {
+		return nil, err
+	}
+
+	receipt.ID = uuid.New().String()
+	receipt.Locale = templateLocale(receipt.Locale)
+	receipt.Merchant = s.config.Merchant
+	receipt.CreatedAt = time.Now()
+	computeReceiptTotals(receipt)
+
+	prefix := s.config.InvoicePrefix
+	if receipt.Kind == models.ReceiptKindCreditNote {
+		prefix = s.config.CreditNotePrefix
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		number, err := nextDocumentNumber(tx, prefix, receipt.IssuedAt)
+		if err != nil {
+			return err
+		}
+		receipt.Number = number
+
+		if receipt.HTML, err = renderReceiptHTML(receipt); err != nil {
+			return err
+		}
+		receipt.PDF = renderReceiptPDF(receipt)
+
+		return tx.Create(receipt).Error
+	})
+	if err != nil {
+		// Документ мог быть выпущен параллельным обработчиком
+		if existing, findErr := s.findBySource(ctx, receipt.Kind, receipt.PaymentID, receipt.RefundID); findErr == nil {
+			return existing, nil
+		}
+		return nil, fmt.Errorf("failed to issue %s for order %s: %w", receipt.Kind, receipt.OrderID, err)
+	}
+
+	log.Printf("Issued %s %s for order %s", receipt.Kind, receipt.Number, receipt.OrderID)
+	return receipt, nil
+}
+
+// findBySource находит документ, выпущенный по платежу или возврату
+func (s *ReceiptService) findBySource(ctx context.Context, kind models.ReceiptKind, paymentID, refundID string) (*models.Receipt, error) {
+	var receipt models.Receipt
+	err := s.db.WithContext(ctx).
+		Where("kind = ? AND payment_id = ? AND refund_id = ?", kind, paymentID, refundID).
+		First(&receipt).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrReceiptNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find receipt: %w", err)
+	}
+	return &receipt, nil
+}
+
+// invoiceLineItems формирует позиции квитанции из metadata.items платежа:
+// [{"description": "...", "quantity": 2, "unit_price": 10.5, "tax_rate": 20}].
+// Если позиции не заданы или их сумма не совпадает с суммой платежа,
+// квитанция содержит одну позицию на всю сумму.
+func (s *ReceiptService) invoiceLineItems(payment *models.Payment) []models.ReceiptLineItem {
+	if items, ok := metadataLineItems(payment.Metadata["items"], s.config.TaxRate, payment.Currency); ok {
+		var total float64
+		for _, item := range items {
+			total += item.Amount
+		}
+		if roundAmount(total, payment.Currency) == roundAmount(payment.Amount, payment.Currency) {
+			return items
+		}
+		log.Printf("Line items of order %s do not match payment amount, using single line", payment.OrderID)
+	}
+
+	description := payment.Description
+	if description == "" {
+		description = fmt.Sprintf(receiptLabel(templateLocale(payment.Locale), "payment_for"), payment.OrderID)
+	}
+
+	return []models.ReceiptLineItem{{
+		Description: description,
+		Quantity:    1,
+		UnitPrice:   payment.Amount,
+		TaxRate:     s.config.TaxRate,
+		Amount:      roundAmount(payment.Amount, payment.Currency),
+	}}
+}
+
+// creditNoteLineItems распределяет сумму возврата по ставкам налога квитанции
+// пропорционально. Остаток от округления относится на последнюю ставку.
+func (s *ReceiptService) creditNoteLineItems(invoice *models.Receipt, description string, refund *models.Refund) []models.ReceiptLineItem {
+	amount := roundAmount(refund.Amount, refund.Currency)
+	if invoice == nil || invoice.Total <= 0 || len(invoice.Taxes) == 0 {
+		return []models.ReceiptLineItem{{
+			Description: description,
+			Quantity:    1,
+			UnitPrice:   amount,
+			TaxRate:     s.config.TaxRate,
+			Amount:      amount,
+		}}
+	}
+
+	items := make([]models.ReceiptLineItem, 0, len(invoice.Taxes))
+	remaining := amount
+	for i, tax := range invoice.Taxes {
+		part := roundAmount(amount*tax.Gross/invoice.Total, refund.Currency)
+		if i == len(invoice.Taxes)-1 {
+			part = roundAmount(remaining, refund.Currency)
+		}
+		remaining -= part
+
+		items = append(items, models.ReceiptLineItem{
+			Description: description,
+			Quantity:    1,
+			UnitPrice:   part,
+			TaxRate:     tax.Rate,
+			Amount:      part,
+		})
+	}
+	return items
+}
+
+// metadataLineItems разбирает позиции документа из метаданных платежа
+func metadataLineItems(value interface{}, defaultRate float64, currency string) ([]models.ReceiptLineItem, bool) {
+	raw, ok := value.([]interface{})
+	if !ok || len(raw) == 0 {
+		return nil, false
+	}
+
+	items := make([]models.ReceiptLineItem, 0, len(raw))
+	for _, entry := range raw {
+		fields, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		description, _ := fields["description"].(string)
+		if description == "" {
+			description, _ = fields["name"].(string)
+		}
+		if description == "" {
+			return nil, false
+		}
+		quantity, ok := metadataNumber(fields["quantity"], 1)
+		if !ok || quantity <= 0 {
+			return nil, false
+		}
+		price, ok := metadataNumber(fields["unit_price"], math.NaN())
+		if !ok || math.IsNaN(price) || price < 0 {
+			return nil, false
+		}
+		rate, ok := metadataNumber(fields["tax_rate"], defaultRate)
+		if !ok || rate < 0 {
+			return nil, false
+		}
+
+		items = append(items, models.ReceiptLineItem{
+			Description: description,
+			Quantity:    quantity,
+			UnitPrice:   price,
+			TaxRate:     rate,
+			Amount:      roundAmount(quantity*price, currency),
+		})
+	}
+
+	return items, true
+}
+
+// metadataNumber приводит числовое значение метаданных к float64. Для
+// отсутствующего значения возвращается def.
+func metadataNumber(value interface{}, def float64) (float64, bool) {
+	switch v := value.(type) {
+	case nil:
+		return def, true
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// computeReceiptTotals рассчитывает налоги по ставкам и итоговые суммы.
+// Цены позиций включают налог, поэтому налог выделяется из суммы по ставке.
+func computeReceiptTotals(receipt *models.Receipt) {
+	receipt.Taxes = nil
+	receipt.Subtotal, receipt.TaxTotal, receipt.Total = 0, 0, 0
+
+	index := make(map[float64]int)
+	for _, item := range receipt.LineItems {
+		i, ok := index[item.TaxRate]
+		if !ok {
+			i = len(receipt.Taxes)
+			index[item.TaxRate] = i
+			receipt.Taxes = append(receipt.Taxes, models.ReceiptTax{Rate: item.TaxRate})
+		}
+		receipt.Taxes[i].Gross += item.Amount
+	}
+
+	for i := range receipt.Taxes {
+		tax := &receipt.Taxes[i]
+		tax.Gross = roundAmount(tax.Gross, receipt.Currency)
+		tax.Tax = roundAmount(tax.Gross*tax.Rate/(100+tax.Rate), receipt.Currency)
+		tax.Net = roundAmount(tax.Gross-tax.Tax, receipt.Currency)
+
+		receipt.Subtotal += tax.Net
+		receipt.TaxTotal += tax.Tax
+		receipt.Total += tax.Gross
+	}
+
+	receipt.Subtotal = roundAmount(receipt.Subtotal, receipt.Currency)
+	receipt.TaxTotal = roundAmount(receipt.TaxTotal, receipt.Currency)
+	receipt.Total = roundAmount(receipt.Total, receipt.Currency)
+}
+
+// nextDocumentNumber выделяет следующий номер в годовой серии префикса:
+// INV-2024-000001. Строка серии блокируется до конца транзакции.
+func nextDocumentNumber(tx *gorm.DB, prefix string, issuedAt time.Time) (string, error) {
+	series := documentSeries(prefix, issuedAt)
+
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.DocumentSequence{Name: series, UpdatedAt: time.Now()}).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to create document sequence %s: %w", series, err)
+	}
+
+	var sequence models.DocumentSequence
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("name = ?", series).
+		First(&sequence).Error
+	if err != nil {
+		return "", fmt.Errorf("failed to lock document sequence %s: %w", series, err)
+	}
+
+	sequence.Value++
+	sequence.UpdatedAt = time.Now()
+	if err := tx.Save(&sequence).Error; err != nil {
+		return "", fmt.Errorf("failed to update document sequence %s: %w", series, err)
+	}
+
+	return formatDocumentNumber(series, sequence.Value), nil
+}
+
+// documentSeries возвращает годовую серию номеров. Год определяется по UTC,
+// как и дата документа, чтобы номер не зависел от зоны сервера.
+func documentSeries(prefix string, issuedAt time.Time) string {
+	return fmt.Sprintf("%s-%d", prefix, issuedAt.UTC().Year())
+}
+
+// formatDocumentNumber возвращает номер документа в серии
+func formatDocumentNumber(series string, value int64) string {
+	return fmt.Sprintf("%s-%06d", series, value)
+}
+
+// roundAmount округляет сумму до точности валюты
+func roundAmount(amount float64, currency string) float64 {
+	scale := math.Pow(10, float64(i18n.CurrencyDigits(currency)))
+	return math.Round(amount*scale) / scale
+}
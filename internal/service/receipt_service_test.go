@@ -0,0 +1,135 @@
+package service
+
+import (
+	"go_payment/internal/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestComputeReceiptTotals(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		items    []models.ReceiptLineItem
+		taxes    []models.ReceiptTax
+		subtotal float64
+		taxTotal float64
+		total    float64
+	}{
+		{
+			name:     "single rate",
+			currency: "EUR",
+			items:    []models.ReceiptLineItem{{Amount: 120, TaxRate: 20}},
+			taxes:    []models.ReceiptTax{{Rate: 20, Net: 100, Tax: 20, Gross: 120}},
+			subtotal: 100, taxTotal: 20, total: 120,
+		},
+		{
+			name:     "items with the same rate are grouped",
+			currency: "EUR",
+			items: []models.ReceiptLineItem{
+				{Amount: 10.1, TaxRate: 20},
+				{Amount: 0.2, TaxRate: 20},
+				{Amount: 5, TaxRate: 10},
+			},
+			taxes: []models.ReceiptTax{
+				{Rate: 20, Net: 8.58, Tax: 1.72, Gross: 10.3},
+				{Rate: 10, Net: 4.55, Tax: 0.45, Gross: 5},
+			},
+			subtotal: 13.13, taxTotal: 2.17, total: 15.3,
+		},
+		{
+			name:     "zero rate",
+			currency: "USD",
+			items:    []models.ReceiptLineItem{{Amount: 9.99, TaxRate: 0}},
+			taxes:    []models.ReceiptTax{{Rate: 0, Net: 9.99, Tax: 0, Gross: 9.99}},
+			subtotal: 9.99, taxTotal: 0, total: 9.99,
+		},
+		{
+			name:     "currency without minor units",
+			currency: "JPY",
+			items:    []models.ReceiptLineItem{{Amount: 1000, TaxRate: 10}},
+			taxes:    []models.ReceiptTax{{Rate: 10, Net: 909, Tax: 91, Gross: 1000}},
+			subtotal: 909, taxTotal: 91, total: 1000,
+		},
+		{
+			name:     "three digit currency",
+			currency: "KWD",
+			items:    []models.ReceiptLineItem{{Amount: 1.5, TaxRate: 5}},
+			taxes:    []models.ReceiptTax{{Rate: 5, Net: 1.429, Tax: 0.071, Gross: 1.5}},
+			subtotal: 1.429, taxTotal: 0.071, total: 1.5,
+		},
+		{
+			name:     "no items",
+			currency: "EUR",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receipt := &models.Receipt{
+				Currency:  tt.currency,
+				LineItems: tt.items,
+				// Повторный расчет не должен учитывать прежние итоги
+				Taxes:    []models.ReceiptTax{{Rate: 99, Gross: 1}},
+				Subtotal: 1, TaxTotal: 1, Total: 1,
+			}
+			computeReceiptTotals(receipt)
+
+			if !reflect.DeepEqual(receipt.Taxes, tt.taxes) {
+				t.Errorf("taxes = %+v, want %+v", receipt.Taxes, tt.taxes)
+			}
+			if receipt.Subtotal != tt.subtotal || receipt.TaxTotal != tt.taxTotal || receipt.Total != tt.total {
+				t.Errorf("totals = %v / %v / %v, want %v / %v / %v",
+					receipt.Subtotal, receipt.TaxTotal, receipt.Total, tt.subtotal, tt.taxTotal, tt.total)
+			}
+			if receipt.Total != roundAmount(receipt.Subtotal+receipt.TaxTotal, tt.currency) {
+				t.Errorf("subtotal %v + tax %v != total %v", receipt.Subtotal, receipt.TaxTotal, receipt.Total)
+			}
+		})
+	}
+}
+
+func TestDocumentNumbering(t *testing.T) {
+	newYear := time.Date(2025, time.January, 1, 1, 0, 0, 0, time.FixedZone("UTC+3", 3*3600))
+
+	tests := []struct {
+		prefix   string
+		issuedAt time.Time
+		value    int64
+		want     string
+	}{
+		{"INV", time.Date(2024, time.May, 9, 12, 0, 0, 0, time.UTC), 1, "INV-2024-000001"},
+		{"CN", time.Date(2024, time.December, 31, 23, 59, 0, 0, time.UTC), 42, "CN-2024-000042"},
+		// 1:00 по UTC+3 — еще 2024 год по UTC
+		{"INV", newYear, 7, "INV-2024-000007"},
+		{"INV", newYear.Add(3 * time.Hour), 1, "INV-2025-000001"},
+		{"INV", time.Date(2024, time.May, 9, 0, 0, 0, 0, time.UTC), 1234567, "INV-2024-1234567"},
+	}
+	for _, tt := range tests {
+		got := formatDocumentNumber(documentSeries(tt.prefix, tt.issuedAt), tt.value)
+		if got != tt.want {
+			t.Errorf("document number for %s %v #%d = %q, want %q", tt.prefix, tt.issuedAt, tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCreditNoteLineItemsSplitByInvoiceRates(t *testing.T) {
+	s := &ReceiptService{config: ReceiptConfig{TaxRate: 20}}
+	invoice := &models.Receipt{
+		Currency: "EUR",
+		LineItems: []models.ReceiptLineItem{
+			{Amount: 10.3, TaxRate: 20},
+			{Amount: 5, TaxRate: 10},
+		},
+	}
+	computeReceiptTotals(invoice)
+
+	items := s.creditNoteLineItems(invoice, "refund", &models.Refund{Amount: 10, Currency: "EUR"})
+	var total float64
+	for _, item := range items {
+		total += item.Amount
+	}
+	if len(items) != 2 || roundAmount(total, "EUR") != 10 {
+		t.Errorf("credit note items = %+v, want two items totalling 10", items)
+	}
+}
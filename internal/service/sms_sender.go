@@ -0,0 +1,260 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+)
+
+const (
+	smsGatewayTimeout = 10 * time.Second
+
+	// Ограничения длины одного SMS и сегмента составного сообщения
+	gsm7SingleLimit  = 160
+	gsm7SegmentLimit = 153
+	ucs2SingleLimit  = 70
+	ucs2SegmentLimit = 67
+	maxSMSSegments   = 10
+	smsEncodingGSM7  = "GSM-7"
+	smsEncodingUCS2  = "UCS-2"
+)
+
+var (
+	// ErrInvalidRecipient возвращается для получателя, которому невозможно доставить сообщение
+	ErrInvalidRecipient = errors.New("invalid notification recipient")
+	// ErrInvalidMessage возвращается для пустого или слишком длинного сообщения
+	ErrInvalidMessage = errors.New("invalid notification message")
+
+	e164Pattern = regexp.MustCompile(`^\+[1-9]\d{1,14}$`)
+
+	// phoneFormatting содержит символы, допустимые при вводе номера
+	phoneFormatting = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "")
+
+	gsm7Basic     = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extension = "^{}\\[~]|€\f"
+)
+
+// SMSMessage представляет SMS, передаваемое в шлюз
+type SMSMessage struct {
+	// ID совпадает с идентификатором уведомления и возвращается шлюзом в
+	// callback'ах о статусе доставки
+	ID   string
+	To   string
+	Body string
+}
+
+// SMSResult представляет ответ шлюза на отправку SMS
+type SMSResult struct {
+	ProviderMessageID string
+	Segments          int
+}
+
+// SMSSender отправляет SMS через внешний шлюз
+type SMSSender interface {
+	Send(ctx context.Context, sms *SMSMessage) (*SMSResult, error)
+}
+
+// NormalizePhoneNumber приводит номер к формату E.164 и проверяет его
+func NormalizePhoneNumber(phone string) (string, error) {
+	normalized := phoneFormatting.Replace(strings.TrimSpace(phone))
+	if strings.HasPrefix(normalized, "00") {
+		normalized = "+" + strings.TrimPrefix(normalized, "00")
+	}
+
+	if !e164Pattern.MatchString(normalized) {
+		return "", fmt.Errorf("%w: %q is not an E.164 phone number", ErrInvalidRecipient, phone)
+	}
+	return normalized, nil
+}
+
+// SMSSegments определяет кодировку сообщения и количество сегментов,
+// которое потребуется для его отправки
+func SMSSegments(body string) (string, int) {
+	length := 0
+	encoding := smsEncodingGSM7
+
+	for _, r := range body {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			length++
+		case strings.ContainsRune(gsm7Extension, r):
+			// Символы расширенной таблицы передаются escape-последовательностью
+			length += 2
+		default:
+			encoding = smsEncodingUCS2
+		}
+	}
+
+	single, segment := gsm7SingleLimit, gsm7SegmentLimit
+	if encoding == smsEncodingUCS2 {
+		length = len(utf16.Encode([]rune(body)))
+		single, segment = ucs2SingleLimit, ucs2SegmentLimit
+	}
+
+	if length <= single {
+		return encoding, 1
+	}
+	return encoding, (length + segment - 1) / segment
+}
+
+// validateSMSBody проверяет, что сообщение укладывается в допустимое число сегментов
+func validateSMSBody(body string) (int, error) {
+	if body == "" {
+		return 0, fmt.Errorf("%w: empty SMS body", ErrInvalidMessage)
+	}
+
+	encoding, segments := SMSSegments(body)
+	if segments > maxSMSSegments {
+		return 0, fmt.Errorf("%w: %d %s segments exceed limit of %d", ErrInvalidMessage, segments, encoding, maxSMSSegments)
+	}
+	return segments, nil
+}
+
+// HTTPSMSConfig содержит настройки HTTP шлюза SMS
+type HTTPSMSConfig struct {
+	URL         string
+	APIKey      string
+	From        string
+	CallbackURL string
+}
+
+// HTTPSMSSender отправляет SMS через HTTP API шлюза
+type HTTPSMSSender struct {
+	config HTTPSMSConfig
+	client *http.Client
+}
+
+// NewHTTPSMSSender создает новый HTTP шлюз SMS
+func NewHTTPSMSSender(config HTTPSMSConfig) *HTTPSMSSender {
+	return &HTTPSMSSender{
+		config: config,
+		client: &http.Client{Timeout: smsGatewayTimeout},
+	}
+}
+
+// httpSMSRequest представляет тело запроса к шлюзу
+type httpSMSRequest struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Body        string `json:"body"`
+	Reference   string `json:"reference"`
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// httpSMSResponse представляет ответ шлюза
+type httpSMSResponse struct {
+	MessageID string `json:"message_id"`
+	Segments  int    `json:"segments"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Send отправляет SMS через шлюз
+func (s *HTTPSMSSender) Send(ctx context.Context, sms *SMSMessage) (*SMSResult, error) {
+	segments, err := validateSMSBody(sms.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(httpSMSRequest{
+		From:        s.config.From,
+		To:          sms.To,
+		Body:        sms.Body,
+		Reference:   sms.ID,
+		CallbackURL: s.config.CallbackURL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal SMS request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SMS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.config.APIKey)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call SMS gateway: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result httpSMSResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode SMS gateway response (status %d): %w", resp.StatusCode, err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity:
+		// Шлюз отклонил сообщение, повторная отправка не поможет
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMessage, result.Error)
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("SMS gateway returned status %d: %s", resp.StatusCode, result.Error)
+	}
+
+	if result.Segments == 0 {
+		result.Segments = segments
+	}
+
+	return &SMSResult{
+		ProviderMessageID: result.MessageID,
+		Segments:          result.Segments,
+	}, nil
+}
+
+// ConsoleSMSSender записывает SMS в консоль или файл. Используется при
+// локальной разработке вместо реального шлюза.
+type ConsoleSMSSender struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewConsoleSMSSender создает sink, пишущий SMS в указанный writer
+func NewConsoleSMSSender(w io.Writer) *ConsoleSMSSender {
+	return &ConsoleSMSSender{w: w}
+}
+
+// NewFileSMSSender создает sink, дописывающий SMS в файл
+func NewFileSMSSender(path string) (*ConsoleSMSSender, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SMS sink file: %w", err)
+	}
+	return NewConsoleSMSSender(f), nil
+}
+
+// Send записывает SMS вместо отправки
+func (s *ConsoleSMSSender) Send(ctx context.Context, sms *SMSMessage) (*SMSResult, error) {
+	segments, err := validateSMSBody(sms.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &SMSResult{
+		ProviderMessageID: "console-" + uuid.New().String(),
+		Segments:          segments,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = fmt.Fprintf(s.w, "[%s] SMS %s to %s (%d segment(s)):\n%s\n\n",
+		time.Now().Format(time.RFC3339), sms.ID, sms.To, segments, sms.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write SMS: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePhoneNumber(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+		valid bool
+	}{
+		{"+79161234567", "+79161234567", true},
+		{" +7 (916) 123-45-67 ", "+79161234567", true},
+		{"+1.415.555.2671", "+14155552671", true},
+		{"0044 20 7946 0958", "+442079460958", true},
+		{"+123456789012345", "+123456789012345", true},
+		{"+1234567890123456", "", false},
+		{"79161234567", "", false},
+		{"+0123456789", "", false},
+		{"+7916abc4567", "", false},
+		{"+", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, err := NormalizePhoneNumber(tt.phone)
+		if tt.valid {
+			if err != nil || got != tt.want {
+				t.Errorf("NormalizePhoneNumber(%q) = %q, %v, want %q", tt.phone, got, err, tt.want)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrInvalidRecipient) {
+			t.Errorf("NormalizePhoneNumber(%q) = %q, %v, want ErrInvalidRecipient", tt.phone, got, err)
+		}
+	}
+}
+
+func TestSMSSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		encoding string
+		segments int
+	}{
+		{"empty", "", smsEncodingGSM7, 1},
+		{"gsm7 single limit", strings.Repeat("a", 160), smsEncodingGSM7, 1},
+		{"gsm7 over single limit", strings.Repeat("a", 161), smsEncodingGSM7, 2},
+		{"gsm7 two full segments", strings.Repeat("a", 306), smsEncodingGSM7, 2},
+		{"gsm7 over two segments", strings.Repeat("a", 307), smsEncodingGSM7, 3},
+		{"gsm7 basic accents", "Zahlung über 10 € für Ñoño", smsEncodingGSM7, 1},
+		{"extended characters count twice", strings.Repeat("€", 80), smsEncodingGSM7, 1},
+		{"extended characters over single limit", strings.Repeat("a", 159) + "{", smsEncodingGSM7, 2},
+		{"extended brackets", strings.Repeat("[]", 40) + strings.Repeat("a", 1), smsEncodingGSM7, 2},
+		{"ucs2 single limit", strings.Repeat("ж", 70), smsEncodingUCS2, 1},
+		{"ucs2 over single limit", strings.Repeat("ж", 71), smsEncodingUCS2, 2},
+		{"ucs2 two full segments", strings.Repeat("ж", 134), smsEncodingUCS2, 2},
+		{"ucs2 over two segments", strings.Repeat("ж", 135), smsEncodingUCS2, 3},
+		{"one non-gsm character switches encoding", strings.Repeat("a", 70) + "ç", smsEncodingUCS2, 2},
+		{"surrogate pairs take two units", strings.Repeat("😀", 35), smsEncodingUCS2, 1},
+		{"surrogate pairs over single limit", strings.Repeat("😀", 36), smsEncodingUCS2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoding, segments := SMSSegments(tt.body)
+			if encoding != tt.encoding || segments != tt.segments {
+				t.Errorf("SMSSegments() = %s, %d, want %s, %d", encoding, segments, tt.encoding, tt.segments)
+			}
+		})
+	}
+}
+
+func TestValidateSMSBody(t *testing.T) {
+	if _, err := validateSMSBody(""); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("empty body: err = %v, want ErrInvalidMessage", err)
+	}
+	if segments, err := validateSMSBody(strings.Repeat("a", 153*maxSMSSegments)); err != nil || segments != maxSMSSegments {
+		t.Errorf("max length body = %d, %v, want %d segments", segments, err, maxSMSSegments)
+	}
+	if _, err := validateSMSBody(strings.Repeat("a", 153*maxSMSSegments+1)); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("too long body: err = %v, want ErrInvalidMessage", err)
+	}
+}
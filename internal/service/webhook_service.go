@@ -0,0 +1,518 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go_payment/internal/messaging"
+	"go_payment/internal/models"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// WebhookSignatureHeader содержит подпись вида "t=<unix>,v1=<hex hmac>"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	// WebhookEventIDHeader содержит идентификатор события
+	WebhookEventIDHeader = "X-Webhook-Event-Id"
+	// WebhookEventTypeHeader содержит тип события
+	WebhookEventTypeHeader = "X-Webhook-Event-Type"
+
+	webhookTimeout             = 10 * time.Second
+	webhookMaxResponseBody     = 4096
+	defaultWebhookMaxFailures  = 25
+	webhookSecretPrefix        = "whsec_"
+	webhookSecretRandomByteLen = 32
+)
+
+var (
+	// ErrWebhookEndpointNotFound возвращается, если endpoint не найден
+	ErrWebhookEndpointNotFound = errors.New("webhook endpoint not found")
+	// ErrWebhookURLNotAllowed возвращается для адреса, который не является
+	// публичным https endpoint'ом
+	ErrWebhookURLNotAllowed = errors.New("webhook url is not allowed")
+)
+
+// blockedWebhookPrefixes дополняет проверки net.IP диапазонами, которые
+// не маршрутизируются в интернет
+var blockedWebhookPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// WebhookEvent представляет событие, отправляемое во внешние вебхуки
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookService управляет endpoint'ами и доставкой исходящих вебхуков
+type WebhookService struct {
+	db          *gorm.DB
+	rabbitmq    *messaging.RabbitMQ
+	client      *http.Client
+	maxFailures int
+	listeners   []WebhookDeliveryListener
+}
+
+// WebhookDeliveryListener получает каждую попытку доставки. Статус попытки
+// succeeded или failed означает окончательный результат доставки события.
+type WebhookDeliveryListener func(ctx context.Context, delivery *models.WebhookDelivery)
+
+// NewWebhookService создает новый экземпляр WebhookService
+func NewWebhookService(db *gorm.DB, rabbitmq *messaging.RabbitMQ) *WebhookService {
+	return &WebhookService{
+		db:          db,
+		rabbitmq:    rabbitmq,
+		client:      newWebhookClient(),
+		maxFailures: defaultWebhookMaxFailures,
+	}
+}
+
+// OnDelivery регистрирует обработчик результатов доставки. Обработчики
+// регистрируются при инициализации, до запуска StartProcessing.
+func (s *WebhookService) OnDelivery(listener WebhookDeliveryListener) {
+	s.listeners = append(s.listeners, listener)
+}
+
+// StartProcessing запускает обработку очереди доставки вебхуков до отмены ctx
+func (s *WebhookService) StartProcessing(ctx context.Context) error {
+	if err := s.rabbitmq.ConsumeWebhooks(ctx, s.handleDelivery); err != nil {
+		return fmt.Errorf("failed to start webhook consumer: %w", err)
+	}
+	return nil
+}
+
+// RegisterEndpoint регистрирует новый endpoint. Если секрет не задан,
+// он генерируется автоматически.
+func (s *WebhookService) RegisterEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	if err := validateWebhookURL(ctx, endpoint.URL); err != nil {
+		return err
+	}
+
+	if len(endpoint.EventTypes) == 0 {
+		endpoint.EventTypes = models.StringList{models.WebhookEventAll}
+	}
+
+	if endpoint.Secret == "" {
+		secret, err := generateWebhookSecret()
+		if err != nil {
+			return err
+		}
+		endpoint.Secret = secret
+	}
+
+	endpoint.ID = uuid.New().String()
+	endpoint.IsActive = true
+	endpoint.CreatedAt = time.Now()
+	endpoint.UpdatedAt = time.Now()
+
+	if err := s.db.WithContext(ctx).Create(endpoint).Error; err != nil {
+		return fmt.Errorf("failed to save webhook endpoint: %w", err)
+	}
+
+	return nil
+}
+
+// ListEndpoints возвращает все зарегистрированные endpoint'ы
+func (s *WebhookService) ListEndpoints(ctx context.Context) ([]models.WebhookEndpoint, error) {
+	var endpoints []models.WebhookEndpoint
+	if err := s.db.WithContext(ctx).Order("created_at").Find(&endpoints).Error; err != nil {
+		return nil, fmt.Errorf("failed to list webhook endpoints: %w", err)
+	}
+	return endpoints, nil
+}
+
+// GetEndpoint возвращает endpoint по идентификатору
+func (s *WebhookService) GetEndpoint(ctx context.Context, id string) (*models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+	err := s.db.WithContext(ctx).Where("id = ?", id).First(&endpoint).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWebhookEndpointNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook endpoint: %w", err)
+	}
+	return &endpoint, nil
+}
+
+// DeleteEndpoint удаляет endpoint
+func (s *WebhookService) DeleteEndpoint(ctx context.Context, id string) error {
+	result := s.db.WithContext(ctx).Where("id = ?", id).Delete(&models.WebhookEndpoint{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete webhook endpoint: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebhookEndpointNotFound
+	}
+	return nil
+}
+
+// EnableEndpoint повторно включает endpoint, отключенный из-за ошибок доставки
+func (s *WebhookService) EnableEndpoint(ctx context.Context, id string) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.GetEndpoint(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Model(endpoint).Updates(map[string]interface{}{
+		"is_active":            true,
+		"consecutive_failures": 0,
+		"disabled_at":          nil,
+		"updated_at":           time.Now(),
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable webhook endpoint: %w", err)
+	}
+
+	return endpoint, nil
+}
+
+// ListDeliveries возвращает журнал попыток доставки для endpoint'а
+func (s *WebhookService) ListDeliveries(ctx context.Context, endpointID string, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := s.db.WithContext(ctx).
+		Where("endpoint_id = ?", endpointID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&deliveries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// Dispatch ставит событие в очередь доставки для всех активных endpoint'ов,
+// подписанных на его тип
+func (s *WebhookService) Dispatch(ctx context.Context, eventType string, data interface{}) error {
+	var endpoints []models.WebhookEndpoint
+	if err := s.db.WithContext(ctx).Where("is_active = ?", true).Find(&endpoints).Error; err != nil {
+		return fmt.Errorf("failed to load webhook endpoints: %w", err)
+	}
+
+	event := WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		CreatedAt: time.Now(),
+		Data:      data,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook event: %w", err)
+	}
+
+	for _, endpoint := range endpoints {
+		if !endpoint.Subscribed(eventType) {
+			continue
+		}
+		if err := s.Enqueue(ctx, endpoint.ID, event.ID, eventType, payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Enqueue ставит готовый payload в очередь доставки для одного endpoint'а
+func (s *WebhookService) Enqueue(ctx context.Context, endpointID, eventID, eventType string, payload []byte) error {
+	msg := &models.WebhookMessage{
+		EventID:    eventID,
+		EventType:  eventType,
+		EndpointID: endpointID,
+		Payload:    payload,
+		CreatedAt:  time.Now(),
+	}
+
+	if err := s.rabbitmq.PublishWebhook(ctx, msg); err != nil {
+		return fmt.Errorf("failed to publish webhook for endpoint %s: %w", endpointID, err)
+	}
+	return nil
+}
+
+// handleDelivery выполняет одну попытку доставки и планирует повтор при ошибке
+func (s *WebhookService) handleDelivery(ctx context.Context, msg *models.WebhookMessage) error {
+	endpoint, err := s.GetEndpoint(ctx, msg.EndpointID)
+	if errors.Is(err, ErrWebhookEndpointNotFound) {
+		log.Printf("Dropping webhook %s: endpoint %s no longer exists", msg.EventID, msg.EndpointID)
+		s.notifyDropped(ctx, msg, "webhook endpoint no longer exists")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !endpoint.IsActive {
+		log.Printf("Dropping webhook %s: endpoint %s is disabled", msg.EventID, msg.EndpointID)
+		s.notifyDropped(ctx, msg, "webhook endpoint is disabled")
+		return nil
+	}
+
+	msg.Attempt++
+	delivery := s.deliver(ctx, endpoint, msg)
+
+	if delivery.Status == models.WebhookDeliverySucceeded {
+		if err := s.db.Create(delivery).Error; err != nil {
+			return fmt.Errorf("failed to save webhook delivery: %w", err)
+		}
+		s.notifyListeners(ctx, delivery)
+		return s.resetFailures(endpoint)
+	}
+
+	if err := s.recordFailure(endpoint); err != nil {
+		return err
+	}
+
+	// Планируем повтор, пока не исчерпано расписание и endpoint активен
+	if msg.Attempt <= len(messaging.WebhookRetryDelays) && endpoint.IsActive {
+		next := time.Now().Add(messaging.WebhookRetryDelays[msg.Attempt-1])
+		delivery.Status = models.WebhookDeliveryRetrying
+		delivery.NextRetryAt = &next
+	}
+
+	if err := s.db.Create(delivery).Error; err != nil {
+		return fmt.Errorf("failed to save webhook delivery: %w", err)
+	}
+	s.notifyListeners(ctx, delivery)
+
+	if delivery.Status == models.WebhookDeliveryRetrying {
+		if err := s.rabbitmq.PublishWebhookRetry(ctx, msg); err != nil {
+			return fmt.Errorf("failed to schedule webhook retry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// notifyListeners передает результат попытки доставки обработчикам
+func (s *WebhookService) notifyListeners(ctx context.Context, delivery *models.WebhookDelivery) {
+	for _, listener := range s.listeners {
+		listener(ctx, delivery)
+	}
+}
+
+// notifyDropped сообщает обработчикам о событии, которое не будет доставлено
+func (s *WebhookService) notifyDropped(ctx context.Context, msg *models.WebhookMessage, reason string) {
+	s.notifyListeners(ctx, &models.WebhookDelivery{
+		EndpointID: msg.EndpointID,
+		EventID:    msg.EventID,
+		EventType:  msg.EventType,
+		Attempt:    msg.Attempt,
+		Status:     models.WebhookDeliveryFailed,
+		Error:      reason,
+		CreatedAt:  time.Now(),
+	})
+}
+
+// deliver отправляет подписанный запрос и возвращает запись о попытке
+func (s *WebhookService) deliver(ctx context.Context, endpoint *models.WebhookEndpoint, msg *models.WebhookMessage) *models.WebhookDelivery {
+	delivery := &models.WebhookDelivery{
+		ID:         uuid.New().String(),
+		EndpointID: endpoint.ID,
+		EventID:    msg.EventID,
+		EventType:  msg.EventType,
+		Attempt:    msg.Attempt,
+		Status:     models.WebhookDeliveryFailed,
+		CreatedAt:  time.Now(),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(msg.Payload))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-payment-webhooks/1.0")
+	req.Header.Set(WebhookEventIDHeader, msg.EventID)
+	req.Header.Set(WebhookEventTypeHeader, msg.EventType)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(endpoint.Secret, time.Now(), msg.Payload))
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, webhookMaxResponseBody))
+	delivery.ResponseCode = resp.StatusCode
+	delivery.ResponseBody = string(body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		delivery.Status = models.WebhookDeliverySucceeded
+	} else {
+		delivery.Error = fmt.Sprintf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return delivery
+}
+
+// resetFailures сбрасывает счетчик ошибок после успешной доставки
+func (s *WebhookService) resetFailures(endpoint *models.WebhookEndpoint) error {
+	if endpoint.ConsecutiveFailures == 0 {
+		return nil
+	}
+	err := s.db.Model(endpoint).Update("consecutive_failures", 0).Error
+	if err != nil {
+		return fmt.Errorf("failed to reset webhook endpoint failures: %w", err)
+	}
+	return nil
+}
+
+// recordFailure увеличивает счетчик ошибок и отключает endpoint при превышении лимита
+func (s *WebhookService) recordFailure(endpoint *models.WebhookEndpoint) error {
+	updates := map[string]interface{}{
+		"consecutive_failures": gorm.Expr("consecutive_failures + 1"),
+	}
+
+	if endpoint.ConsecutiveFailures+1 >= s.maxFailures {
+		now := time.Now()
+		updates["is_active"] = false
+		updates["disabled_at"] = now
+		endpoint.IsActive = false
+		endpoint.DisabledAt = &now
+		log.Printf("Disabling webhook endpoint %s after %d consecutive failures", endpoint.ID, s.maxFailures)
+	}
+
+	if err := s.db.Model(endpoint).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to record webhook endpoint failure: %w", err)
+	}
+	endpoint.ConsecutiveFailures++
+	return nil
+}
+
+// SignWebhookPayload вычисляет значение заголовка подписи. Подписывается
+// строка "<unix timestamp>.<payload>" алгоритмом HMAC-SHA256, что позволяет
+// получателю отклонять повторно отправленные старые запросы.
+func SignWebhookPayload(secret string, timestamp time.Time, payload []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return fmt.Sprintf("t=%s,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// validateWebhookURL проверяет, что endpoint доступен по https и его адрес
+// разрешается только в публичные IP. Проверка при регистрации не защищает
+// от смены DNS записи, поэтому адрес повторно проверяется при соединении.
+func validateWebhookURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWebhookURLNotAllowed, err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme must be https", ErrWebhookURLNotAllowed)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("%w: url has no host", ErrWebhookURLNotAllowed)
+	}
+
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !isPublicWebhookIP(ip) {
+			return fmt.Errorf("%w: %s is not a public address", ErrWebhookURLNotAllowed, ip)
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve webhook host %s: %w", host, err)
+	}
+	for _, ip := range addrs {
+		if !isPublicWebhookIP(ip) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrWebhookURLNotAllowed, host, ip)
+		}
+	}
+	return nil
+}
+
+// isPublicWebhookIP сообщает, что адрес маршрутизируется в интернет:
+// не loopback, не частный, не link-local и не служебный
+func isPublicWebhookIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedWebhookPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookDialControl отклоняет соединение с непубличным адресом. Вызывается
+// после разрешения имени, поэтому проверяет адрес, к которому фактически
+// подключается клиент.
+func webhookDialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrWebhookURLNotAllowed, address)
+	}
+	if !isPublicWebhookIP(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s is not a public address", ErrWebhookURLNotAllowed, addrPort.Addr())
+	}
+	return nil
+}
+
+// newWebhookClient создает HTTP клиент доставки вебхуков. Прокси из
+// окружения не используется, а редиректы не выполняются, чтобы запрос не
+// ушел в обход проверки адреса.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: webhookDialControl,
+	}
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConnsPerHost: 4,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// generateWebhookSecret генерирует секрет для подписи вебхуков
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, webhookSecretRandomByteLen)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return webhookSecretPrefix + hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://93.184.216.34/hooks", true},
+		{"https://[2606:2800:220:1:248:1893:25c8:1946]/hooks", true},
+		{"http://93.184.216.34/hooks", false},
+		{"ftp://93.184.216.34/hooks", false},
+		{"https://127.0.0.1/hooks", false},
+		{"https://[::1]/hooks", false},
+		{"https://10.1.2.3/hooks", false},
+		{"https://172.16.0.1/hooks", false},
+		{"https://192.168.1.1:8443/hooks", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://[fe80::1]/hooks", false},
+		{"https://[fd00::1]/hooks", false},
+		{"https://[::ffff:127.0.0.1]/hooks", false},
+		{"https://0.0.0.0/hooks", false},
+		{"https://100.64.0.1/hooks", false},
+	}
+	for _, tt := range tests {
+		err := validateWebhookURL(context.Background(), tt.url)
+		if tt.allowed && err != nil {
+			t.Errorf("validateWebhookURL(%q) = %v, want nil", tt.url, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrWebhookURLNotAllowed) {
+			t.Errorf("validateWebhookURL(%q) = %v, want ErrWebhookURLNotAllowed", tt.url, err)
+		}
+	}
+}
+
+func TestWebhookDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"127.0.0.1:443", false},
+		{"10.0.0.5:443", false},
+		{"169.254.169.254:80", false},
+		{"[::1]:443", false},
+		{"[fe80::1%eth0]:443", false},
+	}
+	for _, tt := range tests {
+		err := webhookDialControl("tcp", tt.address, nil)
+		if (err == nil) != tt.allowed {
+			t.Errorf("webhookDialControl(%q) = %v, allowed %v", tt.address, err, tt.allowed)
+		}
+	}
+}
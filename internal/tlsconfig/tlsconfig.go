@@ -0,0 +1,288 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultReloadInterval = time.Minute
+
+// Режимы проверки клиентских сертификатов
+const (
+	ClientAuthNone    = "none"
+	ClientAuthRequest = "request"
+	ClientAuthRequire = "require"
+)
+
+// Config задает TLS сервера. Сертификаты перечитываются с диска при
+// изменении файлов, поэтому ротация не требует перезапуска.
+type Config struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	CertFile string `mapstructure:"cert_file"`
+	KeyFile  string `mapstructure:"key_file"`
+	// ClientCAFile включает проверку клиентских сертификатов (mTLS)
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	// ClientAuth задает режим mTLS: none, request (сертификат проверяется,
+	// если предъявлен) или require. По умолчанию require при ClientCAFile.
+	ClientAuth     string        `mapstructure:"client_auth"`
+	ReloadInterval time.Duration `mapstructure:"reload_interval"`
+}
+
+// Reloader хранит текущие сертификат сервера и пул доверенных CA клиентов
+// и обновляет их при изменении файлов
+type Reloader struct {
+	config Config
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+// NewReloader загружает сертификаты из файлов конфигурации
+func NewReloader(config Config) (*Reloader, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, fmt.Errorf("tls certificate and key files are required")
+	}
+	if config.ReloadInterval <= 0 {
+		config.ReloadInterval = defaultReloadInterval
+	}
+
+	r := &Reloader{config: config}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ServerConfig возвращает tls.Config, который берет актуальные сертификаты
+// из Reloader при каждом рукопожатии
+func (r *Reloader) ServerConfig() (*tls.Config, error) {
+	clientAuth, err := r.clientAuthType()
+	if err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: clientAuth,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+
+		config := base.Clone()
+		config.GetConfigForClient = nil
+		config.GetCertificate = r.GetCertificate
+		config.ClientCAs = r.clientCAs
+		return config, nil
+	}
+	return base, nil
+}
+
+// GetCertificate возвращает текущий сертификат сервера
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Start периодически проверяет файлы сертификатов до отмены ctx
+func (r *Reloader) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(r.config.ReloadInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+				// При ошибке продолжаем работать со старыми сертификатами:
+				// файлы могли быть записаны не полностью
+				if err := r.load(); err != nil {
+					log.Printf("Failed to reload TLS certificates: %v", err)
+					continue
+				}
+				log.Printf("Reloaded TLS certificate %s", r.config.CertFile)
+			}
+		}
+	}()
+}
+
+// load читает сертификат, ключ и CA клиентов
+func (r *Reloader) load() error {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.config.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client ca file: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client ca file %s", r.config.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	return nil
+}
+
+// changed проверяет, изменились ли файлы с момента последней загрузки
+func (r *Reloader) changed() bool {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		log.Printf("Failed to check TLS certificate files: %v", err)
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for file, modTime := range modTimes {
+		if !modTime.Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileModTimes возвращает время изменения файлов сертификатов
+func (r *Reloader) fileModTimes() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	for _, file := range []string{r.config.CertFile, r.config.KeyFile, r.config.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", file, err)
+		}
+		modTimes[file] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// clientAuthType преобразует режим mTLS из конфигурации
+func (r *Reloader) clientAuthType() (tls.ClientAuthType, error) {
+	mode := r.config.ClientAuth
+	if mode == "" {
+		mode = ClientAuthNone
+		if r.config.ClientCAFile != "" {
+			mode = ClientAuthRequire
+		}
+	}
+
+	switch mode {
+	case ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthRequest, ClientAuthRequire:
+		if r.config.ClientCAFile == "" {
+			return tls.NoClientCert, fmt.Errorf("client ca file is required for client auth %q", mode)
+		}
+		if mode == ClientAuthRequest {
+			return tls.VerifyClientCertIfGiven, nil
+		}
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q", mode)
+	}
+}
+
+// Identity сопоставляет Common Name клиентского сертификата с внутренним
+// сервисом и его ролями
+type Identity struct {
+	CommonName string   `mapstructure:"common_name"`
+	Name       string   `mapstructure:"name"`
+	Roles      []string `mapstructure:"roles"`
+}
+
+// Identities находит внутренний сервис по клиентскому сертификату
+type Identities map[string]Identity
+
+// NewIdentities индексирует сервисы по Common Name. Сервис без имени
+// называется по Common Name.
+func NewIdentities(entries []Identity) Identities {
+	identities := make(Identities, len(entries))
+	for _, entry := range entries {
+		if entry.Name == "" {
+			entry.Name = entry.CommonName
+		}
+		identities[entry.CommonName] = entry
+	}
+	return identities
+}
+
+// Lookup возвращает сервис, которому выдан клиентский сертификат
+// соединения. Учитывается только сертификат, проверенный по CA клиентов:
+// непроверенный сертификат может предъявить кто угодно.
+func (ids Identities) Lookup(state tls.ConnectionState) (Identity, bool) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return Identity{}, false
+	}
+	identity, ok := ids[state.VerifiedChains[0][0].Subject.CommonName]
+	return identity, ok
+}
+
+// ClientConfig задает TLS исходящего соединения с внутренним сервисом.
+// CertFile и KeyFile нужны, если сервер требует клиентский сертификат.
+type ClientConfig struct {
+	Enabled    bool   `mapstructure:"enabled"`
+	CAFile     string `mapstructure:"ca_file"`
+	CertFile   string `mapstructure:"cert_file"`
+	KeyFile    string `mapstructure:"key_file"`
+	ServerName string `mapstructure:"server_name"`
+}
+
+// NewClientConfig создает tls.Config клиента. Без CAFile сертификат
+// сервера проверяется по системным CA.
+func NewClientConfig(config ClientConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: config.ServerName,
+	}
+
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca file %s", config.CAFile)
+		}
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,252 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testCA выпускает сертификаты для тестов
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue выпускает сертификат commonName с номером serial и возвращает
+// сертификат и ключ в PEM
+func (ca *testCA) issue(t *testing.T, commonName string, serial int64) ([]byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile записывает файл и сдвигает время изменения, чтобы замена была
+// заметна даже при грубом разрешении времени файловой системы
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+}
+
+// leafSerial возвращает номер текущего сертификата сервера
+func leafSerial(t *testing.T, r *Reloader) int64 {
+	t.Helper()
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatalf("GetCertificate() error = %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestReloaderSwapsCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	modTime := time.Now().Add(-time.Hour)
+
+	cert, key := ca.issue(t, "payment.internal", 10)
+	writeFile(t, certFile, cert, modTime)
+	writeFile(t, keyFile, key, modTime)
+
+	r, err := NewReloader(Config{CertFile: certFile, KeyFile: keyFile, ReloadInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	if serial := leafSerial(t, r); serial != 10 {
+		t.Fatalf("serial = %d, want 10", serial)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.Start(ctx)
+
+	// Не полностью записанный сертификат не заменяет действующий
+	modTime = modTime.Add(time.Minute)
+	writeFile(t, certFile, cert[:len(cert)/2], modTime)
+	time.Sleep(50 * time.Millisecond)
+	if serial := leafSerial(t, r); serial != 10 {
+		t.Fatalf("serial after a broken write = %d, want 10", serial)
+	}
+
+	cert, key = ca.issue(t, "payment.internal", 11)
+	modTime = modTime.Add(time.Minute)
+	writeFile(t, keyFile, key, modTime)
+	writeFile(t, certFile, cert, modTime)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for leafSerial(t, r) != 11 {
+		if time.Now().After(deadline) {
+			t.Fatal("GetCertificate() did not return the new certificate")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIdentitiesLookup(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key"), filepath.Join(dir, "ca.crt")
+	cert, key := ca.issue(t, "payment.internal", 10)
+	writeFile(t, certFile, cert, time.Now())
+	writeFile(t, keyFile, key, time.Now())
+	writeFile(t, caFile, ca.pem, time.Now())
+
+	r, err := NewReloader(Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile, ClientAuth: ClientAuthRequest})
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	serverConfig, err := r.ServerConfig()
+	if err != nil {
+		t.Fatalf("ServerConfig() error = %v", err)
+	}
+
+	identities := NewIdentities([]Identity{
+		{CommonName: "orders.internal", Name: "orders", Roles: []string{"manager"}},
+		{CommonName: "ledger.internal", Roles: []string{"admin", "manager"}},
+	})
+
+	tests := []struct {
+		name         string
+		clientCN     string
+		wantIdentity Identity
+		wantOK       bool
+	}{
+		{
+			name:         "known service",
+			clientCN:     "orders.internal",
+			wantIdentity: Identity{CommonName: "orders.internal", Name: "orders", Roles: []string{"manager"}},
+			wantOK:       true,
+		},
+		{
+			name:         "name defaults to the common name",
+			clientCN:     "ledger.internal",
+			wantIdentity: Identity{CommonName: "ledger.internal", Name: "ledger.internal", Roles: []string{"admin", "manager"}},
+			wantOK:       true,
+		},
+		{name: "unknown common name", clientCN: "reports.internal"},
+		{name: "no client certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			roots := x509.NewCertPool()
+			roots.AddCert(ca.cert)
+			clientConfig := &tls.Config{RootCAs: roots, ServerName: "payment.internal"}
+			if tt.clientCN != "" {
+				cert, key := ca.issue(t, tt.clientCN, 20)
+				pair, err := tls.X509KeyPair(cert, key)
+				if err != nil {
+					t.Fatalf("X509KeyPair() error = %v", err)
+				}
+				clientConfig.Certificates = []tls.Certificate{pair}
+			}
+
+			state := handshake(t, serverConfig, clientConfig)
+			identity, ok := identities.Lookup(state)
+			if ok != tt.wantOK || !reflect.DeepEqual(identity, tt.wantIdentity) {
+				t.Errorf("Lookup() = %+v, %v, want %+v, %v", identity, ok, tt.wantIdentity, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestIdentitiesLookupIgnoresUnverifiedCertificate(t *testing.T) {
+	identities := NewIdentities([]Identity{{CommonName: "orders.internal", Name: "orders"}})
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "orders.internal"}}
+
+	if _, ok := identities.Lookup(tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}); ok {
+		t.Error("Lookup() matched a certificate that was not verified")
+	}
+}
+
+// handshake выполняет TLS рукопожатие в памяти и возвращает состояние
+// соединения на стороне сервера
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) tls.ConnectionState {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	server := tls.Server(serverConn, serverConfig)
+	client := tls.Client(clientConn, clientConfig)
+	clientErr := make(chan error, 1)
+	go func() {
+		clientErr <- client.Handshake()
+	}()
+
+	if err := server.Handshake(); err != nil {
+		t.Fatalf("server Handshake() error = %v", err)
+	}
+	if err := <-clientErr; err != nil {
+		t.Fatalf("client Handshake() error = %v", err)
+	}
+	return server.ConnectionState()
+}